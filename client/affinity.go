@@ -0,0 +1,54 @@
+package main
+
+import (
+	"fmt"
+)
+
+// SetPreferredNode makes ONE reads target the node at the given address
+// first whenever it is a replica of the key, such as the node co-located
+// with the client, which cuts cross-host traffic. Reads of keys it does not
+// replicate, or while it cannot be reached, fall back to the read load
+// balancing strategy. The node must be a member of the cluster, given by
+// its external address or its address on the ring. An empty address clears
+// the preference.
+func (c *SwimringClient) SetPreferredNode(address string) error {
+	if address == "" {
+		c.preferredNode = ""
+		return nil
+	}
+
+	nodes, err := c.Stat()
+	if _, ok := err.(*PartialStatError); err != nil && !ok {
+		return err
+	}
+
+	for _, node := range nodes {
+		if node.Address == address || node.ExternalAddress == address {
+			c.preferredNode = node.DialAddress()
+			return nil
+		}
+	}
+
+	return fmt.Errorf("node %s is not a member of the cluster", address)
+}
+
+// PreferredNode returns the node targeted first by ONE reads, or an empty
+// string if there is none.
+func (c *SwimringClient) PreferredNode() string {
+	return c.preferredNode
+}
+
+// preferredReplica returns the preferred node if it is among the given
+// replicas, and an empty string otherwise.
+func (c *SwimringClient) preferredReplica(replicas []string) string {
+	if c.preferredNode == "" {
+		return ""
+	}
+
+	for _, replica := range replicas {
+		if replica == c.preferredNode {
+			return replica
+		}
+	}
+	return ""
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// aliases maps the verbs of other key-value shells, and those loaded with
+// -aliases, to commands.
+var aliases = map[string]string{
+	"set":    PutCmd,
+	"delete": DeleteCmd,
+	"quit":   ExitCmd,
+}
+
+// normalizeCommand lowercases the verb and resolves its alias, if any.
+func normalizeCommand(verb string) string {
+	verb = strings.ToLower(verb)
+	if command, ok := aliases[verb]; ok {
+		return command
+	}
+	return verb
+}
+
+// loadAliases reads additional aliases from the named file, one
+// "<alias> <command>" pair per line. Empty lines and lines starting with #
+// are ignored.
+func loadAliases(name string) error {
+	f, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			return fmt.Errorf("%s:%d: expected <alias> <command>", name, n)
+		}
+		aliases[strings.ToLower(fields[0])] = strings.ToLower(fields[1])
+	}
+
+	return scanner.Err()
+}
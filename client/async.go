@@ -0,0 +1,145 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+)
+
+const (
+	defaultAsyncQueueSize = 1024
+	defaultAsyncWorkers   = 4
+)
+
+var (
+	// ErrQueueFull is returned by PutAsync when the queue is full and the
+	// client is configured not to block.
+	ErrQueueFull = errors.New("async queue is full")
+)
+
+// AsyncError is returned by Flush when some asynchronous writes failed.
+type AsyncError struct {
+	Failed int
+	First  error
+}
+
+func (e *AsyncError) Error() string {
+	return fmt.Sprintf("%d async write(s) failed, first error: %s", e.Failed, e.First.Error())
+}
+
+type asyncPut struct {
+	key, value string
+}
+
+type asyncWriter struct {
+	queue chan asyncPut
+	block bool
+
+	mu      sync.Mutex
+	drained *sync.Cond
+	pending int
+	failed  int
+	first   error
+}
+
+// SetAsyncQueue configures PutAsync: the capacity of the queue, the number
+// of workers draining it, and whether PutAsync blocks or fails with
+// ErrQueueFull when the queue is full. It must be called before the first
+// PutAsync, and zero values select the defaults.
+func (c *SwimringClient) SetAsyncQueue(size, workers int, block bool) {
+	if size <= 0 {
+		size = defaultAsyncQueueSize
+	}
+	if workers <= 0 {
+		workers = defaultAsyncWorkers
+	}
+
+	c.asyncSize, c.asyncWorkers, c.asyncBlock = size, workers, block
+}
+
+// PutAsync enqueues a Put of the given key and returns without waiting for
+// it. It blocks while the queue is full, or returns ErrQueueFull if the
+// client is configured not to block. Errors of the writes themselves are
+// reported by Flush.
+func (c *SwimringClient) PutAsync(key, value string) error {
+	if c.conn() == nil {
+		return errors.New("not connected")
+	}
+
+	c.asyncOnce.Do(c.startAsync)
+	w := c.async
+
+	w.mu.Lock()
+	w.pending++
+	w.mu.Unlock()
+
+	if w.block {
+		w.queue <- asyncPut{key: key, value: value}
+		return nil
+	}
+
+	select {
+	case w.queue <- asyncPut{key: key, value: value}:
+		return nil
+	default:
+		w.done(nil)
+		return ErrQueueFull
+	}
+}
+
+// Flush waits until every write enqueued by PutAsync has completed. It
+// returns an *AsyncError if some of them failed since the previous Flush.
+func (c *SwimringClient) Flush() error {
+	w := c.async
+	if w == nil {
+		return nil
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	for w.pending > 0 {
+		w.drained.Wait()
+	}
+
+	if w.failed == 0 {
+		return nil
+	}
+
+	err := &AsyncError{Failed: w.failed, First: w.first}
+	w.failed, w.first = 0, nil
+	return err
+}
+
+func (c *SwimringClient) startAsync() {
+	w := &asyncWriter{
+		queue: make(chan asyncPut, c.asyncSize),
+		block: c.asyncBlock,
+	}
+	w.drained = sync.NewCond(&w.mu)
+
+	for i := 0; i < c.asyncWorkers; i++ {
+		go func() {
+			for put := range w.queue {
+				w.done(c.Put(put.key, put.value))
+			}
+		}()
+	}
+
+	c.async = w
+}
+
+func (w *asyncWriter) done(err error) {
+	w.mu.Lock()
+	if err != nil {
+		w.failed++
+		if w.first == nil {
+			w.first = err
+		}
+	}
+	w.pending--
+	if w.pending == 0 {
+		w.drained.Broadcast()
+	}
+	w.mu.Unlock()
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"errors"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// BalancePrimary sends every ONE read to the owner of the key.
+	BalancePrimary = "primary"
+	// BalanceRoundRobin spreads ONE reads evenly over the replicas of a key.
+	BalanceRoundRobin = "roundrobin"
+	// BalanceWeighted spreads ONE reads over the replicas of a key at random,
+	// with weights inversely proportional to their recent latency.
+	BalanceWeighted = "weighted"
+
+	// latencySmoothing is the weight of a new sample in the moving average
+	// of the latency of a replica.
+	latencySmoothing = 0.2
+)
+
+// replicaBalancer picks the replica serving a ONE read.
+type replicaBalancer struct {
+	next uint32
+
+	sync.Mutex
+	latencies map[string]time.Duration
+	rand      *rand.Rand
+}
+
+func newReplicaBalancer() *replicaBalancer {
+	return &replicaBalancer{
+		latencies: make(map[string]time.Duration),
+		rand:      rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+}
+
+// observe folds a latency of the given replica into its moving average.
+func (b *replicaBalancer) observe(address string, latency time.Duration) {
+	b.Lock()
+	if avg, ok := b.latencies[address]; ok {
+		latency = time.Duration(latencySmoothing*float64(latency) + (1-latencySmoothing)*float64(avg))
+	}
+	b.latencies[address] = latency
+	b.Unlock()
+}
+
+// weights returns the weight of each replica, the inverse of its average
+// latency. A replica without a latency yet gets the mean weight of the
+// others, or 1 if none has one, so that it gets tried.
+func (b *replicaBalancer) weights(replicas []string) []float64 {
+	weights := make([]float64, len(replicas))
+	var sum float64
+	var known int
+
+	b.Lock()
+	for i, replica := range replicas {
+		if avg, ok := b.latencies[replica]; ok && avg > 0 {
+			weights[i] = 1 / avg.Seconds()
+			sum += weights[i]
+			known++
+		}
+	}
+	b.Unlock()
+
+	def := 1.0
+	if known > 0 {
+		def = sum / float64(known)
+	}
+	for i := range weights {
+		if weights[i] == 0 {
+			weights[i] = def
+		}
+	}
+
+	return weights
+}
+
+// pick returns the replica to read from with the given strategy.
+func (b *replicaBalancer) pick(strategy string, replicas []string) string {
+	switch strategy {
+	case BalanceRoundRobin:
+		n := atomic.AddUint32(&b.next, 1)
+		return replicas[int(n%uint32(len(replicas)))]
+	case BalanceWeighted:
+		weights := b.weights(replicas)
+		var total float64
+		for _, w := range weights {
+			total += w
+		}
+
+		b.Lock()
+		r := b.rand.Float64() * total
+		b.Unlock()
+
+		for i, w := range weights {
+			if r < w {
+				return replicas[i]
+			}
+			r -= w
+		}
+		return replicas[len(replicas)-1]
+	}
+
+	return replicas[0]
+}
+
+// SetReadLoadBalancing sets how ONE reads are spread over the replicas of a
+// key: BalancePrimary, the default, reads from the owner, BalanceRoundRobin
+// from each replica in turn, and BalanceWeighted from a random replica
+// weighted by the inverse of its recent latency. Replicas whose circuit
+// breaker is open are skipped.
+func (c *SwimringClient) SetReadLoadBalancing(strategy string) error {
+	switch strategy {
+	case BalancePrimary, BalanceRoundRobin, BalanceWeighted:
+		c.readBalancing = strategy
+		return nil
+	}
+
+	return errors.New("unknown read load balancing strategy")
+}
+
+// callRead sends a read of the given key at the given level. ONE reads are
+// sent to the preferred node if it is a live replica of the key, and
+// otherwise to a replica picked by the read load balancing strategy,
+// falling back to callKey if it cannot be reached.
+func (c *SwimringClient) callRead(key, level, op string, req interface{}, resp interface{}) error {
+	primary := c.readBalancing == "" || c.readBalancing == BalancePrimary
+	if level != ONE || (primary && c.preferredNode == "") {
+		return c.callKey(key, op, req, resp)
+	}
+
+	replicas, err := c.keyReplicas(key)
+	if err != nil {
+		return c.callKey(key, op, req, resp)
+	}
+
+	var live []string
+	for _, replica := range replicas {
+		if c.breaker.available(replica) {
+			live = append(live, replica)
+		}
+	}
+	if len(live) == 0 {
+		return c.callKey(key, op, req, resp)
+	}
+
+	replica := c.preferredReplica(live)
+	if replica == "" {
+		if primary {
+			return c.callKey(key, op, req, resp)
+		}
+		replica = c.balancer.pick(c.readBalancing, live)
+	}
+	client, err := c.replicaClient(replica)
+	if err != nil {
+		return c.callKey(key, op, req, resp)
+	}
+
+	start := time.Now()
+	err = c.callOn(client, op, req, resp)
+	c.breaker.record(replica, err)
+	if err == nil {
+		c.balancer.observe(replica, time.Since(start))
+		return nil
+	}
+	if answered(err) {
+		return err
+	}
+
+	c.owners.forget(replica)
+	return c.callKey(key, op, req, resp)
+}
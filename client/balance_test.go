@@ -0,0 +1,69 @@
+package main
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+	"time"
+)
+
+func TestReplicaBalancerWeightedDistribution(t *testing.T) {
+	b := newReplicaBalancer()
+	b.rand = rand.New(rand.NewSource(1))
+
+	replicas := []string{"a", "b", "c"}
+	b.observe("a", time.Millisecond)
+	b.observe("b", 2*time.Millisecond)
+	b.observe("c", 4*time.Millisecond)
+
+	const picks = 100000
+	counts := make(map[string]int)
+	for i := 0; i < picks; i++ {
+		counts[b.pick(BalanceWeighted, replicas)]++
+	}
+
+	// Weights are the inverse of the latencies: 4/7, 2/7 and 1/7.
+	want := map[string]float64{"a": 4.0 / 7, "b": 2.0 / 7, "c": 1.0 / 7}
+	for replica, share := range want {
+		got := float64(counts[replica]) / picks
+		if math.Abs(got-share) > 0.01 {
+			t.Errorf("replica %s got %.3f of the reads, want %.3f", replica, got, share)
+		}
+	}
+}
+
+func TestReplicaBalancerUnknownLatency(t *testing.T) {
+	b := newReplicaBalancer()
+	b.observe("a", time.Millisecond)
+	b.observe("b", 4*time.Millisecond)
+
+	// A replica without a latency gets the mean weight of the others.
+	weights := b.weights([]string{"a", "b", "c"})
+	if weights[2] != (weights[0]+weights[1])/2 {
+		t.Fatalf("weights = %v, want the mean of the others for c", weights)
+	}
+
+	weights = newReplicaBalancer().weights([]string{"a", "b"})
+	if weights[0] != 1 || weights[1] != 1 {
+		t.Fatalf("weights without latencies = %v, want [1 1]", weights)
+	}
+}
+
+func TestReplicaBalancerRoundRobin(t *testing.T) {
+	b := newReplicaBalancer()
+	replicas := []string{"a", "b", "c"}
+
+	counts := make(map[string]int)
+	for i := 0; i < 30; i++ {
+		counts[b.pick(BalanceRoundRobin, replicas)]++
+	}
+	for _, replica := range replicas {
+		if counts[replica] != 10 {
+			t.Fatalf("round robin picks = %v, want 10 each", counts)
+		}
+	}
+
+	if got := b.pick(BalancePrimary, replicas); got != "a" {
+		t.Fatalf("primary pick = %s, want a", got)
+	}
+}
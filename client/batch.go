@@ -0,0 +1,151 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+const (
+	// PutBatchOp is the name of the service method for PutBatch.
+	PutBatchOp = "SwimRing.PutBatch"
+	// GetMultiOp is the name of the service method for GetMulti.
+	GetMultiOp = "SwimRing.GetMulti"
+)
+
+// GetMultiRequest is the payload of GetMulti.
+type GetMultiRequest struct {
+	Level string
+	Keys  []string
+}
+
+// GetMultiResponse is the payload of the response of GetMulti. Keys not
+// found are missing from Values.
+type GetMultiResponse struct {
+	Values map[string]string
+}
+
+// PutBatchRequest is the payload of PutBatch. Every key of Pairs must have
+// the same replicas.
+type PutBatchRequest struct {
+	Level string
+	Pairs map[string]string
+
+	IdempotencyKey string
+}
+
+func (r *PutBatchRequest) idempotencyKey() string { return r.IdempotencyKey }
+
+// BatchError is returned by PutBatchAtomic when some groups of keys were not
+// written, with the error of each key not written.
+type BatchError struct {
+	Failed map[string]error
+}
+
+func (e *BatchError) Error() string {
+	keys := make([]string, 0, len(e.Failed))
+	for key := range e.Failed {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	return fmt.Sprintf("%d key(s) not written, %s: %s", len(keys), keys[0], e.Failed[keys[0]].Error())
+}
+
+// PutBatchAtomic writes the given keys at the write level. Keys are grouped
+// by replica set, and each group is written atomically on each of its
+// replicas: a reader sees all the keys of the group or none of them.
+// Atomicity is per replica set, not global: keys with different replicas
+// are written independently, so some groups may be written while others
+// fail, which is reported by a *BatchError.
+func (c *SwimringClient) PutBatchAtomic(pairs map[string]string) error {
+	if c.conn() == nil {
+		return errors.New("not connected")
+	}
+	if err := c.require(FeatureBatch); err != nil {
+		return err
+	}
+	if err := c.checkWriteLevel(c.writeLevel); err != nil {
+		return err
+	}
+
+	groups := make(map[string]map[string]string)
+	failed := make(map[string]error)
+	for key, value := range pairs {
+		replicas, err := c.keyReplicas(key)
+		if err != nil {
+			failed[key] = err
+			continue
+		}
+
+		set := append([]string(nil), replicas...)
+		sort.Strings(set)
+		id := strings.Join(set, ",")
+		if groups[id] == nil {
+			groups[id] = make(map[string]string)
+		}
+		groups[id][key] = value
+	}
+
+	for _, group := range groups {
+		if err := c.putGroup(group); err != nil {
+			for key := range group {
+				failed[key] = err
+			}
+		}
+	}
+
+	if len(failed) > 0 {
+		return &BatchError{Failed: failed}
+	}
+	return nil
+}
+
+// putGroup writes keys sharing the same replicas in a single PutBatch.
+func (c *SwimringClient) putGroup(pairs map[string]string) error {
+	req := &PutBatchRequest{
+		Level:          c.writeLevel,
+		Pairs:          pairs,
+		IdempotencyKey: newIdempotencyKey(),
+	}
+	resp := &PutResponse{}
+
+	var key string
+	for key = range pairs {
+		break
+	}
+	if err := c.callKey(key, PutBatchOp, req, resp); err != nil {
+		return writeError(err)
+	}
+
+	if resp.Reason != "" {
+		return &QuorumError{
+			Level:    req.Level,
+			Reason:   resp.Reason,
+			Replicas: resp.Replicas,
+		}
+	}
+
+	return nil
+}
+
+// GetMulti reads the given keys at the read level in a single call. The
+// coordinator sends one request per replica for all the keys it holds,
+// instead of one per key. Keys not found are missing from the result.
+func (c *SwimringClient) GetMulti(keys []string) (map[string]string, error) {
+	if c.conn() == nil {
+		return nil, errors.New("not connected")
+	}
+	if err := c.require(FeatureGetMulti); err != nil {
+		return nil, err
+	}
+
+	req := &GetMultiRequest{Level: c.readLevel, Keys: keys}
+	resp := &GetMultiResponse{}
+	if err := c.call(GetMultiOp, req, resp); err != nil {
+		return nil, err
+	}
+
+	return resp.Values, nil
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/olekukonko/tablewriter"
+)
+
+// histogramBounds are the upper bounds of the latency buckets, in a 1-2-5
+// series from 100µs to 10s. Slower samples fall in a last, unbounded bucket.
+var histogramBounds = func() []time.Duration {
+	var bounds []time.Duration
+	for d := 100 * time.Microsecond; d <= 10*time.Second; d *= 10 {
+		bounds = append(bounds, d, 2*d, 5*d)
+	}
+	return bounds[:len(bounds)-2]
+}()
+
+// latencyHistogram records the latencies of one operation.
+type latencyHistogram struct {
+	op      string
+	samples []time.Duration
+	counts  []int64
+	errors  int
+}
+
+func newLatencyHistogram(op string) *latencyHistogram {
+	return &latencyHistogram{
+		op:     op,
+		counts: make([]int64, len(histogramBounds)+1),
+	}
+}
+
+func (h *latencyHistogram) record(d time.Duration, err error) {
+	if err != nil {
+		h.errors++
+		return
+	}
+
+	h.samples = append(h.samples, d)
+	i := sort.Search(len(histogramBounds), func(i int) bool {
+		return d <= histogramBounds[i]
+	})
+	h.counts[i]++
+}
+
+// percentile returns the latency below which p percent of the samples fall.
+func (h *latencyHistogram) percentile(p float64) time.Duration {
+	if len(h.samples) == 0 {
+		return 0
+	}
+
+	sorted := make([]time.Duration, len(h.samples))
+	copy(sorted, h.samples)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+	i := int(float64(len(sorted))*p/100+0.5) - 1
+	if i < 0 {
+		i = 0
+	}
+	if i >= len(sorted) {
+		i = len(sorted) - 1
+	}
+	return sorted[i]
+}
+
+// writeHistograms writes the buckets of every histogram to the named file as
+// CSV rows of operation, bucket upper bound in microseconds ("+Inf" for the
+// last bucket) and count.
+func writeHistograms(name string, histograms ...*latencyHistogram) error {
+	f, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+
+	w := csv.NewWriter(f)
+	w.Write([]string{"op", "le_us", "count"})
+	for _, h := range histograms {
+		for i, count := range h.counts {
+			le := "+Inf"
+			if i < len(histogramBounds) {
+				le = strconv.FormatInt(int64(histogramBounds[i]/time.Microsecond), 10)
+			}
+			w.Write([]string{h.op, le, strconv.FormatInt(count, 10)})
+		}
+	}
+	w.Flush()
+
+	err = w.Error()
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+var histFile string
+
+func processBench(tokens []string) {
+	if len(tokens) != 2 {
+		fmt.Println("usage: bench <count>")
+		return
+	}
+
+	count, err := strconv.Atoi(tokens[1])
+	if err != nil || count <= 0 {
+		fmt.Printf("error: invalid count %s\n", tokens[1])
+		return
+	}
+
+	writes := newLatencyHistogram(PutCmd)
+	reads := newLatencyHistogram(GetCmd)
+
+	for i := 0; i < count; i++ {
+		start := time.Now()
+		err := client.Put(fmt.Sprintf("bench-%d", i), strconv.Itoa(i))
+		writes.record(time.Since(start), err)
+	}
+	for i := 0; i < count; i++ {
+		start := time.Now()
+		_, err := client.Get(fmt.Sprintf("bench-%d", i))
+		reads.record(time.Since(start), err)
+	}
+
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetHeader([]string{"Op", "Count", "Errors", "p50", "p95", "p99"})
+	for _, h := range []*latencyHistogram{writes, reads} {
+		table.Append([]string{
+			h.op,
+			strconv.Itoa(len(h.samples)),
+			strconv.Itoa(h.errors),
+			h.percentile(50).String(),
+			h.percentile(95).String(),
+			h.percentile(99).String(),
+		})
+	}
+	table.Render()
+
+	if histFile == "" {
+		return
+	}
+	if err := writeHistograms(histFile, writes, reads); err != nil {
+		fmt.Printf("error: %s\n", err.Error())
+		return
+	}
+	fmt.Printf("histograms written to %s\n", histFile)
+}
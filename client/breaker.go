@@ -0,0 +1,188 @@
+package main
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+const (
+	// BreakerClosed means requests flow to the node normally.
+	BreakerClosed = "closed"
+	// BreakerOpen means requests to the node fail fast until the cooldown
+	// has elapsed.
+	BreakerOpen = "open"
+	// BreakerHalfOpen means a single request is let through to test whether
+	// the node has recovered.
+	BreakerHalfOpen = "half-open"
+)
+
+var (
+	// ErrCircuitOpen is returned instead of calling a node whose circuit
+	// breaker is open.
+	ErrCircuitOpen = errors.New("circuit breaker open")
+)
+
+// circuitBreaker tracks the consecutive failures of each node and stops
+// calling a node for a cooldown once they reach the threshold. A zero
+// threshold disables it.
+type circuitBreaker struct {
+	sync.Mutex
+	threshold int
+	cooldown  time.Duration
+	nodes     map[string]*breakerState
+}
+
+type breakerState struct {
+	state    string
+	failures int
+	openedAt time.Time
+	probing  bool
+}
+
+func newCircuitBreaker() *circuitBreaker {
+	return &circuitBreaker{
+		nodes: make(map[string]*breakerState),
+	}
+}
+
+// SetCircuitBreaker opens the circuit of a node after threshold consecutive
+// failures to reach it: requests routed to that node then skip it, falling
+// back to the connected node, or fail fast with ErrCircuitOpen when the call
+// targets that node only. After cooldown, one request is let through and
+// closes the circuit again if it succeeds. A zero threshold disables it.
+func (c *SwimringClient) SetCircuitBreaker(threshold int, cooldown time.Duration) {
+	c.breaker.Lock()
+	c.breaker.threshold = threshold
+	c.breaker.cooldown = cooldown
+	c.breaker.nodes = make(map[string]*breakerState)
+	c.breaker.Unlock()
+}
+
+// BreakerStates returns the circuit breaker state of every node called so
+// far: BreakerClosed, BreakerOpen or BreakerHalfOpen.
+func (c *SwimringClient) BreakerStates() map[string]string {
+	c.breaker.Lock()
+	defer c.breaker.Unlock()
+
+	states := make(map[string]string, len(c.breaker.nodes))
+	for address, node := range c.breaker.nodes {
+		if node.state == BreakerOpen && time.Since(node.openedAt) >= c.breaker.cooldown {
+			states[address] = BreakerHalfOpen
+			continue
+		}
+		states[address] = node.state
+	}
+	return states
+}
+
+// allow returns whether a request may be sent to the given node. Once the
+// cooldown of an open circuit has elapsed, only one probe is allowed until
+// its outcome is known.
+func (b *circuitBreaker) allow(address string) bool {
+	b.Lock()
+	defer b.Unlock()
+
+	if b.threshold <= 0 {
+		return true
+	}
+
+	node, ok := b.nodes[address]
+	if !ok {
+		return true
+	}
+
+	switch node.state {
+	case BreakerOpen:
+		if time.Since(node.openedAt) < b.cooldown {
+			return false
+		}
+		node.state = BreakerHalfOpen
+		node.probing = true
+		return true
+	case BreakerHalfOpen:
+		if node.probing {
+			return false
+		}
+		node.probing = true
+		return true
+	}
+
+	return true
+}
+
+// available returns whether allow would let a request through to the given
+// node, without taking the probe of a half-open circuit.
+func (b *circuitBreaker) available(address string) bool {
+	b.Lock()
+	defer b.Unlock()
+
+	node, ok := b.nodes[address]
+	if b.threshold <= 0 || !ok {
+		return true
+	}
+
+	switch node.state {
+	case BreakerOpen:
+		return time.Since(node.openedAt) >= b.cooldown
+	case BreakerHalfOpen:
+		return !node.probing
+	}
+
+	return true
+}
+
+// success records that the node answered, closing its circuit.
+func (b *circuitBreaker) success(address string) {
+	b.Lock()
+	defer b.Unlock()
+
+	if b.threshold <= 0 {
+		return
+	}
+
+	b.nodes[address] = &breakerState{state: BreakerClosed}
+}
+
+// failure records that the node could not be reached, opening its circuit
+// after threshold consecutive failures, or right away after a failed probe.
+func (b *circuitBreaker) failure(address string) {
+	b.Lock()
+	defer b.Unlock()
+
+	if b.threshold <= 0 {
+		return
+	}
+
+	node, ok := b.nodes[address]
+	if !ok {
+		node = &breakerState{state: BreakerClosed}
+		b.nodes[address] = node
+	}
+
+	node.failures++
+	node.probing = false
+	if node.state == BreakerHalfOpen || node.failures >= b.threshold {
+		node.state = BreakerOpen
+		node.openedAt = time.Now()
+	}
+}
+
+// record records the outcome of a call to the given node. Server errors
+// prove that the node is up, so only other errors count as failures. A call
+// refused locally by the in-flight limit says nothing about the node.
+func (b *circuitBreaker) record(address string, err error) {
+	if err == ErrTooManyInflight {
+		b.Lock()
+		if node, ok := b.nodes[address]; ok {
+			node.probing = false
+		}
+		b.Unlock()
+		return
+	}
+	if err == nil || answered(err) {
+		b.success(address)
+		return
+	}
+	b.failure(address)
+}
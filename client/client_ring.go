@@ -0,0 +1,203 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"swimring/hashring"
+	"sync"
+	"time"
+
+	"github.com/dgryski/go-farm"
+)
+
+// ClientRing is a local copy of the server's token map, used to compute the
+// replicas of a key without a round trip. It mirrors the placement of the
+// server's hash ring, zones included.
+type ClientRing struct {
+	sync.RWMutex
+	tokens        RingTokens
+	zones         map[string]string
+	replicaPoints int
+	salts         map[string]string
+	ranged        bool
+	updated       time.Time
+}
+
+// Replicas returns the n replicas of the key, the owner first: the distinct
+// owners found clockwise from the key's position on the ring, spread across
+// zones as the servers do.
+func (r *ClientRing) Replicas(key string, n int) []string {
+	r.RLock()
+	defer r.RUnlock()
+
+	if len(r.tokens) == 0 {
+		return nil
+	}
+
+	hash := r.hash(key)
+	start := sort.Search(len(r.tokens), func(i int) bool {
+		return r.tokens[i].Token >= hash
+	})
+
+	var owners []string
+	seen := make(map[string]bool)
+	for i := 0; i < len(r.tokens); i++ {
+		owner := r.tokens[(start+i)%len(r.tokens)].Owner
+		if !seen[owner] {
+			seen[owner] = true
+			owners = append(owners, owner)
+		}
+	}
+
+	return hashring.SpreadZones(owners, n, func(server string) string {
+		return r.zones[server]
+	})
+}
+
+// hash returns the position of the key on the ring, as computed by the
+// servers.
+func (r *ClientRing) hash(key string) uint32 {
+	if r.ranged {
+		return hashring.RangePosition(key)
+	}
+	return farm.Fingerprint32([]byte(hashring.SaltedKey(key, r.salts)))
+}
+
+// KeyHash returns the position of the given key on the ring, the same way
+// the servers place it, bucket salts included.
+func (c *SwimringClient) KeyHash(key string) uint64 {
+	c.ring.RLock()
+	defer c.ring.RUnlock()
+
+	return uint64(c.ring.hash(key))
+}
+
+// SetBucketSalts sets the hash salt of each bucket. It must match the
+// BucketSalts of the cluster for LocalReplicas to agree with the servers.
+func (c *SwimringClient) SetBucketSalts(salts map[string]string) {
+	c.ring.Lock()
+	c.ring.salts = salts
+	c.ring.Unlock()
+}
+
+// Updated returns when the token map was last refreshed.
+func (r *ClientRing) Updated() time.Time {
+	r.RLock()
+	updated := r.updated
+	r.RUnlock()
+
+	return updated
+}
+
+func (r *ClientRing) update(tokens RingTokens, zones map[string]string, replicaPoints int, partitioning string) {
+	sort.Sort(tokens)
+
+	r.Lock()
+	r.tokens = tokens
+	r.zones = zones
+	r.replicaPoints = replicaPoints
+	r.ranged = partitioning == hashring.RangePartitioning
+	r.updated = time.Now()
+	r.Unlock()
+}
+
+// EnableClientRing fetches the token map of the cluster and keeps it fresh
+// by refreshing it every interval in the background, so that LocalReplicas
+// needs no RPC. Enabling it again replaces the previous refresh, and a zero
+// interval stops it.
+func (c *SwimringClient) EnableClientRing(interval time.Duration) error {
+	if interval < 0 {
+		return errors.New("invalid refresh interval")
+	}
+
+	if c.ringRefresh != nil {
+		close(c.ringRefresh)
+		c.ringRefresh = nil
+	}
+	if interval == 0 {
+		return nil
+	}
+
+	if err := c.RefreshRing(); err != nil {
+		return err
+	}
+
+	stop := make(chan struct{})
+	c.ringRefresh = stop
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				c.RefreshRing()
+			}
+		}
+	}()
+
+	return nil
+}
+
+// RefreshRing fetches the token map of the cluster into the client ring.
+func (c *SwimringClient) RefreshRing() error {
+	if c.conn() == nil {
+		return errors.New("not connected")
+	}
+
+	req := &RingStateRequest{}
+	resp := &RingStateResponse{}
+
+	err := c.call(RingStateOp, req, resp)
+	if err != nil {
+		return err
+	}
+
+	c.ring.update(RingTokens(resp.Tokens), resp.Zones, resp.ReplicaPoints, resp.Partitioning)
+	return nil
+}
+
+// LocalReplicas computes the replicas of the given key from the cached token
+// map, the owner first, without any RPC. It returns nil until the client ring
+// has been fetched with EnableClientRing or RefreshRing.
+func (c *SwimringClient) LocalReplicas(key string) []string {
+	c.ring.RLock()
+	n := c.ring.replicaPoints
+	c.ring.RUnlock()
+
+	if n <= 0 {
+		n = 1
+	}
+
+	return c.ring.Replicas(key, n)
+}
+
+func processHash(tokens []string) {
+	if len(tokens) != 2 {
+		fmt.Println("usage: hash <key>")
+		return
+	}
+
+	if client.ring.Updated().IsZero() {
+		if err := client.RefreshRing(); err != nil {
+			fmt.Printf("error: %s\n", err.Error())
+			return
+		}
+	}
+
+	hash := client.KeyHash(tokens[1])
+	fmt.Printf("hash: %d (0x%08x)\n", hash, hash)
+	fmt.Printf("position: %s of the ring\n", formatRingShare(hash))
+
+	for i, replica := range client.LocalReplicas(tokens[1]) {
+		role := "replica"
+		if i == 0 {
+			role = "owner"
+		}
+		fmt.Printf("%d. %s (%s)\n", i+1, replica, role)
+	}
+}
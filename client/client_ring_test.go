@@ -0,0 +1,37 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"swimring/hashring"
+	"testing"
+
+	"github.com/dgryski/go-farm"
+)
+
+func TestClientRingMatchesZonePlacement(t *testing.T) {
+	zones := map[string]string{
+		"a:7000": "z1", "b:7000": "z1", "c:7000": "z1",
+		"d:7000": "z2", "e:7000": "z3",
+	}
+
+	ring := hashring.NewHashRing(farm.Fingerprint32, 5)
+	ring.SetZoneFunc(func(server string) string { return zones[server] })
+	for server := range zones {
+		ring.AddServer(server)
+	}
+
+	var tokens RingTokens
+	for _, token := range ring.Tokens() {
+		tokens = append(tokens, RingToken{Token: uint32(token.Value), Owner: token.Server})
+	}
+	r := &ClientRing{}
+	r.update(tokens, zones, 3, hashring.HashPartitioning)
+
+	for i := 0; i < 1000; i++ {
+		key := fmt.Sprintf("key%d", i)
+		if got, want := r.Replicas(key, 3), ring.LookupN(key, 3); !reflect.DeepEqual(got, want) {
+			t.Fatalf("replicas of %s are %v, want %v", key, got, want)
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"sync"
+)
+
+// getCall is a Get RPC in flight, shared by the concurrent Get calls for
+// the same key.
+type getCall struct {
+	done chan struct{}
+	resp *GetResponse
+	err  error
+}
+
+// getGroup coalesces the concurrent Get calls for the same key into a single
+// RPC. Results are only shared while the call is in flight, never cached.
+type getGroup struct {
+	sync.Mutex
+	calls map[string]*getCall
+}
+
+func newGetGroup() *getGroup {
+	return &getGroup{
+		calls: make(map[string]*getCall),
+	}
+}
+
+// do calls fn, unless a call for the same key is already in flight, in which
+// case it waits for that call and returns its result, errors included. A
+// shared response is copied for each waiter.
+func (g *getGroup) do(key string, fn func() (*GetResponse, error)) (*GetResponse, error) {
+	g.Lock()
+	if call, ok := g.calls[key]; ok {
+		g.Unlock()
+		<-call.done
+
+		if call.err != nil {
+			return nil, call.err
+		}
+		resp := *call.resp
+		return &resp, nil
+	}
+
+	call := &getCall{done: make(chan struct{})}
+	g.calls[key] = call
+	g.Unlock()
+
+	call.resp, call.err = fn()
+
+	g.Lock()
+	delete(g.calls, key)
+	g.Unlock()
+	close(call.done)
+
+	return call.resp, call.err
+}
+
+// SetRequestCoalescing enables or disables the coalescing of concurrent Get
+// calls: while a Get for a key is in flight, other Get calls for the same key
+// at the same read level wait for its result instead of issuing their own RPC.
+func (c *SwimringClient) SetRequestCoalescing(enabled bool) {
+	c.coalescing = enabled
+}
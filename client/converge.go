@@ -0,0 +1,142 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	convergencePollInterval = 500 * time.Millisecond
+)
+
+// ConvergenceError is returned by WaitForConvergence when the membership
+// did not settle in time, with the reason each disagreeing node is off.
+type ConvergenceError struct {
+	Timeout     time.Duration
+	Disagreeing map[string]string
+}
+
+func (e *ConvergenceError) Error() string {
+	nodes := make([]string, 0, len(e.Disagreeing))
+	for address := range e.Disagreeing {
+		nodes = append(nodes, address)
+	}
+	sort.Strings(nodes)
+
+	reasons := make([]string, len(nodes))
+	for i, address := range nodes {
+		reasons[i] = fmt.Sprintf("%s (%s)", address, e.Disagreeing[address])
+	}
+
+	return fmt.Sprintf("cluster did not converge within %s: %s", e.Timeout, strings.Join(reasons, ", "))
+}
+
+// WaitForConvergence blocks until the membership is stable across the
+// cluster, that is until every node reports the same member set with every
+// member alive, or the timeout elapses. It polls Stat on the connected node
+// to find the members, then on each member for its own view. On timeout, a
+// *ConvergenceError lists the disagreeing nodes.
+func (c *SwimringClient) WaitForConvergence(timeout time.Duration) error {
+	if c.conn() == nil {
+		return errors.New("not connected")
+	}
+
+	deadline := time.Now().Add(timeout)
+	for {
+		disagreeing, err := c.disagreeingNodes()
+		if err != nil {
+			return err
+		}
+		if len(disagreeing) == 0 {
+			return nil
+		}
+
+		if time.Now().Add(convergencePollInterval).After(deadline) {
+			return &ConvergenceError{Timeout: timeout, Disagreeing: disagreeing}
+		}
+		time.Sleep(convergencePollInterval)
+	}
+}
+
+// disagreeingNodes returns the nodes whose view of the membership differs
+// from the union of all views or has a member not alive, with the reason.
+func (c *SwimringClient) disagreeingNodes() (map[string]string, error) {
+	nodes, err := c.Stat()
+	if _, ok := err.(*PartialStatError); err != nil && !ok {
+		return nil, err
+	}
+
+	disagreeing := make(map[string]string)
+	views := make(map[string]NodeStats, len(nodes))
+	members := make(map[string]bool)
+	for _, node := range nodes {
+		members[node.Address] = true
+	}
+
+	for _, node := range nodes {
+		view, err := c.statOn(node.Address)
+		if err != nil {
+			disagreeing[node.Address] = "unreachable: " + err.Error()
+			continue
+		}
+
+		views[node.Address] = view
+		for _, member := range view {
+			members[member.Address] = true
+		}
+	}
+
+	for address, view := range views {
+		if reason := viewDisagreement(view, members); reason != "" {
+			disagreeing[address] = reason
+		}
+	}
+
+	return disagreeing, nil
+}
+
+// viewDisagreement returns why the view of a node differs from the given
+// member set or has a member not alive, or an empty string if it does not.
+func viewDisagreement(view NodeStats, members map[string]bool) string {
+	seen := make(map[string]bool, len(view))
+	for _, member := range view {
+		seen[member.Address] = true
+		if member.Status != "alive" {
+			return fmt.Sprintf("sees %s as %s", member.Address, member.Status)
+		}
+	}
+
+	var missing []string
+	for address := range members {
+		if !seen[address] {
+			missing = append(missing, address)
+		}
+	}
+	if len(missing) > 0 {
+		sort.Strings(missing)
+		return "does not see " + strings.Join(missing, ", ")
+	}
+
+	return ""
+}
+
+// statOn calls the remote Stat method of the node at the given address and
+// returns its view of the cluster.
+func (c *SwimringClient) statOn(address string) (NodeStats, error) {
+	client, err := c.dial(address)
+	if err != nil {
+		return nil, err
+	}
+	defer client.Close()
+
+	req := &StateRequest{}
+	resp := &StateResponse{}
+	if err := c.callOn(client, StatOp, req, resp); err != nil {
+		return nil, err
+	}
+
+	return NodeStats(resp.Nodes), nil
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"errors"
+	"net/rpc"
+	"sync"
+)
+
+const (
+	// CoordinatorAny lets the connected node coordinate every request.
+	CoordinatorAny = "any"
+	// CoordinatorOwner sends each request directly to the node owning the key.
+	CoordinatorOwner = "owner"
+	// ReplicasOp is the name of the service method for Replicas.
+	ReplicasOp = "SwimRing.Replicas"
+
+	maxCachedReplicas = 1024
+)
+
+// ReplicasRequest is the payload of Replicas.
+type ReplicasRequest struct {
+	Key string
+}
+
+// ReplicasResponse is the payload of the response of Replicas.
+// Replicas are external addresses ordered clockwise, the owner first.
+type ReplicasResponse struct {
+	Replicas []string
+}
+
+type coordinatorCache struct {
+	sync.Mutex
+	replicas map[string][]string
+	clients  map[string]*rpc.Client
+}
+
+func newCoordinatorCache() *coordinatorCache {
+	return &coordinatorCache{
+		replicas: make(map[string][]string),
+		clients:  make(map[string]*rpc.Client),
+	}
+}
+
+// SetCoordinatorStrategy sets how the coordinator of a request is selected,
+// either CoordinatorAny or CoordinatorOwner.
+func (c *SwimringClient) SetCoordinatorStrategy(strategy string) error {
+	switch strategy {
+	case CoordinatorAny, CoordinatorOwner:
+		c.coordinatorStrategy = strategy
+		return nil
+	}
+
+	return errors.New("unknown coordinator strategy")
+}
+
+// Replicas calls the remote Replicas method and returns the external addresses
+// of the replicas of the given key, the owner first.
+func (c *SwimringClient) Replicas(key string) ([]string, error) {
+	if c.conn() == nil {
+		return nil, errors.New("not connected")
+	}
+
+	req := &ReplicasRequest{
+		Key: key,
+	}
+	resp := &ReplicasResponse{}
+
+	err := c.call(ReplicasOp, req, resp)
+	if err != nil {
+		return nil, err
+	}
+
+	return resp.Replicas, nil
+}
+
+// callKey sends the request of the given key to its coordinator. In owner
+// mode the owner is tried first, unless its circuit breaker is open, falling
+// back to the connected node.
+func (c *SwimringClient) callKey(key string, op string, req interface{}, resp interface{}) error {
+	if c.coordinatorStrategy != CoordinatorOwner {
+		return c.call(op, req, resp)
+	}
+
+	owner, client, err := c.ownerClient(key)
+	if err != nil {
+		return c.call(op, req, resp)
+	}
+
+	err = c.callOn(client, op, req, resp)
+	c.breaker.record(owner, err)
+	if err == nil {
+		return nil
+	}
+	if answered(err) {
+		return err
+	}
+
+	c.owners.forget(owner)
+	return c.call(op, req, resp)
+}
+
+func (c *SwimringClient) ownerClient(key string) (string, *rpc.Client, error) {
+	replicas, err := c.keyReplicas(key)
+	if err != nil {
+		return "", nil, err
+	}
+
+	owner := replicas[0]
+	client, err := c.replicaClient(owner)
+	if err != nil {
+		return "", nil, err
+	}
+
+	return owner, client, nil
+}
+
+// keyReplicas returns the replicas of the given key, the owner first, from
+// the cache or else from the connected node.
+func (c *SwimringClient) keyReplicas(key string) ([]string, error) {
+	c.owners.Lock()
+	replicas, ok := c.owners.replicas[key]
+	c.owners.Unlock()
+	if ok {
+		return replicas, nil
+	}
+
+	replicas, err := c.Replicas(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(replicas) == 0 {
+		return nil, errors.New("no replica found")
+	}
+
+	c.owners.Lock()
+	if len(c.owners.replicas) >= maxCachedReplicas {
+		c.owners.replicas = make(map[string][]string)
+	}
+	c.owners.replicas[key] = replicas
+	c.owners.Unlock()
+
+	return replicas, nil
+}
+
+// replicaClient returns the cached connection to the given replica, dialing
+// it if needed, unless its circuit breaker is open.
+func (c *SwimringClient) replicaClient(address string) (*rpc.Client, error) {
+	if !c.breaker.allow(address) {
+		return nil, ErrCircuitOpen
+	}
+
+	c.owners.Lock()
+	client, ok := c.owners.clients[address]
+	c.owners.Unlock()
+	if ok {
+		return client, nil
+	}
+
+	client, err := c.dial(address)
+	if err != nil {
+		c.breaker.failure(address)
+		c.owners.forget(address)
+		return nil, err
+	}
+
+	c.owners.Lock()
+	c.owners.clients[address] = client
+	c.owners.Unlock()
+
+	return client, nil
+}
+
+// forget drops the connection to the replica and every key cached with it
+// among its replicas.
+func (cc *coordinatorCache) forget(replica string) {
+	cc.Lock()
+	if client, ok := cc.clients[replica]; ok {
+		client.Close()
+		delete(cc.clients, replica)
+	}
+	for key, replicas := range cc.replicas {
+		if contains(replicas, replica) {
+			delete(cc.replicas, key)
+		}
+	}
+	cc.Unlock()
+}
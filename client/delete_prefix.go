@@ -0,0 +1,75 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// DeletePrefix deletes every key with the given prefix at the delete
+// consistency level, and returns the number of keys deleted. Keys are found
+// with a paginated scan across the ring and each one is routed to its own
+// replica set. It stops at the first failed delete.
+func (c *SwimringClient) DeletePrefix(prefix string) (int, error) {
+	deleted := 0
+	cursor := ""
+
+	for {
+		items, next, err := c.ScanPage(prefix, cursor, scanPageSize)
+		if err != nil {
+			return deleted, err
+		}
+
+		for key := range items {
+			err := c.Delete(key)
+			if isNotFound(err) {
+				continue
+			}
+			if err != nil {
+				return deleted, err
+			}
+			deleted++
+		}
+
+		if next == "" {
+			return deleted, nil
+		}
+		cursor = next
+	}
+}
+
+// interactive returns whether the standard input is a terminal.
+func interactive() bool {
+	info, err := os.Stdin.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+func processDeletePrefix(tokens []string) {
+	if len(tokens) < 2 || len(tokens) > 3 || (len(tokens) == 3 && tokens[2] != "--yes") {
+		fmt.Println("usage: delprefix <prefix> [--yes]")
+		return
+	}
+
+	prefix := tokens[1]
+	if len(tokens) != 3 {
+		if !interactive() {
+			fmt.Println("error: delprefix requires --yes in non-interactive mode")
+			return
+		}
+
+		fmt.Printf("delete all keys with prefix %q? [y/N] ", prefix)
+		answer, _ := stdin.ReadString('\n')
+		if strings.ToLower(strings.TrimSpace(answer)) != "y" {
+			fmt.Println("aborted")
+			return
+		}
+	}
+
+	deleted, err := client.DeletePrefix(prefix)
+	if err != nil {
+		fmt.Printf("error: %s (%d keys deleted)\n", err.Error(), deleted)
+		return
+	}
+
+	fmt.Printf("%d keys deleted\n", deleted)
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"fmt"
+	"net/rpc"
+	"sort"
+	"swimring/util"
+)
+
+const (
+	// LocalDigestsOp is the name of the service method for LocalDigests.
+	LocalDigestsOp = "SwimRing.LocalDigests"
+	// LocalBucketOp is the name of the service method for LocalBucket.
+	LocalBucketOp = "SwimRing.LocalBucket"
+
+	diffBuckets = 256
+)
+
+// LocalDigestsRequest is the payload of LocalDigests.
+type LocalDigestsRequest struct {
+	Buckets int
+}
+
+// LocalDigestsResponse is the payload of the response of LocalDigests. It
+// holds a digest of each bucket of the keys stored on the node.
+type LocalDigestsResponse struct {
+	Digests []uint64
+}
+
+// LocalBucketRequest is the payload of LocalBucket.
+type LocalBucketRequest struct {
+	Bucket  int
+	Buckets int
+}
+
+// LocalBucketResponse is the payload of the response of LocalBucket.
+type LocalBucketResponse struct {
+	Entries map[string]LocalEntry
+}
+
+// LocalEntry is the version of a key stored on a node, without its value.
+type LocalEntry struct {
+	Timestamp int64
+	Deleted   bool
+	Clock     *util.VectorClock
+}
+
+// DiffReport lists the keys, tombstones included, on which two nodes
+// diverge.
+type DiffReport struct {
+	OnlyA, OnlyB []string
+	// Differing are the keys held by both nodes in different versions.
+	Differing []string
+
+	// Buckets is the number of buckets compared by digest, and
+	// DifferingBuckets the number compared key by key.
+	Buckets, DifferingBuckets int
+}
+
+// DiffNodes compares the keys held by two nodes without modifying either.
+// Keys are split into buckets by hash and the digests of the buckets are
+// exchanged first, so only the buckets whose digests differ are listed key
+// by key.
+func (c *SwimringClient) DiffNodes(addrA, addrB string) (DiffReport, error) {
+	report := DiffReport{Buckets: diffBuckets}
+
+	clientA, err := c.dial(addrA)
+	if err != nil {
+		return report, err
+	}
+	defer clientA.Close()
+
+	clientB, err := c.dial(addrB)
+	if err != nil {
+		return report, err
+	}
+	defer clientB.Close()
+
+	digestsA, err := c.localDigests(clientA)
+	if err != nil {
+		return report, err
+	}
+	digestsB, err := c.localDigests(clientB)
+	if err != nil {
+		return report, err
+	}
+
+	for bucket := 0; bucket < diffBuckets; bucket++ {
+		if digestsA[bucket] == digestsB[bucket] {
+			continue
+		}
+		report.DifferingBuckets++
+
+		entriesA, err := c.localBucket(clientA, bucket)
+		if err != nil {
+			return report, err
+		}
+		entriesB, err := c.localBucket(clientB, bucket)
+		if err != nil {
+			return report, err
+		}
+
+		for key, a := range entriesA {
+			b, ok := entriesB[key]
+			if !ok {
+				report.OnlyA = append(report.OnlyA, key)
+			} else if !sameVersion(a, b) {
+				report.Differing = append(report.Differing, key)
+			}
+		}
+		for key := range entriesB {
+			if _, ok := entriesA[key]; !ok {
+				report.OnlyB = append(report.OnlyB, key)
+			}
+		}
+	}
+
+	sort.Strings(report.OnlyA)
+	sort.Strings(report.OnlyB)
+	sort.Strings(report.Differing)
+
+	return report, nil
+}
+
+func (c *SwimringClient) localDigests(client *rpc.Client) ([]uint64, error) {
+	req := &LocalDigestsRequest{
+		Buckets: diffBuckets,
+	}
+	resp := &LocalDigestsResponse{}
+
+	err := c.callOn(client, LocalDigestsOp, req, resp)
+	if err != nil {
+		return nil, err
+	}
+	if len(resp.Digests) != diffBuckets {
+		return nil, fmt.Errorf("expected %d digests, got %d", diffBuckets, len(resp.Digests))
+	}
+
+	return resp.Digests, nil
+}
+
+func (c *SwimringClient) localBucket(client *rpc.Client, bucket int) (map[string]LocalEntry, error) {
+	req := &LocalBucketRequest{
+		Bucket:  bucket,
+		Buckets: diffBuckets,
+	}
+	resp := &LocalBucketResponse{}
+
+	err := c.callOn(client, LocalBucketOp, req, resp)
+	if err != nil {
+		return nil, err
+	}
+
+	return resp.Entries, nil
+}
+
+// sameVersion returns whether two copies of a key are the same version,
+// by clock when both have one and by timestamp otherwise.
+func sameVersion(a, b LocalEntry) bool {
+	if a.Deleted != b.Deleted {
+		return false
+	}
+	if a.Clock != nil && b.Clock != nil {
+		return a.Clock.Compare(b.Clock) == "EQUAL"
+	}
+	return a.Timestamp == b.Timestamp
+}
+
+func processDiff(tokens []string) {
+	if len(tokens) != 3 {
+		fmt.Println("usage: diff <nodeA> <nodeB>")
+		return
+	}
+
+	report, err := client.DiffNodes(tokens[1], tokens[2])
+	if err != nil {
+		fmt.Printf("error: %s\n", err.Error())
+		return
+	}
+
+	for _, key := range report.OnlyA {
+		fmt.Printf("< %s\n", key)
+	}
+	for _, key := range report.OnlyB {
+		fmt.Printf("> %s\n", key)
+	}
+	for _, key := range report.Differing {
+		fmt.Printf("! %s\n", key)
+	}
+
+	fmt.Printf("%d only on %s, %d only on %s, %d differing (%d/%d buckets compared)\n",
+		len(report.OnlyA), tokens[1], len(report.OnlyB), tokens[2], len(report.Differing),
+		report.DifferingBuckets, report.Buckets)
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/rpc"
+	"strings"
+	"time"
+)
+
+const (
+	// ReasonTimeout means too few replicas answered before the deadline.
+	ReasonTimeout = "TIMEOUT"
+	// ReasonUnavailable means too few replicas were alive to reach the level.
+	ReasonUnavailable = "UNAVAILABLE"
+	// ReasonConflict means replicas rejected the write due to a conflict.
+	ReasonConflict = "CONFLICT"
+
+	// ReplicaAcked means the replica applied the write.
+	ReplicaAcked = "acked"
+	// ReplicaFailed means the replica answered with an error or was unreachable.
+	ReplicaFailed = "failed"
+	// ReplicaTimedOut means the replica did not answer in time.
+	ReplicaTimedOut = "timeout"
+	// ReplicaHinted means the replica was down and the coordinator stored a
+	// hint to hand the write off to it later.
+	ReplicaHinted = "hinted"
+	// ReplicaPending means the write is not yet known to have reached the
+	// replica.
+	ReplicaPending = "pending"
+)
+
+// ReplicaStatus is the outcome of a write on a single replica.
+type ReplicaStatus struct {
+	Address string
+	Status  string
+	Message string
+}
+
+// QuorumError is returned when a write cannot reach its consistency level.
+// It carries the reason code and the outcome on every replica.
+type QuorumError struct {
+	Level    string
+	Reason   string
+	Replicas []ReplicaStatus
+}
+
+func (e *QuorumError) Error() string {
+	return fmt.Sprintf("cannot reach consistency level %s: %s (acked: [%s], failed: [%s], timeout: [%s])",
+		e.Level, e.Reason,
+		strings.Join(e.Acked(), ", "),
+		strings.Join(e.Failed(), ", "),
+		strings.Join(e.TimedOut(), ", "))
+}
+
+// Acked returns the addresses of the replicas which applied the write.
+func (e *QuorumError) Acked() []string {
+	return e.replicasWithStatus(ReplicaAcked)
+}
+
+// Failed returns the addresses of the replicas which failed the write.
+func (e *QuorumError) Failed() []string {
+	return e.replicasWithStatus(ReplicaFailed)
+}
+
+// Hinted returns the addresses of the replicas for which a hint was stored.
+func (e *QuorumError) Hinted() []string {
+	return e.replicasWithStatus(ReplicaHinted)
+}
+
+// TimedOut returns the addresses of the replicas which did not answer in time.
+func (e *QuorumError) TimedOut() []string {
+	return e.replicasWithStatus(ReplicaTimedOut)
+}
+
+func (e *QuorumError) replicasWithStatus(status string) []string {
+	var addresses []string
+	for _, replica := range e.Replicas {
+		if replica.Status == status {
+			addresses = append(addresses, replica.Address)
+		}
+	}
+	return addresses
+}
+
+// ErrKeyNotFound is returned when the requested key does not exist.
+var ErrKeyNotFound = errors.New("key not found")
+
+// isNotFound returns whether the error tells that the key does not exist,
+// whether it was returned locally or by the server.
+func isNotFound(err error) bool {
+	if err == ErrKeyNotFound {
+		return true
+	}
+	serr, ok := err.(rpc.ServerError)
+	return ok && string(serr) == ErrKeyNotFound.Error()
+}
+
+// PartialStatError is returned by Stat when some nodes did not respond.
+// The stats of the other nodes are still returned along with it.
+type PartialStatError struct {
+	Unreachable []string
+}
+
+func (e *PartialStatError) Error() string {
+	return fmt.Sprintf("no stat from %d node(s): %s", len(e.Unreachable), strings.Join(e.Unreachable, ", "))
+}
+
+// StalenessError is returned by GetFresh when no replica holds a version of
+// the key updated within the requested staleness bound.
+type StalenessError struct {
+	Key          string
+	MaxStaleness time.Duration
+}
+
+func (e *StalenessError) Error() string {
+	return fmt.Sprintf("no replica has %s updated within %s", e.Key, e.MaxStaleness)
+}
+
+// ErrProtocolMismatch is the error a *ProtocolMismatchError matches with
+// errors.Is.
+var ErrProtocolMismatch = errors.New("protocol mismatch")
+
+// ProtocolMismatchError is returned when a payload exchanged with the server
+// cannot be encoded or decoded, which usually means that the client and the
+// server disagree on its layout because they run different versions.
+type ProtocolMismatchError struct {
+	Op  string
+	Err error
+}
+
+func (e *ProtocolMismatchError) Error() string {
+	return fmt.Sprintf("%s: cannot decode %s payload, client and server versions may differ, check them with the version command: %s",
+		ErrProtocolMismatch, e.Op, e.Err)
+}
+
+// Unwrap returns the underlying codec error.
+func (e *ProtocolMismatchError) Unwrap() error {
+	return e.Err
+}
+
+// Is reports whether target is ErrProtocolMismatch.
+func (e *ProtocolMismatchError) Is(target error) bool {
+	return target == ErrProtocolMismatch
+}
+
+// codecError wraps the error of a call of op in a *ProtocolMismatchError if
+// it comes from gob, when encoding the request, decoding it on the server,
+// or decoding the response.
+func codecError(op string, err error) error {
+	msg := err.Error()
+	if strings.HasPrefix(msg, "gob: ") || strings.HasPrefix(msg, "reading body gob: ") {
+		return &ProtocolMismatchError{Op: op, Err: err}
+	}
+	return err
+}
+
+// answered returns whether the error was returned by a server that received
+// the request, as opposed to a transport failure. A response that cannot be
+// decoded still proves the server is up.
+func answered(err error) bool {
+	switch err.(type) {
+	case rpc.ServerError, *ProtocolMismatchError:
+		return true
+	}
+	return false
+}
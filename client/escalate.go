@@ -0,0 +1,44 @@
+package main
+
+import (
+	"swimring/util"
+	"time"
+)
+
+const defaultEscalationThreshold = 10 * time.Second
+
+// SetAutoEscalateReads enables or disables the escalation of reads: when a
+// read at level ONE returns a version last updated longer ago than the
+// escalation threshold, which may come from a lagging replica, it is retried
+// once at QUORUM and the QUORUM result is returned instead.
+func (c *SwimringClient) SetAutoEscalateReads(enabled bool) {
+	c.autoEscalate = enabled
+}
+
+// SetEscalationThreshold sets the age of a version read at level ONE beyond
+// which the read is escalated to QUORUM.
+func (c *SwimringClient) SetEscalationThreshold(threshold time.Duration) {
+	c.escalationThreshold = threshold
+}
+
+// shouldEscalate returns whether a read at the given level returning a
+// version with the given clock must be retried at QUORUM.
+func (c *SwimringClient) shouldEscalate(level string, clock *util.VectorClock) bool {
+	if !c.autoEscalate || level != ONE || clock == nil {
+		return false
+	}
+
+	threshold := c.escalationThreshold
+	if threshold <= 0 {
+		threshold = defaultEscalationThreshold
+	}
+
+	return time.Since(clock.LastUpdated()) > threshold
+}
+
+// escalatedRequest returns a copy of the given request at level QUORUM.
+func escalatedRequest(req *GetRequest) *GetRequest {
+	escalated := *req
+	escalated.Level = QUORUM
+	return &escalated
+}
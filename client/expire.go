@@ -0,0 +1,155 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+const (
+	// ExpireOp is the name of the service method for Expire.
+	ExpireOp = "SwimRing.Expire"
+	// TTLOp is the name of the service method for TTL.
+	TTLOp = "SwimRing.TTL"
+
+	// NoExpiry is returned by TTL for a key without expiry.
+	NoExpiry time.Duration = -1
+)
+
+// ExpireRequest is the payload of Expire.
+type ExpireRequest struct {
+	Level string
+	Key   string
+	TTL   time.Duration
+}
+
+// ExpireResponse is the payload of the response of Expire.
+type ExpireResponse struct {
+	NotFound bool
+}
+
+// TTLRequest is the payload of TTL.
+type TTLRequest struct {
+	Level string
+	Key   string
+}
+
+// TTLResponse is the payload of the response of TTL.
+type TTLResponse struct {
+	NotFound bool
+	TTL      time.Duration
+}
+
+// Expire calls the remote Expire method and sets the TTL of an existing key
+// without rewriting its value. A non-positive ttl removes the expiry. It
+// returns ErrKeyNotFound if the key does not exist.
+func (c *SwimringClient) Expire(key string, ttl time.Duration) error {
+	if c.conn() == nil {
+		return errors.New("not connected")
+	}
+	if err := c.require(FeatureExpire); err != nil {
+		return err
+	}
+	if err := c.checkWriteLevel(c.writeLevel); err != nil {
+		return err
+	}
+
+	req := &ExpireRequest{
+		Key:   key,
+		Level: c.writeLevel,
+		TTL:   ttl,
+	}
+	resp := &ExpireResponse{}
+
+	err := c.callKey(key, ExpireOp, req, resp)
+	if isNotFound(err) || (err == nil && resp.NotFound) {
+		return ErrKeyNotFound
+	}
+	if err != nil {
+		return writeError(err)
+	}
+
+	return nil
+}
+
+// TTL calls the remote TTL method and returns the remaining time to live of
+// the key, or NoExpiry if it does not expire. It returns ErrKeyNotFound if
+// the key does not exist.
+func (c *SwimringClient) TTL(key string) (time.Duration, error) {
+	if c.conn() == nil {
+		return 0, errors.New("not connected")
+	}
+	if err := c.require(FeatureExpire); err != nil {
+		return 0, err
+	}
+
+	req := &TTLRequest{
+		Key:   key,
+		Level: c.readLevel,
+	}
+	resp := &TTLResponse{}
+
+	err := c.callKey(key, TTLOp, req, resp)
+	if isNotFound(err) || (err == nil && resp.NotFound) {
+		return 0, ErrKeyNotFound
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	return resp.TTL, nil
+}
+
+// parseTTL parses a duration such as 90s or 1h30m, or a bare number of
+// seconds.
+func parseTTL(s string) (time.Duration, error) {
+	if seconds, err := strconv.Atoi(s); err == nil {
+		return time.Duration(seconds) * time.Second, nil
+	}
+	return time.ParseDuration(s)
+}
+
+func processExpire(tokens []string) {
+	if len(tokens) != 3 {
+		fmt.Println("usage: expire <key> <duration>")
+		return
+	}
+
+	ttl, err := parseTTL(tokens[2])
+	if err != nil {
+		fmt.Printf("error: invalid duration %s\n", tokens[2])
+		return
+	}
+
+	err = client.Expire(tokens[1], ttl)
+	if err != nil {
+		fmt.Printf("error: %s\n", err.Error())
+		return
+	}
+
+	fmt.Println("ok")
+}
+
+func processTTL(tokens []string) {
+	if len(tokens) != 2 {
+		fmt.Println("usage: ttl <key>")
+		return
+	}
+
+	ttl, err := client.TTL(tokens[1])
+	if err == ErrKeyNotFound {
+		fmt.Println(-2)
+		return
+	}
+	if err != nil {
+		fmt.Printf("error: %s\n", err.Error())
+		return
+	}
+
+	if ttl == NoExpiry {
+		fmt.Println(-1)
+		return
+	}
+	fmt.Println(ttl.Round(time.Millisecond))
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"fmt"
+)
+
+const (
+	// ExportOp is the name of the service method for Export.
+	ExportOp = "SwimRing.Export"
+	// ImportOp is the name of the service method for Import.
+	ImportOp = "SwimRing.Import"
+)
+
+// ExportRequest is the payload of Export.
+type ExportRequest struct {
+	File string
+}
+
+// ExportResponse is the payload of the response of Export.
+type ExportResponse struct{}
+
+// ImportRequest is the payload of Import. ConflictStrategy is merge, skip or
+// overwrite, merge by default.
+type ImportRequest struct {
+	File             string
+	ConflictStrategy string
+}
+
+// ImportStats are the counts of an Import. Imported entries were applied,
+// skipped ones lost to the local version, and conflicted ones were
+// concurrent with it, whichever was kept.
+type ImportStats struct {
+	Imported, Skipped, Conflicted int
+}
+
+// ImportResponse is the payload of the response of Import.
+type ImportResponse struct {
+	Stats ImportStats
+}
+
+// Export dials the node at the given address and has it write its local
+// data to the named file of its working directory, gzip-compressed if the
+// name ends with .gz.
+func (c *SwimringClient) Export(address, file string) error {
+	client, err := c.dial(address)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	req := &ExportRequest{
+		File: file,
+	}
+	resp := &ExportResponse{}
+
+	return c.callOn(client, ExportOp, req, resp)
+}
+
+// Import dials the node at the given address and has it restore the named
+// export file of its working directory into its local data, resolving the
+// keys it already holds with the given conflict strategy.
+func (c *SwimringClient) Import(address, file, strategy string) (ImportStats, error) {
+	client, err := c.dial(address)
+	if err != nil {
+		return ImportStats{}, err
+	}
+	defer client.Close()
+
+	req := &ImportRequest{
+		File:             file,
+		ConflictStrategy: strategy,
+	}
+	resp := &ImportResponse{}
+
+	if err := c.callOn(client, ImportOp, req, resp); err != nil {
+		return ImportStats{}, writeError(err)
+	}
+
+	return resp.Stats, nil
+}
+
+func processExport(tokens []string) {
+	if len(tokens) != 3 {
+		fmt.Println("usage: export <address> <file>")
+		return
+	}
+
+	if err := client.Export(tokens[1], tokens[2]); err != nil {
+		fmt.Printf("error: %s\n", err.Error())
+		return
+	}
+
+	fmt.Println("ok")
+}
+
+func processImport(tokens []string) {
+	if len(tokens) != 3 && len(tokens) != 4 {
+		fmt.Println("usage: import <address> <file> [merge|skip|overwrite]")
+		return
+	}
+
+	strategy := ""
+	if len(tokens) == 4 {
+		strategy = tokens[3]
+	}
+
+	stats, err := client.Import(tokens[1], tokens[2], strategy)
+	if err != nil {
+		fmt.Printf("error: %s\n", err.Error())
+		return
+	}
+
+	fmt.Printf("ok, %d imported, %d skipped, %d conflicted\n", stats.Imported, stats.Skipped, stats.Conflicted)
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/olekukonko/tablewriter"
+)
+
+const (
+	// GossipDebugOp is the name of the service method for GossipDebug.
+	GossipDebugOp = "SwimRing.GossipDebug"
+)
+
+// GossipDebugRequest is the payload of GossipDebug.
+type GossipDebugRequest struct{}
+
+// GossipDebugResponse is the payload of the response of GossipDebug, the raw
+// membership view of a node.
+type GossipDebugResponse struct {
+	Address        string
+	Incarnation    int64
+	Checksum       uint32
+	PendingChanges int
+	Members        []MemberDebug
+}
+
+// MemberDebug is the raw state of a member as seen by a node. LastHeard and
+// SuspectDeadline are zero if the node never heard from the member or has
+// no suspect timer running for it.
+type MemberDebug struct {
+	Address         string
+	Status          string
+	Incarnation     int64
+	Tags            map[string]string
+	LastHeard       time.Time
+	SuspectDeadline time.Time
+}
+
+// GossipDebug calls the remote GossipDebug method of the node at the given
+// address, or of the connected node if address is empty, and returns its
+// raw membership view, incarnation numbers and suspect timers included.
+func (c *SwimringClient) GossipDebug(address string) (*GossipDebugResponse, error) {
+	req := &GossipDebugRequest{}
+	resp := &GossipDebugResponse{}
+
+	if address == "" {
+		if c.conn() == nil {
+			return nil, errors.New("not connected")
+		}
+		if err := c.require(FeatureGossipDebug); err != nil {
+			return nil, err
+		}
+
+		return resp, c.call(GossipDebugOp, req, resp)
+	}
+
+	client, err := c.dial(address)
+	if err != nil {
+		return nil, err
+	}
+	defer client.Close()
+
+	return resp, c.callOn(client, GossipDebugOp, req, resp)
+}
+
+func processGossip(tokens []string) {
+	if len(tokens) > 2 {
+		fmt.Println("usage: gossip [address]")
+		return
+	}
+
+	var address string
+	if len(tokens) == 2 {
+		address = tokens[1]
+	}
+
+	debug, err := client.GossipDebug(address)
+	if err != nil {
+		fmt.Printf("error: %s\n", err.Error())
+		return
+	}
+
+	fmt.Printf("node: %s, incarnation: %d, checksum: %08x, pending changes: %d\n",
+		debug.Address, debug.Incarnation, debug.Checksum, debug.PendingChanges)
+
+	now := time.Now()
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetHeader([]string{"Address", "Status", "Incarnation", "Last Heard", "Suspect Timer", "Tags"})
+
+	for _, member := range debug.Members {
+		lastHeard := "never"
+		if member.Address == debug.Address {
+			lastHeard = "self"
+		} else if !member.LastHeard.IsZero() {
+			lastHeard = now.Sub(member.LastHeard).Round(time.Millisecond).String() + " ago"
+		}
+
+		var suspectTimer string
+		if !member.SuspectDeadline.IsZero() {
+			suspectTimer = "fires in " + member.SuspectDeadline.Sub(now).Round(time.Millisecond).String()
+		}
+
+		table.Append([]string{member.Address, member.Status, strconv.FormatInt(member.Incarnation, 10),
+			lastHeard, suspectTimer, formatTags(member.Tags)})
+	}
+
+	table.Render()
+}
+
+// formatTags returns the tags as key=value pairs sorted by key.
+func formatTags(tags map[string]string) string {
+	pairs := make([]string, 0, len(tags))
+	for key, value := range tags {
+		pairs = append(pairs, key+"="+value)
+	}
+	sort.Strings(pairs)
+
+	return strings.Join(pairs, ",")
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"errors"
+	"swimring/util"
+	"time"
+)
+
+const (
+	// GetHistoryOp is the name of the service method for GetHistory.
+	GetHistoryOp = "SwimRing.GetHistory"
+)
+
+// GetHistoryRequest is the payload of GetHistory.
+type GetHistoryRequest struct {
+	Level string
+	Key   string
+}
+
+// GetHistoryResponse is the payload of the response of GetHistory.
+type GetHistoryResponse struct {
+	Key      string
+	Versions []VersionedValue
+}
+
+// VersionedValue is a past or current version of a key. Deleted marks a
+// tombstone, whose Value is empty.
+type VersionedValue struct {
+	Value     []byte
+	Clock     *util.VectorClock
+	Timestamp time.Time
+	Deleted   bool
+}
+
+// GetHistory calls the remote GetHistory method and returns the last
+// versions of the key kept by the replicas, newest first, tombstones
+// included. The number of versions is bounded by MaxVersionsPerKey on the
+// server.
+func (c *SwimringClient) GetHistory(key string) ([]VersionedValue, error) {
+	if c.conn() == nil {
+		return nil, errors.New("not connected")
+	}
+	if err := c.require(FeatureHistory); err != nil {
+		return nil, err
+	}
+
+	req := &GetHistoryRequest{
+		Key:   key,
+		Level: c.readLevel,
+	}
+	resp := &GetHistoryResponse{}
+
+	err := c.callKey(key, GetHistoryOp, req, resp)
+	if err != nil {
+		return nil, err
+	}
+
+	return resp.Versions, nil
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"errors"
+)
+
+const (
+	// PutIndexedOp is the name of the service method for PutIndexed.
+	PutIndexedOp = "SwimRing.PutIndexed"
+	// QueryIndexOp is the name of the service method for QueryIndex.
+	QueryIndexOp = "SwimRing.QueryIndex"
+)
+
+// PutIndexedRequest is the payload of PutIndexed.
+type PutIndexedRequest struct {
+	Level      string
+	Key        string
+	Value      string
+	IndexField string
+
+	IdempotencyKey string
+}
+
+func (r *PutIndexedRequest) idempotencyKey() string { return r.IdempotencyKey }
+
+// QueryIndexRequest is the payload of QueryIndex.
+type QueryIndexRequest struct {
+	Level string
+	Field string
+	Value string
+}
+
+// QueryIndexResponse is the payload of the response of QueryIndex.
+type QueryIndexResponse struct {
+	Keys []string
+}
+
+// PutIndexed calls the remote PutIndexed method to update the value of the
+// key, which must be a JSON object, and index the key on one of its fields.
+// Only keys written with PutIndexed are indexed, so plain writes are not
+// slowed down.
+func (c *SwimringClient) PutIndexed(key, value, indexField string) error {
+	if c.conn() == nil {
+		return errors.New("not connected")
+	}
+	if err := c.require(FeatureIndex); err != nil {
+		return err
+	}
+	if err := c.checkWriteLevel(c.writeLevel); err != nil {
+		return err
+	}
+
+	req := &PutIndexedRequest{
+		Key:        key,
+		Value:      value,
+		IndexField: indexField,
+		Level:      c.writeLevel,
+
+		IdempotencyKey: newIdempotencyKey(),
+	}
+	resp := &PutResponse{}
+
+	err := c.callKey(key, PutIndexedOp, req, resp)
+	if err != nil {
+		return writeError(err)
+	}
+
+	if resp.Reason != "" {
+		return &QuorumError{
+			Level:    req.Level,
+			Reason:   resp.Reason,
+			Replicas: resp.Replicas,
+		}
+	}
+
+	if c.sessionConsistency {
+		c.session.track(key, resp.Clock)
+	}
+
+	return nil
+}
+
+// QueryIndex calls the remote QueryIndex method and returns the keys whose
+// indexField was set to indexValue by PutIndexed, in ascending order.
+func (c *SwimringClient) QueryIndex(indexField, indexValue string) ([]string, error) {
+	if c.conn() == nil {
+		return nil, errors.New("not connected")
+	}
+	if err := c.require(FeatureIndex); err != nil {
+		return nil, err
+	}
+
+	req := &QueryIndexRequest{
+		Level: c.readLevel,
+		Field: indexField,
+		Value: indexValue,
+	}
+	resp := &QueryIndexResponse{}
+
+	err := c.call(QueryIndexOp, req, resp)
+	if err != nil {
+		return nil, err
+	}
+
+	return resp.Keys, nil
+}
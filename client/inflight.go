@@ -0,0 +1,59 @@
+package main
+
+import (
+	"errors"
+	"sync/atomic"
+)
+
+var (
+	// ErrTooManyInflight is returned when the in-flight limit is reached and
+	// the client is configured not to wait.
+	ErrTooManyInflight = errors.New("too many requests in flight")
+)
+
+// SetMaxInflight limits the number of concurrent remote calls to n. Once n
+// calls are in flight, further ones wait for a slot, or fail with
+// ErrTooManyInflight if SetInflightFailFast is enabled. Zero or less removes
+// the limit. Calls already in flight are not affected.
+func (c *SwimringClient) SetMaxInflight(n int) {
+	if n <= 0 {
+		c.inflightSlots = nil
+		return
+	}
+	c.inflightSlots = make(chan struct{}, n)
+}
+
+// SetInflightFailFast makes calls fail with ErrTooManyInflight instead of
+// waiting when the in-flight limit is reached.
+func (c *SwimringClient) SetInflightFailFast(enabled bool) {
+	c.inflightFailFast = enabled
+}
+
+// Inflight returns the number of remote calls currently in flight.
+func (c *SwimringClient) Inflight() int {
+	return int(atomic.LoadInt32(&c.inflightCount))
+}
+
+// acquire takes an in-flight slot and returns the function releasing it.
+func (c *SwimringClient) acquire() (func(), error) {
+	slots := c.inflightSlots
+	if slots != nil {
+		if c.inflightFailFast {
+			select {
+			case slots <- struct{}{}:
+			default:
+				return nil, ErrTooManyInflight
+			}
+		} else {
+			slots <- struct{}{}
+		}
+	}
+
+	atomic.AddInt32(&c.inflightCount, 1)
+	return func() {
+		atomic.AddInt32(&c.inflightCount, -1)
+		if slots != nil {
+			<-slots
+		}
+	}, nil
+}
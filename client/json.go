@@ -0,0 +1,57 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// DecodeError is returned by GetJSON when the stored value of a key cannot
+// be unmarshaled into the requested type. A missing key is reported as
+// ErrKeyNotFound instead.
+type DecodeError struct {
+	Key string
+	Err error
+}
+
+func (e *DecodeError) Error() string {
+	return fmt.Sprintf("cannot decode value of %s: %s", e.Key, e.Err.Error())
+}
+
+// PutJSON marshals v to JSON and stores it as the value of the given key.
+func (c *SwimringClient) PutJSON(key string, v interface{}) error {
+	value, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	return c.PutBytes(key, value)
+}
+
+// GetJSON reads the value of the given key and unmarshals it from JSON into
+// out. It returns ErrKeyNotFound if the key does not exist, and a
+// *DecodeError if the value is not valid JSON for out.
+func (c *SwimringClient) GetJSON(key string, out interface{}) error {
+	if c.conn() == nil {
+		return errors.New("not connected")
+	}
+
+	req := &GetRequest{
+		Key:   key,
+		Level: c.readLevel,
+	}
+
+	resp, err := c.getBytes(req)
+	if isNotFound(err) || (err == nil && resp.NotFound) {
+		return ErrKeyNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := json.Unmarshal([]byte(resp.Value), out); err != nil {
+		return &DecodeError{Key: key, Err: err}
+	}
+
+	return nil
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"errors"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// PingOp is the name of the service method for Ping.
+	PingOp = "SwimRing.Ping"
+)
+
+// PingRequest is the payload of Ping.
+type PingRequest struct{}
+
+// PingResponse is the payload of the response of Ping.
+type PingResponse struct{}
+
+// Ping calls the remote Ping method once, without retries, to check that
+// the connection is alive.
+func (c *SwimringClient) Ping() error {
+	client := c.conn()
+	if client == nil {
+		return errors.New("not connected")
+	}
+
+	return c.callOn(client, PingOp, &PingRequest{}, &PingResponse{})
+}
+
+// SetKeepalive pings the connected node every interval in the background.
+// When a ping fails, the connection is marked dead and the next call dials
+// again right away instead of failing first. A zero interval stops it.
+func (c *SwimringClient) SetKeepalive(interval time.Duration) {
+	if c.keepalive != nil {
+		close(c.keepalive)
+		c.keepalive = nil
+	}
+	if interval <= 0 {
+		return
+	}
+
+	stop := make(chan struct{})
+	c.keepalive = stop
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				// A server error still proves the connection is alive, e.g.
+				// a server without the Ping method.
+				err := c.Ping()
+				if err != nil && !answered(err) {
+					atomic.StoreInt32(&c.dead, 1)
+				}
+			}
+		}
+	}()
+}
+
+// redialIfDead reconnects when the keepalive marked the connection dead.
+func (c *SwimringClient) redialIfDead() {
+	if !atomic.CompareAndSwapInt32(&c.dead, 1, 0) {
+		return
+	}
+
+	old := c.conn()
+	if err := c.Connect(); err != nil {
+		atomic.StoreInt32(&c.dead, 1)
+		return
+	}
+	if old != nil {
+		old.Close()
+	}
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"net"
+	"net/rpc"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// fakeNode answers the handshake and the pings of the client.
+type fakeNode struct{}
+
+func (fakeNode) Handshake(req *HandshakeRequest, resp *HandshakeResponse) error {
+	resp.ProtocolVersion = req.ProtocolVersion
+	resp.Features = []string{FeatureBytes}
+	return nil
+}
+
+func (fakeNode) Ping(req *PingRequest, resp *PingResponse) error {
+	return nil
+}
+
+// serveFakeNode serves a fakeNode on a local port until the test ends, and
+// returns a client for it.
+func serveFakeNode(t *testing.T) *SwimringClient {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	server := rpc.NewServer()
+	server.RegisterName("SwimRing", fakeNode{})
+	go server.Accept(listener)
+
+	host, port, _ := net.SplitHostPort(listener.Addr().String())
+	n, _ := strconv.Atoi(port)
+	return NewSwimringClient(host, n)
+}
+
+func TestKeepaliveRedial(t *testing.T) {
+	c := serveFakeNode(t)
+	if err := c.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	c.SetKeepalive(time.Millisecond)
+	defer c.SetKeepalive(0)
+
+	// The connection is dialed again while the keepalive and the calls use
+	// it, which the race detector checks.
+	deadline := time.Now().Add(50 * time.Millisecond)
+	for time.Now().Before(deadline) {
+		atomic.StoreInt32(&c.dead, 1)
+		if err := c.call(PingOp, &PingRequest{}, &PingResponse{}); err != nil {
+			t.Fatalf("ping failed: %s", err.Error())
+		}
+		if !c.Supports(FeatureBytes) {
+			t.Fatal("negotiated features lost")
+		}
+	}
+}
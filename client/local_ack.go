@@ -0,0 +1,56 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	// ErrUnsafeLocalWrite is returned by writes at level LOCAL unless they
+	// were explicitly allowed with AllowUnsafeLocalWrites.
+	ErrUnsafeLocalWrite = errors.New("LOCAL writes are not durable and must be allowed with AllowUnsafeLocalWrites")
+)
+
+// localWriteWarning is printed by the CLI whenever LOCAL writes are enabled.
+const localWriteWarning = "warning: LOCAL writes are acknowledged before replication; " +
+	"an acknowledged write is lost if the coordinator fails before replicating it"
+
+// AllowUnsafeLocalWrites allows the LOCAL write level, which is acknowledged
+// as soon as the coordinator has written locally, and replicated in the
+// background. An acknowledged LOCAL write is lost if the coordinator fails
+// before replicating it, so it must never be used for data that has to be
+// durable. The cluster must also enable AllowLocalAck.
+func (c *SwimringClient) AllowUnsafeLocalWrites(allowed bool) {
+	c.unsafeLocalWrites = allowed
+}
+
+// checkWriteLevel returns an error if a write at the given level cannot be
+// sent: LOCAL must be allowed, and ANY and LOCAL need server support.
+func (c *SwimringClient) checkWriteLevel(level string) error {
+	switch level {
+	case ANY:
+		return c.require(FeatureHints)
+	case LOCAL:
+		if !c.unsafeLocalWrites {
+			return ErrUnsafeLocalWrite
+		}
+		return c.require(FeatureLocalAck)
+	}
+	return nil
+}
+
+// checkLocalWriteLevels returns an error if LOCAL is requested for writes or
+// deletes without allowUnsafe, and prints the durability warning otherwise.
+func checkLocalWriteLevels(allowUnsafe bool, levels ...string) error {
+	for _, level := range levels {
+		if level != LOCAL {
+			continue
+		}
+		if !allowUnsafe {
+			return fmt.Errorf("level %s requires -unsafe-local-writes", LOCAL)
+		}
+		fmt.Println(localWriteWarning)
+		return nil
+	}
+	return nil
+}
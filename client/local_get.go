@@ -0,0 +1,54 @@
+package main
+
+import (
+	"swimring/util"
+)
+
+const (
+	// LocalGetOp is the name of the service method for LocalGet.
+	LocalGetOp = "SwimRing.LocalGet"
+)
+
+// LocalGetRequest is the payload of LocalGet.
+type LocalGetRequest struct {
+	Key string
+}
+
+// LocalGetResponse is the payload of the response of LocalGet.
+type LocalGetResponse struct {
+	Found bool
+	Value []byte
+	Clock *util.VectorClock
+}
+
+// GetFromNode dials the node at the given address and returns its local copy
+// of the key, bypassing coordination. No other replica is contacted and no
+// read repair is triggered, which reveals exactly what each replica holds.
+func (c *SwimringClient) GetFromNode(address, key string) (string, *util.VectorClock, error) {
+	if !c.breaker.allow(address) {
+		return "", nil, ErrCircuitOpen
+	}
+
+	client, err := c.dial(address)
+	if err != nil {
+		c.breaker.failure(address)
+		return "", nil, err
+	}
+	defer client.Close()
+
+	req := &LocalGetRequest{
+		Key: key,
+	}
+	resp := &LocalGetResponse{}
+
+	err = c.callOn(client, LocalGetOp, req, resp)
+	c.breaker.record(address, err)
+	if err != nil {
+		return "", nil, err
+	}
+	if !resp.Found {
+		return "", nil, ErrKeyNotFound
+	}
+
+	return string(resp.Value), resp.Clock, nil
+}
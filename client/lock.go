@@ -0,0 +1,129 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/rpc"
+	"time"
+)
+
+const (
+	// CompareAndSwapOp is the name of the service method for CompareAndSwap.
+	CompareAndSwapOp = "SwimRing.CompareAndSwap"
+)
+
+var (
+	// ErrLockHeld is returned by AcquireLock when the lock is held by
+	// someone else.
+	ErrLockHeld = errors.New("lock is held")
+	// ErrLockNotHeld is returned by ReleaseLock when the lock is no longer
+	// held with the given token, because it expired or was taken over.
+	ErrLockNotHeld = errors.New("lock is not held")
+
+	errCASMismatch = errors.New("value does not match")
+)
+
+// CompareAndSwapRequest is the payload of CompareAndSwap. The value of the
+// key is replaced, or deleted if Delete is set, only if the key holds
+// Expected or, if Absent is set, does not exist.
+type CompareAndSwapRequest struct {
+	Level string
+	Key   string
+
+	Expected string
+	Absent   bool
+
+	Value  string
+	Delete bool
+	TTL    time.Duration
+}
+
+// CompareAndSwapResponse is the payload of the response of CompareAndSwap.
+type CompareAndSwapResponse struct {
+	Mismatch bool
+}
+
+// AcquireLock takes the lock named by the given key for ttl, after which it
+// expires if not released, and returns the token identifying this holder.
+// It returns ErrLockHeld if the lock is already held.
+//
+// The lock is a lease written with a compare-and-swap on a missing key, at
+// QUORUM or ALL, so that two acquirers cannot both reach a quorum. An
+// acquisition that fails midway leaves a lease on some replicas until it
+// expires. Tokens start with the acquisition time in nanoseconds, so a
+// resource guarded by the lock can use them as fencing tokens and reject a
+// holder whose lease expired, as long as client clocks are roughly in sync.
+func (c *SwimringClient) AcquireLock(key string, ttl time.Duration) (string, error) {
+	if ttl <= 0 {
+		return "", errors.New("lock ttl must be positive")
+	}
+
+	token := fmt.Sprintf("%019d-%s", time.Now().UnixNano(), newIdempotencyKey())
+	req := &CompareAndSwapRequest{
+		Key:    key,
+		Absent: true,
+		Value:  token,
+		TTL:    ttl,
+	}
+
+	err := c.compareAndSwap(req)
+	if err == errCASMismatch {
+		return "", ErrLockHeld
+	}
+	if err != nil {
+		return "", err
+	}
+
+	return token, nil
+}
+
+// ReleaseLock releases the lock named by the given key if it is still held
+// with the given token. It returns ErrLockNotHeld otherwise.
+func (c *SwimringClient) ReleaseLock(key, token string) error {
+	req := &CompareAndSwapRequest{
+		Key:      key,
+		Expected: token,
+		Delete:   true,
+	}
+
+	err := c.compareAndSwap(req)
+	if err == errCASMismatch {
+		return ErrLockNotHeld
+	}
+	return err
+}
+
+// compareAndSwap calls the remote CompareAndSwap method at the lock level.
+func (c *SwimringClient) compareAndSwap(req *CompareAndSwapRequest) error {
+	if c.conn() == nil {
+		return errors.New("not connected")
+	}
+	if err := c.require(FeatureCAS); err != nil {
+		return err
+	}
+
+	req.Level = c.lockLevel()
+	resp := &CompareAndSwapResponse{}
+
+	err := c.callKey(req.Key, CompareAndSwapOp, req, resp)
+	if serr, ok := err.(rpc.ServerError); ok && string(serr) == errCASMismatch.Error() {
+		return errCASMismatch
+	}
+	if err != nil {
+		return writeError(err)
+	}
+	if resp.Mismatch {
+		return errCASMismatch
+	}
+
+	return nil
+}
+
+// lockLevel returns the write level if it is QUORUM or ALL, and QUORUM
+// otherwise, since a lock taken at a lower level could be taken twice.
+func (c *SwimringClient) lockLevel() string {
+	if c.writeLevel == ALL {
+		return ALL
+	}
+	return QUORUM
+}
@@ -2,28 +2,67 @@ package main
 
 import (
 	"bufio"
+	"crypto/rand"
+	"encoding/hex"
 	"errors"
 	"flag"
 	"fmt"
+	"net"
 	"net/rpc"
 	"os"
+	"reflect"
 	"sort"
 	"strconv"
 	"strings"
+	"swimring/util"
+	"sync"
+	"sync/atomic"
+	"time"
 
-	"github.com/hungys/swimring/util"
 	"github.com/olekukonko/tablewriter"
 )
 
 const (
-	GetCmd    = "get"
-	PutCmd    = "put"
-	DeleteCmd = "del"
-	StatCmd   = "stat"
-	ExitCmd   = "exit"
+	GetCmd       = "get"
+	PutCmd       = "put"
+	DeleteCmd    = "del"
+	StatCmd      = "stat"
+	RingCmd      = "ring"
+	UseCmd       = "use"
+	TagsCmd      = "tags"
+	VersionCmd   = "version"
+	BenchCmd     = "bench"
+	ReadOnlyCmd  = "readonly"
+	HashCmd      = "hash"
+	ScanCmd      = "scan"
+	DelPrefixCmd = "delprefix"
+	WatchCmd     = "watch"
+	DiffCmd      = "diff"
+	ExpireCmd    = "expire"
+	TTLCmd       = "ttl"
+	GossipCmd    = "gossip"
+	OwnedCmd     = "owned"
+	TokensCmd    = "tokens"
+	RebalanceCmd = "rebalance"
+	MetricsCmd   = "metrics"
+	PartitionCmd = "partition"
+	ExportCmd    = "export"
+	ImportCmd    = "import"
+	ExitCmd      = "exit"
+
+	ConvergenceCmd = "convergence"
 )
 
 const (
+	// ANY is a write-only level weaker than ONE.
+	// For write request, returns when a replica ACKed or, if none is alive,
+	// when the coordinator stored a hint to hand the write off later.
+	ANY = "ANY"
+	// LOCAL is a write-only level that is NOT durable, allowed only with
+	// AllowUnsafeLocalWrites.
+	// For write request, returns when the coordinator wrote locally, before
+	// any replica ACKed; replication and hints happen in the background.
+	LOCAL = "LOCAL"
 	// ONE is the weakest consistency level.
 	// For read request, returns value when the first response arrived.
 	// For write request, returns when the first ACK received.
@@ -46,44 +85,151 @@ const (
 	StatOp = "SwimRing.Stat"
 )
 
+const (
+	defaultTimeout     = 5 * time.Second
+	defaultDialTimeout = 3 * time.Second
+	defaultRetries     = 0
+)
+
 // SwimringClient is a RPC client for connecting to SwimRing server.
 type SwimringClient struct {
 	address string
 	port    int
-	client  *rpc.Client
 
-	readLevel  string
-	writeLevel string
+	// connMu guards the connection to the node and the protocol negotiated
+	// with it, which are replaced when the client dials again.
+	connMu   sync.RWMutex
+	client   *rpc.Client
+	protocol protocol
+
+	readLevel   string
+	writeLevel  string
+	deleteLevel string
+
+	timeout     time.Duration
+	dialTimeout time.Duration
+	retries     int
+
+	coordinatorStrategy string
+	owners              *coordinatorCache
+
+	sessionConsistency bool
+	session            *sessionClocks
+
+	sequencedWrites bool
+	sequences       *writeSequences
+
+	ring        *ClientRing
+	ringRefresh chan struct{}
+
+	asyncSize, asyncWorkers int
+	asyncBlock              bool
+	asyncOnce               sync.Once
+	async                   *asyncWriter
+
+	coalescing bool
+	inflight   *getGroup
+
+	keepalive chan struct{}
+	dead      int32
+
+	resolver          ConflictResolver
+	resolverWriteBack bool
+
+	inflightSlots    chan struct{}
+	inflightFailFast bool
+	inflightCount    int32
+
+	breaker *circuitBreaker
+
+	unsafeLocalWrites bool
+
+	autoEscalate        bool
+	escalationThreshold time.Duration
+
+	readBalancing string
+	balancer      *replicaBalancer
+	preferredNode string
+
+	allowStale bool
 }
 
 // GetRequest is the payload of Get.
 type GetRequest struct {
 	Level string
 	Key   string
+
+	// MinClock asks the coordinator for a version descending from it.
+	MinClock *util.VectorClock
+	// MaxStaleness asks the coordinator to skip replica versions last updated
+	// longer ago than it. Zero accepts any version.
+	MaxStaleness time.Duration
+	// AllowStale asks the coordinator, when too few replicas answer to reach
+	// the level, to return the most recent version among those which did
+	// instead of failing.
+	AllowStale bool
 }
 
-// GetResponse is the payload of the response of Get.
+// GetResponse is the payload of the response of Get. Value holds the bytes
+// of the value as is, binary included, as gob does not alter strings.
+// NotFound is set, instead of returning an empty value, when the key does
+// not exist. Stale is set when the read level was not reached and the value
+// comes from fewer replicas, as allowed by GetRequest.AllowStale. Metadata
+// is the one written with the value, if any.
 type GetResponse struct {
 	Key, Value string
+	Clock      *util.VectorClock
+	NotFound   bool
+	Stale      bool
+	Metadata   map[string]string
 }
 
-// PutRequest is the payload of Put.
+// PutRequest is the payload of Put. Value holds the bytes of the value as
+// is, binary included.
 type PutRequest struct {
 	Level      string
 	Key, Value string
+
+	// Context is the clock the value descends from, if any, so that the
+	// write supersedes the siblings it was merged from.
+	Context *util.VectorClock
+	// Sequence, if positive, fences the write: replicas holding a write of
+	// the key with a sequence greater or equal reject it.
+	Sequence int64
+	// Metadata is attached to the value and replicated with it.
+	Metadata map[string]string
+
+	// IdempotencyKey identifies the logical write, so that the coordinator
+	// can return the original result of a retried write instead of
+	// applying it twice.
+	IdempotencyKey string
 }
 
-// PutResponse is the payload of the response of Put.
-type PutResponse struct{}
+// PutResponse is the payload of the response of Put. Reason is set when the
+// write cannot reach its consistency level, with the outcome of each replica.
+// Stale is set when a sequenced write was rejected, and Sequence is then the
+// greatest sequence held by the replicas.
+type PutResponse struct {
+	Reason   string
+	Replicas []ReplicaStatus
+	Clock    *util.VectorClock
+
+	Stale    bool
+	Sequence int64
+}
 
 // DeleteRequest is the payload of Delete.
 type DeleteRequest struct {
 	Level string
 	Key   string
+
+	IdempotencyKey string
 }
 
 // DeleteResponse is the payload of the response of Delete.
-type DeleteResponse struct{}
+type DeleteResponse struct {
+	Clock *util.VectorClock
+}
 
 // StateRequest is the payload of Stat.
 type StateRequest struct{}
@@ -91,13 +237,42 @@ type StateRequest struct{}
 // StateResponse is the payload of the response of Stat.
 type StateResponse struct {
 	Nodes []NodeStat
+
+	// Unreachable lists the nodes which did not answer the Stat request.
+	Unreachable []string
+	// ReplicaPoints is the replication factor of the cluster.
+	ReplicaPoints int
 }
 
-// NodeStat stores the information of a Node
+// NodeStat stores the information of a Node. Address is the address of the
+// node on the ring, and ExternalAddress the one to dial to call it, which
+// servers without it leave empty.
 type NodeStat struct {
-	Address  string
-	Status   string
-	KeyCount int
+	Address         string
+	ExternalAddress string
+	Status          string
+	KeyCount        int
+	MemoryBytes     int64
+	Tags            map[string]string
+	ReadOnly        bool
+
+	// PendingReconcile is the number of keys for which the node is known to
+	// diverge from its peers, waiting for anti-entropy reconciliation.
+	PendingReconcile int
+	// Minority is set when the node sees at most half of the cluster alive,
+	// and suspects it is on the minority side of a partition.
+	Minority bool
+	// DuplicateAddress is set when another node claimed the address of the
+	// node, whose join or gossip was rejected.
+	DuplicateAddress bool
+}
+
+// DialAddress returns the address to dial to call the node.
+func (n *NodeStat) DialAddress() string {
+	if n.ExternalAddress != "" {
+		return n.ExternalAddress
+	}
+	return n.Address
 }
 
 // NodeStats is an array of NodeStat
@@ -110,11 +285,65 @@ func NewSwimringClient(address string, port int) *SwimringClient {
 		port:       port,
 		readLevel:  ALL,
 		writeLevel: ALL,
+		timeout:    defaultTimeout,
+		retries:    defaultRetries,
+
+		dialTimeout: defaultDialTimeout,
+
+		coordinatorStrategy: CoordinatorAny,
+		owners:              newCoordinatorCache(),
+
+		session:   newSessionClocks(),
+		sequences: newWriteSequences(),
+		ring:      &ClientRing{},
+
+		asyncSize:    defaultAsyncQueueSize,
+		asyncWorkers: defaultAsyncWorkers,
+		asyncBlock:   true,
+
+		inflight: newGetGroup(),
+		breaker:  newCircuitBreaker(),
+		balancer: newReplicaBalancer(),
 	}
 
 	return c
 }
 
+// newIdempotencyKey returns a random key identifying a logical write across
+// its retries.
+func newIdempotencyKey() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return ""
+	}
+	return hex.EncodeToString(b)
+}
+
+// ValidLevel returns whether the given string is a consistency level.
+func ValidLevel(level string) bool {
+	switch level {
+	case ONE, QUORUM, ALL:
+		return true
+	}
+	return false
+}
+
+// ValidWriteLevel returns whether the given string is a consistency level
+// accepted by writes, which also includes ANY and LOCAL.
+func ValidWriteLevel(level string) bool {
+	return level == ANY || level == LOCAL || ValidLevel(level)
+}
+
+// ReadLevel returns the consistency level used by Get.
+func (c *SwimringClient) ReadLevel() string {
+	return c.readLevel
+}
+
+// WriteLevel returns the consistency level used by Put.
+func (c *SwimringClient) WriteLevel() string {
+	return c.writeLevel
+}
+
 // SetReadLevel sets the readLevel to specific level.
 func (c *SwimringClient) SetReadLevel(level string) {
 	c.readLevel = level
@@ -125,20 +354,112 @@ func (c *SwimringClient) SetWriteLevel(level string) {
 	c.writeLevel = level
 }
 
+// SetDeleteLevel sets the deleteLevel to specific level. An empty level
+// makes Delete follow the writeLevel, which is the default.
+func (c *SwimringClient) SetDeleteLevel(level string) {
+	c.deleteLevel = level
+}
+
+// DeleteLevel returns the consistency level used by Delete.
+func (c *SwimringClient) DeleteLevel() string {
+	if c.deleteLevel == "" {
+		return c.writeLevel
+	}
+	return c.deleteLevel
+}
+
+// Timeout returns the timeout of each remote call.
+func (c *SwimringClient) Timeout() time.Duration {
+	return c.timeout
+}
+
+// SetTimeout sets the timeout of each remote call.
+func (c *SwimringClient) SetTimeout(timeout time.Duration) {
+	c.timeout = timeout
+}
+
+// DialTimeout returns the timeout of establishing a connection to a node.
+func (c *SwimringClient) DialTimeout() time.Duration {
+	return c.dialTimeout
+}
+
+// SetDialTimeout sets the timeout of establishing a connection to a node,
+// separate from the timeout of each remote call, so that connecting to an
+// unreachable host fails instead of hanging on the TCP handshake.
+func (c *SwimringClient) SetDialTimeout(timeout time.Duration) {
+	c.dialTimeout = timeout
+}
+
+// SetRetries sets the number of retries after a remote call fails
+// due to timeout or connection errors. Writes are only retried when they
+// carry an idempotency key, as a write that timed out may have been applied.
+func (c *SwimringClient) SetRetries(retries int) {
+	c.retries = retries
+}
+
 // Connect establishes a connection to remote RPC server.
 func (c *SwimringClient) Connect() error {
-	var err error
-	c.client, err = rpc.Dial("tcp", fmt.Sprintf("%s:%d", c.address, c.port))
+	client, err := c.dial(fmt.Sprintf("%s:%d", c.address, c.port))
+	if err != nil {
+		return err
+	}
+
+	p, err := c.handshake(client)
 	if err != nil {
+		client.Close()
 		return err
 	}
+	c.connMu.Lock()
+	c.client = client
+	c.protocol = p
+	c.connMu.Unlock()
 
 	return nil
 }
 
-// Get calls the remote Get method and returns the requested value.
+// conn returns the connection to the node, nil if not connected.
+func (c *SwimringClient) conn() *rpc.Client {
+	c.connMu.RLock()
+	client := c.client
+	c.connMu.RUnlock()
+
+	return client
+}
+
+// dial connects to the RPC server at the given address, giving up after the
+// dial timeout.
+func (c *SwimringClient) dial(address string) (*rpc.Client, error) {
+	conn, err := net.DialTimeout("tcp", address, c.dialTimeout)
+	if err != nil {
+		return nil, err
+	}
+
+	return rpc.NewClient(conn), nil
+}
+
+// Get calls the remote Get method and returns the requested value as string.
+// With a conflict resolver set, it reads the siblings of the key instead and
+// returns the value merged from them.
 func (c *SwimringClient) Get(key string) (string, error) {
-	if c.client == nil {
+	if c.resolver != nil && c.Supports(FeatureSiblings) {
+		return c.getResolved(key)
+	}
+
+	return c.get(key)
+}
+
+// GetBytes calls the remote Get method and returns the requested value.
+func (c *SwimringClient) GetBytes(key string) ([]byte, error) {
+	value, err := c.get(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return []byte(value), nil
+}
+
+func (c *SwimringClient) get(key string) (string, error) {
+	if c.conn() == nil {
 		return "", errors.New("not connected")
 	}
 
@@ -146,9 +467,16 @@ func (c *SwimringClient) Get(key string) (string, error) {
 		Key:   key,
 		Level: c.readLevel,
 	}
-	resp := &GetResponse{}
 
-	err := c.client.Call(GetOp, req, resp)
+	var resp *GetResponse
+	var err error
+	if c.coalescing {
+		resp, err = c.inflight.do(req.Level+" "+key, func() (*GetResponse, error) {
+			return c.getBytes(req)
+		})
+	} else {
+		resp, err = c.getBytes(req)
+	}
 	if err != nil {
 		return "", err
 	}
@@ -156,42 +484,194 @@ func (c *SwimringClient) Get(key string) (string, error) {
 	return resp.Value, nil
 }
 
+// GetOrDefault calls the remote Get method and returns the requested
+// value as string, or def if the key does not exist. A stored empty value is
+// returned as is, and other errors are propagated.
+func (c *SwimringClient) GetOrDefault(key, def string) (string, error) {
+	if c.conn() == nil {
+		return "", errors.New("not connected")
+	}
+
+	req := &GetRequest{
+		Key:   key,
+		Level: c.readLevel,
+	}
+
+	resp, err := c.getBytes(req)
+	if isNotFound(err) || (err == nil && resp.NotFound) {
+		return def, nil
+	}
+	if err != nil {
+		return "", err
+	}
+
+	return resp.Value, nil
+}
+
+// GetFresh calls the remote Get method and returns the requested value
+// as string, accepting only a version updated within maxStaleness. A
+// *StalenessError is returned if no replica has such a version.
+func (c *SwimringClient) GetFresh(key string, maxStaleness time.Duration) (string, error) {
+	if c.conn() == nil {
+		return "", errors.New("not connected")
+	}
+	if err := c.require(FeatureStaleness); err != nil {
+		return "", err
+	}
+
+	req := &GetRequest{
+		Key:          key,
+		Level:        c.readLevel,
+		MaxStaleness: maxStaleness,
+	}
+
+	resp, err := c.getBytes(req)
+	if err != nil {
+		return "", err
+	}
+
+	if resp.Clock == nil || time.Since(resp.Clock.LastUpdated()) > maxStaleness {
+		return "", &StalenessError{Key: key, MaxStaleness: maxStaleness}
+	}
+
+	return resp.Value, nil
+}
+
+// getBytes reads the given key, escalating the read to QUORUM if it returned
+// a suspiciously old version. The first result is kept if the escalated read
+// fails for another reason than a missing key.
+func (c *SwimringClient) getBytes(req *GetRequest) (*GetResponse, error) {
+	resp, err := c.readBytes(req)
+	if err != nil || !c.shouldEscalate(req.Level, resp.Clock) {
+		return resp, err
+	}
+
+	escalated, err := c.readBytes(escalatedRequest(req))
+	if err == nil || isNotFound(err) {
+		return escalated, err
+	}
+
+	return resp, nil
+}
+
+func (c *SwimringClient) readBytes(req *GetRequest) (*GetResponse, error) {
+	if c.sessionConsistency && c.Supports(FeatureClocks) {
+		req.MinClock = c.session.get(req.Key)
+	}
+	req.AllowStale = c.staleAllowed()
+
+	for attempt := 0; attempt <= c.retries; attempt++ {
+		resp := &GetResponse{}
+
+		err := c.callRead(req.Key, req.Level, GetOp, req, resp)
+		if err != nil {
+			return nil, err
+		}
+
+		if satisfies(resp.Clock, req.MinClock) {
+			return resp, nil
+		}
+	}
+
+	return nil, ErrSessionStale
+}
+
 // Put calls the remote Put method to update for specific key.
 func (c *SwimringClient) Put(key, value string) error {
-	if c.client == nil {
-		return errors.New("not connected")
-	}
+	return c.PutBytes(key, []byte(value))
+}
+
+// PutBytes calls the remote Put method to update for specific key.
+func (c *SwimringClient) PutBytes(key string, value []byte) error {
+	_, err := c.putBytes(key, value, nil)
+	return err
+}
+
+func (c *SwimringClient) putBytes(key string, value []byte, context *util.VectorClock) (*PutResponse, error) {
+	return c.putBytesSequenced(key, value, context, c.nextSequence(key), nil)
+}
 
-	req := &PutRequest{
+func (c *SwimringClient) putBytesSequenced(key string, value []byte, context *util.VectorClock, seq int64, metadata map[string]string) (*PutResponse, error) {
+	return c.sendPut(&PutRequest{
 		Key:   key,
-		Value: value,
+		Value: string(value),
 		Level: c.writeLevel,
+
+		Context:        context,
+		Sequence:       seq,
+		Metadata:       metadata,
+		IdempotencyKey: newIdempotencyKey(),
+	})
+}
+
+// sendPut sends the given write to the coordinator of its key, at the level
+// of the request.
+func (c *SwimringClient) sendPut(req *PutRequest) (*PutResponse, error) {
+	if c.conn() == nil {
+		return nil, errors.New("not connected")
 	}
+
+	if err := c.checkWriteLevel(req.Level); err != nil {
+		return nil, err
+	}
+	if req.Sequence > 0 {
+		if err := c.require(FeatureSequence); err != nil {
+			return nil, err
+		}
+	}
+
 	resp := &PutResponse{}
 
-	err := c.client.Call(PutOp, req, resp)
+	err := c.callKey(req.Key, PutOp, req, resp)
 	if err != nil {
-		return err
+		return nil, writeError(err)
 	}
 
-	return nil
+	if resp.Stale {
+		c.sequences.observe(req.Key, resp.Sequence)
+		return nil, ErrStaleSequence
+	}
+
+	if resp.Reason != "" {
+		return nil, &QuorumError{
+			Level:    req.Level,
+			Reason:   resp.Reason,
+			Replicas: resp.Replicas,
+		}
+	}
+
+	if c.sessionConsistency {
+		c.session.track(req.Key, resp.Clock)
+	}
+
+	return resp, nil
 }
 
 // Delete calls the remote Delete method to remove specific key.
 func (c *SwimringClient) Delete(key string) error {
-	if c.client == nil {
+	if c.conn() == nil {
 		return errors.New("not connected")
 	}
 
+	if err := c.checkWriteLevel(c.DeleteLevel()); err != nil {
+		return err
+	}
+
 	req := &DeleteRequest{
 		Key:   key,
-		Level: c.writeLevel,
+		Level: c.DeleteLevel(),
+
+		IdempotencyKey: newIdempotencyKey(),
 	}
 	resp := &DeleteResponse{}
 
-	err := c.client.Call(DeleteOp, req, resp)
+	err := c.callKey(key, DeleteOp, req, resp)
 	if err != nil {
-		return err
+		return writeError(err)
+	}
+
+	if c.sessionConsistency {
+		c.session.track(key, resp.Clock)
 	}
 
 	return nil
@@ -199,19 +679,106 @@ func (c *SwimringClient) Delete(key string) error {
 
 // Stat calls the remote Stat method to gather Nodes' information.
 func (c *SwimringClient) Stat() (NodeStats, error) {
-	if c.client == nil {
+	if c.conn() == nil {
 		return nil, errors.New("not connected")
 	}
 
-	req := &StateRequest{}
-	resp := &StateResponse{}
+	summary, err := c.ClusterStat()
+	return summary.Nodes, err
+}
+
+// writeOps are the operations which change data, and so are not retried
+// unless their payload carries an idempotency key.
+var writeOps = map[string]bool{
+	PutOp:            true,
+	DeleteOp:         true,
+	PutBatchOp:       true,
+	PutIndexedOp:     true,
+	CompareAndSwapOp: true,
+	ExpireOp:         true,
+	SetReadOnlyOp:    true,
+	SetTokensOp:      true,
+}
+
+// idempotent is implemented by the payloads of writes carrying an
+// idempotency key, which the coordinator uses to recognize a retry.
+type idempotent interface {
+	idempotencyKey() string
+}
+
+func (r *PutRequest) idempotencyKey() string    { return r.IdempotencyKey }
+func (r *DeleteRequest) idempotencyKey() string { return r.IdempotencyKey }
 
-	err := c.client.Call(StatOp, req, resp)
+// retryable returns whether a failed call may be sent again: a read, or a
+// write carrying an idempotency key, so that a write which reached the
+// server before the failure is not applied twice.
+func retryable(op string, req interface{}) bool {
+	if !writeOps[op] {
+		return true
+	}
+
+	r, ok := req.(idempotent)
+	return ok && r.idempotencyKey() != ""
+}
+
+func (c *SwimringClient) call(op string, req interface{}, resp interface{}) error {
+	var err error
+
+	c.redialIfDead()
+
+	for attempt := 0; attempt <= c.retries; attempt++ {
+		if attempt > 0 {
+			if answered(err) || err == ErrTooManyInflight || !retryable(op, req) {
+				return err
+			}
+			if err == rpc.ErrShutdown {
+				if cerr := c.Connect(); cerr != nil {
+					return cerr
+				}
+			}
+		}
+
+		err = c.callOn(c.conn(), op, req, resp)
+		if err == nil {
+			return nil
+		}
+		if perr, ok := err.(*ProtocolMismatchError); ok {
+			// A response that cannot be decoded shuts the connection down,
+			// so it is dialed again by the next call.
+			if _, ok := perr.Err.(rpc.ServerError); !ok {
+				atomic.StoreInt32(&c.dead, 1)
+			}
+			return err
+		}
+	}
+
+	return err
+}
+
+// callOn calls op on the given client. The reply is decoded into a fresh
+// value of the type of resp, copied into resp only once the call succeeded,
+// so that a call abandoned on timeout never writes into resp while a retry
+// or the caller uses it.
+func (c *SwimringClient) callOn(client *rpc.Client, op string, req interface{}, resp interface{}) error {
+	release, err := c.acquire()
 	if err != nil {
-		return nil, err
+		return err
 	}
+	defer release()
+
+	reply := reflect.New(reflect.TypeOf(resp).Elem())
+	call := client.Go(op, req, reply.Interface(), make(chan *rpc.Call, 1))
 
-	return NodeStats(resp.Nodes), nil
+	select {
+	case <-call.Done:
+		if call.Error != nil {
+			return codecError(op, call.Error)
+		}
+		reflect.ValueOf(resp).Elem().Set(reply.Elem())
+		return nil
+	case <-time.After(c.timeout):
+		return errors.New("request timeout")
+	}
 }
 
 func (ns NodeStats) Len() int {
@@ -219,16 +786,7 @@ func (ns NodeStats) Len() int {
 }
 
 func (ns NodeStats) Less(i, j int) bool {
-	itokens := strings.Split(ns[i].Address, ":")
-	jtokens := strings.Split(ns[j].Address, ":")
-
-	if itokens[0] != jtokens[0] {
-		return itokens[0] < jtokens[0]
-	}
-
-	iport, _ := strconv.Atoi(itokens[1])
-	jport, _ := strconv.Atoi(jtokens[1])
-	return iport < jport
+	return addressLess(&ns[i], &ns[j])
 }
 
 func (ns NodeStats) Swap(i, j int) {
@@ -236,33 +794,102 @@ func (ns NodeStats) Swap(i, j int) {
 }
 
 var client *SwimringClient
+var stdin *bufio.Reader
 
 func main() {
 	var serverAddr string
 	var serverPort int
-	var readLevel, writeLevel string
+	var readLevel, writeLevel, deleteLevel string
+	var timeout, dialTimeout, keepalive, coordinator, readBalancing, preferredNode, aliasFile string
+	var retries int
+	var unsafeLocalWrites, allowStale bool
 
 	flag.StringVar(&serverAddr, "host", "127.0.0.1", "address of server node")
 	flag.IntVar(&serverPort, "port", 7000, "port number of server node")
 	flag.StringVar(&readLevel, "rl", QUORUM, "read consistency level")
 	flag.StringVar(&writeLevel, "wl", QUORUM, "write consistency level")
+	flag.StringVar(&deleteLevel, "dl", "", "delete consistency level (default same as write level)")
+	flag.StringVar(&timeout, "timeout", defaultTimeout.String(), "timeout of each request")
+	flag.StringVar(&dialTimeout, "dial-timeout", defaultDialTimeout.String(), "timeout of establishing a connection")
+	flag.StringVar(&keepalive, "keepalive", "0s", "interval of the keepalive pings, 0 to disable")
+	flag.IntVar(&retries, "retries", defaultRetries, "number of retries for failed reads and idempotent writes")
+	flag.StringVar(&coordinator, "coordinator", CoordinatorAny, "coordinator selection strategy: any, owner")
+	flag.StringVar(&readBalancing, "read-balancing", BalancePrimary, "replica selection of ONE reads: primary, roundrobin, weighted")
+	flag.StringVar(&preferredNode, "prefer-node", "", "node read first by ONE reads when it is a replica of the key")
+	flag.StringVar(&aliasFile, "aliases", "", "file of additional command aliases")
+	flag.BoolVar(&unsafeLocalWrites, "unsafe-local-writes", false, "allow the non-durable LOCAL write level")
+	flag.StringVar(&histFile, "histfile", "", "CSV file receiving the latency histograms of bench")
+	flag.BoolVar(&allowStale, "allow-stale", false, "return stale values when the read level cannot be reached")
 	flag.Parse()
 
+	callTimeout, err := time.ParseDuration(timeout)
+	if err != nil || callTimeout <= 0 {
+		fmt.Printf("error: invalid timeout %s\n", timeout)
+		os.Exit(1)
+	}
+	connectTimeout, err := time.ParseDuration(dialTimeout)
+	if err != nil || connectTimeout <= 0 {
+		fmt.Printf("error: invalid dial timeout %s\n", dialTimeout)
+		os.Exit(1)
+	}
+	keepaliveInterval, err := time.ParseDuration(keepalive)
+	if err != nil || keepaliveInterval < 0 {
+		fmt.Printf("error: invalid keepalive %s\n", keepalive)
+		os.Exit(1)
+	}
+	if retries < 0 {
+		fmt.Printf("error: invalid retries %d\n", retries)
+		os.Exit(1)
+	}
+	if err := checkLocalWriteLevels(unsafeLocalWrites, writeLevel, deleteLevel); err != nil {
+		fmt.Printf("error: %s\n", err.Error())
+		os.Exit(1)
+	}
+	if aliasFile != "" {
+		if err := loadAliases(aliasFile); err != nil {
+			fmt.Printf("error: %s\n", err.Error())
+			os.Exit(1)
+		}
+	}
+
 	client = NewSwimringClient(serverAddr, serverPort)
 	client.SetReadLevel(readLevel)
 	client.SetWriteLevel(writeLevel)
+	client.SetDeleteLevel(deleteLevel)
+	client.SetTimeout(callTimeout)
+	client.SetDialTimeout(connectTimeout)
+	client.SetRetries(retries)
+	client.AllowUnsafeLocalWrites(unsafeLocalWrites)
+	client.SetAllowStaleDuringPartition(allowStale)
+	if err := client.SetCoordinatorStrategy(coordinator); err != nil {
+		fmt.Printf("error: %s\n", err.Error())
+		os.Exit(1)
+	}
+	if err := client.SetReadLoadBalancing(readBalancing); err != nil {
+		fmt.Printf("error: %s\n", err.Error())
+		os.Exit(1)
+	}
 
-	err := client.Connect()
+	err = client.Connect()
+	if perr, ok := err.(*ProtocolError); ok {
+		fmt.Printf("error: unable to connect to %s:%d: %s\n", serverAddr, serverPort, perr.Error())
+		os.Exit(0)
+	}
 	if err != nil {
 		fmt.Printf("error: unable to connect to %s:%d\n", serverAddr, serverPort)
 		os.Exit(0)
 	}
 	fmt.Printf("connected to %s:%d\n", serverAddr, serverPort)
+	client.SetKeepalive(keepaliveInterval)
+	if err := client.SetPreferredNode(preferredNode); err != nil {
+		fmt.Printf("error: %s\n", err.Error())
+		os.Exit(1)
+	}
 
-	reader := bufio.NewReader(os.Stdin)
+	stdin = bufio.NewReader(os.Stdin)
 	for {
 		fmt.Print("> ")
-		command, _ := reader.ReadString('\n')
+		command, _ := stdin.ReadString('\n')
 		if err := processCommand(strings.Trim(command, " \r\n")); err != nil {
 			fmt.Println(err.Error())
 		}
@@ -270,13 +897,23 @@ func main() {
 }
 
 func processCommand(line string) error {
-	tokens := util.SafeSplit(line)
+	tokens, timeout, err := commandTimeout(util.SafeSplit(line))
+	if err != nil {
+		return err
+	}
 
 	if len(tokens) == 0 {
 		return nil
 	}
 
-	switch tokens[0] {
+	if timeout > 0 {
+		previous := client.Timeout()
+		client.SetTimeout(timeout)
+		defer client.SetTimeout(previous)
+		fmt.Printf("(timeout: %s)\n", timeout)
+	}
+
+	switch normalizeCommand(tokens[0]) {
 	case GetCmd:
 		processGet(tokens)
 	case PutCmd:
@@ -285,6 +922,50 @@ func processCommand(line string) error {
 		processDelete(tokens)
 	case StatCmd:
 		processStat(tokens)
+	case RingCmd:
+		processRing(tokens)
+	case UseCmd:
+		processUse(tokens)
+	case TagsCmd:
+		processTags(tokens)
+	case VersionCmd:
+		processVersion(tokens)
+	case BenchCmd:
+		processBench(tokens)
+	case ReadOnlyCmd:
+		processReadOnly(tokens)
+	case HashCmd:
+		processHash(tokens)
+	case ScanCmd:
+		processScan(tokens)
+	case DelPrefixCmd:
+		processDeletePrefix(tokens)
+	case WatchCmd:
+		processWatch(tokens)
+	case DiffCmd:
+		processDiff(tokens)
+	case ExpireCmd:
+		processExpire(tokens)
+	case TTLCmd:
+		processTTL(tokens)
+	case GossipCmd:
+		processGossip(tokens)
+	case OwnedCmd:
+		processOwned(tokens)
+	case TokensCmd:
+		processTokens(tokens)
+	case RebalanceCmd:
+		processRebalance(tokens)
+	case MetricsCmd:
+		processMetrics(tokens)
+	case PartitionCmd:
+		processPartition(tokens)
+	case ExportCmd:
+		processExport(tokens)
+	case ImportCmd:
+		processImport(tokens)
+	case ConvergenceCmd:
+		processConvergence(tokens)
 	case ExitCmd:
 		os.Exit(0)
 	default:
@@ -300,6 +981,21 @@ func processGet(tokens []string) {
 		return
 	}
 
+	if client.staleAllowed() && client.Supports(FeatureReadMetadata) {
+		resp, err := client.GetVersioned(tokens[1])
+		if err != nil {
+			fmt.Printf("error: %s\n", err.Error())
+			return
+		}
+
+		if resp.Stale {
+			fmt.Printf("%s (stale: read level not reached)\n", resp.Value)
+		} else {
+			fmt.Println(string(resp.Value))
+		}
+		return
+	}
+
 	val, err := client.Get(tokens[1])
 	if err != nil {
 		fmt.Printf("error: %s\n", err.Error())
@@ -339,29 +1035,213 @@ func processDelete(tokens []string) {
 	fmt.Println("ok")
 }
 
+func processUse(tokens []string) {
+	if len(tokens) < 2 {
+		fmt.Println("usage: use [rl=<level>] [wl=<level>] [dl=<level>]")
+		return
+	}
+
+	levels := make(map[string]string)
+	for _, token := range tokens[1:] {
+		parts := strings.SplitN(token, "=", 2)
+		if len(parts) != 2 {
+			fmt.Println("usage: use [rl=<level>] [wl=<level>] [dl=<level>]")
+			return
+		}
+
+		name, level := strings.ToLower(parts[0]), strings.ToUpper(parts[1])
+		switch name {
+		case "rl", "wl", "dl":
+		default:
+			fmt.Printf("error: unknown setting %s\n", parts[0])
+			return
+		}
+		valid := ValidWriteLevel(level)
+		if name == "rl" {
+			valid = ValidLevel(level)
+		}
+		if !valid {
+			fmt.Printf("error: invalid consistency level %s\n", parts[1])
+			return
+		}
+		levels[name] = level
+	}
+
+	if err := checkLocalWriteLevels(client.unsafeLocalWrites, levels["wl"], levels["dl"]); err != nil {
+		fmt.Printf("error: %s\n", err.Error())
+		return
+	}
+
+	if level, ok := levels["rl"]; ok {
+		client.SetReadLevel(level)
+	}
+	if level, ok := levels["wl"]; ok {
+		client.SetWriteLevel(level)
+	}
+	if level, ok := levels["dl"]; ok {
+		client.SetDeleteLevel(level)
+	}
+
+	fmt.Printf("rl=%s wl=%s dl=%s\n", client.ReadLevel(), client.WriteLevel(), client.DeleteLevel())
+}
+
+func processTags(tokens []string) {
+	if len(tokens) != 2 {
+		fmt.Println("usage: tags <address>")
+		return
+	}
+
+	tags, err := client.NodeTags(tokens[1])
+	if err != nil {
+		fmt.Printf("error: %s\n", err.Error())
+		return
+	}
+
+	keys := make([]string, 0, len(tags))
+	for key := range tags {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		fmt.Printf("%s=%s\n", key, tags[key])
+	}
+	if len(keys) == 0 {
+		fmt.Println("(no tags)")
+	}
+}
+
+func processReadOnly(tokens []string) {
+	if len(tokens) != 3 || (tokens[2] != "on" && tokens[2] != "off") {
+		fmt.Println("usage: readonly <address> on|off")
+		return
+	}
+
+	err := client.SetReadOnly(tokens[1], tokens[2] == "on")
+	if err != nil {
+		fmt.Printf("error: %s\n", err.Error())
+		return
+	}
+
+	fmt.Println("ok")
+}
+
 func processStat(tokens []string) {
-	nodes, err := client.Stat()
+	tokens, sortKey, err := commandOption(tokens, "--sort", SortByAddress)
+	if err != nil {
+		fmt.Printf("error: %s\n", err.Error())
+		return
+	}
+	tokens, columnNames, err := commandOption(tokens, "--columns", "")
 	if err != nil {
 		fmt.Printf("error: %s\n", err.Error())
 		return
 	}
+	if len(tokens) > 2 {
+		fmt.Println("usage: stat [alive|suspect|faulty] [--sort address|keycount|status] [--columns <column,...>]")
+		return
+	}
+
+	columns, err := statColumnIndexes(columnNames)
+	if err != nil {
+		fmt.Printf("error: %s\n", err.Error())
+		return
+	}
+
+	var status string
+	if len(tokens) == 2 {
+		status = strings.ToLower(tokens[1])
+		if !ValidStatus(status) {
+			fmt.Printf("error: unknown status %s\n", tokens[1])
+			return
+		}
+	}
+
+	summary, err := client.ClusterStat()
+	unreachable := make(map[string]bool)
+	if partial, ok := err.(*PartialStatError); ok {
+		for _, address := range partial.Unreachable {
+			unreachable[address] = true
+		}
+	} else if err != nil {
+		fmt.Printf("error: %s\n", err.Error())
+		return
+	}
 
 	var data [][]string
-	sort.Sort(nodes)
+	nodes := summary.Nodes
+	if status != "" {
+		nodes = filterNodes(nodes, status)
+	}
+	if err := nodes.SortBy(strings.ToLower(sortKey)); err != nil {
+		fmt.Printf("error: %s\n", err.Error())
+		return
+	}
 
 	for _, node := range nodes {
+		status := node.Status
+		if unreachable[node.Address] {
+			status = "unreachable"
+		} else if node.ReadOnly {
+			status += " (read-only)"
+		}
+		if node.Minority {
+			status += " (minority)"
+		}
+		if node.DuplicateAddress {
+			status += " (duplicate address)"
+		}
+
 		var n []string
 		n = append(n, node.Address)
-		n = append(n, node.Status)
+		n = append(n, status)
 		n = append(n, strconv.Itoa(node.KeyCount))
-		data = append(data, n)
+		n = append(n, formatBytes(node.MemoryBytes))
+		n = append(n, strconv.Itoa(node.PendingReconcile))
+		data = append(data, selectColumns(n, columns))
+	}
+
+	var header []string
+	for _, i := range columns {
+		header = append(header, statColumns[i].header)
 	}
 
 	table := tablewriter.NewWriter(os.Stdout)
-	table.SetHeader([]string{"Address", "Status", "Key Count"})
+	table.SetHeader(header)
 
 	for _, d := range data {
 		table.Append(d)
 	}
+	table.SetFooter(selectColumns([]string{
+		fmt.Sprintf("%d nodes", len(summary.Nodes)),
+		fmt.Sprintf("%d alive, %d suspect, %d faulty", summary.Alive, summary.Suspect, summary.Faulty),
+		fmt.Sprintf("%d (~%d unique)", summary.TotalKeys, summary.UniqueKeys),
+		formatBytes(summary.MemoryBytes),
+		strconv.Itoa(summary.PendingReconcile),
+	}, columns))
 	table.Render()
 }
+
+// selectColumns returns the cells of a row of the stat table at the given
+// column indexes.
+func selectColumns(row []string, columns []int) []string {
+	selected := make([]string, len(columns))
+	for i, column := range columns {
+		selected[i] = row[column]
+	}
+	return selected
+}
+
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
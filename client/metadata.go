@@ -0,0 +1,48 @@
+package main
+
+import (
+	"errors"
+	"swimring/util"
+)
+
+// PutWithMetadata calls the remote Put method to update the value of
+// the given key along with its metadata, such as its content type. The
+// metadata is replicated with the value, and replaced by the next write of
+// the key: a plain Put leaves it empty. Its keys and values must not exceed
+// util.MaxMetadataBytes in total.
+func (c *SwimringClient) PutWithMetadata(key, value string, metadata map[string]string) error {
+	if err := util.CheckMetadata(metadata); err != nil {
+		return err
+	}
+	if len(metadata) > 0 {
+		if err := c.require(FeatureMetadata); err != nil {
+			return err
+		}
+	}
+
+	_, err := c.putBytesSequenced(key, []byte(value), nil, c.nextSequence(key), metadata)
+	return err
+}
+
+// GetWithMetadata calls the remote Get method and returns the requested
+// value as string along with its metadata, nil if it has none.
+func (c *SwimringClient) GetWithMetadata(key string) (string, map[string]string, error) {
+	if c.conn() == nil {
+		return "", nil, errors.New("not connected")
+	}
+	if err := c.require(FeatureMetadata); err != nil {
+		return "", nil, err
+	}
+
+	req := &GetRequest{
+		Key:   key,
+		Level: c.readLevel,
+	}
+
+	resp, err := c.getBytes(req)
+	if err != nil {
+		return "", nil, err
+	}
+
+	return resp.Value, resp.Metadata, nil
+}
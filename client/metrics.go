@@ -0,0 +1,92 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+const (
+	// MetricsOp is the name of the service method for Metrics.
+	MetricsOp = "SwimRing.Metrics"
+)
+
+// MetricsRequest is the payload of Metrics.
+type MetricsRequest struct{}
+
+// MetricsResponse is the payload of the response of Metrics, the KVS
+// metrics of a node.
+type MetricsResponse struct {
+	Address string
+	Metrics NodeMetrics
+}
+
+// NodeMetrics are the KVS metrics of a node this client shows.
+// QueueDepth is the number of requests waiting for another to release the
+// store, and the processing latencies are measured across operations, which
+// tells queuing apart from slow processing.
+type NodeMetrics struct {
+	KeyCount int
+	WALSize  int64
+	Load     NodeLoad
+
+	QueueDepth                                                       int64
+	AvgProcessingLatency                                             time.Duration
+	ProcessingLatencyP50, ProcessingLatencyP95, ProcessingLatencyP99 time.Duration
+}
+
+// NodeLoad is the request rate of a node and the requests it has in progress.
+type NodeLoad struct {
+	RequestsPerSec int64
+	InFlight       int64
+}
+
+// Metrics calls the remote Metrics method of the node at the given address,
+// or of the connected node if address is empty, and returns its KVS metrics.
+func (c *SwimringClient) Metrics(address string) (*MetricsResponse, error) {
+	req := &MetricsRequest{}
+	resp := &MetricsResponse{}
+
+	if address == "" {
+		if c.conn() == nil {
+			return nil, errors.New("not connected")
+		}
+		if err := c.require(FeatureMetrics); err != nil {
+			return nil, err
+		}
+
+		return resp, c.call(MetricsOp, req, resp)
+	}
+
+	client, err := c.dial(address)
+	if err != nil {
+		return nil, err
+	}
+	defer client.Close()
+
+	return resp, c.callOn(client, MetricsOp, req, resp)
+}
+
+func processMetrics(tokens []string) {
+	if len(tokens) > 2 {
+		fmt.Println("usage: metrics [address]")
+		return
+	}
+
+	var address string
+	if len(tokens) == 2 {
+		address = tokens[1]
+	}
+
+	resp, err := client.Metrics(address)
+	if err != nil {
+		fmt.Printf("error: %s\n", err.Error())
+		return
+	}
+
+	m := resp.Metrics
+	fmt.Printf("node: %s, keys: %d, commit log: %d bytes\n", resp.Address, m.KeyCount, m.WALSize)
+	fmt.Printf("requests: %d/s, in flight: %d, queue depth: %d\n", m.Load.RequestsPerSec, m.Load.InFlight, m.QueueDepth)
+	fmt.Printf("processing latency: avg %s, p50 %s, p95 %s, p99 %s\n", m.AvgProcessingLatency,
+		m.ProcessingLatencyP50, m.ProcessingLatencyP95, m.ProcessingLatencyP99)
+}
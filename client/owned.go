@@ -0,0 +1,104 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+const (
+	// OwnedKeysOp is the name of the service method for OwnedKeys.
+	OwnedKeysOp = "SwimRing.OwnedKeys"
+
+	ownedKeysPageSize = 1000
+)
+
+// OwnedKeysRequest is the payload of OwnedKeys.
+type OwnedKeysRequest struct {
+	Cursor string
+	Limit  int
+}
+
+// OwnedKeysResponse is the payload of the response of OwnedKeys. Next is
+// empty when the listing is complete.
+type OwnedKeysResponse struct {
+	Keys []string
+	Next string
+}
+
+// OwnedKeys returns, in key order, the keys for which the node at the given
+// address is the primary owner on the ring, that is the keys it coordinates.
+// The keys are fetched in pages with the same opaque cursor as ScanPage.
+func (c *SwimringClient) OwnedKeys(address string) ([]string, error) {
+	if c.conn() == nil {
+		return nil, errors.New("not connected")
+	}
+	if err := c.require(FeatureOwnedKeys); err != nil {
+		return nil, err
+	}
+
+	client, err := c.dial(address)
+	if err != nil {
+		return nil, err
+	}
+	defer client.Close()
+
+	var keys []string
+	cursor := ""
+	for {
+		req := &OwnedKeysRequest{
+			Cursor: cursor,
+			Limit:  ownedKeysPageSize,
+		}
+		resp := &OwnedKeysResponse{}
+
+		if err := c.callOn(client, OwnedKeysOp, req, resp); err != nil {
+			return nil, err
+		}
+		keys = append(keys, resp.Keys...)
+
+		if resp.Next == "" {
+			return keys, nil
+		}
+		cursor = resp.Next
+	}
+}
+
+func processOwned(tokens []string) {
+	if len(tokens) != 2 {
+		fmt.Println("usage: owned <address>")
+		return
+	}
+
+	keys, err := client.OwnedKeys(tokens[1])
+	if err != nil {
+		fmt.Printf("error: %s\n", err.Error())
+		return
+	}
+
+	if len(keys) > 0 {
+		fmt.Println(strings.Join(keys, "\n"))
+	}
+
+	stored, err := storedKeyCount(tokens[1])
+	if err != nil {
+		fmt.Printf("(%d keys)\n", len(keys))
+		return
+	}
+	fmt.Printf("(%d keys, %d stored as replica or owner)\n", len(keys), stored)
+}
+
+// storedKeyCount returns the KeyCount reported by Stat for the node at the
+// given address.
+func storedKeyCount(address string) (int, error) {
+	nodes, err := client.Stat()
+	for _, node := range nodes {
+		if node.Address == address || node.ExternalAddress == address {
+			return node.KeyCount, nil
+		}
+	}
+	if err == nil {
+		err = fmt.Errorf("node %s not found", address)
+	}
+	return 0, err
+}
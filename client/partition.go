@@ -0,0 +1,82 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+const (
+	// SplitBrainCheckOp is the name of the service method for SplitBrainCheck.
+	SplitBrainCheckOp = "SwimRing.SplitBrainCheck"
+)
+
+// SplitBrainCheckRequest is the payload of SplitBrainCheck.
+type SplitBrainCheckRequest struct{}
+
+// SplitBrainCheckResponse is the payload of the response of SplitBrainCheck,
+// the view of a node on whether it is in a minority partition. Alive counts
+// the alive members, the node included, and Known the members of the
+// cluster, those which left on purpose excluded.
+type SplitBrainCheckResponse struct {
+	Address     string
+	Alive       int
+	Known       int
+	Minority    bool
+	Unreachable []string
+}
+
+// SplitBrainCheck calls the remote SplitBrainCheck method of the node at the
+// given address, or of the connected node if address is empty. A node
+// reporting Minority sees at most half of the cluster alive, so writes it
+// accepts may not reach the majority side.
+func (c *SwimringClient) SplitBrainCheck(address string) (*SplitBrainCheckResponse, error) {
+	req := &SplitBrainCheckRequest{}
+	resp := &SplitBrainCheckResponse{}
+
+	if address == "" {
+		if c.conn() == nil {
+			return nil, errors.New("not connected")
+		}
+		if err := c.require(FeatureSplitBrain); err != nil {
+			return nil, err
+		}
+
+		return resp, c.call(SplitBrainCheckOp, req, resp)
+	}
+
+	client, err := c.dial(address)
+	if err != nil {
+		return nil, err
+	}
+	defer client.Close()
+
+	return resp, c.callOn(client, SplitBrainCheckOp, req, resp)
+}
+
+func processPartition(tokens []string) {
+	if len(tokens) > 2 {
+		fmt.Println("usage: partition [address]")
+		return
+	}
+
+	var address string
+	if len(tokens) == 2 {
+		address = tokens[1]
+	}
+
+	check, err := client.SplitBrainCheck(address)
+	if err != nil {
+		fmt.Printf("error: %s\n", err.Error())
+		return
+	}
+
+	side := "majority"
+	if check.Minority {
+		side = "minority, do not trust its writes"
+	}
+	fmt.Printf("node: %s, %d of %d members alive, %s\n", check.Address, check.Alive, check.Known, side)
+	if len(check.Unreachable) > 0 {
+		fmt.Printf("unreachable: %s\n", strings.Join(check.Unreachable, ", "))
+	}
+}
@@ -0,0 +1,210 @@
+package main
+
+import (
+	"fmt"
+	"net/rpc"
+	"sort"
+	"strings"
+	"swimring/util"
+)
+
+const (
+	// HandshakeOp is the name of the service method for Handshake.
+	HandshakeOp = "SwimRing.Handshake"
+
+	// FeatureBytes covers binary values, carried as is by Get and Put.
+	FeatureBytes = "bytes"
+	// FeatureClocks covers the vector clocks returned by reads and writes.
+	FeatureClocks = "clocks"
+	// FeatureStaleness covers GetRequest.MaxStaleness used by GetFresh.
+	FeatureStaleness = "staleness"
+	// FeatureHistory covers GetHistory.
+	FeatureHistory = "history"
+	// FeatureHints covers the ANY write level, acknowledged by hinted handoff.
+	FeatureHints = "hints"
+	// FeatureReadMetadata covers GetVersioned and its consistency metadata.
+	FeatureReadMetadata = "readmeta"
+	// FeatureSiblings covers GetSiblings and PutRequest.Context.
+	FeatureSiblings = "siblings"
+	// FeatureWatch covers Watch.
+	FeatureWatch = "watch"
+	// FeatureIndex covers PutIndexed and QueryIndex.
+	FeatureIndex = "index"
+	// FeatureLocalAck covers the LOCAL write level.
+	FeatureLocalAck = "localack"
+	// FeatureSnapshot covers SnapshotGet.
+	FeatureSnapshot = "snapshot"
+	// FeatureExpire covers Expire and TTL.
+	FeatureExpire = "expire"
+	// FeatureGossipDebug covers GossipDebug.
+	FeatureGossipDebug = "gossipdebug"
+	// FeatureCAS covers CompareAndSwap, which AcquireLock and ReleaseLock
+	// rely on.
+	FeatureCAS = "cas"
+	// FeatureOwnedKeys covers OwnedKeys.
+	FeatureOwnedKeys = "ownedkeys"
+	// FeatureSequence covers PutRequest.Sequence.
+	FeatureSequence = "sequence"
+	// FeatureRebalance covers RebalanceStatus.
+	FeatureRebalance = "rebalance"
+	// FeatureStaleReads covers GetRequest.AllowStale.
+	FeatureStaleReads = "stalereads"
+	// FeatureMetrics covers Metrics.
+	FeatureMetrics = "metrics"
+	// FeatureMetadata covers PutRequest.Metadata and
+	// GetResponse.Metadata.
+	FeatureMetadata = "metadata"
+	// FeatureBatch covers PutBatch.
+	FeatureBatch = "batch"
+	// FeatureSplitBrain covers SplitBrainCheck and NodeStat.Minority.
+	FeatureSplitBrain = "splitbrain"
+	// FeatureGetMulti covers GetMulti.
+	FeatureGetMulti = "getmulti"
+)
+
+var (
+	// clientFeatures are the features this client knows how to use.
+	clientFeatures = []string{
+		FeatureBytes,
+		FeatureClocks,
+		FeatureStaleness,
+		FeatureHistory,
+		FeatureHints,
+		FeatureReadMetadata,
+		FeatureSiblings,
+		FeatureWatch,
+		FeatureIndex,
+		FeatureLocalAck,
+		FeatureSnapshot,
+		FeatureExpire,
+		FeatureGossipDebug,
+		FeatureCAS,
+		FeatureOwnedKeys,
+		FeatureSequence,
+		FeatureRebalance,
+		FeatureStaleReads,
+		FeatureMetrics,
+		FeatureMetadata,
+		FeatureBatch,
+		FeatureSplitBrain,
+		FeatureGetMulti,
+	}
+	// requiredFeatures are the features without which the client refuses to
+	// connect, as its payloads would not decode on the server. Every payload
+	// of the client still decodes on a node without Handshake, gob ignoring
+	// the fields it does not know, so none is required.
+	requiredFeatures []string
+)
+
+// HandshakeRequest is the payload of Handshake.
+type HandshakeRequest struct {
+	ProtocolVersion int
+	Features        []string
+}
+
+// HandshakeResponse is the payload of the response of Handshake.
+type HandshakeResponse struct {
+	ProtocolVersion int
+	Features        []string
+}
+
+// ProtocolError is returned by Connect when the server does not support a
+// feature the client requires.
+type ProtocolError struct {
+	ServerVersion int
+	Missing       []string
+}
+
+func (e *ProtocolError) Error() string {
+	return fmt.Sprintf("server protocol version %d is too old: missing %s",
+		e.ServerVersion, strings.Join(e.Missing, ", "))
+}
+
+// protocol is the result of the handshake with the connected node.
+type protocol struct {
+	version  int
+	features map[string]bool
+}
+
+// ProtocolVersion returns the protocol version negotiated on Connect.
+func (c *SwimringClient) ProtocolVersion() int {
+	c.connMu.RLock()
+	defer c.connMu.RUnlock()
+
+	return c.protocol.version
+}
+
+// Supports returns whether the feature was negotiated on Connect.
+func (c *SwimringClient) Supports(feature string) bool {
+	c.connMu.RLock()
+	defer c.connMu.RUnlock()
+
+	return c.protocol.features[feature]
+}
+
+// require returns an error if the feature was not negotiated on Connect.
+func (c *SwimringClient) require(feature string) error {
+	if !c.Supports(feature) {
+		return fmt.Errorf("server does not support %s", feature)
+	}
+	return nil
+}
+
+// handshake exchanges protocol versions and features with the node, keeping
+// the features both sides support. A node answering Handshake with an
+// error, such as a node which predates it, is treated as protocol version 0
+// with no features.
+func (c *SwimringClient) handshake(client *rpc.Client) (protocol, error) {
+	req := &HandshakeRequest{
+		ProtocolVersion: util.ProtocolVersion,
+		Features:        clientFeatures,
+	}
+	resp := &HandshakeResponse{}
+
+	err := c.callOn(client, HandshakeOp, req, resp)
+	if answered(err) {
+		err = nil
+	}
+	if err != nil {
+		return protocol{}, err
+	}
+
+	p := protocol{
+		version:  resp.ProtocolVersion,
+		features: make(map[string]bool),
+	}
+	if p.version > util.ProtocolVersion {
+		p.version = util.ProtocolVersion
+	}
+
+	for _, feature := range resp.Features {
+		p.features[feature] = true
+	}
+	for feature := range p.features {
+		if !contains(clientFeatures, feature) {
+			delete(p.features, feature)
+		}
+	}
+
+	var missing []string
+	for _, feature := range requiredFeatures {
+		if !p.features[feature] {
+			missing = append(missing, feature)
+		}
+	}
+	if len(missing) > 0 {
+		sort.Strings(missing)
+		return protocol{}, &ProtocolError{ServerVersion: resp.ProtocolVersion, Missing: missing}
+	}
+
+	return p, nil
+}
+
+func contains(list []string, str string) bool {
+	for _, s := range list {
+		if s == str {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"errors"
+	"net/rpc"
+)
+
+const (
+	// SetReadOnlyOp is the name of the service method for SetReadOnly.
+	SetReadOnlyOp = "SwimRing.SetReadOnly"
+)
+
+var (
+	// ErrReadOnly is returned by writes coordinated by a node in read-only
+	// mode.
+	ErrReadOnly = errors.New("node is read-only")
+)
+
+// SetReadOnlyRequest is the payload of SetReadOnly.
+type SetReadOnlyRequest struct {
+	ReadOnly bool
+}
+
+// SetReadOnlyResponse is the payload of the response of SetReadOnly.
+type SetReadOnlyResponse struct {
+	ReadOnly bool
+}
+
+// SetReadOnly dials the node at the given address and switches its read-only
+// mode. A read-only node keeps serving reads but refuses writes, and is
+// skipped as a write replica, which makes it safe for brief maintenance.
+func (c *SwimringClient) SetReadOnly(address string, readOnly bool) error {
+	client, err := c.dial(address)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	req := &SetReadOnlyRequest{
+		ReadOnly: readOnly,
+	}
+	resp := &SetReadOnlyResponse{}
+
+	return c.callOn(client, SetReadOnlyOp, req, resp)
+}
+
+// writeError translates the error of a write returned by the server.
+func writeError(err error) error {
+	if serr, ok := err.(rpc.ServerError); ok && string(serr) == ErrReadOnly.Error() {
+		return ErrReadOnly
+	}
+	return err
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+const (
+	// RebalanceStatusOp is the name of the service method for RebalanceStatus.
+	RebalanceStatusOp = "SwimRing.RebalanceStatus"
+)
+
+// RebalanceStatusRequest is the payload of RebalanceStatus.
+type RebalanceStatusRequest struct{}
+
+// RebalanceStatusResponse is the payload of the response of RebalanceStatus,
+// the progress of the key migration of a node after a join, a leave or a
+// token change. ETA is zero if it cannot be estimated yet.
+type RebalanceStatusResponse struct {
+	Address       string
+	Active        bool
+	Started       time.Time
+	KeysMoved     int64
+	KeysRemaining int64
+	KeysPerSec    int64
+	BytesPerSec   int64
+	ETA           time.Duration
+}
+
+// RebalanceStatus calls the remote RebalanceStatus method of the node at the
+// given address, or of the connected node if address is empty, and returns
+// the progress of its key migration.
+func (c *SwimringClient) RebalanceStatus(address string) (*RebalanceStatusResponse, error) {
+	req := &RebalanceStatusRequest{}
+	resp := &RebalanceStatusResponse{}
+
+	if address == "" {
+		if c.conn() == nil {
+			return nil, errors.New("not connected")
+		}
+		if err := c.require(FeatureRebalance); err != nil {
+			return nil, err
+		}
+
+		return resp, c.call(RebalanceStatusOp, req, resp)
+	}
+
+	client, err := c.dial(address)
+	if err != nil {
+		return nil, err
+	}
+	defer client.Close()
+
+	return resp, c.callOn(client, RebalanceStatusOp, req, resp)
+}
+
+func processRebalance(tokens []string) {
+	if len(tokens) > 2 {
+		fmt.Println("usage: rebalance [address]")
+		return
+	}
+
+	var address string
+	if len(tokens) == 2 {
+		address = tokens[1]
+	}
+
+	status, err := client.RebalanceStatus(address)
+	if err != nil {
+		fmt.Printf("error: %s\n", err.Error())
+		return
+	}
+
+	if !status.Active {
+		fmt.Printf("node: %s, no rebalance in progress\n", status.Address)
+		return
+	}
+
+	total := status.KeysMoved + status.KeysRemaining
+	eta := "unknown"
+	if status.ETA > 0 {
+		eta = status.ETA.Round(time.Second).String()
+	}
+
+	fmt.Printf("node: %s, rebalancing for %s\n", status.Address, time.Since(status.Started).Round(time.Second))
+	fmt.Printf("moved: %d/%d keys (%.1f%%), remaining: %d keys\n",
+		status.KeysMoved, total, float64(status.KeysMoved)*100/float64(total), status.KeysRemaining)
+	fmt.Printf("throughput: %d keys/s, %d bytes/s, eta: %s\n", status.KeysPerSec, status.BytesPerSec, eta)
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+
+	"github.com/olekukonko/tablewriter"
+)
+
+const (
+	// RingStateOp is the name of the service method for RingState.
+	RingStateOp = "SwimRing.RingState"
+
+	ringSize = 1 << 32
+)
+
+// RingStateRequest is the payload of RingState.
+type RingStateRequest struct{}
+
+// RingStateResponse is the payload of the response of RingState.
+type RingStateResponse struct {
+	Tokens []RingToken
+	// ReplicaPoints is the replication factor of the cluster.
+	ReplicaPoints int
+	// Partitioning is the partitioning strategy of the cluster, hash or
+	// range.
+	Partitioning string
+	// Zones are the zones of the owners announcing one, across which the
+	// servers spread the replicas of a key.
+	Zones map[string]string
+}
+
+// RingToken is a position on the hash ring and the node owning it.
+type RingToken struct {
+	Token uint32
+	Owner string
+}
+
+// RingTokens is an array of RingToken
+type RingTokens []RingToken
+
+// RingState calls the remote RingState method and returns all the tokens on
+// the ring, including virtual nodes, sorted by token.
+func (c *SwimringClient) RingState() (RingTokens, error) {
+	if c.conn() == nil {
+		return nil, errors.New("not connected")
+	}
+
+	req := &RingStateRequest{}
+	resp := &RingStateResponse{}
+
+	err := c.call(RingStateOp, req, resp)
+	if err != nil {
+		return nil, err
+	}
+
+	tokens := RingTokens(resp.Tokens)
+	sort.Sort(tokens)
+
+	return tokens, nil
+}
+
+// Ranges returns the size of the range owned by each token, i.e. the distance
+// from the previous token on the ring.
+func (rt RingTokens) Ranges() []uint64 {
+	ranges := make([]uint64, len(rt))
+	for i, token := range rt {
+		prev := rt[(i+len(rt)-1)%len(rt)].Token
+		ranges[i] = (uint64(token.Token) - uint64(prev) + ringSize) % ringSize
+		if ranges[i] == 0 {
+			ranges[i] = ringSize
+		}
+	}
+	return ranges
+}
+
+func (rt RingTokens) Len() int {
+	return len(rt)
+}
+
+func (rt RingTokens) Less(i, j int) bool {
+	return rt[i].Token < rt[j].Token
+}
+
+func (rt RingTokens) Swap(i, j int) {
+	rt[i], rt[j] = rt[j], rt[i]
+}
+
+func processRing(tokens []string) {
+	ring, err := client.RingState()
+	if err != nil {
+		fmt.Printf("error: %s\n", err.Error())
+		return
+	}
+
+	ranges := ring.Ranges()
+	owned := make(map[string]uint64)
+
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetHeader([]string{"Token", "Owner", "Range"})
+
+	for i, token := range ring {
+		owned[token.Owner] += ranges[i]
+		table.Append([]string{
+			strconv.FormatUint(uint64(token.Token), 10),
+			token.Owner,
+			formatRingShare(ranges[i]),
+		})
+	}
+	table.Render()
+
+	var owners []string
+	for owner := range owned {
+		owners = append(owners, owner)
+	}
+	sort.Strings(owners)
+
+	summary := tablewriter.NewWriter(os.Stdout)
+	summary.SetHeader([]string{"Owner", "Ownership"})
+	for _, owner := range owners {
+		summary.Append([]string{owner, formatRingShare(owned[owner])})
+	}
+	summary.Render()
+}
+
+func formatRingShare(size uint64) string {
+	return fmt.Sprintf("%.2f%%", float64(size)*100/ringSize)
+}
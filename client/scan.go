@@ -0,0 +1,139 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+)
+
+const (
+	// ScanPageOp is the name of the service method for ScanPage.
+	ScanPageOp = "SwimRing.ScanPage"
+
+	scanPageSize = 100
+	// scanMaxResults is the default maximum number of keys listed by scan.
+	scanMaxResults = 10000
+)
+
+// ScanPageRequest is the payload of ScanPage.
+type ScanPageRequest struct {
+	Level  string
+	Prefix string
+	Cursor string
+	Limit  int
+}
+
+// ScanPageResponse is the payload of the response of ScanPage. Next is empty
+// when the scan is complete.
+type ScanPageResponse struct {
+	Items map[string]string
+	Next  string
+}
+
+// ScanPage calls the remote ScanPage method and returns at most limit keys
+// with the given prefix, starting from cursor, along with the cursor of the
+// next page. The cursor is opaque; the empty string starts a scan, and an
+// empty next cursor means the scan is complete.
+func (c *SwimringClient) ScanPage(prefix, cursor string, limit int) (map[string]string, string, error) {
+	if c.conn() == nil {
+		return nil, "", errors.New("not connected")
+	}
+	if limit <= 0 {
+		return nil, "", errors.New("invalid limit")
+	}
+
+	req := &ScanPageRequest{
+		Level:  c.readLevel,
+		Prefix: prefix,
+		Cursor: cursor,
+		Limit:  limit,
+	}
+	resp := &ScanPageResponse{}
+
+	err := c.call(ScanPageOp, req, resp)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return resp.Items, resp.Next, nil
+}
+
+// ScanPrefix returns the keys with the given prefix and their values, at
+// most maxResults of them. It fetches them page by page, and stops once
+// maxResults keys are collected, in which case truncated is set: more keys
+// may match, and the caller should narrow the prefix or use ScanPage.
+func (c *SwimringClient) ScanPrefix(prefix string, maxResults int) (items map[string]string, truncated bool, err error) {
+	if maxResults <= 0 {
+		return nil, false, errors.New("invalid maximum number of results")
+	}
+
+	items = make(map[string]string)
+	cursor := ""
+	for {
+		limit := maxResults - len(items)
+		if limit > scanPageSize {
+			limit = scanPageSize
+		}
+
+		page, next, err := c.ScanPage(prefix, cursor, limit)
+		if err != nil {
+			return nil, false, err
+		}
+		for key, value := range page {
+			items[key] = value
+		}
+
+		if next == "" {
+			return items, false, nil
+		}
+		if len(items) >= maxResults {
+			return items, true, nil
+		}
+		cursor = next
+	}
+}
+
+func processScan(tokens []string) {
+	if len(tokens) > 3 {
+		fmt.Println("usage: scan [prefix] [max]")
+		return
+	}
+
+	var prefix string
+	if len(tokens) >= 2 {
+		prefix = tokens[1]
+	}
+
+	maxResults := scanMaxResults
+	if len(tokens) == 3 {
+		n, err := strconv.Atoi(tokens[2])
+		if err != nil || n < 1 {
+			fmt.Printf("error: invalid maximum %s\n", tokens[2])
+			return
+		}
+		maxResults = n
+	}
+
+	items, truncated, err := client.ScanPrefix(prefix, maxResults)
+	if err != nil {
+		fmt.Printf("error: %s\n", err.Error())
+		return
+	}
+
+	keys := make([]string, 0, len(items))
+	for key := range items {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		fmt.Printf("%s=%s\n", key, items[key])
+	}
+
+	if truncated {
+		fmt.Printf("(%d keys, truncated: narrow the prefix or raise the maximum)\n", len(keys))
+		return
+	}
+	fmt.Printf("(%d keys)\n", len(keys))
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+const (
+	maxSequencedKeys = 4096
+)
+
+var (
+	// ErrStaleSequence is returned by a sequenced write whose sequence is not
+	// greater than the one stored for the key, such as a write delivered
+	// after a later one.
+	ErrStaleSequence = errors.New("stale write sequence")
+)
+
+// writeSequences keeps the last sequence written or observed for each key.
+type writeSequences struct {
+	sync.Mutex
+	last map[string]int64
+}
+
+func newWriteSequences() *writeSequences {
+	return &writeSequences{
+		last: make(map[string]int64),
+	}
+}
+
+// SetSequencedWrites enables or disables write fencing. When enabled, every
+// Put carries a per-key sequence greater than any the client wrote or saw
+// for the key, and the replicas reject it with ErrStaleSequence if they
+// already hold a write with a greater sequence. Sequences start from the
+// current time in nanoseconds, so writes of different clients are ordered
+// as long as their clocks are roughly in sync.
+func (c *SwimringClient) SetSequencedWrites(enabled bool) {
+	c.sequencedWrites = enabled
+	if !enabled {
+		c.sequences.reset()
+	}
+}
+
+// PutWithSequence calls the remote Put method to update the value of
+// the given key, unless the replicas hold a write with a sequence greater or
+// equal to seq, in which case ErrStaleSequence is returned. seq must be
+// positive.
+func (c *SwimringClient) PutWithSequence(key, value string, seq int64) error {
+	if seq <= 0 {
+		return errors.New("sequence must be positive")
+	}
+
+	_, err := c.putBytesSequenced(key, []byte(value), nil, seq, nil)
+	return err
+}
+
+// nextSequence returns the sequence of the next write of the given key if
+// sequenced writes are enabled, and zero otherwise.
+func (c *SwimringClient) nextSequence(key string) int64 {
+	if !c.sequencedWrites {
+		return 0
+	}
+	return c.sequences.next(key)
+}
+
+// next returns a sequence greater than the last one of the given key and
+// records it.
+func (s *writeSequences) next(key string) int64 {
+	seq := time.Now().UnixNano()
+
+	s.Lock()
+	if last := s.last[key]; seq <= last {
+		seq = last + 1
+	}
+	if len(s.last) >= maxSequencedKeys {
+		s.last = make(map[string]int64)
+	}
+	s.last[key] = seq
+	s.Unlock()
+
+	return seq
+}
+
+// observe records a sequence of the given key returned by a replica, so that
+// the next write goes beyond it.
+func (s *writeSequences) observe(key string, seq int64) {
+	s.Lock()
+	if seq > s.last[key] {
+		s.last[key] = seq
+	}
+	s.Unlock()
+}
+
+func (s *writeSequences) reset() {
+	s.Lock()
+	s.last = make(map[string]int64)
+	s.Unlock()
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"errors"
+	"swimring/util"
+	"sync"
+)
+
+const (
+	maxSessionKeys = 4096
+)
+
+var (
+	// ErrSessionStale is returned when no replica could return a version that
+	// includes the client's own writes.
+	ErrSessionStale = errors.New("cannot read own write: replicas are stale")
+)
+
+type sessionClocks struct {
+	sync.Mutex
+	clocks map[string]*util.VectorClock
+}
+
+func newSessionClocks() *sessionClocks {
+	return &sessionClocks{
+		clocks: make(map[string]*util.VectorClock),
+	}
+}
+
+// SetSessionConsistency enables or disables read-your-writes consistency.
+// When enabled, the client remembers the clock of its own writes and a Get
+// only accepts versions descending from it.
+func (c *SwimringClient) SetSessionConsistency(enabled bool) {
+	c.sessionConsistency = enabled
+	if !enabled {
+		c.session.reset()
+	}
+}
+
+// track records the clock returned by a write of the given key.
+func (s *sessionClocks) track(key string, clock *util.VectorClock) {
+	if clock == nil {
+		return
+	}
+
+	s.Lock()
+	if len(s.clocks) >= maxSessionKeys {
+		s.clocks = make(map[string]*util.VectorClock)
+	}
+	s.clocks[key] = clock
+	s.Unlock()
+}
+
+// get returns the clock of the last write of the given key, if any.
+func (s *sessionClocks) get(key string) *util.VectorClock {
+	s.Lock()
+	clock := s.clocks[key]
+	s.Unlock()
+
+	return clock
+}
+
+func (s *sessionClocks) reset() {
+	s.Lock()
+	s.clocks = make(map[string]*util.VectorClock)
+	s.Unlock()
+}
+
+// satisfies returns whether a version with the given clock includes the
+// tracked write.
+func satisfies(clock, tracked *util.VectorClock) bool {
+	if tracked == nil {
+		return true
+	}
+	if clock == nil {
+		return false
+	}
+
+	switch clock.Compare(tracked) {
+	case "NEWER", "EQUAL":
+		return true
+	}
+	return false
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"errors"
+	"swimring/util"
+)
+
+const (
+	// GetSiblingsOp is the name of the service method for GetSiblings.
+	GetSiblingsOp = "SwimRing.GetSiblings"
+)
+
+// Sibling is one of the concurrent versions of a key, none of which
+// descends from the others.
+type Sibling struct {
+	Value string
+	Clock *util.VectorClock
+}
+
+// GetSiblingsRequest is the payload of GetSiblings.
+type GetSiblingsRequest struct {
+	Level string
+	Key   string
+}
+
+// GetSiblingsResponse is the payload of the response of GetSiblings.
+type GetSiblingsResponse struct {
+	Key      string
+	Siblings []Sibling
+}
+
+// ConflictResolver merges the siblings of a key into a single value.
+type ConflictResolver func(key string, siblings []Sibling) (resolved string)
+
+// GetSiblings calls the remote GetSiblings method and returns every
+// concurrent version of the key found on the replicas read.
+func (c *SwimringClient) GetSiblings(key string) ([]Sibling, error) {
+	if c.conn() == nil {
+		return nil, errors.New("not connected")
+	}
+	if err := c.require(FeatureSiblings); err != nil {
+		return nil, err
+	}
+
+	req := &GetSiblingsRequest{
+		Key:   key,
+		Level: c.readLevel,
+	}
+	resp := &GetSiblingsResponse{}
+
+	err := c.callKey(key, GetSiblingsOp, req, resp)
+	if err != nil {
+		return nil, err
+	}
+	if len(resp.Siblings) == 0 {
+		return nil, ErrKeyNotFound
+	}
+
+	return resp.Siblings, nil
+}
+
+// SetConflictResolver makes Get read all the siblings of a key and return
+// the value merged by resolver when there are several. A nil resolver, or a
+// server without siblings support, restores the single-value Get.
+func (c *SwimringClient) SetConflictResolver(resolver ConflictResolver) {
+	c.resolver = resolver
+}
+
+// SetConflictWriteBack makes Get write a value merged by the conflict
+// resolver back to the cluster, with a clock merged from the siblings so
+// that it supersedes them all. If the write fails, Get returns its error
+// along with the merged value.
+func (c *SwimringClient) SetConflictWriteBack(enabled bool) {
+	c.resolverWriteBack = enabled
+}
+
+// getResolved returns the value of the key, merging its siblings with the
+// conflict resolver.
+func (c *SwimringClient) getResolved(key string) (string, error) {
+	siblings, err := c.GetSiblings(key)
+	if err != nil {
+		return "", err
+	}
+	if len(siblings) == 1 {
+		return siblings[0].Value, nil
+	}
+
+	resolved := c.resolver(key, siblings)
+
+	if c.resolverWriteBack {
+		clock := util.NewVectorClock()
+		for _, sibling := range siblings {
+			if sibling.Clock != nil {
+				clock.Merge(sibling.Clock)
+			}
+		}
+
+		if _, err := c.putBytes(key, []byte(resolved), clock); err != nil {
+			return resolved, err
+		}
+	}
+
+	return resolved, nil
+}
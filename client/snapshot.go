@@ -0,0 +1,62 @@
+package main
+
+import (
+	"errors"
+	"swimring/util"
+)
+
+const (
+	// SnapshotGetOp is the name of the service method for SnapshotGet.
+	SnapshotGetOp = "SwimRing.SnapshotGet"
+)
+
+// SnapshotGetRequest is the payload of SnapshotGet.
+type SnapshotGetRequest struct {
+	Level string
+	Keys  []string
+}
+
+// SnapshotGetResponse is the payload of the response of SnapshotGet. Keys
+// not found are missing from Values.
+type SnapshotGetResponse struct {
+	Values map[string][]byte
+	Clock  *util.VectorClock
+}
+
+// SnapshotGet calls the remote SnapshotGet method and reads several keys as
+// of a single vector clock frontier, snapshotClock, which is the merge of the
+// clocks of the returned versions. Keys not found are missing from the map.
+//
+// Each key is read at the read level, and the coordinator reads the replicas
+// again until no replica holds a version of a requested key that is newer
+// than the returned one yet still covered by snapshotClock. So if the value
+// of one key reflects a write, the other keys are not returned as of before
+// that write's frontier. This is not a transaction: writes concurrent with
+// the frontier may show up for some keys and not for others, and writes made
+// after the read are not isolated from it.
+func (c *SwimringClient) SnapshotGet(keys []string) (map[string]string, *util.VectorClock, error) {
+	if c.conn() == nil {
+		return nil, nil, errors.New("not connected")
+	}
+	if err := c.require(FeatureSnapshot); err != nil {
+		return nil, nil, err
+	}
+
+	req := &SnapshotGetRequest{
+		Level: c.readLevel,
+		Keys:  keys,
+	}
+	resp := &SnapshotGetResponse{}
+
+	err := c.call(SnapshotGetOp, req, resp)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	values := make(map[string]string, len(resp.Values))
+	for key, value := range resp.Values {
+		values[key] = string(value)
+	}
+
+	return values, resp.Clock, nil
+}
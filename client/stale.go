@@ -0,0 +1,17 @@
+package main
+
+// SetAllowStaleDuringPartition enables or disables stale reads during
+// partitions. When enabled, a read whose consistency level cannot be
+// reached, because too few replicas answered, returns the most recent
+// version among the replicas that did answer instead of failing. Such a
+// read is marked Stale in GetVersionedResponse. This trades consistency for
+// availability, and is disabled by default.
+func (c *SwimringClient) SetAllowStaleDuringPartition(enabled bool) {
+	c.allowStale = enabled
+}
+
+// staleAllowed returns whether reads may ask for stale values, which needs
+// the server to support it.
+func (c *SwimringClient) staleAllowed() bool {
+	return c.allowStale && c.Supports(FeatureStaleReads)
+}
@@ -0,0 +1,256 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	// SortByAddress sorts nodes by host, then by port. It is the default.
+	SortByAddress = "address"
+	// SortByKeyCount sorts nodes by decreasing key count, busiest first.
+	SortByKeyCount = "keycount"
+	// SortByStatus sorts alive nodes first, then suspect and faulty ones.
+	SortByStatus = "status"
+)
+
+// nodeStatComparators are the orders in which NodeStats can be sorted, by
+// sort key. Ties are broken by address.
+var nodeStatComparators = map[string]func(a, b *NodeStat) bool{
+	SortByAddress: addressLess,
+	SortByKeyCount: func(a, b *NodeStat) bool {
+		if a.KeyCount != b.KeyCount {
+			return a.KeyCount > b.KeyCount
+		}
+		return addressLess(a, b)
+	},
+	SortByStatus: func(a, b *NodeStat) bool {
+		if ra, rb := statusRank(a.Status), statusRank(b.Status); ra != rb {
+			return ra < rb
+		}
+		return addressLess(a, b)
+	},
+}
+
+// statColumns are the columns of the stat table, by name, in their default
+// order.
+var statColumns = []struct {
+	name, header string
+}{
+	{"address", "Address"},
+	{"status", "Status"},
+	{"keycount", "Key Count"},
+	{"memory", "Memory"},
+	{"pending", "Pending Reconcile"},
+}
+
+// ClusterSummary aggregates the NodeStats of the whole cluster.
+type ClusterSummary struct {
+	Nodes       NodeStats
+	Unreachable []string
+
+	Alive, Suspect, Faulty int
+
+	// TotalKeys counts every replica of every key, while UniqueKeys estimates
+	// the number of distinct keys by dividing it by the replication factor.
+	TotalKeys   int
+	UniqueKeys  int
+	MemoryBytes int64
+
+	// PendingReconcile sums the keys awaiting anti-entropy on every node.
+	PendingReconcile int
+}
+
+// ValidStatus returns whether the given string is a SWIM member status.
+func ValidStatus(status string) bool {
+	switch status {
+	case "alive", "suspect", "faulty":
+		return true
+	}
+	return false
+}
+
+// StatFiltered is like Stat but only returns the nodes with the given status.
+func (c *SwimringClient) StatFiltered(status string) (NodeStats, error) {
+	if !ValidStatus(status) {
+		return nil, fmt.Errorf("unknown status %s", status)
+	}
+
+	nodes, err := c.Stat()
+	return filterNodes(nodes, status), err
+}
+
+// ClusterStat calls the remote Stat method and aggregates the result into a
+// ClusterSummary. Like Stat, a *PartialStatError is returned along with the
+// summary when some nodes did not respond.
+func (c *SwimringClient) ClusterStat() (ClusterSummary, error) {
+	if c.conn() == nil {
+		return ClusterSummary{}, errors.New("not connected")
+	}
+
+	req := &StateRequest{}
+	resp := &StateResponse{}
+
+	err := c.call(StatOp, req, resp)
+	if err != nil {
+		return ClusterSummary{}, err
+	}
+
+	summary := summarize(NodeStats(resp.Nodes), resp.ReplicaPoints)
+	summary.Unreachable = resp.Unreachable
+
+	if len(resp.Unreachable) > 0 {
+		return summary, &PartialStatError{Unreachable: resp.Unreachable}
+	}
+
+	return summary, nil
+}
+
+func filterNodes(nodes NodeStats, status string) NodeStats {
+	var filtered NodeStats
+	for _, node := range nodes {
+		if node.Status == status {
+			filtered = append(filtered, node)
+		}
+	}
+	return filtered
+}
+
+func summarize(nodes NodeStats, replicaPoints int) ClusterSummary {
+	summary := ClusterSummary{
+		Nodes: nodes,
+	}
+
+	for _, node := range nodes {
+		switch node.Status {
+		case "alive":
+			summary.Alive++
+		case "suspect":
+			summary.Suspect++
+		case "faulty":
+			summary.Faulty++
+		}
+
+		summary.TotalKeys += node.KeyCount
+		summary.MemoryBytes += node.MemoryBytes
+		summary.PendingReconcile += node.PendingReconcile
+	}
+
+	summary.UniqueKeys = summary.TotalKeys
+	if replicaPoints > 1 {
+		summary.UniqueKeys = summary.TotalKeys / replicaPoints
+	}
+
+	return summary
+}
+
+// NodeTags returns the tags gossiped by the node at the given address.
+func (c *SwimringClient) NodeTags(address string) (map[string]string, error) {
+	nodes, err := c.Stat()
+	if _, ok := err.(*PartialStatError); err != nil && !ok {
+		return nil, err
+	}
+
+	for _, node := range nodes {
+		if node.Address == address {
+			return node.Tags, nil
+		}
+	}
+
+	return nil, fmt.Errorf("node %s not found", address)
+}
+
+// SortBy sorts the nodes by the given sort key: address, keycount or
+// status.
+func (ns NodeStats) SortBy(key string) error {
+	less, ok := nodeStatComparators[key]
+	if !ok {
+		return fmt.Errorf("unknown sort key %s", key)
+	}
+
+	sort.SliceStable(ns, func(i, j int) bool {
+		return less(&ns[i], &ns[j])
+	})
+	return nil
+}
+
+func addressLess(a, b *NodeStat) bool {
+	atokens := strings.Split(a.Address, ":")
+	btokens := strings.Split(b.Address, ":")
+
+	if atokens[0] != btokens[0] {
+		return atokens[0] < btokens[0]
+	}
+
+	aport, _ := strconv.Atoi(atokens[1])
+	bport, _ := strconv.Atoi(btokens[1])
+	return aport < bport
+}
+
+func statusRank(status string) int {
+	switch status {
+	case "alive":
+		return 0
+	case "suspect":
+		return 1
+	case "faulty":
+		return 2
+	}
+	return 3
+}
+
+// statColumnIndexes returns the indexes in statColumns of the given comma
+// separated column names, or of every column if names is empty.
+func statColumnIndexes(names string) ([]int, error) {
+	if names == "" {
+		indexes := make([]int, len(statColumns))
+		for i := range statColumns {
+			indexes[i] = i
+		}
+		return indexes, nil
+	}
+
+	var indexes []int
+	for _, name := range strings.Split(names, ",") {
+		index := -1
+		for i, column := range statColumns {
+			if column.name == strings.ToLower(name) {
+				index = i
+				break
+			}
+		}
+		if index < 0 {
+			return nil, fmt.Errorf("unknown column %s", name)
+		}
+		indexes = append(indexes, index)
+	}
+	return indexes, nil
+}
+
+// commandOption removes a <name> <value> or <name>=<value> option from the
+// tokens of a command, and returns the remaining tokens along with the
+// value, or def if the option is missing.
+func commandOption(tokens []string, name, def string) ([]string, string, error) {
+	value := def
+	rest := make([]string, 0, len(tokens))
+
+	for i := 0; i < len(tokens); i++ {
+		switch {
+		case tokens[i] == name:
+			if i+1 == len(tokens) {
+				return nil, "", fmt.Errorf("%s requires a value", name)
+			}
+			i++
+			value = tokens[i]
+		case strings.HasPrefix(tokens[i], name+"="):
+			value = strings.TrimPrefix(tokens[i], name+"=")
+		default:
+			rest = append(rest, tokens[i])
+		}
+	}
+
+	return rest, value, nil
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	timeoutOption = "--timeout"
+)
+
+// commandTimeout removes a --timeout <duration> or --timeout=<duration>
+// option from the tokens of a command, and returns the remaining tokens
+// along with the timeout, or zero if the option is missing. The duration is
+// given as 2s or 1m30s, or as a bare number of seconds, and must be
+// positive.
+func commandTimeout(tokens []string) ([]string, time.Duration, error) {
+	var timeout time.Duration
+	rest := make([]string, 0, len(tokens))
+
+	for i := 0; i < len(tokens); i++ {
+		var value string
+		switch {
+		case tokens[i] == timeoutOption:
+			if i+1 == len(tokens) {
+				return nil, 0, fmt.Errorf("%s requires a duration", timeoutOption)
+			}
+			i++
+			value = tokens[i]
+		case strings.HasPrefix(tokens[i], timeoutOption+"="):
+			value = strings.TrimPrefix(tokens[i], timeoutOption+"=")
+		default:
+			rest = append(rest, tokens[i])
+			continue
+		}
+
+		d, err := parseTTL(value)
+		if err != nil || d <= 0 {
+			return nil, 0, fmt.Errorf("invalid timeout %s", value)
+		}
+		timeout = d
+	}
+
+	return rest, timeout, nil
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+const (
+	// SetTokensOp is the name of the service method for SetTokens.
+	SetTokensOp = "SwimRing.SetTokens"
+)
+
+// SetTokensRequest is the payload of SetTokens.
+type SetTokensRequest struct {
+	Tokens int
+}
+
+// SetTokensResponse is the payload of the response of SetTokens, with the
+// token count of the node before the change.
+type SetTokensResponse struct {
+	Previous int
+}
+
+// SetTokens dials the node at the given address and changes its number of
+// tokens, virtual nodes included, to n, which grows or shrinks its share of
+// the ring without adding or removing nodes. The node gossips its new token
+// count, and every node migrates the keys whose ownership changed at the
+// throttled migration rate. It returns the previous token count.
+func (c *SwimringClient) SetTokens(address string, n int) (int, error) {
+	if n < 1 {
+		return 0, errors.New("token count must be positive")
+	}
+
+	client, err := c.dial(address)
+	if err != nil {
+		return 0, err
+	}
+	defer client.Close()
+
+	req := &SetTokensRequest{
+		Tokens: n,
+	}
+	resp := &SetTokensResponse{}
+
+	if err := c.callOn(client, SetTokensOp, req, resp); err != nil {
+		return 0, err
+	}
+
+	return resp.Previous, nil
+}
+
+func processTokens(tokens []string) {
+	if len(tokens) != 3 {
+		fmt.Println("usage: tokens <address> <count>")
+		return
+	}
+
+	n, err := strconv.Atoi(tokens[2])
+	if err != nil || n < 1 {
+		fmt.Printf("error: invalid token count %s\n", tokens[2])
+		return
+	}
+
+	previous, err := client.SetTokens(tokens[1], n)
+	if err != nil {
+		fmt.Printf("error: %s\n", err.Error())
+		return
+	}
+
+	fmt.Printf("ok, %d -> %d tokens\n", previous, n)
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"bytes"
+	"swimring/util"
+	"sync"
+	"time"
+)
+
+const (
+	trackPollInterval = 100 * time.Millisecond
+)
+
+// WriteHandle tracks a write on every replica of its key after the write
+// returned at its consistency level.
+type WriteHandle struct {
+	Key string
+
+	mu       sync.Mutex
+	replicas []ReplicaStatus
+	done     chan struct{}
+}
+
+// PutTracked writes the value like Put, returning as soon as the write
+// consistency level is reached, along with a handle tracking the write on
+// the remaining replicas in the background. Each replica is polled directly
+// until it holds the write, or until the client timeout elapses.
+func (c *SwimringClient) PutTracked(key, value string) (*WriteHandle, error) {
+	resp, err := c.putBytes(key, []byte(value), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	addresses, err := c.Replicas(key)
+	if err != nil {
+		return nil, err
+	}
+
+	h := &WriteHandle{
+		Key:      key,
+		replicas: make([]ReplicaStatus, len(addresses)),
+		done:     make(chan struct{}),
+	}
+	for i, address := range addresses {
+		h.replicas[i] = ReplicaStatus{Address: address, Status: ReplicaPending}
+	}
+
+	go h.track(c, []byte(value), resp)
+	return h, nil
+}
+
+// track polls the replicas still pending until they all hold the write or
+// the client timeout elapses, then releases the waiters.
+func (h *WriteHandle) track(c *SwimringClient, value []byte, resp *PutResponse) {
+	defer close(h.done)
+
+	deadline := time.Now().Add(c.timeout)
+	for {
+		pending := 0
+		for i, replica := range h.Replicas() {
+			if replica.Status != ReplicaPending {
+				continue
+			}
+
+			v, clock, err := c.GetFromNode(replica.Address, h.Key)
+			if err == nil && holdsWrite([]byte(v), value, clock, resp) {
+				h.setStatus(i, ReplicaAcked, "")
+				continue
+			}
+			if err != nil && !isNotFound(err) {
+				h.setStatus(i, ReplicaPending, err.Error())
+			}
+			pending++
+		}
+
+		if pending == 0 {
+			return
+		}
+		if time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(trackPollInterval)
+	}
+
+	for i, replica := range h.Replicas() {
+		if replica.Status == ReplicaPending {
+			h.setStatus(i, ReplicaTimedOut, replica.Message)
+		}
+	}
+}
+
+// holdsWrite returns whether a replica's copy includes the write. Without a
+// clock from the server, the values are compared instead.
+func holdsWrite(value, written []byte, clock *util.VectorClock, resp *PutResponse) bool {
+	if resp.Clock == nil {
+		return bytes.Equal(value, written)
+	}
+	return satisfies(clock, resp.Clock)
+}
+
+func (h *WriteHandle) setStatus(i int, status, message string) {
+	h.mu.Lock()
+	h.replicas[i].Status = status
+	h.replicas[i].Message = message
+	h.mu.Unlock()
+}
+
+// Replicas returns the current status of the write on each replica, which
+// is final once Wait has returned.
+func (h *WriteHandle) Replicas() []ReplicaStatus {
+	h.mu.Lock()
+	replicas := make([]ReplicaStatus, len(h.replicas))
+	copy(replicas, h.replicas)
+	h.mu.Unlock()
+
+	return replicas
+}
+
+// Done returns a channel closed once every replica has acked the write or
+// timed out.
+func (h *WriteHandle) Done() <-chan struct{} {
+	return h.done
+}
+
+// Wait blocks until every replica has acked the write or timed out. It
+// returns a *QuorumError at level ALL listing the status of each replica if
+// some of them timed out.
+func (h *WriteHandle) Wait() error {
+	<-h.done
+
+	replicas := h.Replicas()
+	for _, replica := range replicas {
+		if replica.Status != ReplicaAcked {
+			return &QuorumError{
+				Level:    ALL,
+				Reason:   ReasonTimeout,
+				Replicas: replicas,
+			}
+		}
+	}
+
+	return nil
+}
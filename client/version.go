@@ -0,0 +1,80 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"swimring/util"
+
+	"github.com/olekukonko/tablewriter"
+)
+
+const (
+	// VersionOp is the name of the service method for Version.
+	VersionOp = "SwimRing.Version"
+)
+
+// VersionRequest is the payload of Version.
+type VersionRequest struct{}
+
+// VersionResponse is the payload of the response of Version.
+type VersionResponse struct {
+	Info util.VersionInfo
+}
+
+// Version dials the node at the given address, calls its Version method and
+// returns the version of the code it runs.
+func (c *SwimringClient) Version(address string) (util.VersionInfo, error) {
+	client, err := c.dial(address)
+	if err != nil {
+		return util.VersionInfo{}, err
+	}
+	defer client.Close()
+
+	req := &VersionRequest{}
+	resp := &VersionResponse{}
+
+	err = c.callOn(client, VersionOp, req, resp)
+	if err != nil {
+		return util.VersionInfo{}, err
+	}
+
+	return resp.Info, nil
+}
+
+func processVersion(tokens []string) {
+	local := util.LocalVersion()
+	fmt.Printf("client: %s\n", local)
+
+	nodes, err := client.Stat()
+	if _, ok := err.(*PartialStatError); err != nil && !ok {
+		fmt.Printf("error: %s\n", err.Error())
+		return
+	}
+	sort.Sort(nodes)
+
+	var mismatched []string
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetHeader([]string{"Address", "Version", "Commit", "Protocol"})
+
+	for _, node := range nodes {
+		info, err := client.Version(node.DialAddress())
+		if err != nil {
+			table.Append([]string{node.Address, "error: " + err.Error(), "", ""})
+			continue
+		}
+
+		protocol := fmt.Sprintf("%d", info.ProtocolVersion)
+		if info.ProtocolVersion != local.ProtocolVersion {
+			protocol += " (!)"
+			mismatched = append(mismatched, node.Address)
+		}
+		table.Append([]string{node.Address, info.Version, info.GitCommit, protocol})
+	}
+
+	table.Render()
+
+	for _, address := range mismatched {
+		fmt.Printf("warning: %s speaks a different protocol version than this client (%d)\n", address, local.ProtocolVersion)
+	}
+}
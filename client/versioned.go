@@ -0,0 +1,85 @@
+package main
+
+import (
+	"errors"
+	"swimring/util"
+)
+
+const (
+	// GetVersionedOp is the name of the service method for GetVersioned.
+	GetVersionedOp = "SwimRing.GetVersioned"
+)
+
+// GetVersionedResponse is the payload of the response of GetVersioned. Along
+// with the value and its clock, it tells how consistent the read was.
+type GetVersionedResponse struct {
+	Key   string
+	Value []byte
+	Clock *util.VectorClock
+
+	// RepliesReceived is the number of replicas which answered in time.
+	RepliesReceived int
+	// RepliesAgreed is the number of those replicas holding the returned version.
+	RepliesAgreed int
+	// RepairTriggered reports whether diverging replicas were read-repaired.
+	RepairTriggered bool
+	// Escalated reports whether the read was retried at QUORUM because the
+	// version first read at ONE was older than the escalation threshold.
+	Escalated bool
+	// Stale reports whether the read level was not reached, and the value
+	// comes from fewer replicas, as allowed by SetAllowStaleDuringPartition.
+	Stale bool
+}
+
+// Agreement returns the share of the replies holding the returned version.
+func (r *GetVersionedResponse) Agreement() float64 {
+	if r.RepliesReceived == 0 {
+		return 0
+	}
+	return float64(r.RepliesAgreed) / float64(r.RepliesReceived)
+}
+
+// GetVersioned calls the remote GetVersioned method and returns the value of
+// the key with its clock and consistency metadata, so that the caller can
+// e.g. retry at a higher level when few replicas agreed.
+func (c *SwimringClient) GetVersioned(key string) (*GetVersionedResponse, error) {
+	if c.conn() == nil {
+		return nil, errors.New("not connected")
+	}
+	if err := c.require(FeatureReadMetadata); err != nil {
+		return nil, err
+	}
+
+	req := &GetRequest{
+		Key:        key,
+		Level:      c.readLevel,
+		AllowStale: c.staleAllowed(),
+	}
+	if c.sessionConsistency && c.Supports(FeatureClocks) {
+		req.MinClock = c.session.get(key)
+	}
+	resp := &GetVersionedResponse{}
+
+	err := c.callRead(key, req.Level, GetVersionedOp, req, resp)
+	if err != nil {
+		return nil, err
+	}
+
+	if !satisfies(resp.Clock, req.MinClock) {
+		return nil, ErrSessionStale
+	}
+
+	if c.shouldEscalate(req.Level, resp.Clock) {
+		escalated := &GetVersionedResponse{}
+		err := c.callKey(key, GetVersionedOp, escalatedRequest(req), escalated)
+		if isNotFound(err) {
+			return nil, err
+		}
+		if err == nil && satisfies(escalated.Clock, req.MinClock) {
+			escalated.Escalated = true
+			return escalated, nil
+		}
+	}
+
+	return resp, nil
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/olekukonko/tablewriter"
+)
+
+const (
+	visibilityPollInterval = 10 * time.Millisecond
+)
+
+// ReplicaArrival is when a write became visible on a replica, relative to
+// the acknowledgement of the write. Arrived is false if the replica did not
+// hold the write before the timeout, with the last error in Message.
+type ReplicaArrival struct {
+	Address string
+	Arrived bool
+	After   time.Duration
+	Message string
+}
+
+// VisibilityReport is the propagation of a write at level ONE to the
+// replicas of its key. QuorumAfter and AllAfter are how long after the
+// acknowledgement of the write a quorum and all of the replicas held it,
+// and are negative if they did not before the timeout.
+type VisibilityReport struct {
+	Key          string
+	Value        string
+	WriteLatency time.Duration
+	Replicas     []ReplicaArrival
+
+	QuorumAfter time.Duration
+	AllAfter    time.Duration
+}
+
+// MeasureVisibility writes a unique value to the given key at level ONE,
+// then polls every replica of the key directly until they all hold it or
+// the client timeout elapses, and reports when the value arrived on each of
+// them. The replicas are read with LocalGet rather than with a read at ALL,
+// whose read repair would propagate the value itself. The previous value of
+// the key is overwritten.
+func (c *SwimringClient) MeasureVisibility(key string) (*VisibilityReport, error) {
+	addresses, err := c.Replicas(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(addresses) == 0 {
+		return nil, errors.New("no replica found")
+	}
+
+	report := &VisibilityReport{
+		Key:         key,
+		Value:       "visibility-" + newIdempotencyKey(),
+		Replicas:    make([]ReplicaArrival, len(addresses)),
+		QuorumAfter: -1,
+		AllAfter:    -1,
+	}
+	for i, address := range addresses {
+		report.Replicas[i].Address = address
+	}
+
+	start := time.Now()
+	_, err = c.sendPut(&PutRequest{
+		Key:   key,
+		Value: report.Value,
+		Level: ONE,
+
+		Sequence:       c.nextSequence(key),
+		IdempotencyKey: newIdempotencyKey(),
+	})
+	if err != nil {
+		return nil, err
+	}
+	acked := time.Now()
+	report.WriteLatency = acked.Sub(start)
+
+	quorum := len(addresses)/2 + 1
+	arrived := 0
+	deadline := acked.Add(c.timeout)
+	for {
+		for i := range report.Replicas {
+			replica := &report.Replicas[i]
+			if replica.Arrived {
+				continue
+			}
+
+			value, _, err := c.GetFromNode(replica.Address, key)
+			if err == nil && value == report.Value {
+				replica.Arrived, replica.After, replica.Message = true, time.Since(acked), ""
+				arrived++
+				if arrived == quorum {
+					report.QuorumAfter = replica.After
+				}
+				continue
+			}
+			if err != nil && !isNotFound(err) {
+				replica.Message = err.Error()
+			}
+		}
+
+		if arrived == len(addresses) {
+			report.AllAfter = time.Since(acked)
+			return report, nil
+		}
+		if time.Now().After(deadline) {
+			return report, nil
+		}
+		time.Sleep(visibilityPollInterval)
+	}
+}
+
+func processConvergence(tokens []string) {
+	if len(tokens) != 2 {
+		fmt.Println("usage: convergence <key>")
+		return
+	}
+
+	report, err := client.MeasureVisibility(tokens[1])
+	if err != nil {
+		fmt.Printf("error: %s\n", err.Error())
+		return
+	}
+
+	fmt.Printf("wrote %s at ONE in %s\n", report.Value, report.WriteLatency)
+
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetHeader([]string{"Replica", "Arrival"})
+	for _, replica := range report.Replicas {
+		arrival := replica.After.String()
+		if !replica.Arrived {
+			arrival = "not arrived"
+			if replica.Message != "" {
+				arrival += " (" + replica.Message + ")"
+			}
+		}
+		table.Append([]string{replica.Address, arrival})
+	}
+	table.Render()
+
+	fmt.Printf("visible at QUORUM after %s, at ALL after %s\n",
+		formatVisibility(report.QuorumAfter), formatVisibility(report.AllAfter))
+}
+
+func formatVisibility(after time.Duration) string {
+	if after < 0 {
+		return "timeout"
+	}
+	return after.String()
+}
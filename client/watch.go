@@ -0,0 +1,147 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"swimring/util"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// WatchOp is the name of the service method for Watch.
+	WatchOp = "SwimRing.Watch"
+
+	watchRetryInterval = time.Second
+)
+
+// WatchRequest is the payload of Watch. The server answers once the key has
+// changed after Since, or with no event when Wait elapses.
+type WatchRequest struct {
+	Key   string
+	Since int64
+	Wait  time.Duration
+}
+
+// WatchResponse is the payload of the response of Watch.
+type WatchResponse struct {
+	Events []WatchEvent
+}
+
+// WatchEvent is a change of a watched key. Timestamp is the time of the
+// change in Unix nanoseconds.
+type WatchEvent struct {
+	Key       string
+	Value     []byte
+	Clock     *util.VectorClock
+	Deleted   bool
+	Timestamp int64
+}
+
+// Watch subscribes to the changes of the given key and sends them on the
+// returned channel until stop is closed, after which the channel is closed.
+// Changes are long-polled. When the connection drops, the client dials
+// again and resubscribes from the last change it received, so none is lost.
+func (c *SwimringClient) Watch(key string, stop <-chan struct{}) (<-chan WatchEvent, error) {
+	if c.conn() == nil {
+		return nil, errors.New("not connected")
+	}
+	if err := c.require(FeatureWatch); err != nil {
+		return nil, err
+	}
+
+	events := make(chan WatchEvent)
+	go func() {
+		defer close(events)
+
+		since := time.Now().UnixNano()
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+
+			req := &WatchRequest{
+				Key:   key,
+				Since: since,
+				Wait:  c.timeout / 2,
+			}
+			resp := &WatchResponse{}
+
+			err := c.callKey(key, WatchOp, req, resp)
+			if err != nil {
+				// A dropped connection is dialed again by the next call.
+				if !answered(err) {
+					atomic.StoreInt32(&c.dead, 1)
+				}
+
+				select {
+				case <-stop:
+					return
+				case <-time.After(watchRetryInterval):
+				}
+				continue
+			}
+
+			for _, event := range resp.Events {
+				select {
+				case events <- event:
+				case <-stop:
+					return
+				}
+				if event.Timestamp > since {
+					since = event.Timestamp
+				}
+			}
+		}
+	}()
+
+	return events, nil
+}
+
+func processWatch(tokens []string) {
+	if len(tokens) != 2 {
+		fmt.Println("usage: watch <key>")
+		return
+	}
+
+	stop := make(chan struct{})
+	events, err := client.Watch(tokens[1], stop)
+	if err != nil {
+		fmt.Printf("error: %s\n", err.Error())
+		return
+	}
+
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+	defer signal.Stop(interrupt)
+
+	fmt.Printf("watching %s, press Ctrl-C to stop\n", tokens[1])
+	for {
+		select {
+		case event := <-events:
+			printWatchEvent(event)
+		case <-interrupt:
+			close(stop)
+			return
+		}
+	}
+}
+
+func printWatchEvent(event WatchEvent) {
+	at := time.Unix(0, event.Timestamp).Format("15:04:05.000")
+
+	var clock string
+	if event.Clock != nil {
+		clock = event.Clock.String()
+	}
+
+	if event.Deleted {
+		fmt.Printf("[%s] %s deleted (clock: %s)\n", at, event.Key, clock)
+		return
+	}
+	fmt.Printf("[%s] %s = %s (clock: %s)\n", at, event.Key, string(event.Value), clock)
+}
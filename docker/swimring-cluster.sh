@@ -2,6 +2,9 @@ if [ -z "$SEEDS" ]; then
     echo "No seeds specified, being my own seed..."
 	SEEDS = "[\":7001\"]"
 fi
+if [ -n "$ADVERTISE" ]; then
+    sed -i -e "s/AdvertiseAddress: \"\"/AdvertiseAddress: $ADVERTISE/" /go/bin/config.yml
+fi
 sed -i -e "s/BootstrapNodes: \[\":7001\"\]/BootstrapNodes: $SEEDS/" /go/bin/config.yml
 
 /go/bin/swimring
\ No newline at end of file
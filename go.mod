@@ -7,7 +7,11 @@ require (
 	github.com/hungys/swimring v0.0.0-20160712071950-c599edbf2cb5
 	github.com/olekukonko/tablewriter v0.0.5
 	github.com/op/go-logging v0.0.0-20160315200505-970db520ece7
+	go.etcd.io/bbolt v1.3.10
 	gopkg.in/yaml.v2 v2.4.0
 )
 
-require github.com/mattn/go-runewidth v0.0.9 // indirect
+require (
+	github.com/mattn/go-runewidth v0.0.9 // indirect
+	golang.org/x/sys v0.20.0 // indirect
+)
@@ -0,0 +1,292 @@
+package hashring
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"sync"
+	"testing"
+)
+
+var _ Ring = &FakeRing{}
+
+// FakeRing is a Ring whose membership and tokens are driven explicitly,
+// without gossip. It is meant for tests of rebalancing and handoff, which
+// need deterministic control over which server owns which range. It is only
+// built with the tests of the package.
+type FakeRing struct {
+	sync.RWMutex
+
+	hashfunc func(string) int64
+	tokens   map[string][]int64
+	tree     *redBlackTree
+	zoneOf   ZoneFunc
+	salts    map[string]string
+
+	listeners []func(added, removed []string)
+}
+
+// NewFakeRing returns an empty FakeRing hashing keys with hashfunc.
+func NewFakeRing(hashfunc func([]byte) uint32) *FakeRing {
+	return &FakeRing{
+		hashfunc: func(str string) int64 {
+			return int64(hashfunc([]byte(str)))
+		},
+		tokens: make(map[string][]int64),
+		tree:   &redBlackTree{},
+	}
+}
+
+// OnChange registers a hook called after servers join or leave the ring.
+func (r *FakeRing) OnChange(fn func(added, removed []string)) {
+	r.Lock()
+	r.listeners = append(r.listeners, fn)
+	r.Unlock()
+}
+
+// Join adds the server with the given tokens. Without tokens, a single token
+// is derived from the server address.
+func (r *FakeRing) Join(address string, tokens ...int64) bool {
+	r.Lock()
+	ok := r.joinNoLock(address, tokens)
+	r.Unlock()
+
+	if ok {
+		r.notify([]string{address}, nil)
+	}
+	return ok
+}
+
+// Leave removes the server and all its tokens.
+func (r *FakeRing) Leave(address string) bool {
+	r.Lock()
+	ok := r.leaveNoLock(address)
+	r.Unlock()
+
+	if ok {
+		r.notify(nil, []string{address})
+	}
+	return ok
+}
+
+// SetTokens forces the server to own exactly the given tokens, moving the
+// ranges they cover from their previous owners.
+func (r *FakeRing) SetTokens(address string, tokens ...int64) error {
+	r.Lock()
+	defer r.Unlock()
+
+	if _, ok := r.tokens[address]; !ok {
+		return fmt.Errorf("server %s is not on the ring", address)
+	}
+
+	for _, token := range r.tokens[address] {
+		r.tree.Delete(token)
+	}
+	r.tokens[address] = nil
+
+	for _, token := range tokens {
+		r.assignNoLock(address, token)
+	}
+
+	return nil
+}
+
+// SetZoneFunc makes LookupN spread the servers of a key across zones, like
+// HashRing.SetZoneFunc.
+func (r *FakeRing) SetZoneFunc(zoneOf ZoneFunc) {
+	r.Lock()
+	r.zoneOf = zoneOf
+	r.Unlock()
+}
+
+// SetBucketSalts sets the hash salt of each bucket, like
+// HashRing.SetBucketSalts.
+func (r *FakeRing) SetBucketSalts(salts map[string]string) {
+	r.Lock()
+	r.salts = salts
+	r.Unlock()
+}
+
+// AddServer adds the server with a token derived from its address.
+func (r *FakeRing) AddServer(address string) bool {
+	return r.Join(address)
+}
+
+// RemoveServer removes the server and all its tokens.
+func (r *FakeRing) RemoveServer(address string) bool {
+	return r.Leave(address)
+}
+
+// AddRemoveServers adds and removes servers. Returns whether the ring has changed.
+func (r *FakeRing) AddRemoveServers(add []string, remove []string) bool {
+	var added, removed []string
+
+	r.Lock()
+	for _, server := range add {
+		if r.joinNoLock(server, nil) {
+			added = append(added, server)
+		}
+	}
+	for _, server := range remove {
+		if r.leaveNoLock(server) {
+			removed = append(removed, server)
+		}
+	}
+	r.Unlock()
+
+	changed := len(added) > 0 || len(removed) > 0
+	if changed {
+		r.notify(added, removed)
+	}
+	return changed
+}
+
+// Lookup returns the owner of the given key.
+func (r *FakeRing) Lookup(key string) (string, bool) {
+	servers := r.LookupN(key, 1)
+	if len(servers) == 0 {
+		return "", false
+	}
+	return servers[0], true
+}
+
+// LookupN returns the N servers that own the given key, owner first.
+func (r *FakeRing) LookupN(key string, n int) []string {
+	r.RLock()
+	defer r.RUnlock()
+
+	if n > len(r.tokens) {
+		n = len(r.tokens)
+	}
+	hash := r.hashfunc(SaltedKey(key, r.salts))
+	if r.zoneOf != nil {
+		candidates := r.tree.LookupNUniqueWrapped(len(r.tokens), hash)
+		return SpreadZones(candidates, n, r.zoneOf)
+	}
+	return r.tree.LookupNUniqueWrapped(n, hash)
+}
+
+// Tokens returns all the tokens on the ring in ascending order.
+func (r *FakeRing) Tokens() []Token {
+	var tokens []Token
+
+	r.RLock()
+	r.tree.Walk(func(val int64, str string) {
+		tokens = append(tokens, Token{Value: val, Server: str})
+	})
+	r.RUnlock()
+
+	return tokens
+}
+
+// Servers returns the servers on the ring sorted by address.
+func (r *FakeRing) Servers() []string {
+	r.RLock()
+	servers := make([]string, 0, len(r.tokens))
+	for server := range r.tokens {
+		servers = append(servers, server)
+	}
+	r.RUnlock()
+
+	sort.Strings(servers)
+	return servers
+}
+
+func (r *FakeRing) joinNoLock(address string, tokens []int64) bool {
+	if _, ok := r.tokens[address]; ok {
+		return false
+	}
+
+	if len(tokens) == 0 {
+		tokens = []int64{r.hashfunc(address)}
+	}
+
+	r.tokens[address] = nil
+	for _, token := range tokens {
+		r.assignNoLock(address, token)
+	}
+	return true
+}
+
+func (r *FakeRing) leaveNoLock(address string) bool {
+	tokens, ok := r.tokens[address]
+	if !ok {
+		return false
+	}
+
+	for _, token := range tokens {
+		r.tree.Delete(token)
+	}
+	delete(r.tokens, address)
+	return true
+}
+
+// assignNoLock gives the token to address, taking it from its previous owner.
+func (r *FakeRing) assignNoLock(address string, token int64) {
+	if owner, ok := r.tree.Search(token); ok {
+		r.tree.Delete(token)
+		r.tokens[owner] = removeToken(r.tokens[owner], token)
+	}
+
+	r.tree.Insert(token, address)
+	r.tokens[address] = append(r.tokens[address], token)
+}
+
+func (r *FakeRing) notify(added, removed []string) {
+	r.RLock()
+	listeners := r.listeners
+	r.RUnlock()
+
+	for _, fn := range listeners {
+		fn(added, removed)
+	}
+}
+
+func removeToken(tokens []int64, token int64) []int64 {
+	for i, t := range tokens {
+		if t == token {
+			return append(tokens[:i], tokens[i+1:]...)
+		}
+	}
+	return tokens
+}
+
+func TestFakeRingSetTokens(t *testing.T) {
+	ring := NewFakeRing(func([]byte) uint32 { return 0 })
+
+	var changes [][]string
+	ring.OnChange(func(added, removed []string) {
+		changes = append(changes, append(added, removed...))
+	})
+
+	ring.Join("a", 10)
+	ring.Join("b", 20)
+	ring.Join("c", 30)
+	if got := ring.LookupN("key", 2); !reflect.DeepEqual(got, []string{"a", "b"}) {
+		t.Fatalf("LookupN = %v, want [a b]", got)
+	}
+
+	zones := map[string]string{"a": "z1", "b": "z1", "c": "z2"}
+	ring.SetZoneFunc(func(server string) string { return zones[server] })
+	if got := ring.LookupN("key", 2); !reflect.DeepEqual(got, []string{"a", "c"}) {
+		t.Fatalf("LookupN with zones = %v, want [a c]", got)
+	}
+
+	if err := ring.SetTokens("c", 5); err != nil {
+		t.Fatal(err)
+	}
+	if owner, _ := ring.Lookup("key"); owner != "c" {
+		t.Fatalf("Lookup = %s after SetTokens, want c", owner)
+	}
+	if err := ring.SetTokens("d", 1); err == nil {
+		t.Fatal("SetTokens succeeded for a server not on the ring")
+	}
+
+	ring.Leave("c")
+	if got := ring.Servers(); !reflect.DeepEqual(got, []string{"a", "b"}) {
+		t.Fatalf("Servers = %v, want [a b]", got)
+	}
+	if len(changes) != 4 {
+		t.Fatalf("OnChange called %d times, want 4", len(changes))
+	}
+}
@@ -0,0 +1,23 @@
+package hashring
+
+// GroupByServer returns, for each server, the keys among the given ones that
+// it holds a replica of, as returned by lookup, such as the LookupN of a
+// ring. A batch read can then send a single request per server instead of
+// one per key. Keys keep their relative order within each group.
+func GroupByServer(keys []string, lookup func(key string) []string) map[string][]string {
+	groups := make(map[string][]string)
+	seen := make(map[string]bool)
+
+	for _, key := range keys {
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+
+		for _, server := range lookup(key) {
+			groups[server] = append(groups[server], key)
+		}
+	}
+
+	return groups
+}
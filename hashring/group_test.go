@@ -0,0 +1,76 @@
+package hashring
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/dgryski/go-farm"
+	"github.com/op/go-logging"
+)
+
+func TestGroupByServer(t *testing.T) {
+	ring := NewHashRing(farm.Fingerprint32, 8)
+	for i := 0; i < 6; i++ {
+		ring.AddServer(fmt.Sprintf("10.0.0.%d:7001", i))
+	}
+	lookup := func(key string) []string { return ring.LookupN(key, 3) }
+
+	keys := []string{"a", "b", "c", "a", "d"}
+	groups := GroupByServer(keys, lookup)
+
+	held := 0
+	for _, group := range groups {
+		held += len(group)
+	}
+	if held != 4*3 {
+		t.Fatalf("%d keys grouped, want each of the 4 distinct keys on its 3 replicas", held)
+	}
+	for _, key := range []string{"a", "b", "c", "d"} {
+		for _, server := range lookup(key) {
+			if !contains(groups[server], key) {
+				t.Errorf("key %s missing from the group of its replica %s", key, server)
+			}
+		}
+	}
+}
+
+func contains(keys []string, key string) bool {
+	for _, k := range keys {
+		if k == key {
+			return true
+		}
+	}
+	return false
+}
+
+// BenchmarkGroupByServer groups the keys of a multi-key read on 6 nodes with
+// 3 replicas per key, and reports the requests sent to the replicas with the
+// grouping, one per node, and without it, one per key and replica.
+func BenchmarkGroupByServer(b *testing.B) {
+	// LookupN logs every lookup at debug level.
+	defer logging.SetLevel(logging.GetLevel("hashring"), "hashring")
+	logging.SetLevel(logging.WARNING, "hashring")
+
+	ring := NewHashRing(farm.Fingerprint32, 8)
+	for i := 0; i < 6; i++ {
+		ring.AddServer(fmt.Sprintf("10.0.0.%d:7001", i))
+	}
+	lookup := func(key string) []string { return ring.LookupN(key, 3) }
+
+	for _, n := range []int{10, 100, 1000} {
+		keys := make([]string, n)
+		for i := range keys {
+			keys[i] = fmt.Sprintf("key-%d", i)
+		}
+
+		b.Run(fmt.Sprintf("keys=%d", n), func(b *testing.B) {
+			var groups map[string][]string
+			for i := 0; i < b.N; i++ {
+				groups = GroupByServer(keys, lookup)
+			}
+
+			b.ReportMetric(float64(len(groups)), "rpcs")
+			b.ReportMetric(float64(3*n), "ungrouped-rpcs")
+		})
+	}
+}
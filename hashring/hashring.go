@@ -9,28 +9,48 @@ import (
 
 var logger = logging.MustGetLogger("hashring")
 
+// Ring is a consistent hash ring mapping keys to servers.
+type Ring interface {
+	AddServer(address string) bool
+	RemoveServer(address string) bool
+	AddRemoveServers(add []string, remove []string) bool
+	Lookup(key string) (string, bool)
+	LookupN(key string, n int) []string
+	Tokens() []Token
+}
+
+var _ Ring = &HashRing{}
+
 // HashRing stores strings on a consistent hash ring. HashRing internally uses
 // a Red-Black Tree to achieve O(log N) lookup and insertion time.
+// Positions on the ring are the uint32 hashes of keys and virtual nodes. They
+// are held in an int64, never an int, so that they are ordered the same way
+// on 32-bit and 64-bit platforms and every node places keys identically.
 type HashRing struct {
 	sync.RWMutex
 
-	hashfunc      func(string) int
+	hashfunc      func(string) int64
 	replicaPoints int
 
-	serverSet map[string]struct{}
-	tree      *redBlackTree
+	serverSet   map[string]struct{}
+	tokenCounts map[string]int
+	tree        *redBlackTree
+	zoneOf      ZoneFunc
+	salts       map[string]string
+	ranged      bool
 }
 
 // NewHashRing instantiates and returns a new HashRing.
 func NewHashRing(hashfunc func([]byte) uint32, replicaPoints int) *HashRing {
 	r := &HashRing{
 		replicaPoints: replicaPoints,
-		hashfunc: func(str string) int {
-			return int(hashfunc([]byte(str)))
+		hashfunc: func(str string) int64 {
+			return int64(hashfunc([]byte(str)))
 		},
 	}
 
 	r.serverSet = make(map[string]struct{})
+	r.tokenCounts = make(map[string]int)
 	r.tree = &redBlackTree{}
 	return r
 }
@@ -55,7 +75,7 @@ func (r *HashRing) addServerNoLock(address string) bool {
 
 func (r *HashRing) addVirtualNodesNoLock(server string) {
 	r.serverSet[server] = struct{}{}
-	for i := 0; i < r.replicaPoints; i++ {
+	for i := 0; i < r.tokenCountNoLock(server); i++ {
 		address := fmt.Sprintf("%s%v", server, i)
 		key := r.hashfunc(address)
 		r.tree.Insert(key, server)
@@ -83,7 +103,7 @@ func (r *HashRing) removeServerNoLock(address string) bool {
 
 func (r *HashRing) removeVirtualNodesNoLock(server string) {
 	delete(r.serverSet, server)
-	for i := 0; i < r.replicaPoints; i++ {
+	for i := 0; i < r.tokenCountNoLock(server); i++ {
 		address := fmt.Sprintf("%s%v", server, i)
 		key := r.hashfunc(address)
 		r.tree.Delete(key)
@@ -118,12 +138,81 @@ func (r *HashRing) addRemoveServersNoLock(add []string, remove []string) bool {
 	return changed
 }
 
-func (r *HashRing) copyServersNoLock() []string {
-	var servers []string
+// HasServer returns whether the server is on the HashRing.
+func (r *HashRing) HasServer(address string) bool {
+	r.RLock()
+	_, ok := r.serverSet[address]
+	r.RUnlock()
+
+	return ok
+}
+
+// Clone returns a copy of the HashRing, which is not affected by the later
+// changes of the original, such as to compare placements across a change.
+func (r *HashRing) Clone() *HashRing {
+	r.RLock()
+	defer r.RUnlock()
+
+	c := &HashRing{
+		hashfunc:      r.hashfunc,
+		replicaPoints: r.replicaPoints,
+		serverSet:     make(map[string]struct{}, len(r.serverSet)),
+		tokenCounts:   make(map[string]int, len(r.tokenCounts)),
+		tree:          &redBlackTree{},
+		zoneOf:        r.zoneOf,
+		salts:         r.salts,
+		ranged:        r.ranged,
+	}
 	for server := range r.serverSet {
-		servers = append(servers, server)
+		c.serverSet[server] = struct{}{}
 	}
-	return servers
+	for server, n := range r.tokenCounts {
+		c.tokenCounts[server] = n
+	}
+	r.tree.Walk(func(val int64, str string) {
+		c.tree.Insert(val, str)
+	})
+
+	return c
+}
+
+// Token is a position on the HashRing owned by a server. Value is in the
+// uint32 range.
+type Token struct {
+	Value  int64
+	Server string
+}
+
+// Tokens returns all the tokens on the HashRing, including virtual nodes,
+// in ascending order.
+func (r *HashRing) Tokens() []Token {
+	var tokens []Token
+
+	r.RLock()
+	r.tree.Walk(func(val int64, str string) {
+		tokens = append(tokens, Token{Value: val, Server: str})
+	})
+	r.RUnlock()
+
+	return tokens
+}
+
+// SetZoneFunc makes LookupN spread the servers of a key across distinct
+// zones, as returned by zoneOf, when possible. A nil zoneOf restores the
+// plain clockwise placement.
+func (r *HashRing) SetZoneFunc(zoneOf ZoneFunc) {
+	r.Lock()
+	r.zoneOf = zoneOf
+	r.Unlock()
+}
+
+// SetBucketSalts sets the hash salt of each bucket. Keys are placed on the
+// ring by hashing their SaltedKey. Salts are ignored in range mode, where
+// keys are not hashed.
+func (r *HashRing) SetBucketSalts(salts map[string]string) {
+	r.Lock()
+	r.salts = salts
+	r.Unlock()
 }
 
 // Lookup returns the owner of the given key and whether the HashRing contains
@@ -138,9 +227,12 @@ func (r *HashRing) Lookup(key string) (string, bool) {
 	return strs[0], true
 }
 
-// LookupN returns the N servers that own the given key. Duplicates in the form
-// of virtual nodes are skipped to maintain a list of unique servers. If there
-// are less servers than N, we simply return all existing servers.
+// LookupN returns the N servers that own the given key, ordered clockwise from
+// the key's position on the ring so the first one is the owner. Duplicates in
+// the form of virtual nodes are skipped to maintain a list of unique servers.
+// If there are less servers than N, we simply return all existing servers.
+// With a zone function set, servers in zones not yet used are preferred
+// over the next ones on the ring.
 func (r *HashRing) LookupN(key string, n int) []string {
 	r.RLock()
 	servers := r.lookupNNoLock(key, n)
@@ -151,21 +243,26 @@ func (r *HashRing) LookupN(key string, n int) []string {
 }
 
 func (r *HashRing) lookupNNoLock(key string, n int) []string {
-	if n >= len(r.serverSet) {
-		return r.copyServersNoLock()
-	}
+	return r.lookupNAtNoLock(r.positionNoLock(key), n)
+}
 
-	hash := r.hashfunc(key)
-	unique := make(map[string]struct{})
+// positionNoLock returns the position of the given key on the ring.
+func (r *HashRing) positionNoLock(key string) int64 {
+	if r.ranged {
+		return int64(RangePosition(key))
+	}
+	return r.hashfunc(SaltedKey(key, r.salts))
+}
 
-	r.tree.LookupNUniqueAt(n, hash, unique)
-	if len(unique) < n {
-		r.tree.LookupNUniqueAt(n, 0, unique)
+func (r *HashRing) lookupNAtNoLock(position int64, n int) []string {
+	if n > len(r.serverSet) {
+		n = len(r.serverSet)
 	}
 
-	var servers []string
-	for server := range unique {
-		servers = append(servers, server)
+	if r.zoneOf != nil {
+		candidates := r.tree.LookupNUniqueWrapped(len(r.serverSet), position)
+		return SpreadZones(candidates, n, r.zoneOf)
 	}
-	return servers
+
+	return r.tree.LookupNUniqueWrapped(n, position)
 }
@@ -0,0 +1,53 @@
+package hashring
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/dgryski/go-farm"
+)
+
+func TestHashRingHighPositions(t *testing.T) {
+	positions := map[string]uint32{
+		"a0":   0x10,
+		"b0":   0x90000000,
+		"high": 0x80000000,
+		"top":  0xf0000000,
+		"low":  0x08,
+	}
+	ring := NewHashRing(func(b []byte) uint32 { return positions[string(b)] }, 1)
+	ring.AddServer("a")
+	ring.AddServer("b")
+
+	// Positions of 2^31 and above must sort after the others, as they do as
+	// uint32, whatever the size of int.
+	tests := map[string]string{"low": "a", "high": "b", "top": "a"}
+	for key, want := range tests {
+		if got, _ := ring.Lookup(key); got != want {
+			t.Errorf("Lookup(%s) = %s, want %s", key, got, want)
+		}
+	}
+
+	tokens := ring.Tokens()
+	if len(tokens) != 2 || tokens[0].Server != "a" || tokens[1].Value != 0x90000000 {
+		t.Fatalf("Tokens = %v, want a at 0x10 then b at 0x90000000", tokens)
+	}
+}
+
+func TestHashRingStablePlacement(t *testing.T) {
+	ring := NewHashRing(farm.Fingerprint32, 8)
+	for i := 0; i < 6; i++ {
+		ring.AddServer(fmt.Sprintf("10.0.0.%d:7001", i))
+	}
+
+	// The placement of these keys was recorded once. Every platform must
+	// place them the same way, or nodes would disagree on replicas.
+	h := farm.Fingerprint64(nil)
+	for i := 0; i < 200; i++ {
+		key := fmt.Sprintf("key-%d", i)
+		h = farm.Fingerprint64([]byte(fmt.Sprintf("%x%s%v", h, key, ring.LookupN(key, 3))))
+	}
+	if want := uint64(0x36f7fd38acc8f03d); h != want {
+		t.Fatalf("placement digest = %#x, want %#x", h, want)
+	}
+}
@@ -0,0 +1,93 @@
+package hashring
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+// Partitioning strategies, which decide how keys are placed on the ring.
+const (
+	// HashPartitioning places keys by hashing them, which scatters keys with
+	// a common prefix across the whole ring.
+	HashPartitioning = "hash"
+	// RangePartitioning places keys in lexicographic order, so that each node
+	// owns contiguous key ranges.
+	RangePartitioning = "range"
+)
+
+// ErrUnknownPartitioning is returned for a partitioning strategy that is
+// neither hash nor range.
+var ErrUnknownPartitioning = errors.New("unknown partitioning strategy")
+
+// NewRing instantiates a HashRing with the given partitioning strategy. The
+// hash function always places the virtual nodes; in range mode keys are
+// placed with RangePosition instead.
+func NewRing(strategy string, hashfunc func([]byte) uint32, replicaPoints int) (*HashRing, error) {
+	r := NewHashRing(hashfunc, replicaPoints)
+
+	switch strategy {
+	case HashPartitioning, "":
+	case RangePartitioning:
+		r.ranged = true
+	default:
+		return nil, ErrUnknownPartitioning
+	}
+
+	return r, nil
+}
+
+// RangePosition returns the position of the key on the ring in range mode:
+// its first four bytes, read as a big-endian number and padded with zeros.
+// Key order is preserved, so keys sharing a prefix are adjacent on the ring.
+func RangePosition(key string) uint32 {
+	var buf [4]byte
+	copy(buf[:], key)
+	return binary.BigEndian.Uint32(buf[:])
+}
+
+// rangeEnd returns the last position of the keys with the given prefix.
+func rangeEnd(prefix string) uint32 {
+	buf := [4]byte{0xff, 0xff, 0xff, 0xff}
+	copy(buf[:], prefix)
+	return binary.BigEndian.Uint32(buf[:])
+}
+
+// PrefixServers returns the servers holding one of the n replicas of any key
+// with the given prefix. In range mode, this is only the owners of the few
+// ranges spanned by the prefix; in hash mode, every server.
+func (r *HashRing) PrefixServers(prefix string, n int) []string {
+	r.RLock()
+	defer r.RUnlock()
+
+	if !r.ranged {
+		servers := make([]string, 0, len(r.serverSet))
+		for server := range r.serverSet {
+			servers = append(servers, server)
+		}
+		return servers
+	}
+
+	start, end := int64(RangePosition(prefix)), int64(rangeEnd(prefix))
+
+	// Each range spanned by the prefix starts at the prefix itself or right
+	// after a token between the start and the end of the prefix.
+	positions := []int64{start}
+	r.tree.Walk(func(val int64, str string) {
+		if val >= start && val < end {
+			positions = append(positions, val+1)
+		}
+	})
+
+	var servers []string
+	seen := make(map[string]bool)
+	for _, position := range positions {
+		for _, server := range r.lookupNAtNoLock(position, n) {
+			if !seen[server] {
+				seen[server] = true
+				servers = append(servers, server)
+			}
+		}
+	}
+
+	return servers
+}
@@ -8,7 +8,7 @@ type redBlackTree struct {
 
 // redBlackNode is a node of the redBlackTree
 type redBlackNode struct {
-	val   int
+	val   int64
 	str   string
 	left  *redBlackNode
 	right *redBlackNode
@@ -60,7 +60,7 @@ func doubleRotate(root *redBlackNode, dir bool) *redBlackNode {
 
 // Insert inserts a value and string into the tree
 // Returns true on succesful insertion, false if duplicate exists
-func (t *redBlackTree) Insert(val int, str string) (ret bool) {
+func (t *redBlackTree) Insert(val int64, str string) (ret bool) {
 	if t.root == nil {
 		t.root = &redBlackNode{val: val, str: str}
 		ret = true
@@ -134,7 +134,7 @@ func (t *redBlackTree) Insert(val int, str string) (ret bool) {
 
 // Delete removes a value from the redBlackTree
 // Returns true on succesful deletion, false if val is not in tree
-func (t *redBlackTree) Delete(val int) bool {
+func (t *redBlackTree) Delete(val int64) bool {
 	if t.root == nil {
 		return false
 	}
@@ -214,7 +214,7 @@ func (t *redBlackTree) Delete(val int) bool {
 	return found != nil
 }
 
-func (n *redBlackNode) search(val int) (string, bool) {
+func (n *redBlackNode) search(val int64) (string, bool) {
 	if n.val == val {
 		return n.str, true
 	} else if val < n.val {
@@ -229,30 +229,60 @@ func (n *redBlackNode) search(val int) (string, bool) {
 
 // Search searches for a value in the redBlackTree, returns the string and true
 // if found or the empty string and false if val is not in the tree.
-func (t *redBlackTree) Search(val int) (string, bool) {
+func (t *redBlackTree) Search(val int64) (string, bool) {
 	if t.root == nil {
 		return "", false
 	}
 	return t.root.search(val)
 }
 
+// Walk visits every node of the redBlackTree in ascending order of value.
+func (t *redBlackTree) Walk(fn func(val int64, str string)) {
+	walkInOrder(t.root, fn)
+}
+
+func walkInOrder(node *redBlackNode, fn func(val int64, str string)) {
+	if node == nil {
+		return
+	}
+
+	walkInOrder(node.left, fn)
+	fn(node.val, node.str)
+	walkInOrder(node.right, fn)
+}
+
 // LookupNAt iterates through the tree from the node with value val, and
-// returns the next n unique strings. This function is not guaranteed to
+// returns the next n unique strings. Newly found strings are appended to
+// ordered in ascending order of value. This function is not guaranteed to
 // return n strings.
-func (t *redBlackTree) LookupNUniqueAt(n int, val int, result map[string]struct{}) {
-	findNUniqueAbove(t.root, n, val, result)
+func (t *redBlackTree) LookupNUniqueAt(n int, val int64, result map[string]struct{}, ordered *[]string) {
+	findNUniqueAbove(t.root, n, val, result, ordered)
+}
+
+// LookupNUniqueWrapped returns the next n unique strings clockwise from val,
+// wrapping around to the smallest value when the end of the tree is reached.
+func (t *redBlackTree) LookupNUniqueWrapped(n int, val int64) []string {
+	unique := make(map[string]struct{})
+
+	var result []string
+	t.LookupNUniqueAt(n, val, unique, &result)
+	if len(unique) < n {
+		t.LookupNUniqueAt(n, 0, unique, &result)
+	}
+
+	return result
 }
 
 // findNUniqueAbove is a recursive search that finds n unique strings
 // with a value bigger or equal than val
-func findNUniqueAbove(node *redBlackNode, n int, val int, result map[string]struct{}) {
+func findNUniqueAbove(node *redBlackNode, n int, val int64, result map[string]struct{}, ordered *[]string) {
 	if len(result) >= n || node == nil {
 		return
 	}
 
 	// skip left branch when all its values are smaller than val
 	if node.val >= val {
-		findNUniqueAbove(node.left, n, val, result)
+		findNUniqueAbove(node.left, n, val, result, ordered)
 	}
 
 	// Make sure to stop when we have n unique strings
@@ -261,8 +291,11 @@ func findNUniqueAbove(node *redBlackNode, n int, val int, result map[string]stru
 	}
 
 	if node.val >= val {
-		result[node.str] = struct{}{}
+		if _, ok := result[node.str]; !ok {
+			result[node.str] = struct{}{}
+			*ordered = append(*ordered, node.str)
+		}
 	}
 
-	findNUniqueAbove(node.right, n, val, result)
+	findNUniqueAbove(node.right, n, val, result, ordered)
 }
@@ -0,0 +1,26 @@
+package hashring
+
+import (
+	"strings"
+)
+
+// BucketSeparator separates the bucket from the rest of a key, as in
+// "bucket:key".
+const BucketSeparator = ":"
+
+// SaltedKey returns the string hashed to place the given key on the ring.
+// Keys of a bucket with a salt are prefixed with it, so that each bucket is
+// spread across the ring independently of the others. Keys without a bucket,
+// or of a bucket without salt, are hashed as is.
+func SaltedKey(key string, salts map[string]string) string {
+	i := strings.Index(key, BucketSeparator)
+	if i < 0 {
+		return key
+	}
+
+	salt, ok := salts[key[:i]]
+	if !ok || salt == "" {
+		return key
+	}
+	return salt + BucketSeparator + key
+}
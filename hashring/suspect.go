@@ -0,0 +1,44 @@
+package hashring
+
+import "math"
+
+// SuspectFunc returns whether a server is suspected to have failed.
+type SuspectFunc func(server string) bool
+
+// LookupNHealthy returns the N servers to use as replicas of the given key,
+// in ring order. Suspect servers among the N owners are skipped in favour of
+// the next servers on the ring, and returned apart as skipped: they still
+// own the key, so the writes meant for them can be handed off once they
+// recover. Suspect servers fill the remaining slots if there are not enough
+// other servers.
+func LookupNHealthy(r Ring, key string, n int, suspect SuspectFunc) (replicas, skipped []string) {
+	owners := r.LookupN(key, n)
+
+	for _, owner := range owners {
+		if suspect(owner) {
+			skipped = append(skipped, owner)
+		}
+	}
+	if len(skipped) == 0 {
+		return owners, nil
+	}
+
+	replicas = make([]string, 0, len(owners))
+	for _, server := range r.LookupN(key, math.MaxInt32) {
+		if len(replicas) == len(owners) {
+			break
+		}
+		if !suspect(server) {
+			replicas = append(replicas, server)
+		}
+	}
+
+	for _, owner := range skipped {
+		if len(replicas) == len(owners) {
+			break
+		}
+		replicas = append(replicas, owner)
+	}
+
+	return replicas, skipped
+}
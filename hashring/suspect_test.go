@@ -0,0 +1,35 @@
+package hashring
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestLookupNHealthy(t *testing.T) {
+	ring := NewFakeRing(func([]byte) uint32 { return 0 })
+	ring.Join("a", 10)
+	ring.Join("b", 20)
+	ring.Join("c", 30)
+	ring.Join("d", 40)
+
+	suspects := map[string]bool{}
+	suspect := func(server string) bool { return suspects[server] }
+
+	replicas, skipped := LookupNHealthy(ring, "key", 2, suspect)
+	if !reflect.DeepEqual(replicas, []string{"a", "b"}) || skipped != nil {
+		t.Fatalf("LookupNHealthy = %v, %v, want [a b], []", replicas, skipped)
+	}
+
+	suspects["b"] = true
+	replicas, skipped = LookupNHealthy(ring, "key", 2, suspect)
+	if !reflect.DeepEqual(replicas, []string{"a", "c"}) || !reflect.DeepEqual(skipped, []string{"b"}) {
+		t.Fatalf("LookupNHealthy = %v, %v, want [a c], [b]", replicas, skipped)
+	}
+
+	// Suspect owners fill the slots left when too few servers are healthy.
+	suspects["c"], suspects["d"] = true, true
+	replicas, skipped = LookupNHealthy(ring, "key", 2, suspect)
+	if !reflect.DeepEqual(replicas, []string{"a", "b"}) || !reflect.DeepEqual(skipped, []string{"b"}) {
+		t.Fatalf("LookupNHealthy = %v, %v, want [a b], [b]", replicas, skipped)
+	}
+}
@@ -0,0 +1,72 @@
+package hashring
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// TokensTag is the member tag through which a node announces its token
+// count when it differs from the configured number of virtual nodes.
+const TokensTag = "tokens"
+
+// TokenCountFromTags returns the token count announced in the given member
+// tags, or def if there is none or it is invalid.
+func TokenCountFromTags(tags map[string]string, def int) int {
+	n, err := strconv.Atoi(tags[TokensTag])
+	if err != nil || n < 1 {
+		return def
+	}
+	return n
+}
+
+// TokenCount returns the number of tokens, virtual nodes included, owned by
+// the given server or that it would own once added.
+func (r *HashRing) TokenCount(address string) int {
+	r.RLock()
+	n := r.tokenCountNoLock(address)
+	r.RUnlock()
+
+	return n
+}
+
+func (r *HashRing) tokenCountNoLock(address string) int {
+	if n, ok := r.tokenCounts[address]; ok {
+		return n
+	}
+	return r.replicaPoints
+}
+
+// SetTokenCount changes the number of tokens of the given server, which
+// changes its share of the ring, and returns whether the ring has changed.
+// Tokens are derived from the server address and their index, so growing or
+// shrinking the count only adds or removes the last tokens, and only the
+// ranges they cover change owner. The count of a server not on the ring is
+// kept for when it is added.
+func (r *HashRing) SetTokenCount(address string, n int) (bool, error) {
+	if n < 1 {
+		return false, fmt.Errorf("invalid token count %d", n)
+	}
+
+	r.Lock()
+	defer r.Unlock()
+
+	if r.tokenCountNoLock(address) == n {
+		return false, nil
+	}
+
+	_, onRing := r.serverSet[address]
+	if onRing {
+		r.removeVirtualNodesNoLock(address)
+	}
+	if n == r.replicaPoints {
+		delete(r.tokenCounts, address)
+	} else {
+		r.tokenCounts[address] = n
+	}
+	if onRing {
+		r.addVirtualNodesNoLock(address)
+		logger.Noticef("Server %s now has %d tokens", address, n)
+	}
+
+	return onRing, nil
+}
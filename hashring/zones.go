@@ -0,0 +1,60 @@
+package hashring
+
+// ZoneTag is the member tag through which a node announces its zone.
+const ZoneTag = "zone"
+
+// ZoneFunc returns the zone of a server, or an empty string if unknown.
+type ZoneFunc func(server string) string
+
+// ZoneFromTags returns a ZoneFunc reading the zone of a server from the
+// member tags returned by tagsOf. Servers without a zone tag are all in the
+// same unknown zone.
+func ZoneFromTags(tagsOf func(server string) (map[string]string, bool)) ZoneFunc {
+	return func(server string) string {
+		tags, _ := tagsOf(server)
+		return tags[ZoneTag]
+	}
+}
+
+// SpreadZones picks n servers from candidates, given in ring order from the
+// key's position, so that they span as many zones as possible. The first
+// server of each zone is picked first, then the remaining ones in ring
+// order when there are fewer zones than n. The owner stays first. It is the
+// placement of LookupN with a zone function, for those holding a copy of
+// the ring such as clients.
+func SpreadZones(candidates []string, n int, zoneOf ZoneFunc) []string {
+	if n > len(candidates) {
+		n = len(candidates)
+	}
+
+	servers := make([]string, 0, n)
+	picked := make(map[string]bool)
+	zones := make(map[string]bool)
+
+	for _, server := range candidates {
+		if len(servers) == n {
+			return servers
+		}
+
+		zone := zoneOf(server)
+		if zones[zone] {
+			continue
+		}
+
+		zones[zone] = true
+		picked[server] = true
+		servers = append(servers, server)
+	}
+
+	for _, server := range candidates {
+		if len(servers) == n {
+			break
+		}
+
+		if !picked[server] {
+			servers = append(servers, server)
+		}
+	}
+
+	return servers
+}
@@ -0,0 +1,47 @@
+package hashring
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/dgryski/go-farm"
+)
+
+func TestLookupNSpreadsZoneTags(t *testing.T) {
+	tags := map[string]map[string]string{
+		"a:1": {ZoneTag: "z1"},
+		"b:1": {ZoneTag: "z1"},
+		"c:1": {ZoneTag: "z1"},
+		"d:1": {ZoneTag: "z2"},
+		"e:1": {},
+	}
+
+	ring := NewHashRing(farm.Fingerprint32, 8)
+	for server := range tags {
+		ring.AddServer(server)
+	}
+	ring.SetZoneFunc(ZoneFromTags(func(server string) (map[string]string, bool) {
+		t, ok := tags[server]
+		return t, ok
+	}))
+
+	for i := 0; i < 200; i++ {
+		key := fmt.Sprintf("key%d", i)
+		replicas := ring.LookupN(key, 3)
+		if len(replicas) != 3 {
+			t.Fatalf("LookupN(%s) = %v", key, replicas)
+		}
+
+		zones := make(map[string]bool)
+		for _, server := range replicas {
+			zones[tags[server][ZoneTag]] = true
+		}
+		if len(zones) != 3 {
+			t.Fatalf("LookupN(%s) = %v, not spread over the 3 zones", key, replicas)
+		}
+
+		if owner, _ := ring.Lookup(key); owner != replicas[0] {
+			t.Fatalf("LookupN(%s) = %v, owner %s not first", key, replicas, owner)
+		}
+	}
+}
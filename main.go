@@ -2,14 +2,19 @@ package main
 
 import (
 	"flag"
+	"fmt"
 	"io/ioutil"
+	"net"
 	"os"
+	"os/signal"
 	"strings"
 	"swimring/swimring"
+	"swimring/util"
+	"syscall"
+	"time"
 
 	"gopkg.in/yaml.v2"
 
-	"github.com/hungys/swimring/util"
 	"github.com/op/go-logging"
 )
 
@@ -20,8 +25,8 @@ func main() {
 	var localIPAddr string
 
 	initializeLogger()
-	localIPAddr = util.GetLocalIP()
 	config := loadConfig()
+	localIPAddr = config.AdvertiseAddress
 
 	flag.IntVar(&externalPort, "export", config.ExternalPort, "port number for external request")
 	flag.IntVar(&internalPort, "inport", config.InternalPort, "port number for internal protocal communication")
@@ -31,15 +36,57 @@ func main() {
 	config.ExternalPort = externalPort
 	config.InternalPort = internalPort
 
+	configureLogger(config, fmt.Sprintf("%s:%d", localIPAddr, internalPort))
+
+	if err := validateAdvertiseAddress(config); err != nil {
+		logger.Fatal(err.Error())
+	}
+	if err := validateRepairWriteLevel(config); err != nil {
+		logger.Fatal(err.Error())
+	}
+
+	logger.Infof("Version: %s", util.LocalVersion())
 	logger.Infof("IP address: %s", localIPAddr)
+	logger.Infof("Bind address: %s", config.BindAddress)
 	logger.Infof("External port: %d", config.ExternalPort)
 	logger.Infof("Internal port: %d", config.InternalPort)
 	logger.Infof("Bootsrap nodes: %v", config.BootstrapNodes)
 
 	swimring := swimring.NewSwimRing(config)
-	swimring.Bootstrap()
+	if _, err := swimring.Bootstrap(); err != nil {
+		// The cause is logged by Bootstrap, such as a duplicate address.
+		os.Exit(1)
+	}
 
-	select {}
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	sig := <-signals
+
+	// Leave the ring gracefully: flush the commit log, stream the pending
+	// hints and announce the departure, for at most ShutdownTimeout. A
+	// second signal exits right away.
+	timeout := time.Duration(config.ShutdownTimeout) * time.Millisecond
+	logger.Noticef("Received %s, leaving the ring within %s", sig, timeout)
+
+	done := make(chan error, 1)
+	go func() {
+		done <- swimring.Leave()
+	}()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			logger.Warningf("Cannot leave the ring gracefully: %s", err.Error())
+			os.Exit(1)
+		}
+		logger.Notice("Left the ring")
+	case <-time.After(timeout):
+		logger.Warning("Shutdown timeout elapsed, exiting")
+		os.Exit(1)
+	case sig = <-signals:
+		logger.Warningf("Received %s again, exiting", sig)
+		os.Exit(1)
+	}
 }
 
 func initializeLogger() {
@@ -52,22 +99,91 @@ func initializeLogger() {
 	logging.SetBackend(backendFormatter)
 }
 
+// configureLogger switches the logger to the format and minimum level
+// given in the configuration.
+func configureLogger(config *swimring.Configuration, node string) {
+	var formatter logging.Formatter
+	switch strings.ToLower(config.LogFormat) {
+	case "json":
+		formatter = &util.JSONFormatter{Node: node}
+	case "text", "":
+		formatter = logging.MustStringFormatter(
+			`%{color}%{time:15:04:05.000} %{shortpkg} ▶ %{level:.4s}%{color:reset} %{message}`,
+		)
+	default:
+		logger.Warningf("Unknown log format %s", config.LogFormat)
+		return
+	}
+
+	level, err := logging.LogLevel(config.LogLevel)
+	if err != nil {
+		logger.Warningf("Unknown log level %s", config.LogLevel)
+		level = logging.INFO
+	}
+
+	backend := logging.NewLogBackend(os.Stderr, "", 0)
+	leveled := logging.AddModuleLevel(logging.NewBackendFormatter(backend, formatter))
+	leveled.SetLevel(level, "")
+	logging.SetBackend(leveled)
+}
+
 func loadConfig() *swimring.Configuration {
 	logger.Info("Loading configurations from config.yml")
 
 	config := &swimring.Configuration{
-		Host:               "0.0.0.0",
-		ExternalPort:       7000,
-		InternalPort:       7001,
-		JoinTimeout:        1000,
-		SuspectTimeout:     5000,
-		PingTimeout:        1500,
-		PingRequestTimeout: 5000,
-		MinProtocolPeriod:  200,
-		PingRequestSize:    3,
-		VirtualNodeSize:    5,
-		KVSReplicaPoints:   3,
-		BootstrapNodes:     []string{},
+		Host:                  "0.0.0.0",
+		BindAddress:           "0.0.0.0",
+		AdvertiseAddress:      "",
+		ExternalPort:          7000,
+		InternalPort:          7001,
+		JoinTimeout:           1000,
+		SuspectTimeout:        5000,
+		PingTimeout:           1500,
+		PingRequestTimeout:    5000,
+		MinProtocolPeriod:     200,
+		PingRequestSize:       3,
+		GossipFanout:          1,
+		GossipBatchSize:       0,
+		GossipCompression:     false,
+		VirtualNodeSize:       5,
+		KVSReplicaPoints:      3,
+		PartitionStrategy:     "hash",
+		MaxVersionsPerKey:     1,
+		MaxMigrationTransfers: 2,
+		AllowLocalAck:         false,
+		ExpirySweepInterval:   60000,
+		CompactionInterval:    300000,
+		VersionGracePeriod:    3600000,
+		StorageBackend:        "memory",
+		LogFormat:             "text",
+		LogLevel:              "INFO",
+		BootstrapNodes:        []string{},
+		Tags:                  map[string]string{},
+		BucketSalts:           map[string]string{},
+
+		RepairMaxRequestsPerSec: 0,
+		RepairMaxInFlight:       0,
+
+		ClusterName:    "",
+		RemoteClusters: map[string][]string{},
+		MaxMemoryBytes: 0,
+		MetricsPort:    0,
+
+		SkipSuspectReplicas: false,
+		MaxClockEntries:     0,
+
+		ReadCacheTTL:  0,
+		ReadCacheSize: 0,
+
+		ShutdownTimeout: 30000,
+
+		RepairWriteLevel:   "QUORUM",
+		ReadRepairInterval: 1000,
+
+		ReplicaWriteConcurrency: 0,
+
+		KeyFilterFalsePositiveRate: 0,
+		KeyFilterRefreshInterval:   0,
 	}
 
 	data, err := ioutil.ReadFile("config.yml")
@@ -80,11 +196,48 @@ func loadConfig() *swimring.Configuration {
 		logger.Error("Fail to unmarshal config.yml")
 	}
 
+	if config.AdvertiseAddress == "" {
+		config.AdvertiseAddress = util.GetLocalIP()
+	}
+
 	for i, addr := range config.BootstrapNodes {
 		if strings.HasPrefix(addr, ":") {
-			config.BootstrapNodes[i] = util.GetLocalIP() + addr
+			config.BootstrapNodes[i] = config.AdvertiseAddress + addr
 		}
 	}
 
 	return config
 }
+
+// validateAdvertiseAddress checks that the other nodes can reach the
+// advertised address: a loopback address is refused as soon as a bootstrap
+// node is on another host.
+func validateAdvertiseAddress(config *swimring.Configuration) error {
+	if !util.IsLoopback(config.AdvertiseAddress) {
+		return nil
+	}
+
+	for _, addr := range config.BootstrapNodes {
+		host, _, err := net.SplitHostPort(addr)
+		if err != nil || !util.IsLoopback(host) {
+			return fmt.Errorf("advertise address %s is loopback, but bootstrap node %s is not",
+				config.AdvertiseAddress, addr)
+		}
+	}
+
+	return nil
+}
+
+// validateRepairWriteLevel checks the level at which anti-entropy writes
+// reconciled values. Only levels acknowledged by replicas are accepted, so
+// that a repair survives the failure of the replica it landed on.
+func validateRepairWriteLevel(config *swimring.Configuration) error {
+	config.RepairWriteLevel = strings.ToUpper(config.RepairWriteLevel)
+
+	switch config.RepairWriteLevel {
+	case "ONE", "QUORUM", "ALL":
+		return nil
+	}
+
+	return fmt.Errorf("invalid repair write level %s: must be ONE, QUORUM or ALL", config.RepairWriteLevel)
+}
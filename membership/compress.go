@@ -0,0 +1,59 @@
+package membership
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/gob"
+)
+
+// minCompressedChanges is the smallest batch of changes worth compressing;
+// smaller ones would barely shrink, if at all.
+const minCompressedChanges = 8
+
+// packChanges returns the changes to send in a gossip message, either as is
+// or, with compression enabled and enough of them, gob-encoded and gzipped.
+func (n *Node) packChanges(changes []Change) ([]Change, []byte) {
+	if !n.gossipCompression || len(changes) < minCompressedChanges {
+		return changes, nil
+	}
+
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	if err := gob.NewEncoder(w).Encode(changes); err != nil {
+		return changes, nil
+	}
+	if err := w.Close(); err != nil {
+		return changes, nil
+	}
+
+	return nil, buf.Bytes()
+}
+
+// unpackChanges returns the changes of a gossip message, decompressing them
+// if needed, without the claims of another node on the local address.
+// Compressed changes are always accepted, whether compression is enabled
+// locally or not.
+func (n *Node) unpackChanges(changes []Change, compressed []byte) []Change {
+	return n.dropDuplicateClaims(n.decompressChanges(changes, compressed))
+}
+
+func (n *Node) decompressChanges(changes []Change, compressed []byte) []Change {
+	if len(compressed) == 0 {
+		return changes
+	}
+
+	r, err := gzip.NewReader(bytes.NewReader(compressed))
+	if err != nil {
+		logger.Warningf("Cannot decompress gossip changes: %s", err.Error())
+		return changes
+	}
+	defer r.Close()
+
+	var unpacked []Change
+	if err := gob.NewDecoder(r).Decode(&unpacked); err != nil {
+		logger.Warningf("Cannot decode gossip changes: %s", err.Error())
+		return changes
+	}
+
+	return append(changes, unpacked...)
+}
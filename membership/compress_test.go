@@ -0,0 +1,70 @@
+package membership
+
+import (
+	"bytes"
+	"encoding/gob"
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+// testChanges returns n changes announcing the members of a cluster alive,
+// as gossiped while it forms.
+func testChanges(n int) []Change {
+	changes := make([]Change, n)
+	for i := range changes {
+		address := fmt.Sprintf("10.0.%d.%d:7001", i/256, i%256)
+		changes[i] = Change{
+			Source:            address,
+			SourceIncarnation: 1602844800000,
+			Address:           address,
+			Incarnation:       1602844800000,
+			Status:            Alive,
+		}
+	}
+	return changes
+}
+
+func TestCompressedChangesRoundTrip(t *testing.T) {
+	node := &Node{gossipCompression: true}
+	changes := testChanges(minCompressedChanges)
+
+	plain, compressed := node.packChanges(changes)
+	if plain != nil || len(compressed) == 0 {
+		t.Fatalf("%d changes not compressed", len(changes))
+	}
+	if got := node.decompressChanges(plain, compressed); !reflect.DeepEqual(got, changes) {
+		t.Fatalf("decompressed changes %v, want %v", got, changes)
+	}
+
+	plain, compressed = node.packChanges(changes[:minCompressedChanges-1])
+	if compressed != nil || len(plain) != minCompressedChanges-1 {
+		t.Fatal("small batch of changes compressed")
+	}
+}
+
+// BenchmarkGossipBandwidth reports the size of a ping carrying a batch of
+// changes, as sent on the wire, with and without compression.
+func BenchmarkGossipBandwidth(b *testing.B) {
+	for _, n := range []int{10, 100, 300} {
+		for _, compression := range []bool{false, true} {
+			b.Run(fmt.Sprintf("changes=%d/compression=%t", n, compression), func(b *testing.B) {
+				node := &Node{gossipCompression: compression}
+				changes := testChanges(n)
+
+				var buf bytes.Buffer
+				for i := 0; i < b.N; i++ {
+					ping := &Ping{Source: "10.0.0.0:7001"}
+					ping.Changes, ping.CompressedChanges = node.packChanges(changes)
+
+					buf.Reset()
+					if err := gob.NewEncoder(&buf).Encode(ping); err != nil {
+						b.Fatal(err)
+					}
+				}
+
+				b.ReportMetric(float64(buf.Len()), "bytes/msg")
+			})
+		}
+	}
+}
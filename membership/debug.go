@@ -0,0 +1,105 @@
+package membership
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// MemberDebug is the raw state of a member as seen by the local node.
+type MemberDebug struct {
+	Address     string
+	Status      string
+	Incarnation int64
+	Tags        map[string]string
+	// LastHeard is when the local node last exchanged a message with the
+	// member, zero if it never did.
+	LastHeard time.Time
+	// SuspectDeadline is when the member is marked faulty unless it refutes
+	// the suspicion, zero if no suspect timer is running.
+	SuspectDeadline time.Time
+}
+
+// GossipDebug is the raw membership view of the local node, exposing the
+// protocol internals behind the summarized membership.
+type GossipDebug struct {
+	Address     string
+	Incarnation int64
+	Checksum    uint32
+	// PendingChanges is the number of changes still being disseminated.
+	PendingChanges int
+	Members        []MemberDebug
+}
+
+// lastHeard records when the local node last exchanged a message with each
+// member.
+type lastHeard struct {
+	sync.Mutex
+	at map[string]time.Time
+}
+
+func newLastHeard() *lastHeard {
+	return &lastHeard{
+		at: make(map[string]time.Time),
+	}
+}
+
+func (h *lastHeard) record(address string) {
+	h.Lock()
+	h.at[address] = time.Now()
+	h.Unlock()
+}
+
+func (h *lastHeard) get(address string) time.Time {
+	h.Lock()
+	at := h.at[address]
+	h.Unlock()
+
+	return at
+}
+
+// suspectDeadlines returns when each suspect timer running expires, by
+// member address.
+func (s *stateTransitions) suspectDeadlines() map[string]time.Time {
+	s.Lock()
+	defer s.Unlock()
+
+	deadlines := make(map[string]time.Time)
+	for address, timer := range s.timers {
+		if timer.state == Suspect {
+			deadlines[address] = timer.deadline
+		}
+	}
+
+	return deadlines
+}
+
+// GossipDebug returns the raw membership view of the node, sorted by
+// address, for debugging flapping or split membership.
+func (n *Node) GossipDebug() GossipDebug {
+	deadlines := n.stateTransitions.suspectDeadlines()
+
+	debug := GossipDebug{
+		Address:        n.Address(),
+		Incarnation:    n.Incarnation(),
+		Checksum:       n.memberlist.Checksum(),
+		PendingChanges: n.disseminator.NumChanges(),
+	}
+
+	for _, member := range n.memberlist.Members() {
+		debug.Members = append(debug.Members, MemberDebug{
+			Address:         member.Address,
+			Status:          member.Status,
+			Incarnation:     member.Incarnation,
+			Tags:            member.Tags,
+			LastHeard:       n.lastHeard.get(member.Address),
+			SuspectDeadline: deadlines[member.Address],
+		})
+	}
+
+	sort.Slice(debug.Members, func(i, j int) bool {
+		return debug.Members[i].Address < debug.Members[j].Address
+	})
+
+	return debug
+}
@@ -1,6 +1,9 @@
 package membership
 
-import "sync"
+import (
+	"sort"
+	"sync"
+)
 
 const defaultPFactor int = 15
 
@@ -42,6 +45,7 @@ func (d *disseminator) MembershipAsChanges() (changes []Change) {
 			Source:            d.node.Address(),
 			SourceIncarnation: d.node.Incarnation(),
 			Status:            member.Status,
+			Tags:              member.Tags,
 		})
 	}
 
@@ -104,11 +108,25 @@ func (d *disseminator) bumpPiggybackCounters(changes []Change) {
 	d.Unlock()
 }
 
+// issueChanges returns the recorded changes, or the least disseminated ones
+// when there are more than the gossip batch size.
 func (d *disseminator) issueChanges() []Change {
 	d.Lock()
 
-	result := []Change{}
+	pending := make([]*pChange, 0, len(d.changes))
 	for _, change := range d.changes {
+		pending = append(pending, change)
+	}
+
+	if size := d.node.gossipBatchSize; size > 0 && len(pending) > size {
+		sort.Slice(pending, func(i, j int) bool {
+			return pending[i].p < pending[j].p
+		})
+		pending = pending[:size]
+	}
+
+	result := []Change{}
+	for _, change := range pending {
 		result = append(result, change.Change)
 	}
 
@@ -137,3 +155,12 @@ func (d *disseminator) ClearChanges() {
 	d.changes = make(map[string]*pChange)
 	d.Unlock()
 }
+
+// NumChanges returns the number of Changes still being disseminated.
+func (d *disseminator) NumChanges() int {
+	d.RLock()
+	n := len(d.changes)
+	d.RUnlock()
+
+	return n
+}
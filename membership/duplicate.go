@@ -0,0 +1,115 @@
+package membership
+
+import (
+	"errors"
+	"sort"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrDuplicateAddress is returned when joining with an address already
+	// held by another live node.
+	ErrDuplicateAddress = errors.New("address already held by another live node")
+)
+
+// AddressConflict is an address claimed by two nodes at once, such as two
+// nodes misconfigured with the same advertise address.
+type AddressConflict struct {
+	Address string
+	// Incarnation is the incarnation number of the conflicting claim, which
+	// was rejected, and Detected when it was last seen.
+	Incarnation int64
+	Detected    time.Time
+}
+
+// addressConflicts records the conflicting claims seen by the local node.
+type addressConflicts struct {
+	sync.Mutex
+	byAddress map[string]AddressConflict
+}
+
+func newAddressConflicts() *addressConflicts {
+	return &addressConflicts{
+		byAddress: make(map[string]AddressConflict),
+	}
+}
+
+func (c *addressConflicts) record(address string, incarnation int64) {
+	c.Lock()
+	c.byAddress[address] = AddressConflict{
+		Address:     address,
+		Incarnation: incarnation,
+		Detected:    time.Now(),
+	}
+	c.Unlock()
+}
+
+// AddressConflicts returns the addresses claimed by two nodes at once, as
+// seen by the local node, sorted by address.
+func (n *Node) AddressConflicts() []AddressConflict {
+	n.conflicts.Lock()
+	conflicts := make([]AddressConflict, 0, len(n.conflicts.byAddress))
+	for _, conflict := range n.conflicts.byAddress {
+		conflicts = append(conflicts, conflict)
+	}
+	n.conflicts.Unlock()
+
+	sort.Slice(conflicts, func(i, j int) bool {
+		return conflicts[i].Address < conflicts[j].Address
+	})
+	return conflicts
+}
+
+// duplicateJoin returns whether a join from the given address and
+// incarnation conflicts with a live node already holding the address. A
+// node restarting gets a new incarnation too, so the holder is probed
+// first: the join only conflicts if a node still answers at the address
+// with another incarnation.
+func (n *Node) duplicateJoin(address string, incarnation int64) bool {
+	if address == n.address {
+		return incarnation != n.Incarnation()
+	}
+
+	member, ok := n.memberlist.Member(address)
+	if !ok {
+		return false
+	}
+
+	member.RLock()
+	alive := member.Status == Alive
+	current := member.Incarnation
+	member.RUnlock()
+	if !alive || current == incarnation {
+		return false
+	}
+
+	res, err := sendDirectPing(n, address, n.pingTimeout)
+	return err == nil && res.SourceIncarnation != incarnation
+}
+
+// dropDuplicateClaims removes from remote changes the claims of another node
+// on the local address: only the local node announces itself alive with a
+// new incarnation, so a remote alive change for the local address with an
+// incarnation greater than the local one comes from a node advertising the
+// same address. Applying it would replace the local tags, and so the tokens
+// of the node, with the ones of the duplicate.
+func (n *Node) dropDuplicateClaims(changes []Change) []Change {
+	local := n.Incarnation()
+	if local < 0 {
+		return changes
+	}
+
+	var kept []Change
+	for _, change := range changes {
+		if change.Address == n.address && change.Status == Alive && change.Incarnation > local {
+			logger.Errorf("Another node claims the local address %s with incarnation %d, ignored",
+				change.Address, change.Incarnation)
+			n.conflicts.record(change.Address, change.Incarnation)
+			continue
+		}
+		kept = append(kept, change)
+	}
+
+	return kept
+}
@@ -0,0 +1,159 @@
+package membership
+
+import (
+	"net"
+	"net/rpc"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+type nopHandler struct{}
+
+func (nopHandler) HandleChanges(changes []Change) {}
+
+// testServer serves the protocol handlers of a node on a local port, until
+// stopped along with the connections it accepted.
+type testServer struct {
+	listener net.Listener
+
+	mu    sync.Mutex
+	conns []net.Conn
+}
+
+func serveNode(t *testing.T, node *Node, listener net.Listener) *testServer {
+	server := rpc.NewServer()
+	node.RegisterRPCHandlers(server)
+
+	s := &testServer{listener: listener}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			s.mu.Lock()
+			s.conns = append(s.conns, conn)
+			s.mu.Unlock()
+			go server.ServeConn(conn)
+		}
+	}()
+
+	t.Cleanup(s.stop)
+	return s
+}
+
+func (s *testServer) stop() {
+	s.listener.Close()
+
+	s.mu.Lock()
+	for _, conn := range s.conns {
+		conn.Close()
+	}
+	s.conns = nil
+	s.mu.Unlock()
+}
+
+// startNode bootstraps a node listening on a local port, joining the given
+// bootstrap nodes.
+func startNode(t *testing.T, bootstrap ...string) (*Node, *testServer) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	node := NewNode(nopHandler{}, listener.Addr().String(), &Options{BootstrapNodes: bootstrap})
+	server := serveNode(t, node, listener)
+	t.Cleanup(node.Destroy)
+
+	if _, err := node.Bootstrap(); err != nil {
+		t.Fatal(err)
+	}
+	return node, server
+}
+
+// joinAs joins the given bootstrap node from a node advertising the given
+// address with the given incarnation, without serving it.
+func joinAs(address string, incarnation int64, bootstrap string) error {
+	node := NewNode(nopHandler{}, address, &Options{BootstrapNodes: []string{bootstrap}})
+	node.memberlist.MarkAlive(address, incarnation)
+
+	_, err := node.joinCluster()
+	return err
+}
+
+// waitMember waits until the given node knows the member at the given
+// address, which it learns from the first gossip of the member.
+func waitMember(t *testing.T, node *Node, address string) *Member {
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if member, ok := node.memberlist.Member(address); ok {
+			return member
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	t.Fatalf("%s never learned about %s", node.Address(), address)
+	return nil
+}
+
+func TestJoinDuplicateAddress(t *testing.T) {
+	seed, _ := startNode(t)
+	node, server := startNode(t, seed.Address())
+
+	address := node.Address()
+	incarnation := node.Incarnation()
+	member := waitMember(t, seed, address)
+
+	// Another node advertising the address of a live one is rejected.
+	if err := joinAs(address, incarnation+1, seed.Address()); err != ErrDuplicateAddress {
+		t.Fatalf("duplicate join returned %v, want %v", err, ErrDuplicateAddress)
+	}
+
+	conflicts := seed.AddressConflicts()
+	if len(conflicts) != 1 || conflicts[0].Address != address || conflicts[0].Incarnation != incarnation+1 {
+		t.Errorf("conflicts %+v, want %s with incarnation %d", conflicts, address, incarnation+1)
+	}
+
+	member.RLock()
+	current := member.Incarnation
+	member.RUnlock()
+	if current != incarnation {
+		t.Errorf("member incarnation %d, want %d", current, incarnation)
+	}
+
+	// The same node joining again is not a duplicate.
+	if err := joinAs(address, incarnation, seed.Address()); err != nil {
+		t.Errorf("join with the same incarnation returned %v", err)
+	}
+
+	// A node restarted at the address gets a new incarnation, and joins
+	// once nothing answers there anymore.
+	server.stop()
+	if err := joinAs(address, incarnation+2, seed.Address()); err != nil {
+		t.Errorf("join of a restarted node returned %v", err)
+	}
+}
+
+func TestDropDuplicateClaims(t *testing.T) {
+	node := NewNode(nopHandler{}, "127.0.0.1:7001", nil)
+	node.memberlist.MarkAlive(node.Address(), 10)
+
+	changes := []Change{
+		{Address: "127.0.0.1:7001", Incarnation: 11, Status: Alive},
+		{Address: "127.0.0.1:7001", Incarnation: 10, Status: Alive},
+		{Address: "127.0.0.1:7001", Incarnation: 11, Status: Suspect},
+		{Address: "127.0.0.1:7002", Incarnation: 11, Status: Alive},
+	}
+
+	kept := node.dropDuplicateClaims(changes)
+	if !reflect.DeepEqual(kept, changes[1:]) {
+		t.Errorf("kept %+v, want %+v", kept, changes[1:])
+	}
+
+	conflicts := node.AddressConflicts()
+	if len(conflicts) != 1 || conflicts[0].Incarnation != 11 {
+		t.Errorf("conflicts %+v, want one with incarnation 11", conflicts)
+	}
+}
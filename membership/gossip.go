@@ -75,7 +75,7 @@ func (g *gossip) Stop() {
 
 // ProtocolPeriod run a gossip protocol period.
 func (g *gossip) ProtocolPeriod() {
-	g.node.pingNextMember()
+	g.node.pingNextMembers()
 }
 
 // RunProtocolPeriodLoop run the gossip protocol period loop.
@@ -1,7 +1,6 @@
 package membership
 
 import (
-	"math/rand"
 	"sync"
 )
 
@@ -16,11 +15,12 @@ type Member struct {
 	Address     string
 	Status      string
 	Incarnation int64
+	Tags        map[string]string
 }
 
-func shuffle(members []*Member) []*Member {
+func shuffle(random *random, members []*Member) []*Member {
 	newMembers := make([]*Member, len(members), cap(members))
-	newIndexes := rand.Perm(len(members))
+	newIndexes := random.Perm(len(members))
 
 	for o, n := range newIndexes {
 		newMembers[n] = members[o]
@@ -65,10 +65,35 @@ func (m *Member) isReachable() bool {
 	return m.Status == Alive || m.Status == Suspect
 }
 
+// MemberState is a copy of the fields of a member, taken under its lock, so
+// that it can be passed around without copying the lock.
+type MemberState struct {
+	Address     string
+	Status      string
+	Incarnation int64
+	Tags        map[string]string
+}
+
+func (m *Member) state() MemberState {
+	m.RLock()
+	defer m.RUnlock()
+
+	return MemberState{
+		Address:     m.Address,
+		Status:      m.Status,
+		Incarnation: m.Incarnation,
+		Tags:        m.Tags,
+	}
+}
+
 type Change struct {
 	Source            string
 	SourceIncarnation int64
 	Address           string
 	Incarnation       int64
 	Status            string
+
+	// Tags carries the node metadata of the member. It is only set by the
+	// member itself, and a nil Tags leaves the known tags unchanged.
+	Tags map[string]string
 }
@@ -3,9 +3,9 @@ package membership
 import (
 	"bytes"
 	"fmt"
-	"math/rand"
 	"net/rpc"
 	"sort"
+	"strings"
 	"sync"
 	"time"
 
@@ -74,7 +74,7 @@ func (i *memberlistIter) Next() (*Member, bool) {
 		member := i.m.MemberAt(i.currentIndex)
 		visited[member.Address] = true
 
-		if i.m.Pingable(*member) {
+		if i.m.Pingable(member) {
 			return member, true
 		}
 	}
@@ -103,7 +103,7 @@ func (m *memberlist) genChecksumString() string {
 	var strings sort.StringSlice
 
 	for _, member := range m.members.list {
-		s := fmt.Sprintf("%s,%s,%v", member.Address, member.Status, member.Incarnation)
+		s := fmt.Sprintf("%s,%s,%v,%s", member.Address, member.Status, member.Incarnation, tagsString(member.Tags))
 		strings = append(strings, s)
 	}
 
@@ -181,7 +181,7 @@ func (m *memberlist) NumMembers() int {
 func (m *memberlist) NumPingableMembers() (n int) {
 	m.members.Lock()
 	for _, member := range m.members.list {
-		if m.Pingable(*member) {
+		if m.Pingable(member) {
 			n++
 		}
 	}
@@ -190,19 +190,20 @@ func (m *memberlist) NumPingableMembers() (n int) {
 	return
 }
 
-// Members returns all the members in the memberlist.
-func (m *memberlist) Members() (members []Member) {
+// Members returns a copy of the fields of every member in the memberlist.
+func (m *memberlist) Members() []MemberState {
 	m.members.RLock()
+	states := make([]MemberState, 0, len(m.members.list))
 	for _, member := range m.members.list {
-		members = append(members, *member)
+		states = append(states, member.state())
 	}
 	m.members.RUnlock()
 
-	return
+	return states
 }
 
 // Pingable returns whether or not a member is pingable.
-func (m *memberlist) Pingable(member Member) bool {
+func (m *memberlist) Pingable(member *Member) bool {
 	return member.Address != m.local.Address && member.isReachable()
 }
 
@@ -212,13 +213,13 @@ func (m *memberlist) RandomPingableMembers(n int, excluding map[string]bool) []*
 
 	m.members.RLock()
 	for _, member := range m.members.list {
-		if m.Pingable(*member) && !excluding[member.Address] {
+		if m.Pingable(member) && !excluding[member.Address] {
 			members = append(members, member)
 		}
 	}
 	m.members.RUnlock()
 
-	members = shuffle(members)
+	members = shuffle(m.node.random, members)
 
 	if n > len(members) {
 		return members
@@ -260,13 +261,18 @@ func (m *memberlist) MakeChange(address string, incarnation int64, status string
 		}
 	}
 
-	changes := m.Update([]Change{Change{
+	change := Change{
 		Source:            m.local.Address,
 		SourceIncarnation: m.local.Incarnation,
 		Address:           address,
 		Incarnation:       incarnation,
 		Status:            status,
-	}})
+	}
+	if address == m.node.Address() {
+		change.Tags = m.node.localTags()
+	}
+
+	changes := m.Update([]Change{change})
 
 	return changes
 }
@@ -297,6 +303,7 @@ func (m *memberlist) Update(changes []Change) (applied []Change) {
 				Address:           change.Address,
 				Incarnation:       time.Now().Unix(),
 				Status:            Alive,
+				Tags:              m.node.localTags(),
 			}
 
 			if m.applyChange(overrideChange) {
@@ -345,7 +352,7 @@ func (m *memberlist) getJoinPosition() int {
 	if l == 0 {
 		return l
 	}
-	return rand.Intn(l)
+	return m.node.random.Intn(l)
 }
 
 func (m *memberlist) applyChange(change Change) bool {
@@ -370,18 +377,41 @@ func (m *memberlist) applyChange(change Change) bool {
 	}
 
 	member.Lock()
+	oldStatus := member.Status
+	if !ok {
+		oldStatus = ""
+	}
 	member.Status = change.Status
 	member.Incarnation = change.Incarnation
+	if change.Tags != nil {
+		member.Tags = change.Tags
+	}
 	member.Unlock()
 
 	logger.Noticef("%s is marked as %s node", member.Address, change.Status)
 
+	if oldStatus != change.Status {
+		m.node.stateChanges.notify(member.Address, oldStatus, change.Status)
+	}
+
 	return true
 }
 
 // Shuffle shuffles the memberlist.
 func (m *memberlist) Shuffle() {
 	m.members.Lock()
-	m.members.list = shuffle(m.members.list)
+	m.members.list = shuffle(m.node.random, m.members.list)
 	m.members.Unlock()
 }
+
+// tagsString returns the tags as key=value pairs sorted by key.
+func tagsString(tags map[string]string) string {
+	var pairs sort.StringSlice
+	for key, value := range tags {
+		pairs = append(pairs, key+"="+value)
+	}
+
+	pairs.Sort()
+
+	return strings.Join(pairs, ";")
+}
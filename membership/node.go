@@ -2,11 +2,13 @@ package membership
 
 import (
 	"errors"
+	"math/rand"
 	"net/rpc"
+	"swimring/util"
 	"sync"
+	"sync/atomic"
 	"time"
 
-	"github.com/hungys/swimring/util"
 	"github.com/op/go-logging"
 )
 
@@ -27,6 +29,26 @@ type Options struct {
 
 	PingRequestSize int
 	BootstrapNodes  []string
+
+	// GossipFanout is the number of members probed in each protocol period.
+	// A larger fanout detects failures and spreads changes faster, at the
+	// cost of more traffic per period.
+	GossipFanout int
+
+	// GossipBatchSize caps the number of membership changes piggybacked on a
+	// single gossip message, the least disseminated first, zero meaning
+	// unlimited. GossipCompression gzips the batches of changes.
+	GossipBatchSize   int
+	GossipCompression bool
+
+	// Tags are arbitrary key/value metadata of the node, such as its zone,
+	// gossiped to the other members.
+	Tags map[string]string
+
+	// RandSource is the source of the random choices of the node, such as
+	// the members it probes. It defaults to a source seeded with the current
+	// time; tests can pass a seeded source to reproduce a gossip ordering.
+	RandSource rand.Source
 }
 
 func defaultOptions() *Options {
@@ -37,6 +59,7 @@ func defaultOptions() *Options {
 		PingRequestTimeout: 5000 * time.Millisecond,
 		MinProtocolPeriod:  200 * time.Millisecond,
 		PingRequestSize:    3,
+		GossipFanout:       1,
 	}
 
 	return opts
@@ -55,6 +78,7 @@ func mergeDefaultOptions(opts *Options) *Options {
 	opts.PingRequestTimeout = util.SelectDurationOpt(opts.PingRequestTimeout, def.PingRequestTimeout)
 	opts.MinProtocolPeriod = util.SelectDurationOpt(opts.MinProtocolPeriod, def.MinProtocolPeriod)
 	opts.PingRequestSize = util.SelectIntOpt(opts.PingRequestSize, def.PingRequestSize)
+	opts.GossipFanout = util.SelectIntOpt(opts.GossipFanout, def.GossipFanout)
 
 	return opts
 }
@@ -75,11 +99,28 @@ type Node struct {
 	stateTransitions *stateTransitions
 	gossip           *gossip
 	protocolHandlers *ProtocolHandlers
+	stateChanges     *stateChangeNotifier
+	lastHeard        *lastHeard
 
 	joinTimeout, suspectTimeout, pingTimeout, pingRequestTimeout time.Duration
 
 	pingRequestSize int
+	gossipFanout    int
+	fanoutCapped    bool
 	bootstrapNodes  []string
+
+	tagsMu sync.RWMutex
+	tags   map[string]string
+
+	gossipBatchSize   int
+	gossipCompression bool
+
+	random *random
+
+	partitionMu sync.Mutex
+	minority    bool
+
+	conflicts *addressConflicts
 }
 
 // NewNode returns a new SWIM node.
@@ -88,6 +129,7 @@ func NewNode(swimring changeHandler, address string, opts *Options) *Node {
 
 	node := &Node{
 		address: address,
+		random:  newRandom(opts.RandSource),
 	}
 
 	node.swimring = swimring
@@ -97,13 +139,28 @@ func NewNode(swimring changeHandler, address string, opts *Options) *Node {
 	node.stateTransitions = newStateTransitions(node)
 	node.gossip = newGossip(node, opts.MinProtocolPeriod)
 	node.protocolHandlers = NewProtocolHandler(node)
+	node.stateChanges = newStateChangeNotifier()
+	node.lastHeard = newLastHeard()
+	node.conflicts = newAddressConflicts()
 
 	node.joinTimeout = opts.JoinTimeout
 	node.suspectTimeout = opts.SuspectTimeout
 	node.pingTimeout = opts.PingTimeout
 	node.pingRequestTimeout = opts.PingRequestTimeout
 	node.pingRequestSize = opts.PingRequestSize
+	node.gossipFanout = opts.GossipFanout
+	node.gossipBatchSize = opts.GossipBatchSize
+	node.gossipCompression = opts.GossipCompression
 	node.bootstrapNodes = opts.BootstrapNodes
+	node.tags = make(map[string]string)
+	for key, value := range opts.Tags {
+		node.tags[key] = value
+	}
+
+	if node.gossipFanout < 1 {
+		logger.Warningf("Invalid gossip fanout %d, using 1", node.gossipFanout)
+		node.gossipFanout = 1
+	}
 
 	return node
 }
@@ -113,11 +170,62 @@ func (n *Node) Address() string {
 	return n.address
 }
 
-// Members returns all the members in Node's memberlist.
-func (n *Node) Members() []Member {
+// Members returns a copy of the fields of all the members in Node's
+// memberlist, taken under their locks.
+func (n *Node) Members() []MemberState {
 	return n.memberlist.Members()
 }
 
+// OnNodeStateChange registers a callback called whenever a member changes
+// status, e.g. when it is escalated from suspect to faulty. The old status
+// of a new member is empty. Callbacks run on a separate goroutine, so a slow
+// callback does not stall failure detection.
+func (n *Node) OnNodeStateChange(fn func(address, oldStatus, newStatus string)) {
+	n.stateChanges.register(fn)
+}
+
+// MemberTags returns the tags of the member at a specific address.
+func (n *Node) MemberTags(address string) (map[string]string, bool) {
+	member, ok := n.memberlist.Member(address)
+	if !ok {
+		return nil, false
+	}
+
+	member.RLock()
+	tags := member.Tags
+	member.RUnlock()
+
+	return tags, true
+}
+
+// SetTag sets a tag of the local node and gossips it with a new incarnation
+// number, so that every member learns it.
+func (n *Node) SetTag(key, value string) {
+	n.tagsMu.Lock()
+	tags := make(map[string]string, len(n.tags)+1)
+	for k, v := range n.tags {
+		tags[k] = v
+	}
+	tags[key] = value
+	n.tags = tags
+	n.tagsMu.Unlock()
+
+	incarnation := time.Now().Unix()
+	if current := n.Incarnation(); incarnation <= current {
+		incarnation = current + 1
+	}
+	n.memberlist.MakeChange(n.address, incarnation, Alive)
+}
+
+// localTags returns the tags of the local node. The map must not be modified.
+func (n *Node) localTags() map[string]string {
+	n.tagsMu.RLock()
+	tags := n.tags
+	n.tagsMu.RUnlock()
+
+	return tags
+}
+
 // MemberClient returns the RPC client of the member at a specific address,
 // and it will dial to RPC server if client is not in rpcClients map.
 func (n *Node) MemberClient(address string) (*rpc.Client, error) {
@@ -134,6 +242,21 @@ func (n *Node) MemberReachable(address string) bool {
 	return member.isReachable()
 }
 
+// MemberSuspect returns whether the member is suspected to have failed but
+// not yet confirmed faulty.
+func (n *Node) MemberSuspect(address string) bool {
+	member, ok := n.memberlist.Member(address)
+	if !ok {
+		return false
+	}
+
+	member.RLock()
+	suspect := member.Status == Suspect
+	member.RUnlock()
+
+	return suspect
+}
+
 // Start starts the SWIM protocol and all sub-protocols.
 func (n *Node) Start() {
 	n.gossip.Start()
@@ -182,6 +305,68 @@ func (n *Node) Destroy() {
 	logger.Noticef("Local node %s destroyed", n.Address())
 }
 
+// Leave announces to other members that the node is leaving, by sending
+// them a change marking it as faulty with the LeftTag and a higher
+// incarnation number, and then destroys the node so that it does not refute
+// it. The members that received the change disseminate it to the rest of
+// the cluster, which then skips the failure detection of the node and no
+// longer counts it as a member. The node stops answering the
+// protocol. It returns an error if no member acknowledged the change.
+func (n *Node) Leave() error {
+	if n.Destroyed() {
+		return nil
+	}
+
+	incarnation := time.Now().Unix()
+	if current := n.Incarnation(); incarnation <= current {
+		incarnation = current + 1
+	}
+	tags := make(map[string]string)
+	for key, value := range n.localTags() {
+		tags[key] = value
+	}
+	tags[LeftTag] = "true"
+
+	change := Change{
+		Source:            n.address,
+		SourceIncarnation: incarnation,
+		Address:           n.address,
+		Incarnation:       incarnation,
+		Status:            Faulty,
+		Tags:              tags,
+	}
+
+	members := n.memberlist.RandomPingableMembers(n.pingRequestSize, nil)
+	n.Destroy()
+
+	n.status.Lock()
+	n.status.ready = false
+	n.status.Unlock()
+
+	var wg sync.WaitGroup
+	var acked int32
+	for _, member := range members {
+		wg.Add(1)
+
+		go func(address string) {
+			defer wg.Done()
+			if _, err := sendPingWithChanges(n, address, []Change{change}, n.pingTimeout); err != nil {
+				logger.Warningf("Cannot announce departure to %s: %s", address, err.Error())
+				return
+			}
+			atomic.AddInt32(&acked, 1)
+		}(member.Address)
+	}
+	wg.Wait()
+
+	if len(members) > 0 && acked == 0 {
+		return errors.New("no member acknowledged the departure")
+	}
+
+	logger.Noticef("Local node %s left, departure acknowledged by %d members", n.address, acked)
+	return nil
+}
+
 // Destroyed returns whether or not the node has been destroyed.
 func (n *Node) Destroyed() bool {
 	n.status.RLock()
@@ -211,12 +396,17 @@ func (n *Node) Incarnation() int64 {
 	return -1
 }
 
-// Bootstrap joins the Node to a cluster.
+// Bootstrap joins the Node to a cluster. It returns ErrDuplicateAddress,
+// without starting the gossip, if a bootstrap node rejected the join because
+// another live node already holds the address of the Node.
 func (n *Node) Bootstrap() ([]string, error) {
 	logger.Notice("Bootstrapping local node...")
 
 	n.memberlist.Reincarnate()
-	nodesJoined := n.joinCluster()
+	nodesJoined, err := n.joinCluster()
+	if err != nil {
+		return nodesJoined, err
+	}
 	n.gossip.Start()
 
 	n.status.Lock()
@@ -244,6 +434,8 @@ func (n *Node) handleChanges(changes []Change) {
 			n.stateTransitions.ScheduleSuspectToFaulty(change)
 		}
 	}
+
+	n.checkPartition()
 }
 
 func (n *Node) pinging() bool {
@@ -260,19 +452,58 @@ func (n *Node) setPinging(pinging bool) {
 	n.status.Unlock()
 }
 
-func (n *Node) pingNextMember() {
+func (n *Node) pingNextMembers() {
 	if n.pinging() {
 		return
 	}
 
-	member, ok := n.memberiter.Next()
-	if !ok {
+	members := n.nextMembers(n.gossipFanout)
+	if len(members) == 0 {
 		return
 	}
 
 	n.setPinging(true)
 	defer n.setPinging(false)
 
+	var wg sync.WaitGroup
+	for _, member := range members {
+		wg.Add(1)
+
+		go func(member *Member) {
+			defer wg.Done()
+			n.pingMember(member)
+		}(member)
+	}
+
+	wg.Wait()
+}
+
+// nextMembers returns up to k distinct pingable members from the round-robin
+// iterator. It warns once when the fanout exceeds the number of members.
+func (n *Node) nextMembers(k int) []*Member {
+	var members []*Member
+	picked := make(map[string]bool)
+
+	for len(members) < k {
+		member, ok := n.memberiter.Next()
+		if !ok || picked[member.Address] {
+			break
+		}
+
+		picked[member.Address] = true
+		members = append(members, member)
+	}
+
+	capped := len(members) < k
+	if capped && !n.fanoutCapped {
+		logger.Warningf("Gossip fanout %d exceeds the %d pingable member(s)", k, len(members))
+	}
+	n.fanoutCapped = capped
+
+	return members
+}
+
+func (n *Node) pingMember(member *Member) {
 	res, err := sendDirectPing(n, member.Address, n.pingTimeout)
 	if err == nil {
 		n.memberlist.Update(res.Changes)
@@ -291,9 +522,10 @@ func (n *Node) pingNextMember() {
 	}
 }
 
-func (n *Node) joinCluster() []string {
+func (n *Node) joinCluster() ([]string, error) {
 	var nodesJoined []string
 	var wg sync.WaitGroup
+	var duplicate int32
 
 	logger.Infof("Trying to join the cluster...")
 	for _, target := range n.bootstrapNodes {
@@ -304,16 +536,23 @@ func (n *Node) joinCluster() []string {
 			res, err := sendJoin(n, target, n.joinTimeout)
 
 			if err != nil {
+				if err.Error() == ErrDuplicateAddress.Error() {
+					logger.Errorf("Join %s rejected, %s is held by another live node", target, n.address)
+					atomic.StoreInt32(&duplicate, 1)
+				}
 				return
 			}
 
 			logger.Noticef("Join %s successfully, %d peers found", target, len(res.Membership))
-			n.memberlist.AddJoinList(res.Membership)
+			n.memberlist.AddJoinList(n.dropDuplicateClaims(res.Membership))
 			nodesJoined = append(nodesJoined, target)
 		}(target)
 	}
 
 	wg.Wait()
 
-	return nodesJoined
+	if atomic.LoadInt32(&duplicate) == 1 {
+		return nodesJoined, ErrDuplicateAddress
+	}
+	return nodesJoined, nil
 }
@@ -0,0 +1,94 @@
+package membership
+
+import (
+	"sort"
+	"swimring/util"
+)
+
+// LeftTag is the member tag set by a node leaving the cluster on purpose, so
+// that the other members no longer count it as part of the cluster.
+const LeftTag = "left"
+
+// PartitionStatus is the view of a node on whether it is on the minority
+// side of a network partition.
+type PartitionStatus struct {
+	// Alive is the number of alive members, the node included, and Known the
+	// number of members of the cluster, those which left on purpose
+	// excluded.
+	Alive, Known int
+	// Minority is set when at most half of the known members are alive, so
+	// that the node may be cut off from the rest of the cluster.
+	// Unreachable lists the known members not alive.
+	Minority    bool
+	Unreachable []string
+}
+
+// PartitionStatus returns whether the node suspects it is in a minority
+// partition. Members are counted as unreachable as soon as they are
+// suspected, so a flapping member may briefly flag a small cluster.
+func (n *Node) PartitionStatus() PartitionStatus {
+	var status PartitionStatus
+
+	for _, member := range n.memberlist.Members() {
+		if member.Status == Faulty && member.Tags[LeftTag] != "" {
+			continue
+		}
+
+		status.Known++
+		if member.Status == Alive {
+			status.Alive++
+		} else {
+			status.Unreachable = append(status.Unreachable, member.Address)
+		}
+	}
+	sort.Strings(status.Unreachable)
+
+	status.Minority = status.Known > 1 && status.Alive*2 <= status.Known
+
+	return status
+}
+
+// checkPartition logs when the node enters or leaves a minority partition.
+func (n *Node) checkPartition() {
+	status := n.PartitionStatus()
+
+	n.partitionMu.Lock()
+	changed := status.Minority != n.minority
+	n.minority = status.Minority
+	n.partitionMu.Unlock()
+
+	if !changed {
+		return
+	}
+
+	if status.Minority {
+		logger.Warningf("Only %d of %d members alive, local node may be in a minority partition, unreachable: %v",
+			status.Alive, status.Known, status.Unreachable)
+	} else {
+		logger.Noticef("%d of %d members alive, local node is back in the majority", status.Alive, status.Known)
+	}
+}
+
+// WritePrometheus writes the partition status of the node in the Prometheus
+// text format.
+func (n *Node) WritePrometheus(p *util.PrometheusWriter) {
+	status := n.PartitionStatus()
+
+	minority := 0.0
+	if status.Minority {
+		minority = 1
+	}
+
+	gauges := []struct {
+		name, help string
+		value      float64
+	}{
+		{"swimring_membership_alive_members", "Alive members, the local node included.", float64(status.Alive)},
+		{"swimring_membership_known_members", "Members of the cluster, those which left excluded.", float64(status.Known)},
+		{"swimring_membership_minority", "Whether the local node suspects it is in a minority partition.", minority},
+	}
+	for _, g := range gauges {
+		p.Family(g.name, "gauge", g.help)
+		p.Sample(g.name, g.value)
+	}
+}
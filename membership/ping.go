@@ -22,10 +22,10 @@ func sendDirectPing(node *Node, target string, timeout time.Duration) (*Ping, er
 func sendPingWithChanges(node *Node, target string, changes []Change, timeout time.Duration) (*Ping, error) {
 	req := &Ping{
 		Checksum:          node.memberlist.Checksum(),
-		Changes:           changes,
 		Source:            node.Address(),
 		SourceIncarnation: node.Incarnation(),
 	}
+	req.Changes, req.CompressedChanges = node.packChanges(changes)
 
 	errCh := make(chan error, 1)
 	resp := &Ping{}
@@ -52,6 +52,10 @@ func sendPingWithChanges(node *Node, target string, changes []Change, timeout ti
 	if err != nil {
 		return nil, err
 	}
+	node.lastHeard.record(target)
+
+	resp.Changes = node.unpackChanges(resp.Changes, resp.CompressedChanges)
+	resp.CompressedChanges = nil
 
 	return resp, err
 }
@@ -82,17 +86,17 @@ func sendPingRequests(node *Node, target string, amount int, timeout time.Durati
 	for _, peer := range peers {
 		wg.Add(1)
 
-		go func(peer Member) {
+		go func(peer string) {
 			defer wg.Done()
 
-			res, err := sendPingRequest(node, peer.Address, target, timeout)
+			res, err := sendPingRequest(node, peer, target, timeout)
 			if err != nil {
 				resCh <- err
 				return
 			}
 
 			resCh <- res
-		}(*peer)
+		}(peer.Address)
 	}
 
 	go func() {
@@ -109,9 +113,9 @@ func sendPingRequest(node *Node, peer string, target string, timeout time.Durati
 		Source:            node.Address(),
 		SourceIncarnation: node.Incarnation(),
 		Checksum:          node.memberlist.Checksum(),
-		Changes:           changes,
 		Target:            target,
 	}
+	req.Changes, req.CompressedChanges = node.packChanges(changes)
 
 	errCh := make(chan error, 1)
 	resp := &PingResponse{}
@@ -138,7 +142,7 @@ func sendPingRequest(node *Node, peer string, target string, timeout time.Durati
 	select {
 	case err = <-errCh:
 		if err == nil {
-			node.memberlist.Update(resp.Changes)
+			node.memberlist.Update(node.unpackChanges(resp.Changes, resp.CompressedChanges))
 		}
 		return resp, err
 	case <-time.After(timeout):
@@ -10,6 +10,7 @@ type ProtocolHandlers struct {
 // Ping is the payload of ping and ping response.
 type Ping struct {
 	Changes           []Change
+	CompressedChanges []byte
 	Checksum          uint32
 	Source            string
 	SourceIncarnation int64
@@ -22,13 +23,15 @@ type PingRequest struct {
 	Target            string
 	Checksum          uint32
 	Changes           []Change
+	CompressedChanges []byte
 }
 
 // PingResponse is the payload of the response of ping request.
 type PingResponse struct {
-	Ok      bool
-	Target  string
-	Changes []Change
+	Ok                bool
+	Target            string
+	Changes           []Change
+	CompressedChanges []byte
 }
 
 // JoinRequest is the payload of join request.
@@ -45,6 +48,9 @@ type JoinResponse struct {
 	Checksum    uint32
 }
 
+// PartitionStatusRequest is the payload of partition status request.
+type PartitionStatusRequest struct{}
+
 // NewProtocolHandler returns a new ProtocolHandlers.
 func NewProtocolHandler(n *Node) *ProtocolHandlers {
 	p := &ProtocolHandlers{
@@ -60,12 +66,13 @@ func (p *ProtocolHandlers) Ping(req *Ping, resp *Ping) error {
 		return ErrNodeNotReady
 	}
 
-	p.node.memberlist.Update(req.Changes)
+	p.node.lastHeard.record(req.Source)
+	p.node.memberlist.Update(p.node.unpackChanges(req.Changes, req.CompressedChanges))
 
 	changes := p.node.disseminator.IssueAsReceiver(req.Source, req.SourceIncarnation, req.Checksum)
 
 	resp.Checksum = p.node.memberlist.Checksum()
-	resp.Changes = changes
+	resp.Changes, resp.CompressedChanges = p.node.packChanges(changes)
 	resp.Source = p.node.Address()
 	resp.SourceIncarnation = p.node.Incarnation()
 
@@ -79,7 +86,8 @@ func (p *ProtocolHandlers) PingRequest(req *PingRequest, resp *PingResponse) err
 		return ErrNodeNotReady
 	}
 
-	p.node.memberlist.Update(req.Changes)
+	p.node.lastHeard.record(req.Source)
+	p.node.memberlist.Update(p.node.unpackChanges(req.Changes, req.CompressedChanges))
 
 	logger.Infof("Handling ping request to %s (from %s)", req.Target, req.Source)
 
@@ -94,18 +102,32 @@ func (p *ProtocolHandlers) PingRequest(req *PingRequest, resp *PingResponse) err
 
 	resp.Target = req.Target
 	resp.Ok = pingOk
-	resp.Changes = changes
+	resp.Changes, resp.CompressedChanges = p.node.packChanges(changes)
 
 	return nil
 }
 
-// Join handles the incoming Join request.
+// Join handles the incoming Join request. A join from an address already
+// held by another live node is rejected with ErrDuplicateAddress.
 func (p *ProtocolHandlers) Join(req *JoinRequest, resp *JoinResponse) error {
 	logger.Infof("Handling join request from %s", req.Source)
 
+	if p.node.duplicateJoin(req.Source, req.Incarnation) {
+		logger.Errorf("Join request from %s rejected, the address is held by another live node", req.Source)
+		p.node.conflicts.record(req.Source, req.Incarnation)
+		return ErrDuplicateAddress
+	}
+
 	resp.Coordinator = p.node.Address()
 	resp.Membership = p.node.disseminator.MembershipAsChanges()
 	resp.Checksum = p.node.memberlist.Checksum()
 
 	return nil
 }
+
+// PartitionStatus handles the incoming PartitionStatus request, with the
+// view of the node on whether it is in a minority partition.
+func (p *ProtocolHandlers) PartitionStatus(req *PartitionStatusRequest, resp *PartitionStatus) error {
+	*resp = p.node.PartitionStatus()
+	return nil
+}
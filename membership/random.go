@@ -0,0 +1,44 @@
+package membership
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// random is a source of randomness safe for concurrent use, from which the
+// node picks the members it probes and the position of new members.
+type random struct {
+	sync.Mutex
+	rand *rand.Rand
+}
+
+// newRandom returns a random drawing from the given source, or from a source
+// seeded with the current time if it is nil.
+func newRandom(source rand.Source) *random {
+	if source == nil {
+		source = rand.NewSource(time.Now().UnixNano())
+	}
+
+	return &random{
+		rand: rand.New(source),
+	}
+}
+
+// Intn returns a number in [0,n).
+func (r *random) Intn(n int) int {
+	r.Lock()
+	i := r.rand.Intn(n)
+	r.Unlock()
+
+	return i
+}
+
+// Perm returns a permutation of [0,n).
+func (r *random) Perm(n int) []int {
+	r.Lock()
+	perm := r.rand.Perm(n)
+	r.Unlock()
+
+	return perm
+}
@@ -0,0 +1,65 @@
+package membership
+
+import (
+	"sync"
+)
+
+const stateChangeQueueSize = 256
+
+type stateChange struct {
+	address, oldStatus, newStatus string
+}
+
+// stateChangeNotifier delivers member status changes to the registered
+// callbacks, off the gossip path. Changes are dropped when the queue is full
+// rather than blocking the protocol.
+type stateChangeNotifier struct {
+	sync.RWMutex
+	callbacks []func(address, oldStatus, newStatus string)
+	queue     chan stateChange
+	once      sync.Once
+}
+
+func newStateChangeNotifier() *stateChangeNotifier {
+	return &stateChangeNotifier{
+		queue: make(chan stateChange, stateChangeQueueSize),
+	}
+}
+
+func (s *stateChangeNotifier) register(fn func(address, oldStatus, newStatus string)) {
+	s.Lock()
+	s.callbacks = append(s.callbacks, fn)
+	s.Unlock()
+
+	s.once.Do(func() {
+		go s.run()
+	})
+}
+
+func (s *stateChangeNotifier) notify(address, oldStatus, newStatus string) {
+	s.RLock()
+	n := len(s.callbacks)
+	s.RUnlock()
+
+	if n == 0 {
+		return
+	}
+
+	select {
+	case s.queue <- stateChange{address, oldStatus, newStatus}:
+	default:
+		logger.Warningf("State change of %s to %s dropped, callbacks are too slow", address, newStatus)
+	}
+}
+
+func (s *stateChangeNotifier) run() {
+	for change := range s.queue {
+		s.RLock()
+		callbacks := s.callbacks
+		s.RUnlock()
+
+		for _, fn := range callbacks {
+			fn(change.address, change.oldStatus, change.newStatus)
+		}
+	}
+}
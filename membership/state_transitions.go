@@ -7,7 +7,8 @@ import (
 
 type transitionTimer struct {
 	*time.Timer
-	state string
+	state    string
+	deadline time.Time
 }
 
 type stateTransitions struct {
@@ -59,8 +60,9 @@ func (s *stateTransitions) schedule(change Change, state string, timeout time.Du
 	})
 
 	s.timers[change.Address] = &transitionTimer{
-		Timer: timer,
-		state: state,
+		Timer:    timer,
+		state:    state,
+		deadline: time.Now().Add(timeout),
 	}
 }
 
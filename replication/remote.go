@@ -0,0 +1,356 @@
+// Package replication forwards the writes accepted by the local cluster to
+// remote clusters, asynchronously, for disaster recovery across datacenters.
+package replication
+
+import (
+	"errors"
+	"net/rpc"
+	"sort"
+	"swimring/util"
+	"sync"
+	"time"
+
+	"github.com/op/go-logging"
+)
+
+var logger = logging.MustGetLogger("replication")
+
+const (
+	// ReplicateRemoteOp is the name of the service method receiving the
+	// writes of another cluster.
+	ReplicateRemoteOp = "SwimRing.ReplicateRemote"
+)
+
+// ErrNoRemoteAddress is returned when a remote cluster has no endpoint.
+var ErrNoRemoteAddress = errors.New("remote cluster has no address")
+
+// RemoteWrite is a write forwarded to a remote cluster. Accepted is when
+// the write was accepted locally, in Unix nanoseconds, and Clock the vector
+// clock it was stored with. The remote cluster keeps the write only if its
+// clock descends from the one of its local version, and falls back to
+// Accepted for concurrent versions or when either clock is unknown.
+type RemoteWrite struct {
+	Key      string
+	Value    []byte
+	Metadata map[string]string
+	Deleted  bool
+	Accepted int64
+	Clock    *util.VectorClock
+}
+
+// ReplicateRemoteRequest is the payload of ReplicateRemote.
+type ReplicateRemoteRequest struct {
+	Source string
+	Writes []RemoteWrite
+}
+
+// ReplicateRemoteResponse is the payload of the response of ReplicateRemote.
+type ReplicateRemoteResponse struct {
+	Applied int
+}
+
+// Options is a configuration struct passed into NewReplicator constructor.
+type Options struct {
+	// BatchSize is the maximum number of writes sent in one call, and
+	// QueueSize the number of writes kept for each remote cluster while it
+	// is unreachable, the oldest being dropped beyond it.
+	BatchSize int
+	QueueSize int
+
+	RetryInterval time.Duration
+	CallTimeout   time.Duration
+}
+
+func defaultOptions() *Options {
+	opts := &Options{
+		BatchSize:     128,
+		QueueSize:     100000,
+		RetryInterval: time.Second,
+		CallTimeout:   5 * time.Second,
+	}
+
+	return opts
+}
+
+func mergeDefaultOptions(opts *Options) *Options {
+	def := defaultOptions()
+
+	if opts == nil {
+		return def
+	}
+
+	opts.BatchSize = util.SelectIntOpt(opts.BatchSize, def.BatchSize)
+	opts.QueueSize = util.SelectIntOpt(opts.QueueSize, def.QueueSize)
+	opts.RetryInterval = util.SelectDurationOpt(opts.RetryInterval, def.RetryInterval)
+	opts.CallTimeout = util.SelectDurationOpt(opts.CallTimeout, def.CallTimeout)
+
+	return opts
+}
+
+// RemoteStats is the replication state towards one remote cluster.
+type RemoteStats struct {
+	Pending int
+	// Lag is the age of the oldest write not yet acknowledged by the remote
+	// cluster, zero when it is up to date.
+	Lag time.Duration
+	// Dropped is the number of writes dropped because the queue was full.
+	Dropped   int64
+	LastError string
+}
+
+// Replicator streams the local writes to remote clusters. Each remote
+// cluster has its own queue and sender, so a slow or unreachable cluster
+// does not hold back the others, nor the local writes.
+type Replicator struct {
+	source  string
+	remotes map[string]*remoteStream
+}
+
+// NewReplicator returns a Replicator sending the writes of the source
+// cluster to the given remote clusters, each given by the addresses of its
+// nodes.
+func NewReplicator(source string, remotes map[string][]string, opts *Options) *Replicator {
+	opts = mergeDefaultOptions(opts)
+
+	r := &Replicator{
+		source:  source,
+		remotes: make(map[string]*remoteStream, len(remotes)),
+	}
+
+	for name, addresses := range remotes {
+		stream := newRemoteStream(source, name, addresses, opts)
+		r.remotes[name] = stream
+		go stream.run()
+	}
+
+	return r
+}
+
+// Replicate queues the given write for every remote cluster. It never
+// blocks.
+func (r *Replicator) Replicate(write RemoteWrite) {
+	if write.Accepted == 0 {
+		write.Accepted = time.Now().UnixNano()
+	}
+
+	for _, stream := range r.remotes {
+		stream.enqueue(write)
+	}
+}
+
+// Stats returns the replication state towards each remote cluster.
+func (r *Replicator) Stats() map[string]RemoteStats {
+	stats := make(map[string]RemoteStats, len(r.remotes))
+	for name, stream := range r.remotes {
+		stats[name] = stream.stats()
+	}
+
+	return stats
+}
+
+// Stop stops the senders. The writes still queued are lost.
+func (r *Replicator) Stop() {
+	for _, stream := range r.remotes {
+		stream.stop()
+	}
+}
+
+type remoteStream struct {
+	source, name string
+	addresses    []string
+	opts         *Options
+
+	mu        sync.Mutex
+	queue     []queuedWrite
+	seq       uint64
+	dropped   int64
+	lastError string
+	ready     chan struct{}
+	done      chan struct{}
+
+	client *rpc.Client
+	next   int
+}
+
+// queuedWrite is a write waiting for a remote cluster, numbered in the
+// order it was queued, so that an acknowledged batch is found in the queue
+// even if an overflow dropped part of it meanwhile.
+type queuedWrite struct {
+	seq   uint64
+	write RemoteWrite
+}
+
+func newRemoteStream(source, name string, addresses []string, opts *Options) *remoteStream {
+	return &remoteStream{
+		source:    source,
+		name:      name,
+		addresses: addresses,
+		opts:      opts,
+		ready:     make(chan struct{}, 1),
+		done:      make(chan struct{}),
+	}
+}
+
+func (s *remoteStream) enqueue(write RemoteWrite) {
+	s.mu.Lock()
+	if len(s.queue) >= s.opts.QueueSize {
+		s.queue = s.queue[1:]
+		s.dropped++
+	}
+	s.seq++
+	s.queue = append(s.queue, queuedWrite{seq: s.seq, write: write})
+	s.mu.Unlock()
+
+	select {
+	case s.ready <- struct{}{}:
+	default:
+	}
+}
+
+// run sends the queued writes in batches, retrying a batch until the remote
+// cluster acknowledges it, so that writes are applied in order.
+func (s *remoteStream) run() {
+	for {
+		batch := s.peek()
+		if len(batch) == 0 {
+			select {
+			case <-s.ready:
+				continue
+			case <-s.done:
+				return
+			}
+		}
+
+		err := s.send(batch)
+		s.mu.Lock()
+		if err != nil {
+			s.lastError = err.Error()
+		} else {
+			s.lastError = ""
+			s.ackNoLock(batch)
+		}
+		s.mu.Unlock()
+
+		if err != nil {
+			logger.Warningf("Cannot replicate to remote cluster %s: %s", s.name, err.Error())
+			select {
+			case <-time.After(s.opts.RetryInterval):
+			case <-s.done:
+				return
+			}
+		}
+	}
+}
+
+func (s *remoteStream) peek() []queuedWrite {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	n := len(s.queue)
+	if n > s.opts.BatchSize {
+		n = s.opts.BatchSize
+	}
+	batch := make([]queuedWrite, n)
+	copy(batch, s.queue)
+
+	return batch
+}
+
+// ackNoLock removes the acknowledged batch from the head of the queue, that
+// is every write queued up to the last one of the batch. The writes of the
+// batch an overflow dropped meanwhile are already gone.
+func (s *remoteStream) ackNoLock(batch []queuedWrite) {
+	last := batch[len(batch)-1].seq
+
+	n := 0
+	for n < len(s.queue) && s.queue[n].seq <= last {
+		n++
+	}
+	s.queue = s.queue[n:]
+}
+
+func (s *remoteStream) send(batch []queuedWrite) error {
+	if s.client == nil {
+		if len(s.addresses) == 0 {
+			return ErrNoRemoteAddress
+		}
+
+		address := s.addresses[s.next%len(s.addresses)]
+		s.next++
+		client, err := rpc.Dial("tcp", address)
+		if err != nil {
+			return err
+		}
+		s.client = client
+	}
+
+	req := &ReplicateRemoteRequest{
+		Source: s.source,
+		Writes: make([]RemoteWrite, len(batch)),
+	}
+	for i, queued := range batch {
+		req.Writes[i] = queued.write
+	}
+	resp := &ReplicateRemoteResponse{}
+
+	var err error
+	call := s.client.Go(ReplicateRemoteOp, req, resp, nil)
+	select {
+	case <-call.Done:
+		err = call.Error
+	case <-time.After(s.opts.CallTimeout):
+		err = errors.New("replication call timed out")
+	}
+
+	if err != nil {
+		s.client.Close()
+		s.client = nil
+	}
+
+	return err
+}
+
+func (s *remoteStream) stats() RemoteStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stats := RemoteStats{
+		Pending:   len(s.queue),
+		Dropped:   s.dropped,
+		LastError: s.lastError,
+	}
+	if len(s.queue) > 0 {
+		stats.Lag = time.Since(time.Unix(0, s.queue[0].write.Accepted))
+	}
+
+	return stats
+}
+
+func (s *remoteStream) stop() {
+	close(s.done)
+}
+
+// WritePrometheus writes the replication state towards each remote cluster
+// in the Prometheus text format.
+func (r *Replicator) WritePrometheus(p *util.PrometheusWriter) {
+	stats := r.Stats()
+
+	names := make([]string, 0, len(stats))
+	for name := range stats {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	p.Family("swimring_replication_lag_seconds", "gauge", "Age of the oldest write not acknowledged by the remote cluster.")
+	for _, name := range names {
+		p.Sample("swimring_replication_lag_seconds", stats[name].Lag.Seconds(), "cluster", name)
+	}
+	p.Family("swimring_replication_pending_writes", "gauge", "Writes queued for the remote cluster.")
+	for _, name := range names {
+		p.Sample("swimring_replication_pending_writes", float64(stats[name].Pending), "cluster", name)
+	}
+	p.Family("swimring_replication_dropped_writes_total", "counter", "Writes dropped because the queue of the remote cluster was full.")
+	for _, name := range names {
+		p.Sample("swimring_replication_dropped_writes_total", float64(stats[name].Dropped), "cluster", name)
+	}
+}
@@ -0,0 +1,29 @@
+package replication
+
+import "testing"
+
+func TestRemoteStreamAckAfterOverflow(t *testing.T) {
+	s := newRemoteStream("dc1", "dc2", nil, mergeDefaultOptions(&Options{
+		BatchSize: 2,
+		QueueSize: 2,
+	}))
+
+	s.enqueue(RemoteWrite{Key: "a", Accepted: 1})
+	s.enqueue(RemoteWrite{Key: "b", Accepted: 1})
+	batch := s.peek()
+
+	// The queue overflows while the batch is in flight, dropping a.
+	s.enqueue(RemoteWrite{Key: "c", Accepted: 1})
+
+	s.mu.Lock()
+	s.ackNoLock(batch)
+	s.mu.Unlock()
+
+	pending := s.peek()
+	if len(pending) != 1 || pending[0].write.Key != "c" {
+		t.Fatalf("pending writes after ack = %v, want only c", pending)
+	}
+	if stats := s.stats(); stats.Dropped != 1 {
+		t.Fatalf("dropped writes = %d, want 1", stats.Dropped)
+	}
+}
@@ -0,0 +1,68 @@
+package storage
+
+import (
+	"sort"
+)
+
+// PutBatch updates the values of the given keys atomically on local KVS:
+// readers going through Get, GetMulti or ScanPage see either all of them or
+// none. Atomicity is local to this node. A crash while the batch is written
+// may leave only part of it in the commit log.
+func (k *KVStore) PutBatch(pairs map[string]string) error {
+	return k.putBatch(pairs, putOptions{})
+}
+
+// putBatch is as PutBatch, the writes being stamped as opts says. A batch
+// carrying the nonce of one already applied is ignored.
+func (k *KVStore) putBatch(pairs map[string]string, opts putOptions) error {
+	keys := make([]string, 0, len(pairs))
+	for key := range pairs {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	if k.readOnly {
+		return ErrReadOnly
+	}
+
+	if len(keys) > 0 && k.replayed(keys[0], opts.nonce) {
+		return nil
+	}
+
+	k.batch.Lock()
+	defer k.batch.Unlock()
+
+	// The nonce is recorded once the whole batch is written, as each key
+	// would otherwise take it for a replay of the previous one.
+	nonce := opts.nonce
+	opts.nonce = ""
+	for _, key := range keys {
+		if err := k.writeValue(key, pairs[key], opts); err != nil {
+			return err
+		}
+	}
+	k.nonces.record(nonce)
+
+	logger.Infof("Batch of %d keys updated to memtable", len(keys))
+
+	return nil
+}
+
+// GetMulti returns the entries of the given keys that exist, read together
+// so that a concurrent PutBatch is seen entirely or not at all.
+func (k *KVStore) GetMulti(keys []string) map[string]KVEntry {
+	values := make(map[string]KVEntry, len(keys))
+
+	k.batch.RLock()
+	for _, key := range keys {
+		if value, err := k.get(key); err == nil {
+			values[key] = *value
+		}
+	}
+	k.batch.RUnlock()
+
+	return values
+}
@@ -0,0 +1,152 @@
+package storage
+
+import (
+	"bytes"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"strings"
+
+	"go.etcd.io/bbolt"
+)
+
+var boltBucket = []byte("kvs")
+
+type boltStore struct {
+	db     *bbolt.DB
+	format int
+}
+
+func newBoltStore(address string, format int) (*boltStore, error) {
+	fileName := strings.Replace(address, ":", "_", -1) + "_kvs.db"
+
+	db, err := bbolt.Open(fileName, 0644, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	err = db.Update(func(tx *bbolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(boltBucket)
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	logger.Noticef("BoltDB storage opened at %s", fileName)
+
+	return &boltStore{db: db, format: format}, nil
+}
+
+// Get returns the entry of the given key.
+func (b *boltStore) Get(key string) (*KVEntry, bool) {
+	var entry *KVEntry
+
+	b.db.View(func(tx *bbolt.Tx) error {
+		data := tx.Bucket(boltBucket).Get([]byte(key))
+		if data == nil {
+			return nil
+		}
+
+		e, err := decodeEntry(data)
+		if err != nil {
+			logger.Errorf("Cannot decode entry of %s: %s", key, err.Error())
+			return err
+		}
+		entry = e
+		return nil
+	})
+
+	return entry, entry != nil
+}
+
+// Put stores the entry for the given key.
+func (b *boltStore) Put(key string, entry *KVEntry) error {
+	data, err := encodeEntry(entry, b.format)
+	if err != nil {
+		return err
+	}
+
+	return b.db.Update(func(tx *bbolt.Tx) error {
+		return tx.Bucket(boltBucket).Put([]byte(key), data)
+	})
+}
+
+// Delete removes the entry of the given key.
+func (b *boltStore) Delete(key string) error {
+	return b.db.Update(func(tx *bbolt.Tx) error {
+		return tx.Bucket(boltBucket).Delete([]byte(key))
+	})
+}
+
+// Scan calls fn for each entry whose key has the given prefix, in key order.
+func (b *boltStore) Scan(prefix string, fn func(key string, entry *KVEntry) bool) error {
+	return b.db.View(func(tx *bbolt.Tx) error {
+		c := tx.Bucket(boltBucket).Cursor()
+		p := []byte(prefix)
+
+		for k, v := c.Seek(p); k != nil && bytes.HasPrefix(k, p); k, v = c.Next() {
+			entry, err := decodeEntry(v)
+			if err != nil {
+				return err
+			}
+			if !fn(string(k), entry) {
+				break
+			}
+		}
+
+		return nil
+	})
+}
+
+// Count returns the number of entries.
+func (b *boltStore) Count() int {
+	n := 0
+	b.db.View(func(tx *bbolt.Tx) error {
+		n = tx.Bucket(boltBucket).Stats().KeyN
+		return nil
+	})
+
+	return n
+}
+
+// Close closes the underlying BoltDB file.
+func (b *boltStore) Close() error {
+	return b.db.Close()
+}
+
+func encodeEntry(entry *KVEntry, format int) ([]byte, error) {
+	var buf bytes.Buffer
+	buf.Write(entryFormatPrefix(format))
+	if err := gob.NewEncoder(&buf).Encode(entry); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// decodeEntry decodes an entry in any supported format.
+func decodeEntry(data []byte) (*KVEntry, error) {
+	if len(data) == 0 {
+		return nil, errors.New("empty entry")
+	}
+
+	if data[0] > maxEntryFormat {
+		return decodeGobEntry(data)
+	}
+
+	switch data[0] {
+	case EntryFormatV2, EntryFormatV3, EntryFormatV4:
+		return decodeGobEntry(data[1:])
+	}
+
+	return nil, fmt.Errorf("unsupported entry format version %d", data[0])
+}
+
+func decodeGobEntry(data []byte) (*KVEntry, error) {
+	entry := &KVEntry{}
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(entry); err != nil {
+		return nil, err
+	}
+	return entry, nil
+}
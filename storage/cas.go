@@ -0,0 +1,65 @@
+package storage
+
+import (
+	"errors"
+	"time"
+)
+
+// ErrCASMismatch is returned by CompareAndSwap when the key does not hold
+// the expected value.
+var ErrCASMismatch = errors.New("value does not match")
+
+// CASOp is a conditional write applied by CompareAndSwap.
+type CASOp struct {
+	// Expected is the value the key must hold or, if Absent is set, the key
+	// must not exist. An expired key does not exist.
+	Expected string
+	Absent   bool
+
+	// Value is written with TTL, if positive, unless Delete is set.
+	Value  string
+	Delete bool
+	TTL    time.Duration
+}
+
+// CompareAndSwap applies the given conditional write atomically, or
+// returns ErrCASMismatch if the key does not hold the expected value.
+func (k *KVStore) CompareAndSwap(key string, op CASOp) error {
+	return k.compareAndSwap(key, op, putOptions{})
+}
+
+// compareAndSwap is as CompareAndSwap, the write being stamped as opts says.
+func (k *KVStore) compareAndSwap(key string, op CASOp, opts putOptions) error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	if k.readOnly {
+		return ErrReadOnly
+	}
+
+	cur, err := k.Get(key)
+	switch {
+	case err != nil && err != ErrKeyNotFound:
+		return err
+	case op.Absent && cur != nil:
+		return ErrCASMismatch
+	case !op.Absent && (cur == nil || cur.Value != op.Expected):
+		return ErrCASMismatch
+	}
+
+	if op.Delete {
+		if cur == nil {
+			return nil
+		}
+		err = k.writeTombstone(key, opts)
+		if err == nil {
+			k.expiry.clear(key)
+		}
+		return err
+	}
+
+	if op.TTL > 0 {
+		opts.deadline = time.Now().Add(op.TTL).UnixNano()
+	}
+	return k.writeValue(key, op.Value, opts)
+}
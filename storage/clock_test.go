@@ -0,0 +1,34 @@
+package storage
+
+import (
+	"swimring/util"
+	"testing"
+	"time"
+)
+
+func TestStampPrunesClock(t *testing.T) {
+	now := time.Now()
+	clockOf := func(updated map[string]time.Duration) *util.VectorClock {
+		clock := util.NewVectorClock()
+		for node, age := range updated {
+			clock.Entries[node] = &util.ClockEntry{NodeID: node, Counter: 1, Updated: now.Add(-age)}
+		}
+		return clock
+	}
+
+	prev := &KVEntry{Clock: clockOf(map[string]time.Duration{"a": 3 * time.Second, "b": 2 * time.Second})}
+	opts := putOptions{clock: clockOf(map[string]time.Duration{"c": time.Second, "d": 0})}
+
+	_, clock := opts.stamp(prev, 3)
+	if len(clock.Entries) != 3 {
+		t.Fatalf("clock has %d entries, want 3", len(clock.Entries))
+	}
+	if _, ok := clock.Entries["a"]; ok {
+		t.Error("least recently updated entry not pruned")
+	}
+
+	_, clock = opts.stamp(prev, 0)
+	if len(clock.Entries) != 4 {
+		t.Fatalf("clock has %d entries without a cap, want 4", len(clock.Entries))
+	}
+}
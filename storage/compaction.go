@@ -0,0 +1,93 @@
+package storage
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// compact drops the superseded versions of each key that have been
+// superseded for longer than grace, as of now, and returns how many it
+// dropped. Entries carry no vector clock at this level, so a version is
+// dominated by the current one when its timestamp is older. Versions with
+// the same timestamp as the current one are concurrent siblings and are
+// kept, and so are tombstones until they are older than grace.
+func (h *versionHistory) compact(now int64, grace time.Duration) int {
+	horizon := now - int64(grace)
+	n := 0
+
+	h.Lock()
+	for key, versions := range h.versions {
+		current := versions[0]
+		kept := versions[:1]
+		for i, version := range versions[1:] {
+			superseded := versions[i].Timestamp
+			if version.Timestamp < current.Timestamp && superseded <= horizon {
+				continue
+			}
+			kept = append(kept, version)
+		}
+
+		if len(kept) == 1 && current.Exist == 0 && current.Timestamp <= horizon {
+			delete(h.versions, key)
+			n += len(versions)
+			continue
+		}
+		if len(kept) == len(versions) {
+			continue
+		}
+
+		n += len(versions) - len(kept)
+		h.versions[key] = append([]KVEntry(nil), kept...)
+	}
+	h.Unlock()
+
+	atomic.AddInt64(&h.compacted, int64(n))
+	return n
+}
+
+// compactHistory periodically drops the superseded versions kept for
+// GetHistory, so that the memory held by the history stays bounded by the
+// live versions rather than by every write ever made, and the tombstones
+// older than the grace period.
+func (k *KVStore) compactHistory() {
+	for range time.Tick(k.compactionInterval) {
+		now := time.Now().UnixNano()
+		if n := k.history.compact(now, k.versionGracePeriod); n > 0 {
+			logger.Infof("%d superseded versions compacted", n)
+		}
+		if n := k.purgeTombstones(now - int64(k.versionGracePeriod)); n > 0 {
+			logger.Infof("%d tombstones purged", n)
+		}
+	}
+}
+
+// purgeTombstones drops the tombstones written before horizon, in Unix
+// nanoseconds, along with the write sequence they kept, and returns how many
+// it dropped. A replica which missed a deletion for longer than the grace
+// period may then bring the key back.
+func (k *KVStore) purgeTombstones(horizon int64) int {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	var keys []string
+	k.memtable.Scan("", func(key string, entry *KVEntry) bool {
+		if entry.Exist == 0 && entry.Timestamp <= horizon {
+			keys = append(keys, key)
+		}
+		return true
+	})
+
+	n := 0
+	for _, key := range keys {
+		prev, _ := k.memtable.Get(key)
+		if err := k.memtable.Delete(key); err != nil {
+			logger.Errorf("Cannot purge tombstone of %s: %s", key, err.Error())
+			continue
+		}
+		k.resizeNoLock(key, prev, nil)
+		k.history.forget(key)
+		n++
+	}
+
+	return n
+}
@@ -0,0 +1,55 @@
+package storage
+
+import (
+	"strconv"
+
+	"github.com/dgryski/go-farm"
+)
+
+// Digests splits the local keys, tombstones included, into the given number
+// of buckets by key hash and returns a digest of each bucket. Two nodes hold
+// the same versions of a bucket's keys when its digests are equal, so only
+// the buckets whose digests differ need to be compared key by key. Nothing
+// is modified.
+func (k *KVStore) Digests(buckets int) []uint64 {
+	if buckets <= 0 {
+		return nil
+	}
+
+	digests := make([]uint64, buckets)
+	k.memtable.Scan("", func(key string, entry *KVEntry) bool {
+		digests[bucketOf(key, buckets)] ^= entryDigest(key, entry)
+		return true
+	})
+
+	return digests
+}
+
+// BucketEntries returns the local entries, tombstones included, of the
+// given bucket out of the given number of buckets.
+func (k *KVStore) BucketEntries(bucket, buckets int) map[string]KVEntry {
+	entries := make(map[string]KVEntry)
+	if buckets <= 0 {
+		return entries
+	}
+
+	k.memtable.Scan("", func(key string, entry *KVEntry) bool {
+		if bucketOf(key, buckets) == bucket {
+			entries[key] = *entry
+		}
+		return true
+	})
+
+	return entries
+}
+
+func bucketOf(key string, buckets int) int {
+	return int(farm.Fingerprint32([]byte(key)) % uint32(buckets))
+}
+
+// entryDigest hashes the key along with the version of its entry. Digests of
+// a bucket are combined with XOR, which does not depend on scan order.
+func entryDigest(key string, entry *KVEntry) uint64 {
+	version := key + " " + strconv.FormatInt(entry.Timestamp, 10) + " " + strconv.Itoa(entry.Exist)
+	return farm.Fingerprint64([]byte(version))
+}
@@ -0,0 +1,204 @@
+package storage
+
+import (
+	"container/list"
+	"swimring/util"
+	"sync"
+	"sync/atomic"
+)
+
+// evictionIndex orders the live keys from the most to the least recently
+// used, with the estimated size of their key and value, so that the coldest
+// ones can be evicted once the total goes over maxBytes.
+type evictionIndex struct {
+	evicted int64 // first for 64-bit alignment of atomic access
+
+	sync.Mutex
+	maxBytes int64
+	bytes    int64
+
+	lru  *list.List
+	keys map[string]*list.Element
+}
+
+type evictionEntry struct {
+	key  string
+	size int64
+}
+
+func newEvictionIndex(maxBytes int64) *evictionIndex {
+	return &evictionIndex{
+		maxBytes: maxBytes,
+		lru:      list.New(),
+		keys:     make(map[string]*list.Element),
+	}
+}
+
+func (e *evictionIndex) enabled() bool {
+	return e.maxBytes > 0
+}
+
+// touch marks the given key as the most recently used.
+func (e *evictionIndex) touch(key string) {
+	if !e.enabled() {
+		return
+	}
+
+	e.Lock()
+	if elem, ok := e.keys[key]; ok {
+		e.lru.MoveToFront(elem)
+	}
+	e.Unlock()
+}
+
+// set records the size of the given key and marks it as the most recently
+// used.
+func (e *evictionIndex) set(key string, size int64) {
+	if !e.enabled() {
+		return
+	}
+
+	e.Lock()
+	if elem, ok := e.keys[key]; ok {
+		entry := elem.Value.(*evictionEntry)
+		e.bytes += size - entry.size
+		entry.size = size
+		e.lru.MoveToFront(elem)
+	} else {
+		e.keys[key] = e.lru.PushFront(&evictionEntry{key: key, size: size})
+		e.bytes += size
+	}
+	e.Unlock()
+}
+
+func (e *evictionIndex) remove(key string) {
+	if !e.enabled() {
+		return
+	}
+
+	e.Lock()
+	if elem, ok := e.keys[key]; ok {
+		e.bytes -= elem.Value.(*evictionEntry).size
+		e.lru.Remove(elem)
+		delete(e.keys, key)
+	}
+	e.Unlock()
+}
+
+// victims removes the least recently used keys from the index until the
+// total fits in maxBytes, and returns them. The kept key, usually the one
+// just written, is never chosen.
+func (e *evictionIndex) victims(keep string) []string {
+	if !e.enabled() {
+		return nil
+	}
+
+	var keys []string
+
+	e.Lock()
+	for elem := e.lru.Back(); elem != nil && e.bytes > e.maxBytes; {
+		prev := elem.Prev()
+		entry := elem.Value.(*evictionEntry)
+		if entry.key != keep {
+			e.bytes -= entry.size
+			e.lru.Remove(elem)
+			delete(e.keys, entry.key)
+			keys = append(keys, entry.key)
+		}
+		elem = prev
+	}
+	e.Unlock()
+
+	atomic.AddInt64(&e.evicted, int64(len(keys)))
+	return keys
+}
+
+// entrySize estimates the memory held by the given entry: its key, value and
+// metadata.
+func entrySize(key string, entry *KVEntry) int64 {
+	return int64(len(key) + len(entry.Value) + util.MetadataSize(entry.Metadata))
+}
+
+// resizeNoLock updates the estimated memory held by local KVS for the given
+// key, whose entry prev, nil if none, was replaced by entry, nil if removed.
+// The caller must hold the lock.
+func (k *KVStore) resizeNoLock(key string, prev, entry *KVEntry) {
+	var delta int64
+	if prev != nil {
+		delta -= entrySize(key, prev)
+	}
+	if entry != nil {
+		delta += entrySize(key, entry)
+	}
+	atomic.AddInt64(&k.memoryBytes, delta)
+}
+
+// countMemoryUsage sets the estimated memory held by local KVS from the
+// entries recovered at startup.
+func (k *KVStore) countMemoryUsage() {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	var n int64
+	k.memtable.Scan("", func(key string, entry *KVEntry) bool {
+		n += entrySize(key, entry)
+		return true
+	})
+	atomic.StoreInt64(&k.memoryBytes, n)
+}
+
+// track records the new entry of the given key for eviction, and evicts the
+// coldest keys if local KVS is now over its memory limit. The caller must
+// hold the lock.
+func (k *KVStore) track(key string, entry *KVEntry) {
+	if !k.eviction.enabled() {
+		return
+	}
+
+	if entry.Exist == 0 {
+		k.eviction.remove(key)
+		return
+	}
+	k.eviction.set(key, entrySize(key, entry))
+
+	for _, victim := range k.eviction.victims(key) {
+		k.evictNoLock(victim)
+	}
+}
+
+// evictNoLock drops the given key from local KVS without writing a
+// tombstone, so that the eviction stays local and later reads of the key
+// are plain misses. The caller must hold the lock.
+func (k *KVStore) evictNoLock(key string) {
+	prev, _ := k.memtable.Get(key)
+	if err := k.memtable.Delete(key); err != nil {
+		logger.Errorf("Cannot evict key %s: %s", key, err.Error())
+		return
+	}
+	k.resizeNoLock(key, prev, nil)
+	k.history.forget(key)
+	k.expiry.clear(key)
+	k.index.remove(key)
+	k.updateKeyFilterNoLock(key, true, false)
+}
+
+// seedEviction records the entries recovered at startup for eviction, and
+// evicts the coldest ones if they do not fit in the memory limit.
+func (k *KVStore) seedEviction() {
+	if !k.eviction.enabled() {
+		return
+	}
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	k.memtable.Scan("", func(key string, entry *KVEntry) bool {
+		if entry.Exist != 0 {
+			k.eviction.set(key, entrySize(key, entry))
+		}
+		return true
+	})
+	for _, victim := range k.eviction.victims("") {
+		k.evictNoLock(victim)
+	}
+}
@@ -0,0 +1,43 @@
+package storage
+
+import "testing"
+
+// scanMemoryUsage sums the size of every entry of local KVS.
+func scanMemoryUsage(k *KVStore) int64 {
+	var n int64
+	k.memtable.Scan("", func(key string, entry *KVEntry) bool {
+		n += entrySize(key, entry)
+		return true
+	})
+	return n
+}
+
+func TestMemoryUsageFollowsWrites(t *testing.T) {
+	chdirTemp(t)
+
+	kvs := newTestKVStore(t, "node:1", &Options{MaxMemoryBytes: 64})
+	steps := []func(){
+		func() { kvs.Put("a", "12345678") },
+		func() { kvs.Put("b", "1234") },
+		func() { kvs.Put("a", "12") },
+		func() { kvs.Delete("b") },
+		// Goes over the limit, which evicts a.
+		func() { kvs.Put("c", string(make([]byte, 63))) },
+	}
+	for i, step := range steps {
+		step()
+		if got, want := kvs.MemoryUsage(), scanMemoryUsage(kvs); got != want {
+			t.Fatalf("step %d: MemoryUsage = %d, want %d", i, got, want)
+		}
+	}
+	if _, err := kvs.Get("a"); err != ErrKeyNotFound {
+		t.Fatalf("a not evicted: %v", err)
+	}
+	kvs.Close()
+
+	kvs = newTestKVStore(t, "node:1", nil)
+	defer kvs.Close()
+	if got, want := kvs.MemoryUsage(), scanMemoryUsage(kvs); got != want || got == 0 {
+		t.Fatalf("MemoryUsage = %d after restart, want %d", got, want)
+	}
+}
@@ -0,0 +1,179 @@
+package storage
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// expiryIndex keeps the expiry deadline of the keys written with a TTL, in
+// Unix nanoseconds.
+type expiryIndex struct {
+	expired int64 // first for 64-bit alignment of atomic access
+
+	sync.Mutex
+	deadlines map[string]int64
+}
+
+func newExpiryIndex() *expiryIndex {
+	return &expiryIndex{
+		deadlines: make(map[string]int64),
+	}
+}
+
+func (e *expiryIndex) set(key string, deadline int64) {
+	e.Lock()
+	e.deadlines[key] = deadline
+	e.Unlock()
+}
+
+func (e *expiryIndex) clear(key string) {
+	e.Lock()
+	delete(e.deadlines, key)
+	e.Unlock()
+}
+
+// deadline returns the deadline of the given key, if it has one.
+func (e *expiryIndex) deadline(key string) (int64, bool) {
+	e.Lock()
+	deadline, ok := e.deadlines[key]
+	e.Unlock()
+
+	return deadline, ok
+}
+
+// isExpired returns whether the given key has a deadline before now.
+func (e *expiryIndex) isExpired(key string, now int64) bool {
+	e.Lock()
+	deadline, ok := e.deadlines[key]
+	e.Unlock()
+
+	return ok && deadline <= now
+}
+
+// due returns the keys whose deadline is before now, along with their
+// deadline.
+func (e *expiryIndex) due(now int64) map[string]int64 {
+	due := make(map[string]int64)
+
+	e.Lock()
+	for key, deadline := range e.deadlines {
+		if deadline <= now {
+			due[key] = deadline
+		}
+	}
+	e.Unlock()
+
+	return due
+}
+
+// reap removes the deadline of the given key if it is still the given one,
+// i.e. the key was not rewritten since, and returns whether it did.
+func (e *expiryIndex) reap(key string, deadline int64) bool {
+	e.Lock()
+	defer e.Unlock()
+
+	if e.deadlines[key] != deadline {
+		return false
+	}
+	delete(e.deadlines, key)
+	return true
+}
+
+func (e *expiryIndex) size() int {
+	e.Lock()
+	n := len(e.deadlines)
+	e.Unlock()
+
+	return n
+}
+
+// PutWithTTL updates the value for the given key, which expires after ttl.
+// An expired key is reported as not found, and is eventually replaced with a
+// tombstone by the expiry sweeper. Deadlines are only kept in memory, so keys
+// recovered after a restart no longer expire.
+func (k *KVStore) PutWithTTL(key, value string, ttl time.Duration) error {
+	if ttl <= 0 {
+		return k.Put(key, value)
+	}
+
+	deadline := time.Now().Add(ttl).UnixNano()
+	return k.put(key, value, putOptions{deadline: deadline})
+}
+
+// NoExpiry is returned by TTL for a key without expiry.
+const NoExpiry time.Duration = -1
+
+// Expire sets the TTL of the given existing key without rewriting its
+// value. A non-positive ttl removes the expiry of the key. Like the other
+// deadlines, it is kept in memory only.
+func (k *KVStore) Expire(key string, ttl time.Duration) error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	if k.readOnly {
+		return ErrReadOnly
+	}
+	if _, err := k.Get(key); err != nil {
+		return err
+	}
+
+	if ttl <= 0 {
+		k.expiry.clear(key)
+	} else {
+		k.expiry.set(key, time.Now().Add(ttl).UnixNano())
+	}
+
+	return nil
+}
+
+// TTL returns the remaining time to live of the given key, or NoExpiry if
+// it does not expire.
+func (k *KVStore) TTL(key string) (time.Duration, error) {
+	if _, err := k.Get(key); err != nil {
+		return 0, err
+	}
+
+	deadline, ok := k.expiry.deadline(key)
+	if !ok {
+		return NoExpiry, nil
+	}
+
+	return time.Until(time.Unix(0, deadline)), nil
+}
+
+// sweepExpired periodically replaces the expired keys with tombstones, so
+// that their values are reclaimed even if they are never read again.
+func (k *KVStore) sweepExpired() {
+	for range time.Tick(k.sweepInterval) {
+		if n := k.sweep(); n > 0 {
+			logger.Infof("%d expired keys removed", n)
+		}
+	}
+}
+
+// sweep replaces the keys expired by now with tombstones and returns how
+// many it removed. The lock is taken for each key rather than for the whole
+// sweep, so that requests are not stalled behind it.
+func (k *KVStore) sweep() int {
+	n := 0
+
+	for key, deadline := range k.expiry.due(time.Now().UnixNano()) {
+		k.mu.Lock()
+		if k.readOnly || !k.expiry.reap(key, deadline) {
+			k.mu.Unlock()
+			continue
+		}
+		err := k.writeTombstone(key, putOptions{})
+		k.mu.Unlock()
+
+		if err != nil {
+			logger.Errorf("Cannot remove expired key %s: %s", key, err.Error())
+			continue
+		}
+		n++
+	}
+
+	atomic.AddInt64(&k.expiry.expired, int64(n))
+	return n
+}
@@ -0,0 +1,244 @@
+package storage
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"swimring/util"
+)
+
+// gzipMagic is the header starting every gzip stream.
+var gzipMagic = []byte{0x1f, 0x8b}
+
+// exportRecord is a single line of an export stream. Value is written in
+// base64, as values may hold any bytes, which a JSON string cannot carry.
+// Clock is the vector clock of the version, if the exporter knows it, and
+// Sequence the write sequence of the key, if any.
+type exportRecord struct {
+	Key       string            `json:"key"`
+	Value     []byte            `json:"value"`
+	Timestamp int64             `json:"timestamp"`
+	Deleted   bool              `json:"deleted,omitempty"`
+	Clock     *util.VectorClock `json:"clock,omitempty"`
+	Metadata  map[string]string `json:"metadata,omitempty"`
+	Sequence  int64             `json:"sequence,omitempty"`
+}
+
+// ConflictStrategy is what Import does with an entry whose key already
+// exists locally, a tombstone included.
+type ConflictStrategy string
+
+const (
+	// ConflictMerge keeps the dominant version. Versions are ordered by
+	// their vector clocks when both are known, and by timestamp otherwise.
+	// Concurrent versions are resolved by timestamp and counted as
+	// conflicted. It is the default.
+	ConflictMerge ConflictStrategy = "merge"
+	// ConflictSkip keeps the local version.
+	ConflictSkip ConflictStrategy = "skip"
+	// ConflictOverwrite replaces the local version, even if it is newer.
+	ConflictOverwrite ConflictStrategy = "overwrite"
+)
+
+// ImportOptions is a configuration struct passed into Import.
+type ImportOptions struct {
+	ConflictStrategy ConflictStrategy
+}
+
+// ImportStats are the counts of an Import. Imported entries were applied,
+// skipped ones lost to the local version, and conflicted ones were
+// concurrent with it, whichever was kept.
+type ImportStats struct {
+	Imported, Skipped, Conflicted int
+}
+
+// Export writes every entry of local KVS, tombstones included, to w as
+// newline-delimited JSON. The stream is gzip-compressed if compress is set.
+func (k *KVStore) Export(w io.Writer, compress bool) error {
+	if compress {
+		zw := gzip.NewWriter(w)
+		if err := k.export(zw); err != nil {
+			zw.Close()
+			return err
+		}
+		return zw.Close()
+	}
+
+	return k.export(w)
+}
+
+func (k *KVStore) export(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	enc := json.NewEncoder(bw)
+
+	var err error
+	scanErr := k.memtable.Scan("", func(key string, entry *KVEntry) bool {
+		err = enc.Encode(&exportRecord{
+			Key:       key,
+			Value:     []byte(entry.Value),
+			Timestamp: entry.Timestamp,
+			Deleted:   entry.Exist == 0,
+			Metadata:  entry.Metadata,
+			Sequence:  entry.Sequence,
+			Clock:     entry.Clock,
+		})
+		return err == nil
+	})
+	if err != nil {
+		return err
+	}
+	if scanErr != nil {
+		return scanErr
+	}
+
+	return bw.Flush()
+}
+
+// Import reads an export stream from r and applies its entries, resolving
+// those whose key exists locally with the conflict strategy of opts, the
+// newer version winning by default. Gzip-compressed streams are detected and
+// decompressed. Returns the counts of imported, skipped and conflicted
+// entries.
+func (k *KVStore) Import(r io.Reader, opts *ImportOptions) (ImportStats, error) {
+	var stats ImportStats
+	if opts == nil {
+		opts = &ImportOptions{}
+	}
+
+	switch opts.ConflictStrategy {
+	case "", ConflictMerge, ConflictSkip, ConflictOverwrite:
+	default:
+		return stats, fmt.Errorf("unknown conflict strategy %q", opts.ConflictStrategy)
+	}
+
+	br := bufio.NewReader(r)
+
+	var src io.Reader = br
+	if header, err := br.Peek(len(gzipMagic)); err == nil && string(header) == string(gzipMagic) {
+		zr, err := gzip.NewReader(br)
+		if err != nil {
+			return stats, err
+		}
+		defer zr.Close()
+		src = zr
+	}
+
+	dec := json.NewDecoder(src)
+	for {
+		var record exportRecord
+		if err := dec.Decode(&record); err == io.EOF {
+			return stats, nil
+		} else if err != nil {
+			return stats, err
+		}
+
+		if err := k.importRecord(&record, opts, &stats); err != nil {
+			return stats, err
+		}
+	}
+}
+
+func (k *KVStore) importRecord(record *exportRecord, opts *ImportOptions, stats *ImportStats) error {
+	entry := KVEntry{
+		Value:     string(record.Value),
+		Timestamp: record.Timestamp,
+		Exist:     1,
+		Metadata:  record.Metadata,
+		Sequence:  record.Sequence,
+		Clock:     record.Clock,
+	}
+	if record.Deleted {
+		entry.Value, entry.Exist, entry.Metadata = "", 0, nil
+	}
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	if k.readOnly {
+		return ErrReadOnly
+	}
+	cur, ok := k.memtable.Get(record.Key)
+	if ok && !k.importWins(record, cur, opts, stats) {
+		stats.Skipped++
+		return nil
+	}
+
+	// The imported version replaces the local one, but not its sequence if
+	// greater, so that the fence of the key never goes back.
+	if ok && cur.Sequence > entry.Sequence {
+		entry.Sequence = cur.Sequence
+	}
+
+	existed := k.existsNoLock(record.Key)
+	if err := k.appendToCommitLog(record.Key, &entry); err != nil {
+		return err
+	}
+	if err := k.memtable.Put(record.Key, &entry); err != nil {
+		return err
+	}
+	k.resizeNoLock(record.Key, cur, &entry)
+	k.history.record(record.Key, cur, entry)
+	k.track(record.Key, &entry)
+	k.updateKeyFilterNoLock(record.Key, existed, entry.Exist == 1)
+	stats.Imported++
+
+	return nil
+}
+
+// importWins returns whether an imported record replaces the local version
+// of its key, cur.
+func (k *KVStore) importWins(record *exportRecord, cur *KVEntry, opts *ImportOptions, stats *ImportStats) bool {
+	switch opts.ConflictStrategy {
+	case ConflictSkip:
+		return false
+	case ConflictOverwrite:
+		return true
+	}
+
+	if record.Clock != nil && cur.Clock != nil {
+		switch record.Clock.Compare(cur.Clock) {
+		case "NEWER":
+			return true
+		case "CONCURRENT":
+			stats.Conflicted++
+		default:
+			return false
+		}
+	}
+
+	return record.Timestamp > cur.Timestamp
+}
+
+// ExportFile exports local KVS to the named file, compressed with gzip if
+// the name ends with .gz.
+func (k *KVStore) ExportFile(name string) error {
+	f, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+
+	err = k.Export(f, strings.HasSuffix(name, ".gz"))
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+
+	return err
+}
+
+// ImportFile imports the named export file into local KVS.
+func (k *KVStore) ImportFile(name string, opts *ImportOptions) (ImportStats, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return ImportStats{}, err
+	}
+	defer f.Close()
+
+	return k.Import(f, opts)
+}
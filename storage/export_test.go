@@ -0,0 +1,70 @@
+package storage
+
+import (
+	"bytes"
+	"swimring/util"
+	"testing"
+)
+
+func TestExportImportBinaryValue(t *testing.T) {
+	chdirTemp(t)
+
+	value := string([]byte{0xff, 0x00, 0xfe, '"', '\n'})
+
+	src := newTestKVStore(t, "node:1", nil)
+	defer src.Close()
+	src.Put("bin", value)
+
+	var buf bytes.Buffer
+	if err := src.Export(&buf, false); err != nil {
+		t.Fatal(err)
+	}
+
+	dst := newTestKVStore(t, "node:2", nil)
+	defer dst.Close()
+	if _, err := dst.Import(&buf, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	entry, err := dst.Get("bin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entry.Value != value {
+		t.Fatalf("imported value %q, want %q", entry.Value, value)
+	}
+}
+
+func TestImportMergesByClock(t *testing.T) {
+	chdirTemp(t)
+
+	k := newTestKVStore(t, "node:1", nil)
+	defer k.Close()
+
+	clockOf := func(counters map[string]int) *util.VectorClock {
+		clock := util.NewVectorClock()
+		for node, counter := range counters {
+			clock.Entries[node] = &util.ClockEntry{NodeID: node, Counter: counter}
+		}
+		return clock
+	}
+
+	// The local version has the later timestamp, but the received one
+	// descends from it and must win.
+	k.Receive("key", KVEntry{Value: "old", Exist: 1, Timestamp: 2, Clock: clockOf(map[string]int{"a": 1})})
+	k.Receive("key", KVEntry{Value: "new", Exist: 1, Timestamp: 1, Clock: clockOf(map[string]int{"a": 1, "b": 1})})
+
+	entry, err := k.Get("key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entry.Value != "new" {
+		t.Fatalf("value %q after a descending version, want %q", entry.Value, "new")
+	}
+
+	// An ancestor is skipped, whatever its timestamp.
+	k.Receive("key", KVEntry{Value: "stale", Exist: 1, Timestamp: 3, Clock: clockOf(map[string]int{"a": 1})})
+	if entry, _ := k.Get("key"); entry.Value != "new" {
+		t.Fatalf("value %q after an ancestor version, want %q", entry.Value, "new")
+	}
+}
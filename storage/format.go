@@ -0,0 +1,73 @@
+package storage
+
+import (
+	"bufio"
+	"fmt"
+)
+
+// Entry format versions. The entries stored in the commit log, the dump file
+// and the BoltDB backend carry the version of their encoding, so that a node
+// keeps reading the data written by older versions after an upgrade.
+const (
+	// EntryFormatV1 is the encoding used before format versions, without a
+	// version byte: a text record in the commit log and the dump file, and a
+	// gob encoding in BoltDB. It is still read, and can still be written so
+	// that a node can be downgraded to a version which does not know format
+	// versions.
+	EntryFormatV1 = 1
+	// EntryFormatV2 is the encoding of EntryFormatV1 prefixed with the
+	// version byte.
+	EntryFormatV2 = 2
+	// EntryFormatV3 adds the write sequence of the key to the text record,
+	// after the timestamp. The gob encoding is that of EntryFormatV2, which
+	// already carries every field of KVEntry.
+	EntryFormatV3 = 3
+	// EntryFormatV4 adds the vector clock of the version to the text record,
+	// after the sequence, as JSON prefixed with its length like the key and
+	// the value. The gob encoding is again that of EntryFormatV2.
+	EntryFormatV4 = 4
+
+	// CurrentEntryFormat is the format written by default.
+	CurrentEntryFormat = EntryFormatV4
+
+	// maxEntryFormat is the largest byte reserved for format versions. An
+	// entry in EntryFormatV1 starts with a digit in text, and with the length
+	// of the gob type definition of KVEntry in BoltDB, both above it.
+	maxEntryFormat = 15
+)
+
+// validEntryFormat returns whether the given format can be written.
+func validEntryFormat(format int) bool {
+	return format >= EntryFormatV1 && format <= CurrentEntryFormat
+}
+
+// entryFormatPrefix returns the version byte starting the entries written
+// in the given format, if any.
+func entryFormatPrefix(format int) []byte {
+	if format == EntryFormatV1 {
+		return nil
+	}
+	return []byte{byte(format)}
+}
+
+// readEntryFormat consumes the version byte of the next record of a commit
+// log or dump file, if any, and returns the format of the record.
+func readEntryFormat(f *bufio.Reader) (int, error) {
+	b, err := f.Peek(1)
+	if err != nil {
+		return 0, err
+	}
+
+	version := b[0]
+	if version > maxEntryFormat {
+		return EntryFormatV1, nil
+	}
+
+	f.ReadByte()
+	switch version {
+	case EntryFormatV2, EntryFormatV3, EntryFormatV4:
+		return int(version), nil
+	}
+
+	return 0, fmt.Errorf("unsupported entry format version %d", version)
+}
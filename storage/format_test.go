@@ -0,0 +1,126 @@
+package storage
+
+import (
+	"bufio"
+	"bytes"
+	"reflect"
+	"strconv"
+	"strings"
+	"swimring/util"
+	"testing"
+	"time"
+)
+
+// gobEntryV1 is a KVEntry with Value "value", Timestamp 123 and Exist 1 as
+// encoded in BoltDB before format versions, from a KVEntry without metadata
+// or sequence.
+const gobEntryV1 = "6\x7f\x03\x01\x01\aKVEntry\x01\xff\x80\x00\x01\x03\x01\x05Value\x01\f\x00" +
+	"\x01\tTimestamp\x01\x04\x00\x01\x05Exist\x01\x04\x00\x00\x00\x0f\xff\x80\x01\x05value\x01\xff\xf6\x01\x02\x00"
+
+func TestReadRecordFormats(t *testing.T) {
+	tests := []struct {
+		name   string
+		record string
+		want   KVEntry
+	}{
+		{"v1", "3 key 5 value 123 1\n", KVEntry{Value: "value", Timestamp: 123, Exist: 1}},
+		{"v1 tombstone", "3 key 0  123 0\n", KVEntry{Timestamp: 123}},
+		{"v2", "\x023 key 5 value 123 1\n", KVEntry{Value: "value", Timestamp: 123, Exist: 1}},
+		{"v2 metadata", "\x023 key 5 value 123 1 {\"type\":\"text\"}\n",
+			KVEntry{Value: "value", Timestamp: 123, Exist: 1, Metadata: map[string]string{"type": "text"}}},
+		{"v3", "\x033 key 5 value 123 7 1\n", KVEntry{Value: "value", Timestamp: 123, Exist: 1, Sequence: 7}},
+		{"v3 metadata", "\x033 key 5 value 123 7 1 {\"type\":\"text\"}\n",
+			KVEntry{Value: "value", Timestamp: 123, Exist: 1, Metadata: map[string]string{"type": "text"}, Sequence: 7}},
+		{"v4", "\x043 key 5 value 123 7 0  1\n", KVEntry{Value: "value", Timestamp: 123, Exist: 1, Sequence: 7}},
+		{"v4 clock", "\x043 key 5 value 123 7 " + strconv.Itoa(len(clockJSON)) + " " + clockJSON + " 1\n",
+			KVEntry{Value: "value", Timestamp: 123, Exist: 1, Sequence: 7, Clock: testClock()}},
+	}
+
+	for _, test := range tests {
+		key, entry, n, err := readRecord(bufio.NewReader(strings.NewReader(test.record)))
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		if key != "key" || !reflect.DeepEqual(*entry, test.want) {
+			t.Errorf("%s: got %q %+v, want key %+v", test.name, key, *entry, test.want)
+		}
+		if n != int64(len(test.record)) {
+			t.Errorf("%s: size %d, want %d", test.name, n, len(test.record))
+		}
+	}
+
+	if _, _, _, err := readRecord(bufio.NewReader(strings.NewReader("\x093 key 5 value 123 1\n"))); err == nil {
+		t.Error("record of an unknown format version read")
+	}
+}
+
+// clockJSON is the text encoding of testClock.
+const clockJSON = `{"Entries":{"n":{"NodeID":"n","Counter":2,"Updated":"1970-01-01T00:01:40Z"}}}`
+
+func testClock() *util.VectorClock {
+	return &util.VectorClock{Entries: map[string]*util.ClockEntry{
+		"n": {NodeID: "n", Counter: 2, Updated: time.Unix(100, 0).UTC()},
+	}}
+}
+
+func TestWriteRecordFormats(t *testing.T) {
+	entry := &KVEntry{Value: "value", Timestamp: 123, Exist: 1, Sequence: 7, Clock: testClock()}
+
+	want := map[int]string{
+		EntryFormatV1: "3 key 5 value 123 1\n",
+		EntryFormatV2: "\x023 key 5 value 123 1\n",
+		EntryFormatV3: "\x033 key 5 value 123 7 1\n",
+		EntryFormatV4: "\x043 key 5 value 123 7 " + strconv.Itoa(len(clockJSON)) + " " + clockJSON + " 1\n",
+	}
+	for format, record := range want {
+		var buf bytes.Buffer
+		if _, err := writeKeyValueToFile(&buf, "key", entry, format); err != nil {
+			t.Fatal(err)
+		}
+		if buf.String() != record {
+			t.Errorf("format %d: wrote %q, want %q", format, buf.String(), record)
+		}
+	}
+}
+
+func TestDecodeEntryFormats(t *testing.T) {
+	want := KVEntry{Value: "value", Timestamp: 123, Exist: 1}
+
+	fixtures := map[string]string{
+		"v1": gobEntryV1,
+		"v2": "\x02" + gobEntryV1,
+		"v3": "\x03" + gobEntryV1,
+		"v4": "\x04" + gobEntryV1,
+	}
+	for name, data := range fixtures {
+		entry, err := decodeEntry([]byte(data))
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+			continue
+		}
+		if !reflect.DeepEqual(*entry, want) {
+			t.Errorf("%s: got %+v, want %+v", name, *entry, want)
+		}
+	}
+
+	if _, err := decodeEntry([]byte("\x09" + gobEntryV1)); err == nil {
+		t.Error("entry of an unknown format version decoded")
+	}
+
+	// Entries are written with their version byte, except in EntryFormatV1.
+	entry := &KVEntry{Value: "value", Timestamp: 123, Exist: 1, Sequence: 7, Clock: testClock()}
+	for _, format := range []int{EntryFormatV1, EntryFormatV2, EntryFormatV3, EntryFormatV4} {
+		data, err := encodeEntry(entry, format)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if format != EntryFormatV1 && data[0] != byte(format) {
+			t.Errorf("format %d: version byte %d", format, data[0])
+		}
+		got, err := decodeEntry(data)
+		if err != nil || !reflect.DeepEqual(got, entry) {
+			t.Errorf("format %d: decoded %+v, %v, want %+v", format, got, err, entry)
+		}
+	}
+}
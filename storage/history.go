@@ -0,0 +1,70 @@
+package storage
+
+import (
+	"sync"
+)
+
+// versionHistory keeps the last versions of each key in memory, newest
+// first, tombstones included.
+type versionHistory struct {
+	compacted int64 // first for 64-bit alignment of atomic access
+
+	sync.RWMutex
+	maxVersions int
+	versions    map[string][]KVEntry
+}
+
+func newVersionHistory(maxVersions int) *versionHistory {
+	return &versionHistory{
+		maxVersions: maxVersions,
+		versions:    make(map[string][]KVEntry),
+	}
+}
+
+// enabled returns whether versions older than the current one are kept. The
+// current version is held by the memtable.
+func (h *versionHistory) enabled() bool {
+	return h.maxVersions > 1
+}
+
+// record adds a version of the given key, which replaced prev, dropping the
+// oldest one when the key already holds maxVersions versions. The history of
+// a key starts from prev, if any, such as the version recovered at startup.
+func (h *versionHistory) record(key string, prev *KVEntry, entry KVEntry) {
+	if !h.enabled() {
+		return
+	}
+
+	h.Lock()
+	defer h.Unlock()
+
+	versions := h.versions[key]
+	if len(versions) == 0 && prev != nil {
+		versions = []KVEntry{*prev}
+	}
+	if len(versions) > 0 && versions[0].Timestamp > entry.Timestamp {
+		return
+	}
+
+	if len(versions) >= h.maxVersions {
+		versions = versions[:h.maxVersions-1]
+	}
+	h.versions[key] = append([]KVEntry{entry}, versions...)
+}
+
+// forget drops every version of the given key.
+func (h *versionHistory) forget(key string) {
+	h.Lock()
+	delete(h.versions, key)
+	h.Unlock()
+}
+
+// get returns a copy of the versions of the given key, newest first.
+func (h *versionHistory) get(key string) []KVEntry {
+	h.RLock()
+	versions := make([]KVEntry, len(h.versions[key]))
+	copy(versions, h.versions[key])
+	h.RUnlock()
+
+	return versions
+}
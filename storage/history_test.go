@@ -0,0 +1,30 @@
+package storage
+
+import "testing"
+
+func TestHistoryKeptAboveOneVersion(t *testing.T) {
+	chdirTemp(t)
+
+	kvs := newTestKVStore(t, "node:1", nil)
+	kvs.Put("a", "1")
+	kvs.Put("a", "2")
+	if n := len(kvs.history.versions); n != 0 {
+		t.Fatalf("history holds %d keys with MaxVersionsPerKey 1", n)
+	}
+	if versions, _ := kvs.GetHistory("a"); len(versions) != 1 || versions[0].Value != "2" {
+		t.Fatalf("GetHistory = %v, want the current version", versions)
+	}
+	kvs.Close()
+
+	kvs = newTestKVStore(t, "node:1", &Options{MaxVersionsPerKey: 3})
+	defer kvs.Close()
+	if n := len(kvs.history.versions); n != 0 {
+		t.Fatalf("history holds %d keys after replay", n)
+	}
+
+	kvs.Put("a", "3")
+	versions, _ := kvs.GetHistory("a")
+	if len(versions) != 2 || versions[0].Value != "3" || versions[1].Value != "2" {
+		t.Fatalf("GetHistory = %v, want 3 then the recovered 2", versions)
+	}
+}
@@ -0,0 +1,152 @@
+package storage
+
+import (
+	"encoding/json"
+	"errors"
+	"sort"
+	"sync"
+)
+
+// ErrNotIndexable is returned by PutIndexed when the value is not a JSON
+// object holding the indexed field.
+var ErrNotIndexable = errors.New("value is not a JSON object with the indexed field")
+
+// secondaryIndex is an inverted index mapping the value of a field to the
+// keys holding it. Each key is indexed on the field given by its last write.
+type secondaryIndex struct {
+	sync.RWMutex
+	postings map[string]map[string]map[string]struct{}
+	entries  map[string]indexEntry
+}
+
+type indexEntry struct {
+	field, value string
+}
+
+func newSecondaryIndex() *secondaryIndex {
+	return &secondaryIndex{
+		postings: make(map[string]map[string]map[string]struct{}),
+		entries:  make(map[string]indexEntry),
+	}
+}
+
+// set indexes the key under the given field value, replacing its previous
+// index entry if any.
+func (x *secondaryIndex) set(key, field, value string) {
+	x.Lock()
+	defer x.Unlock()
+
+	x.removeNoLock(key)
+
+	values, ok := x.postings[field]
+	if !ok {
+		values = make(map[string]map[string]struct{})
+		x.postings[field] = values
+	}
+	keys, ok := values[value]
+	if !ok {
+		keys = make(map[string]struct{})
+		values[value] = keys
+	}
+
+	keys[key] = struct{}{}
+	x.entries[key] = indexEntry{field: field, value: value}
+}
+
+// remove drops the index entry of the key, if any.
+func (x *secondaryIndex) remove(key string) {
+	x.RLock()
+	_, ok := x.entries[key]
+	x.RUnlock()
+
+	if !ok {
+		return
+	}
+
+	x.Lock()
+	x.removeNoLock(key)
+	x.Unlock()
+}
+
+func (x *secondaryIndex) removeNoLock(key string) {
+	entry, ok := x.entries[key]
+	if !ok {
+		return
+	}
+
+	delete(x.entries, key)
+	keys := x.postings[entry.field][entry.value]
+	delete(keys, key)
+	if len(keys) == 0 {
+		delete(x.postings[entry.field], entry.value)
+	}
+	if len(x.postings[entry.field]) == 0 {
+		delete(x.postings, entry.field)
+	}
+}
+
+// lookup returns the keys indexed under the given field value.
+func (x *secondaryIndex) lookup(field, value string) []string {
+	x.RLock()
+	keys := make([]string, 0, len(x.postings[field][value]))
+	for key := range x.postings[field][value] {
+		keys = append(keys, key)
+	}
+	x.RUnlock()
+
+	return keys
+}
+
+// indexValue returns the value of the given field in a JSON object, as is
+// for strings and JSON-encoded otherwise.
+func indexValue(value, field string) (string, error) {
+	var object map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(value), &object); err != nil {
+		return "", ErrNotIndexable
+	}
+
+	raw, ok := object[field]
+	if !ok {
+		return "", ErrNotIndexable
+	}
+
+	var s string
+	if err := json.Unmarshal(raw, &s); err == nil {
+		return s, nil
+	}
+	return string(raw), nil
+}
+
+// CheckIndexable returns ErrNotIndexable unless the value is a JSON object
+// holding the given field, which PutIndexed can index.
+func CheckIndexable(value, field string) error {
+	_, err := indexValue(value, field)
+	return err
+}
+
+// PutIndexed updates the value for the given key, like Put, and indexes the
+// key on a field of the value, which must be a JSON object. The key can then
+// be found with QueryIndex by the value of that field. The index is kept in
+// memory only, so it restarts empty after a restart.
+func (k *KVStore) PutIndexed(key, value, field string) error {
+	indexed, err := indexValue(value, field)
+	if err != nil {
+		return err
+	}
+
+	return k.put(key, value, putOptions{indexField: field, indexValue: indexed})
+}
+
+// QueryIndex returns the keys whose value was indexed with the given field
+// value, in ascending order.
+func (k *KVStore) QueryIndex(field, value string) []string {
+	var keys []string
+	for _, key := range k.index.lookup(field, value) {
+		if _, err := k.Get(key); err == nil {
+			keys = append(keys, key)
+		}
+	}
+
+	sort.Strings(keys)
+	return keys
+}
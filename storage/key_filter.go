@@ -0,0 +1,257 @@
+package storage
+
+import (
+	"math"
+	"sync"
+	"sync/atomic"
+
+	"github.com/dgryski/go-farm"
+)
+
+const (
+	// minKeyFilterCapacity is the number of keys the key filter is sized for
+	// at least.
+	minKeyFilterCapacity = 1024
+)
+
+// keyFilter is a counting bloom filter of the keys holding a live value in
+// local KVS, so that a read of a key definitely absent is answered without
+// a lookup. A counter is kept per position so that deleted keys can be
+// removed. A counter which reached its maximum is never decremented, which
+// only adds false positives. The filter is sized for twice the live keys
+// when rebuilt, and rebuilt once they exceed that capacity.
+type keyFilter struct {
+	rejected int64 // first for 64-bit alignment of atomic access
+
+	sync.RWMutex
+	fpRate   float64
+	counters []uint8
+	hashes   int
+	capacity int
+	keys     int
+}
+
+// KeyFilterSnapshot is a copy of the key filter of a node, one bit per
+// position, for a coordinator to skip the replicas definitely not holding a
+// key. It does not include the keys written after it was taken, so it must
+// be refreshed at least as often as the staleness the reads tolerate. A
+// zero snapshot may contain any key.
+type KeyFilterSnapshot struct {
+	Bits   []byte
+	Size   uint64
+	Hashes int
+}
+
+func newKeyFilter(fpRate float64) *keyFilter {
+	if fpRate <= 0 || fpRate >= 1 {
+		return &keyFilter{}
+	}
+
+	return &keyFilter{
+		fpRate: fpRate,
+	}
+}
+
+func (f *keyFilter) enabled() bool {
+	return f.fpRate > 0
+}
+
+// rebuild replaces the content of the filter with the given keys, sized for
+// twice their number at the false positive rate. The counters are filled
+// before being swapped in, so that reads never miss a key meanwhile.
+func (f *keyFilter) rebuild(keys []string) {
+	capacity := 2 * len(keys)
+	if capacity < minKeyFilterCapacity {
+		capacity = minKeyFilterCapacity
+	}
+
+	size := uint64(math.Ceil(-float64(capacity) * math.Log(f.fpRate) / (math.Ln2 * math.Ln2)))
+	hashes := int(math.Round(float64(size) / float64(capacity) * math.Ln2))
+	if hashes < 1 {
+		hashes = 1
+	}
+
+	counters := make([]uint8, size)
+	for _, key := range keys {
+		forEachPosition(key, size, hashes, func(i uint64) {
+			if counters[i] < math.MaxUint8 {
+				counters[i]++
+			}
+		})
+	}
+
+	f.Lock()
+	f.counters = counters
+	f.hashes = hashes
+	f.capacity = capacity
+	f.keys = len(keys)
+	f.Unlock()
+}
+
+// add records a key which now holds a live value, and returns whether the
+// filter is over its capacity.
+func (f *keyFilter) add(key string) bool {
+	f.Lock()
+	defer f.Unlock()
+
+	forEachPosition(key, uint64(len(f.counters)), f.hashes, func(i uint64) {
+		if f.counters[i] < math.MaxUint8 {
+			f.counters[i]++
+		}
+	})
+	f.keys++
+
+	return f.keys > f.capacity
+}
+
+// remove forgets a key which no longer holds a live value.
+func (f *keyFilter) remove(key string) {
+	f.Lock()
+	defer f.Unlock()
+
+	forEachPosition(key, uint64(len(f.counters)), f.hashes, func(i uint64) {
+		if f.counters[i] > 0 && f.counters[i] < math.MaxUint8 {
+			f.counters[i]--
+		}
+	})
+	if f.keys > 0 {
+		f.keys--
+	}
+}
+
+// mayContain returns false if the given key definitely holds no live value.
+// A disabled filter may contain any key.
+func (f *keyFilter) mayContain(key string) bool {
+	if !f.enabled() {
+		return true
+	}
+
+	f.RLock()
+	defer f.RUnlock()
+
+	found := true
+	forEachPosition(key, uint64(len(f.counters)), f.hashes, func(i uint64) {
+		if f.counters[i] == 0 {
+			found = false
+		}
+	})
+	if !found {
+		atomic.AddInt64(&f.rejected, 1)
+	}
+
+	return found
+}
+
+func (f *keyFilter) snapshot() KeyFilterSnapshot {
+	if !f.enabled() {
+		return KeyFilterSnapshot{}
+	}
+
+	f.RLock()
+	defer f.RUnlock()
+
+	s := KeyFilterSnapshot{
+		Bits:   make([]byte, (len(f.counters)+7)/8),
+		Size:   uint64(len(f.counters)),
+		Hashes: f.hashes,
+	}
+	for i, counter := range f.counters {
+		if counter > 0 {
+			s.Bits[i/8] |= 1 << uint(i%8)
+		}
+	}
+
+	return s
+}
+
+// MayContain returns false if the given key definitely held no live value on
+// the node when the snapshot was taken.
+func (s *KeyFilterSnapshot) MayContain(key string) bool {
+	if s.Size == 0 {
+		return true
+	}
+
+	found := true
+	forEachPosition(key, s.Size, s.Hashes, func(i uint64) {
+		if s.Bits[i/8]&(1<<uint(i%8)) == 0 {
+			found = false
+		}
+	})
+
+	return found
+}
+
+// forEachPosition calls fn with the positions of the given key among size,
+// derived from two halves of a single hash.
+func forEachPosition(key string, size uint64, hashes int, fn func(i uint64)) {
+	if size == 0 {
+		return
+	}
+
+	h := farm.Hash64([]byte(key))
+	h1, h2 := h&math.MaxUint32, h>>32
+	for i := 0; i < hashes; i++ {
+		fn((h1 + uint64(i)*h2) % size)
+	}
+}
+
+// KeyFilter returns a snapshot of the key filter of local KVS.
+func (k *KVStore) KeyFilter() KeyFilterSnapshot {
+	return k.filter.snapshot()
+}
+
+// RebuildKeyFilter rebuilds the key filter from the keys of local KVS, which
+// drops the keys it kept counting after they left the node without a
+// deletion, such as evicted keys or keys moved away by a rebalance.
+func (k *KVStore) RebuildKeyFilter() {
+	if !k.filter.enabled() {
+		return
+	}
+
+	k.mu.Lock()
+	k.rebuildKeyFilterNoLock()
+	k.mu.Unlock()
+}
+
+// rebuildKeyFilterNoLock rebuilds the key filter, sized for twice the live
+// keys. The caller must hold the lock, so that no write is missed.
+func (k *KVStore) rebuildKeyFilterNoLock() {
+	var keys []string
+	k.memtable.Scan("", func(key string, entry *KVEntry) bool {
+		if entry.Exist == 1 {
+			keys = append(keys, key)
+		}
+		return true
+	})
+
+	k.filter.rebuild(keys)
+	logger.Infof("Key filter rebuilt for %d keys", len(keys))
+}
+
+// existsNoLock returns whether the given key holds a live value, or false if
+// the key filter is disabled. The caller must hold the lock.
+func (k *KVStore) existsNoLock(key string) bool {
+	if !k.filter.enabled() {
+		return false
+	}
+
+	entry, ok := k.memtable.Get(key)
+	return ok && entry.Exist == 1
+}
+
+// updateKeyFilterNoLock records in the key filter a write of the given key,
+// which existed or not before and exists or not after, and grows the filter
+// once it is over its capacity. The caller must hold the lock.
+func (k *KVStore) updateKeyFilterNoLock(key string, existed, exists bool) {
+	if !k.filter.enabled() || existed == exists {
+		return
+	}
+
+	if !exists {
+		k.filter.remove(key)
+		return
+	}
+	if k.filter.add(key) {
+		k.rebuildKeyFilterNoLock()
+	}
+}
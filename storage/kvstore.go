@@ -2,14 +2,17 @@ package storage
 
 import (
 	"bufio"
+	"encoding/json"
 	"errors"
-	"io/ioutil"
+	"fmt"
+	"io"
 	"net/rpc"
 	"os"
-	"regexp"
 	"strconv"
 	"strings"
+	"swimring/util"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/op/go-logging"
@@ -17,17 +20,154 @@ import (
 
 var logger = logging.MustGetLogger("storage")
 
+var (
+	// ErrKeyNotFound is returned when the key does not exist or was deleted.
+	ErrKeyNotFound = errors.New("key not found")
+	// ErrReadOnly is returned by writes while the node is in read-only mode.
+	ErrReadOnly = errors.New("node is read-only")
+)
+
+// Options is a configuration struct passed into NewKVStore constructor.
+type Options struct {
+	Backend string
+
+	CheckpointInterval time.Duration
+	WALSegmentSize     int64
+
+	// MaxVersionsPerKey is the number of versions of each key, the current
+	// one included, returned by GetHistory.
+	MaxVersionsPerKey int
+
+	// MigrationKeysPerSec and MigrationBytesPerSec limit the rate of key
+	// transfers while rebalancing, zero meaning unlimited, and
+	// MaxMigrationTransfers caps the transfers in flight.
+	MigrationKeysPerSec   int64
+	MigrationBytesPerSec  int64
+	MaxMigrationTransfers int
+
+	// ExpirySweepInterval is how often the keys written with a TTL are
+	// checked for expiry.
+	ExpirySweepInterval time.Duration
+
+	// CompactionInterval is how often the superseded versions kept for
+	// GetHistory are compacted, and VersionGracePeriod how long a superseded
+	// version or a tombstone is kept before it can be compacted.
+	CompactionInterval time.Duration
+	VersionGracePeriod time.Duration
+
+	// RepairMaxRequestsPerSec and RepairMaxInFlight are the request rate and
+	// the requests in progress above which background reconciliation is
+	// paused, zero meaning unlimited.
+	RepairMaxRequestsPerSec int64
+	RepairMaxInFlight       int
+
+	// MaxMemoryBytes bounds the estimated size of the keys and values held
+	// in local KVS, the least recently used keys being evicted beyond it.
+	// Zero means unbounded.
+	MaxMemoryBytes int64
+
+	// MaxWriteNonces is the number of write nonces remembered to ignore the
+	// internally forwarded writes delivered more than once.
+	MaxWriteNonces int
+	// MaxClockEntries caps the number of entries of the clocks stored, the
+	// least recently updated ones being pruned beyond it. Zero disables it.
+	MaxClockEntries int
+
+	// EntryFormat is the format version of the entries written to disk.
+	// Every supported version is read regardless. Writing EntryFormatV1
+	// keeps the data readable by a node downgraded to a version which does
+	// not know format versions.
+	EntryFormat int
+
+	// KeyFilterFalsePositiveRate enables a bloom filter of the existing keys
+	// with the given false positive rate, such as 0.01, to answer the reads
+	// of absent keys without a lookup. It is disabled if zero.
+	KeyFilterFalsePositiveRate float64
+}
+
+func defaultOptions() *Options {
+	opts := &Options{
+		Backend:            MemoryBackend,
+		CheckpointInterval: 30 * time.Second,
+		WALSegmentSize:     4 << 20,
+		MaxVersionsPerKey:  1,
+
+		MaxMigrationTransfers: 2,
+		ExpirySweepInterval:   time.Minute,
+		CompactionInterval:    5 * time.Minute,
+		VersionGracePeriod:    time.Hour,
+		MaxWriteNonces:        100000,
+		EntryFormat:           CurrentEntryFormat,
+	}
+
+	return opts
+}
+
+func mergeDefaultOptions(opts *Options) *Options {
+	def := defaultOptions()
+
+	if opts == nil {
+		return def
+	}
+
+	if opts.Backend == "" {
+		opts.Backend = def.Backend
+	}
+	if opts.WALSegmentSize <= 0 {
+		opts.WALSegmentSize = def.WALSegmentSize
+	}
+	if opts.MaxVersionsPerKey < 0 {
+		opts.MaxVersionsPerKey = def.MaxVersionsPerKey
+	}
+	opts.CheckpointInterval = util.SelectDurationOpt(opts.CheckpointInterval, def.CheckpointInterval)
+	opts.MaxVersionsPerKey = util.SelectIntOpt(opts.MaxVersionsPerKey, def.MaxVersionsPerKey)
+	opts.MaxMigrationTransfers = util.SelectIntOpt(opts.MaxMigrationTransfers, def.MaxMigrationTransfers)
+	opts.ExpirySweepInterval = util.SelectDurationOpt(opts.ExpirySweepInterval, def.ExpirySweepInterval)
+	opts.CompactionInterval = util.SelectDurationOpt(opts.CompactionInterval, def.CompactionInterval)
+	opts.VersionGracePeriod = util.SelectDurationOpt(opts.VersionGracePeriod, def.VersionGracePeriod)
+	opts.MaxWriteNonces = util.SelectIntOpt(opts.MaxWriteNonces, def.MaxWriteNonces)
+	if !validEntryFormat(opts.EntryFormat) {
+		opts.EntryFormat = def.EntryFormat
+	}
+
+	return opts
+}
+
 // KVStore is a key-value storage engine.
 type KVStore struct {
-	mu sync.Mutex
+	pendingReconcile int64 // first for 64-bit alignment of atomic access
+	memoryBytes      int64
+
+	mu queueMutex
+	// batch is held by PutBatch while it writes, and by the reads that must
+	// not see a batch partially applied.
+	batch sync.RWMutex
 
 	address  string
-	memtable map[string]*KVEntry
+	memtable Store
+	logging  bool
+	wal      *writeAheadLog
+	history  *versionHistory
+	throttle *MigrationThrottle
+	load     *LoadThrottle
+	expiry   *expiryIndex
+	index    *secondaryIndex
+	eviction *evictionIndex
+	nonces   *writeNonces
+	filter   *keyFilter
+	readOnly bool
+
+	checkpointInterval time.Duration
+	sweepInterval      time.Duration
+	compactionInterval time.Duration
+	versionGracePeriod time.Duration
+	maxClockEntries    int
 
 	requestHandlers *RequestHandlers
 
 	commitLogName, dumpFileName       string
 	mapSize, boundarySize, dumpsIndex int
+	entryFormat                       int
 }
 
 // KVEntry is a storage unit for a value.
@@ -35,79 +175,489 @@ type KVEntry struct {
 	Value     string
 	Timestamp int64
 	Exist     int
+	// Metadata are small key/value headers attached to the value, such as
+	// its content type, replaced along with it.
+	Metadata map[string]string
+	// Sequence is the sequence of the last sequenced write of the key. The
+	// writes without a sequence and the deletions keep it, so that a late
+	// write cannot resurrect a key deleted after it.
+	Sequence int64
+	// Clock is the vector clock of the version, stamped by the coordinator
+	// of the write, or nil for the versions written without one.
+	Clock *util.VectorClock
 }
 
-// NewKVStore returns a new KVStore instance.
-func NewKVStore(address string) *KVStore {
+// NewKVStore returns a new KVStore instance backed by the storage backend
+// selected in opts. It fails if the backend is unknown or cannot be opened,
+// rather than running without durability.
+func NewKVStore(address string, opts *Options) (*KVStore, error) {
+	opts = mergeDefaultOptions(opts)
+
 	kvs := &KVStore{
-		address:      address,
-		mapSize:      0,
-		boundarySize: 128,
-		dumpsIndex:   1,
+		address:            address,
+		entryFormat:        opts.EntryFormat,
+		mapSize:            0,
+		boundarySize:       128,
+		dumpsIndex:         1,
+		checkpointInterval: opts.CheckpointInterval,
+		sweepInterval:      opts.ExpirySweepInterval,
+		compactionInterval: opts.CompactionInterval,
+		versionGracePeriod: opts.VersionGracePeriod,
+		history:            newVersionHistory(opts.MaxVersionsPerKey),
+		expiry:             newExpiryIndex(),
+		index:              newSecondaryIndex(),
+		eviction:           newEvictionIndex(opts.MaxMemoryBytes),
+		nonces:             newWriteNonces(opts.MaxWriteNonces),
+		maxClockEntries:    opts.MaxClockEntries,
+		filter:             newKeyFilter(opts.KeyFilterFalsePositiveRate),
+		throttle: NewMigrationThrottle(opts.MigrationKeysPerSec, opts.MigrationBytesPerSec,
+			opts.MaxMigrationTransfers),
+		load: NewLoadThrottle(opts.RepairMaxRequestsPerSec, opts.RepairMaxInFlight),
 	}
-	kvs.memtable = make(map[string]*KVEntry)
+	memtable, err := kvs.openStore(opts.Backend)
+	if err != nil {
+		return nil, err
+	}
+	kvs.memtable = memtable
 	kvs.commitLogName = strings.Replace(address, ":", "_", -1) + "_commit.log"
 	kvs.dumpFileName = strings.Replace(address, ":", "_", -1) + "_dump.log"
 
+	if kvs.logging {
+		wal, err := openWriteAheadLog(strings.Replace(address, ":", "_", -1), opts.WALSegmentSize, opts.EntryFormat)
+		if err != nil {
+			memtable.Close()
+			return nil, fmt.Errorf("cannot open commit log: %s", err.Error())
+		}
+		kvs.wal = wal
+	}
+
 	requestHandlers := NewRequestHandler(kvs)
 	kvs.requestHandlers = requestHandlers
 
-	if _, err := os.Stat(kvs.commitLogName); os.IsNotExist(err) {
-		os.Create(kvs.commitLogName)
+	go kvs.sweepExpired()
+	if opts.MaxVersionsPerKey > 1 {
+		go kvs.compactHistory()
+	}
+
+	if kvs.logging {
+		kvs.repairDB()
+	}
+	kvs.RebuildKeyFilter()
+	kvs.countMemoryUsage()
+	kvs.seedEviction()
+	if kvs.logging {
+		go kvs.flushToDumpFile()
 	}
 
-	kvs.repairDB()
-	go kvs.flushToDumpFile()
+	return kvs, nil
+}
 
-	return kvs
+func (k *KVStore) openStore(backend string) (Store, error) {
+	switch backend {
+	case BoltBackend:
+		store, err := newBoltStore(k.address, k.entryFormat)
+		if err != nil {
+			return nil, fmt.Errorf("cannot open BoltDB storage: %s", err.Error())
+		}
+		return store, nil
+	case MemoryBackend:
+		logger.Notice("Using in-memory storage")
+		k.logging = true
+		return newMemoryStore(), nil
+	}
+
+	return nil, fmt.Errorf("unknown storage backend %s", backend)
 }
 
 // Get returns the KVEntry of the given key.
 func (k *KVStore) Get(key string) (*KVEntry, error) {
+	k.batch.RLock()
+	defer k.batch.RUnlock()
+
+	return k.get(key)
+}
+
+func (k *KVStore) get(key string) (*KVEntry, error) {
+	if !k.filter.mayContain(key) {
+		return nil, ErrKeyNotFound
+	}
+
+	value, ok := k.memtable.Get(key)
+
+	if !ok || value.Exist == 0 || k.expiry.isExpired(key, time.Now().UnixNano()) {
+		return nil, ErrKeyNotFound
+	}
+	k.eviction.touch(key)
+	return value, nil
+}
+
+// tombstone returns the tombstone of the given key, if it was deleted.
+func (k *KVStore) tombstone(key string) (KVEntry, bool) {
+	entry, ok := k.memtable.Get(key)
+	if !ok || entry.Exist != 0 {
+		return KVEntry{}, false
+	}
+	return *entry, true
+}
+
+// SetReadOnly switches the read-only mode, in which writes fail with
+// ErrReadOnly while reads are still served.
+func (k *KVStore) SetReadOnly(readOnly bool) {
 	k.mu.Lock()
-	value, ok := k.memtable[key]
+	k.readOnly = readOnly
 	k.mu.Unlock()
 
-	if !ok || value.Exist == 0 {
-		return nil, errors.New("key not found")
+	if readOnly {
+		logger.Notice("Local KVS is now read-only")
+	} else {
+		logger.Notice("Local KVS is now writable")
 	}
-	return value, nil
+}
+
+// ReadOnly returns whether local KVS is in read-only mode.
+func (k *KVStore) ReadOnly() bool {
+	k.mu.Lock()
+	readOnly := k.readOnly
+	k.mu.Unlock()
+
+	return readOnly
 }
 
 // Put updates the value for the given key.
 func (k *KVStore) Put(key, value string) error {
-	entry := KVEntry{Value: value, Timestamp: time.Now().UnixNano(), Exist: 1}
+	return k.put(key, value, putOptions{})
+}
+
+// PutWithMetadata updates the value for the given key along with its
+// metadata, which must not exceed util.MaxMetadataBytes. A nil metadata
+// writes the value without any, like Put.
+func (k *KVStore) PutWithMetadata(key, value string, metadata map[string]string) error {
+	return k.put(key, value, putOptions{metadata: metadata})
+}
 
+// putOptions are the optional attributes of a write.
+type putOptions struct {
+	// deadline is when the key expires, in Unix nanoseconds, or zero.
+	deadline int64
+	// indexField and indexValue index the key, unless indexField is empty.
+	indexField, indexValue string
+	// metadata is attached to the value.
+	metadata map[string]string
+	// nonce identifies an internally forwarded write, which is ignored if a
+	// write with the same nonce was already applied.
+	nonce string
+	// sequence is the sequence of a sequenced write, or zero.
+	sequence int64
+	// timestamp and clock are those stamped by the coordinator of the
+	// write, if any. The write is otherwise dated from now, without clock.
+	timestamp int64
+	clock     *util.VectorClock
+}
+
+// stamp returns the timestamp and clock of a version written with the given
+// attributes over prev. The clock descends from the one of prev, which the
+// write supersedes, and keeps at most maxEntries entries if it is positive.
+func (opts putOptions) stamp(prev *KVEntry, maxEntries int) (int64, *util.VectorClock) {
+	timestamp := opts.timestamp
+	if timestamp == 0 {
+		timestamp = time.Now().UnixNano()
+	}
+
+	clock := opts.clock
+	if clock != nil && prev != nil && prev.Clock != nil {
+		clock = util.NewVectorClock()
+		clock.Merge(prev.Clock)
+		clock.Merge(opts.clock)
+	}
+	if clock != nil {
+		if pruned := clock.Prune(maxEntries); len(pruned) > 0 {
+			logger.Warningf("Pruned the clock entries of %s beyond MaxClockEntries", strings.Join(pruned, ", "))
+		}
+	}
+
+	return timestamp, clock
+}
+
+// put updates the value for the given key with the given attributes.
+func (k *KVStore) put(key, value string, opts putOptions) error {
 	k.mu.Lock()
-	k.appendToCommitLog(key, &entry)
-	k.memtable[key] = &entry
+	if k.readOnly {
+		k.mu.Unlock()
+		return ErrReadOnly
+	}
+	err := k.writeValue(key, value, opts)
 	k.mu.Unlock()
 
-	logger.Infof("Key-value pair (%s, %s) updated to memtable", key, value)
+	if err != nil {
+		return err
+	}
+
+	logger.Info("Key-value pair updated to memtable", util.LogFields{"key_hash": util.KeyHash(key)})
 
 	return nil
 }
 
+// writeValue writes the value of the given key with the given attributes.
+// The caller must hold the lock.
+func (k *KVStore) writeValue(key, value string, opts putOptions) error {
+	if err := util.CheckMetadata(opts.metadata); err != nil {
+		return err
+	}
+	if k.replayed(key, opts.nonce) {
+		return nil
+	}
+
+	existed := k.existsNoLock(key)
+	prev, _ := k.memtable.Get(key)
+	entry := KVEntry{Value: value, Exist: 1, Metadata: opts.metadata}
+	entry.Timestamp, entry.Clock = opts.stamp(prev, k.maxClockEntries)
+	if opts.sequence > 0 {
+		entry.Sequence = opts.sequence
+	} else if prev != nil {
+		entry.Sequence = prev.Sequence
+	}
+
+	err := k.appendToCommitLog(key, &entry)
+	if err == nil {
+		err = k.memtable.Put(key, &entry)
+	}
+	if err == nil {
+		k.resizeNoLock(key, prev, &entry)
+		k.history.record(key, prev, entry)
+		if opts.deadline > 0 {
+			k.expiry.set(key, opts.deadline)
+		} else {
+			k.expiry.clear(key)
+		}
+		if opts.indexField != "" {
+			k.index.set(key, opts.indexField, opts.indexValue)
+		} else {
+			k.index.remove(key)
+		}
+		k.track(key, &entry)
+		k.nonces.record(opts.nonce)
+		k.updateKeyFilterNoLock(key, existed, true)
+	}
+
+	return err
+}
+
 // Delete removes the entry of the given key.
 func (k *KVStore) Delete(key string) error {
+	return k.delete(key, putOptions{})
+}
+
+// delete replaces the entry of the given key with a tombstone stamped with
+// the timestamp and clock of the given attributes.
+func (k *KVStore) delete(key string, opts putOptions) error {
 	value, _ := k.Get(key)
 
 	if value == nil {
-		return errors.New("key not found")
+		return ErrKeyNotFound
 	}
-	value = &KVEntry{Value: "", Timestamp: time.Now().UnixNano(), Exist: 0}
 
 	k.mu.Lock()
-	k.appendToCommitLog(key, value)
-	k.memtable[key] = value
+	if k.readOnly {
+		k.mu.Unlock()
+		return ErrReadOnly
+	}
+	err := k.writeTombstone(key, opts)
+	if err == nil {
+		k.expiry.clear(key)
+	}
 	k.mu.Unlock()
 
+	return err
+}
+
+// writeTombstone replaces the entry of the given key with a tombstone,
+// stamped with the timestamp and clock of the given attributes. The caller
+// must hold the lock.
+func (k *KVStore) writeTombstone(key string, opts putOptions) error {
+	existed := k.existsNoLock(key)
+	prev, _ := k.memtable.Get(key)
+	value := &KVEntry{Value: "", Exist: 0}
+	value.Timestamp, value.Clock = opts.stamp(prev, k.maxClockEntries)
+	if prev != nil {
+		value.Sequence = prev.Sequence
+	}
+
+	err := k.appendToCommitLog(key, value)
+	if err == nil {
+		err = k.memtable.Put(key, value)
+	}
+	if err == nil {
+		k.resizeNoLock(key, prev, value)
+		k.history.record(key, prev, *value)
+		k.index.remove(key)
+		k.eviction.remove(key)
+		k.updateKeyFilterNoLock(key, existed, false)
+	}
+
+	return err
+}
+
+// Clock returns the vector clock of the current version of the given key,
+// a tombstone included, or nil if it has none.
+func (k *KVStore) Clock(key string) *util.VectorClock {
+	if entry, ok := k.memtable.Get(key); ok {
+		return entry.Clock
+	}
 	return nil
 }
 
+// GetHistory returns the last versions of the given key, newest first,
+// tombstones included. Versions are only kept in memory, so the history
+// restarts from the recovered entries after a restart. Without history,
+// only the current version is returned.
+func (k *KVStore) GetHistory(key string) ([]KVEntry, error) {
+	if versions := k.history.get(key); len(versions) > 0 {
+		return versions, nil
+	}
+
+	entry, ok := k.memtable.Get(key)
+	if !ok {
+		return nil, ErrKeyNotFound
+	}
+	return []KVEntry{*entry}, nil
+}
+
+// Scan calls fn for each existing entry whose key has the given prefix.
+func (k *KVStore) Scan(prefix string, fn func(key string, entry *KVEntry) bool) error {
+	return k.memtable.Scan(prefix, func(key string, entry *KVEntry) bool {
+		if entry.Exist == 0 {
+			return true
+		}
+		return fn(key, entry)
+	})
+}
+
+// SetPendingReconcile records the number of keys for which local KVS is
+// known to diverge from its peers, as found by anti-entropy, and reported by
+// Stat until they are reconciled.
+func (k *KVStore) SetPendingReconcile(n int) {
+	atomic.StoreInt64(&k.pendingReconcile, int64(n))
+}
+
+// PendingReconcile returns the number of keys awaiting anti-entropy
+// reconciliation.
+func (k *KVStore) PendingReconcile() int {
+	return int(atomic.LoadInt64(&k.pendingReconcile))
+}
+
 // Count returns the number of entries in local KVS.
 func (k *KVStore) Count() int {
-	return len(k.memtable)
+	return k.memtable.Count()
+}
+
+// MemoryUsage estimates the bytes held by the keys and values in local KVS.
+// It is kept up to date by every write, so that it costs no scan.
+func (k *KVStore) MemoryUsage() int64 {
+	return atomic.LoadInt64(&k.memoryBytes)
+}
+
+// Close closes the storage backend of local KVS.
+func (k *KVStore) Close() error {
+	if k.wal != nil {
+		k.wal.Close()
+	}
+	return k.memtable.Close()
+}
+
+// Flush checkpoints the memtable into the dump file and clears the commit
+// log, so that a restart does not have to replay it. It does nothing for
+// backends without a commit log.
+func (k *KVStore) Flush() error {
+	if !k.logging {
+		return nil
+	}
+
+	k.mu.Lock()
+	err := k.checkpoint()
+	k.mu.Unlock()
+
+	if err != nil {
+		return err
+	}
+
+	logger.Notice("Memtable flushed to disk")
+	return nil
+}
+
+// MigrationThrottle returns the throttle that key transfers made while
+// rebalancing must go through.
+func (k *KVStore) MigrationThrottle() *MigrationThrottle {
+	return k.throttle
+}
+
+// LoadThrottle returns the throttle that background reconciliation, such
+// as read repair and handoff, must go through.
+func (k *KVStore) LoadThrottle() *LoadThrottle {
+	return k.load
+}
+
+// MetricsSnapshot is a point-in-time view of the local KVS metrics.
+type MetricsSnapshot struct {
+	KeyCount    int
+	WALSize     int64
+	WALSegments int
+	Migration   MigrationStats
+	// ExpiringKeys is the number of keys with a pending TTL, and ExpiredKeys
+	// the number of keys removed by the expiry sweeper so far.
+	ExpiringKeys int
+	ExpiredKeys  int64
+	// CompactedVersions is the number of superseded versions dropped from
+	// the history by compaction so far.
+	CompactedVersions int64
+	Load              LoadStats
+	// EvictedKeys is the number of keys evicted under MaxMemoryBytes so far.
+	EvictedKeys int64
+	// ReplayedWrites is the number of forwarded writes ignored so far because
+	// they had already been applied.
+	ReplayedWrites int64
+	// FilteredReads is the number of reads of absent keys answered by the key
+	// filter without a lookup so far.
+	FilteredReads int64
+
+	// QueueDepth is the number of requests waiting for another to release
+	// local KVS. ProcessingLatency and its percentiles are the time taken to
+	// handle the internal requests, across operations. A deep queue points
+	// at contention, and a high latency with a shallow queue at slow
+	// processing.
+	QueueDepth                                                       int64
+	AvgProcessingLatency                                             time.Duration
+	ProcessingLatencyP50, ProcessingLatencyP95, ProcessingLatencyP99 time.Duration
+}
+
+// Metrics returns a snapshot of the local KVS metrics.
+func (k *KVStore) Metrics() MetricsSnapshot {
+	m := MetricsSnapshot{
+		KeyCount:     k.Count(),
+		Migration:    k.throttle.Stats(),
+		ExpiringKeys: k.expiry.size(),
+		ExpiredKeys:  atomic.LoadInt64(&k.expiry.expired),
+
+		CompactedVersions: atomic.LoadInt64(&k.history.compacted),
+		Load:              k.load.Stats(),
+		EvictedKeys:       atomic.LoadInt64(&k.eviction.evicted),
+		ReplayedWrites:    atomic.LoadInt64(&k.nonces.replayed),
+		FilteredReads:     atomic.LoadInt64(&k.filter.rejected),
+
+		QueueDepth: k.mu.depth(),
+	}
+
+	latency := k.requestHandlers.stats.all
+	m.AvgProcessingLatency = latency.Mean()
+	m.ProcessingLatencyP50 = latency.Quantile(0.5)
+	m.ProcessingLatencyP95 = latency.Quantile(0.95)
+	m.ProcessingLatencyP99 = latency.Quantile(0.99)
+
+	if k.wal != nil {
+		m.WALSize = k.wal.Size()
+		m.WALSegments = k.wal.NumSegments()
+	}
+
+	return m
 }
 
 // RegisterRPCHandlers registers the internal RPC handlers.
@@ -118,124 +668,272 @@ func (k *KVStore) RegisterRPCHandlers(server *rpc.Server) error {
 }
 
 func (k *KVStore) appendToCommitLog(key string, entry *KVEntry) error {
-	fLogfile, err := os.OpenFile(k.commitLogName, os.O_APPEND|os.O_WRONLY, 0644)
-	if err != nil {
+	if !k.logging {
+		return nil
+	}
+
+	if err := k.wal.Append(key, entry); err != nil {
 		logger.Error(err.Error())
 		return err
 	}
 
-	k.writeKeyValueToFile(fLogfile, key, entry)
-	logger.Infof("Key-value pair (%s, %s) appended to commit log", key, entry.Value)
+	logger.Info("Key-value pair appended to commit log", util.LogFields{"key_hash": util.KeyHash(key)})
 
 	return nil
 }
 
 func (k *KVStore) flushToDumpFile() error {
 	for {
-		time.Sleep(30 * time.Second)
+		time.Sleep(k.checkpointInterval)
 
 		k.mu.Lock()
-		f, _ := os.Create(k.dumpFileName)
-		for key, value := range k.memtable {
-			k.writeKeyValueToFile(f, key, value)
-		}
-		f, _ = os.Create(k.commitLogName)
+		err := k.checkpoint()
 		k.mu.Unlock()
 
+		if err != nil {
+			logger.Errorf("Cannot dump memtable to disk: %s", err.Error())
+			continue
+		}
+
 		logger.Notice("Memtable dumped to disk")
 		logger.Info("Commit log cleared")
 	}
 }
 
-func (k *KVStore) repairDB() {
-	files, _ := ioutil.ReadDir("./")
-	matchpattern := strings.Replace(k.address, ":", "_", -1) + "_(dump|commit).log"
+// checkpoint dumps the memtable into a temporary file, atomically replaces
+// the dump file with it, and then removes the commit log segments.
+func (k *KVStore) checkpoint() error {
+	tmpName := k.dumpFileName + ".tmp"
+	f, err := os.Create(tmpName)
+	if err != nil {
+		return err
+	}
 
+	k.memtable.Scan("", func(key string, value *KVEntry) bool {
+		_, err = writeKeyValueToFile(f, key, value, k.entryFormat)
+		return err == nil
+	})
+	if err == nil {
+		err = f.Sync()
+	}
+	f.Close()
+	if err != nil {
+		os.Remove(tmpName)
+		return err
+	}
+
+	if err := os.Rename(tmpName, k.dumpFileName); err != nil {
+		return err
+	}
+
+	os.Remove(k.commitLogName)
+	return k.wal.Checkpoint()
+}
+
+// errTruncatedRecord is returned when the commit log ends in the middle of
+// a record, which is what a crash while appending leaves behind.
+var errTruncatedRecord = errors.New("truncated record")
+
+func (k *KVStore) repairDB() {
 	logger.Notice("Trying to repair key value storage...")
 
+	files := append([]string{k.dumpFileName, k.commitLogName}, k.wal.Segments()...)
 	for _, file := range files {
-		if ok, _ := regexp.Match(matchpattern, []byte(file.Name())); ok {
-			fLog, err := os.Open(file.Name())
-			if err != nil {
-				return
+		fLog, err := os.Open(file)
+		if err != nil {
+			continue
+		}
+
+		// Replay stops at the last complete record. A truncated record was
+		// never acknowledged, and is cut off the commit log so that the
+		// records appended next do not follow it.
+		var offset int64
+		f := bufio.NewReader(fLog)
+		for {
+			key, entry, n, err := readRecord(f)
+			if err == errTruncatedRecord && k.wal.IsSegment(file) {
+				logger.Warningf("Truncated record at offset %d of %s, dropping it", offset, file)
+				if err := k.wal.Truncate(file, offset); err != nil {
+					logger.Errorf("Cannot truncate %s: %s", file, err.Error())
+				}
+				break
 			}
-			f := bufio.NewReader(fLog)
-			for {
-				key, value, timestamp, exist, err := k.getNextKeyValueFromFile(f)
-				if err != nil {
-					break
+			if err != nil {
+				if err != io.EOF {
+					logger.Warningf("Cannot read %s at offset %d: %s", file, offset, err.Error())
 				}
-
-				if cur, ok := k.memtable[key]; ok {
-					if cur.Timestamp < timestamp {
-						cur.Timestamp = timestamp
-						cur.Exist = exist
-						cur.Value = value
-					}
-				} else {
-					tmpKVEntry := &KVEntry{Value: value, Timestamp: timestamp, Exist: exist}
-					k.memtable[key] = tmpKVEntry
+				break
+			}
+			offset += n
+
+			if cur, ok := k.memtable.Get(key); ok {
+				if cur.Timestamp < entry.Timestamp {
+					cur.Timestamp = entry.Timestamp
+					cur.Exist = entry.Exist
+					cur.Value = entry.Value
+					cur.Metadata = entry.Metadata
+					cur.Sequence = entry.Sequence
+					cur.Clock = entry.Clock
 				}
+			} else {
+				k.memtable.Put(key, entry)
 			}
 		}
+		fLog.Close()
 	}
 }
 
-func (k *KVStore) getNextKeyValueFromFile(f *bufio.Reader) (string, string, int64, int, error) {
-	var nextLenStr string
-	var err error
-	if nextLenStr, err = f.ReadString(' '); err != nil {
-		return "", "", 0, 0, err
-	}
-	nextLenStr = nextLenStr[:len(nextLenStr)-1]
-	nextLen, _ := strconv.Atoi(nextLenStr)
-	readKey := ""
-	for len(readKey) != nextLen {
-		tmp := make([]byte, nextLen-len(readKey))
-		f.Read(tmp)
-		readKey += string(tmp[:])
+// readRecord reads the next record of a commit log or dump file, and returns
+// its key and entry along with its size in bytes. It returns io.EOF at the
+// end of the file, errTruncatedRecord if the file ends within the record, and
+// another error if the record is corrupted.
+func readRecord(f *bufio.Reader) (string, *KVEntry, int64, error) {
+	var n int64
+
+	// Every supported format shares the record layout after the version
+	// byte.
+	format, err := readEntryFormat(f)
+	if err != nil {
+		return "", nil, 0, err
 	}
-	nextLenStr, _ = f.ReadString(' ')
-	nextLenStr, _ = f.ReadString(' ')
-	nextLenStr = nextLenStr[:len(nextLenStr)-1]
-	nextLen, _ = strconv.Atoi(nextLenStr)
-	readValue := make([]byte, nextLen)
-	if _, err = f.Read(readValue); err != nil {
-		return "", "", 0, 0, err
+	if format != EntryFormatV1 {
+		n++
 	}
 
-	readTimestamp, err := f.ReadString(' ')
-	readTimestamp, err = f.ReadString(' ')
-	readTimestamp = readTimestamp[:len(readTimestamp)-1]
-	timestamp, _ := strconv.ParseInt(readTimestamp, 10, 64)
+	readField := func(delim byte) (string, error) {
+		field, err := f.ReadString(delim)
+		n += int64(len(field))
+		if err == io.EOF {
+			return "", errTruncatedRecord
+		}
+		if err != nil {
+			return "", err
+		}
+		return field[:len(field)-1], nil
+	}
+	readBytes := func(size string) (string, error) {
+		length, err := strconv.Atoi(size)
+		if err != nil || length < 0 {
+			return "", fmt.Errorf("invalid length %q", size)
+		}
+		buf := make([]byte, length+1)
+		read, err := io.ReadFull(f, buf)
+		n += int64(read)
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return "", errTruncatedRecord
+		}
+		if err != nil {
+			return "", err
+		}
+		if buf[length] != ' ' {
+			return "", errors.New("missing field separator")
+		}
+		return string(buf[:length]), nil
+	}
 
-	readExist, err := f.ReadString('\n')
-	readExist = readExist[:len(readExist)-1]
-	exist, _ := strconv.Atoi(readExist)
+	keyLen, err := readField(' ')
+	if err != nil {
+		return "", nil, 0, err
+	}
+	key, err := readBytes(keyLen)
+	if err != nil {
+		return "", nil, 0, err
+	}
+	valueLen, err := readField(' ')
+	if err != nil {
+		return "", nil, 0, err
+	}
+	value, err := readBytes(valueLen)
+	if err != nil {
+		return "", nil, 0, err
+	}
+	readTimestamp, err := readField(' ')
+	if err != nil {
+		return "", nil, 0, err
+	}
+	timestamp, err := strconv.ParseInt(readTimestamp, 10, 64)
+	if err != nil {
+		return "", nil, 0, fmt.Errorf("invalid timestamp %q", readTimestamp)
+	}
 
-	return string(readKey[:]), string(readValue[:]), timestamp, exist, nil
-}
+	// EntryFormatV3 adds the write sequence after the timestamp.
+	var sequence int64
+	if format >= EntryFormatV3 {
+		readSequence, err := readField(' ')
+		if err != nil {
+			return "", nil, 0, err
+		}
+		sequence, err = strconv.ParseInt(readSequence, 10, 64)
+		if err != nil {
+			return "", nil, 0, fmt.Errorf("invalid sequence %q", readSequence)
+		}
+	}
 
-func (k *KVStore) writeKeyValueToFile(f *os.File, key string, value *KVEntry) error {
-	keyString := strconv.Itoa(len(key)) + " " + key
-	if _, err := f.WriteString(keyString + " "); err != nil {
-		logger.Error(err.Error())
+	// EntryFormatV4 adds the clock after the sequence.
+	var clock *util.VectorClock
+	if format >= EntryFormatV4 {
+		clockLen, err := readField(' ')
+		if err != nil {
+			return "", nil, 0, err
+		}
+		readClock, err := readBytes(clockLen)
+		if err != nil {
+			return "", nil, 0, err
+		}
+		if readClock != "" {
+			clock = &util.VectorClock{}
+			if err := json.Unmarshal([]byte(readClock), clock); err != nil {
+				return "", nil, 0, fmt.Errorf("invalid clock: %s", err.Error())
+			}
+		}
 	}
 
-	valueString := strconv.Itoa(len(value.Value)) + " " + value.Value
-	if _, err := f.WriteString(valueString + " "); err != nil {
-		logger.Error(err.Error())
+	// The metadata, if any, follows the exist flag as a JSON object, which
+	// holds no newline.
+	readExist, err := readField('\n')
+	if err != nil {
+		return "", nil, 0, err
+	}
+	var metadata map[string]string
+	if i := strings.IndexByte(readExist, ' '); i >= 0 {
+		if err := json.Unmarshal([]byte(readExist[i+1:]), &metadata); err != nil {
+			return "", nil, 0, fmt.Errorf("invalid metadata: %s", err.Error())
+		}
+		readExist = readExist[:i]
+	}
+	exist, err := strconv.Atoi(readExist)
+	if err != nil {
+		return "", nil, 0, fmt.Errorf("invalid exist flag %q", readExist)
 	}
 
-	timeStampString := strconv.FormatInt(value.Timestamp, 10)
-	if _, err := f.WriteString(timeStampString + " "); err != nil {
-		logger.Error(err.Error())
+	return key, &KVEntry{Value: value, Timestamp: timestamp, Exist: exist, Metadata: metadata, Sequence: sequence, Clock: clock}, n, nil
+}
+
+func writeKeyValueToFile(f io.Writer, key string, value *KVEntry, format int) (int, error) {
+	record := string(entryFormatPrefix(format)) + strconv.Itoa(len(key)) + " " + key + " " +
+		strconv.Itoa(len(value.Value)) + " " + value.Value + " " +
+		strconv.FormatInt(value.Timestamp, 10) + " "
+	if format >= EntryFormatV3 {
+		record += strconv.FormatInt(value.Sequence, 10) + " "
+	}
+	if format >= EntryFormatV4 {
+		var clock []byte
+		if value.Clock != nil {
+			clock, _ = json.Marshal(value.Clock)
+		}
+		record += strconv.Itoa(len(clock)) + " " + string(clock) + " "
 	}
+	record += strconv.Itoa(value.Exist)
+	if len(value.Metadata) > 0 {
+		metadata, _ := json.Marshal(value.Metadata)
+		record += " " + string(metadata)
+	}
+	record += "\n"
 
-	existString := strconv.Itoa(value.Exist)
-	if _, err := f.WriteString(existString + "\n"); err != nil {
+	n, err := io.WriteString(f, record)
+	if err != nil {
 		logger.Error(err.Error())
 	}
 
-	return nil
+	return n, err
 }
@@ -0,0 +1,130 @@
+package storage
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// loadPollInterval is how often a paused background task checks
+	// whether the load dropped.
+	loadPollInterval = 100 * time.Millisecond
+	// maxBackgroundPause bounds how long a background task is held back, so
+	// that replicas still converge under sustained load.
+	maxBackgroundPause = 30 * time.Second
+)
+
+// LoadThrottle holds back background reconciliation, such as read repair
+// and handoff, while the node is busy serving requests, so that it does
+// not hurt foreground latency during traffic spikes.
+type LoadThrottle struct {
+	inFlight int64 // first for 64-bit alignment of atomic access
+
+	maxRate     int64
+	maxInFlight int64
+
+	mu        sync.Mutex
+	window    time.Time
+	cur, last int64
+	waiting   int
+}
+
+// LoadStats is the current load of the node and the state of background
+// reconciliation.
+type LoadStats struct {
+	RequestsPerSec int64
+	InFlight       int64
+	// Paused is whether background work is held back by the load, and
+	// Waiting the number of background tasks currently held back.
+	Paused  bool
+	Waiting int
+}
+
+// NewLoadThrottle returns a LoadThrottle pausing background work while
+// the node serves more than maxRate requests per second or has more than
+// maxInFlight requests in progress. A zero threshold is unlimited.
+func NewLoadThrottle(maxRate int64, maxInFlight int) *LoadThrottle {
+	return &LoadThrottle{
+		maxRate:     maxRate,
+		maxInFlight: int64(maxInFlight),
+		window:      time.Now(),
+	}
+}
+
+// track accounts for a foreground request and returns the function to call
+// once it is handled.
+func (t *LoadThrottle) track() func() {
+	atomic.AddInt64(&t.inFlight, 1)
+
+	t.mu.Lock()
+	t.rollNoLock(time.Now())
+	t.cur++
+	t.mu.Unlock()
+
+	return func() {
+		atomic.AddInt64(&t.inFlight, -1)
+	}
+}
+
+// Wait blocks while the node is overloaded, for at most maxBackgroundPause.
+// Background tasks call it before each unit of work.
+func (t *LoadThrottle) Wait() {
+	if !t.overloaded() {
+		return
+	}
+
+	t.mu.Lock()
+	t.waiting++
+	t.mu.Unlock()
+
+	deadline := time.Now().Add(maxBackgroundPause)
+	for t.overloaded() && time.Now().Before(deadline) {
+		time.Sleep(loadPollInterval)
+	}
+
+	t.mu.Lock()
+	t.waiting--
+	t.mu.Unlock()
+}
+
+// Stats returns the load measured over the last window of at least a second
+// and the state of background work.
+func (t *LoadThrottle) Stats() LoadStats {
+	t.mu.Lock()
+	t.rollNoLock(time.Now())
+	stats := LoadStats{
+		RequestsPerSec: t.last,
+		InFlight:       atomic.LoadInt64(&t.inFlight),
+		Waiting:        t.waiting,
+	}
+	t.mu.Unlock()
+
+	stats.Paused = t.exceeds(stats.RequestsPerSec, stats.InFlight)
+	return stats
+}
+
+func (t *LoadThrottle) overloaded() bool {
+	t.mu.Lock()
+	t.rollNoLock(time.Now())
+	rate := t.last
+	t.mu.Unlock()
+
+	return t.exceeds(rate, atomic.LoadInt64(&t.inFlight))
+}
+
+func (t *LoadThrottle) exceeds(rate, inFlight int64) bool {
+	return (t.maxRate > 0 && rate > t.maxRate) ||
+		(t.maxInFlight > 0 && inFlight > t.maxInFlight)
+}
+
+func (t *LoadThrottle) rollNoLock(now time.Time) {
+	elapsed := now.Sub(t.window).Seconds()
+	if elapsed < 1 {
+		return
+	}
+
+	t.last = int64(float64(t.cur) / elapsed)
+	t.cur = 0
+	t.window = now
+}
@@ -0,0 +1,37 @@
+package storage
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLoadThrottleWaitsWhileOverloaded(t *testing.T) {
+	throttle := NewLoadThrottle(0, 1)
+
+	done := throttle.track()
+	throttle.Wait() // one request in progress is not over the threshold
+	if throttle.Stats().Paused {
+		t.Fatal("background work paused at the threshold")
+	}
+
+	release := throttle.track()
+	if !throttle.Stats().Paused {
+		t.Fatal("background work not paused over the threshold")
+	}
+
+	go func() {
+		time.Sleep(2 * loadPollInterval)
+		release()
+	}()
+
+	start := time.Now()
+	throttle.Wait()
+	if elapsed := time.Since(start); elapsed < loadPollInterval {
+		t.Fatalf("Wait returned after %s while overloaded", elapsed)
+	}
+	if throttle.Stats().Paused {
+		t.Fatal("background work still paused after the load dropped")
+	}
+
+	done()
+}
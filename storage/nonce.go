@@ -0,0 +1,79 @@
+package storage
+
+import (
+	"swimring/util"
+	"sync"
+	"sync/atomic"
+)
+
+// writeNonces remembers the nonces of the last writes applied by the local
+// KVS, so that an internally forwarded write delivered twice, such as by
+// hinted handoff and by normal replication, is applied once. At most
+// capacity nonces are kept, the oldest being forgotten first.
+type writeNonces struct {
+	replayed int64 // first for 64-bit alignment of atomic access
+
+	sync.Mutex
+	capacity int
+	order    []string
+	next     int
+	applied  map[string]struct{}
+}
+
+func newWriteNonces(capacity int) *writeNonces {
+	return &writeNonces{
+		capacity: capacity,
+		order:    make([]string, 0, capacity),
+		applied:  make(map[string]struct{}, capacity),
+	}
+}
+
+// seen returns whether a write with the given nonce was already applied. The
+// empty nonce is never seen.
+func (n *writeNonces) seen(nonce string) bool {
+	if nonce == "" {
+		return false
+	}
+
+	n.Lock()
+	_, ok := n.applied[nonce]
+	n.Unlock()
+
+	return ok
+}
+
+// record remembers the nonce of an applied write, forgetting the oldest one
+// once capacity nonces are kept. The empty nonce is ignored.
+func (n *writeNonces) record(nonce string) {
+	if nonce == "" || n.capacity < 1 {
+		return
+	}
+
+	n.Lock()
+	defer n.Unlock()
+
+	if _, ok := n.applied[nonce]; ok {
+		return
+	}
+
+	if len(n.order) < n.capacity {
+		n.order = append(n.order, nonce)
+	} else {
+		delete(n.applied, n.order[n.next])
+		n.order[n.next] = nonce
+		n.next = (n.next + 1) % n.capacity
+	}
+	n.applied[nonce] = struct{}{}
+}
+
+// replayed returns whether the write of the given key with the given nonce
+// was already applied, and counts it if so.
+func (k *KVStore) replayed(key, nonce string) bool {
+	if !k.nonces.seen(nonce) {
+		return false
+	}
+
+	atomic.AddInt64(&k.nonces.replayed, 1)
+	logger.Info("Replayed write ignored", util.LogFields{"key_hash": util.KeyHash(key), "nonce": nonce})
+	return true
+}
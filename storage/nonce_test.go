@@ -0,0 +1,72 @@
+package storage
+
+import "testing"
+
+func TestReplayedWriteIgnored(t *testing.T) {
+	chdirTemp(t)
+
+	kvs := newTestKVStore(t, "node:1", nil)
+	defer kvs.Close()
+
+	put := func(value string, sequence int64) *PutResponse {
+		resp := &PutResponse{}
+		kvs.requestHandlers.Put(&PutRequest{Key: "a", Value: value, Sequence: sequence, Nonce: "n1"}, resp)
+		return resp
+	}
+
+	if resp := put("1", 1); !resp.Ok {
+		t.Fatalf("first write failed: %s", resp.Message)
+	}
+	first, _ := kvs.Get("a")
+
+	// A replay is acknowledged, not reported as stale, and changes nothing.
+	if resp := put("2", 1); !resp.Ok || resp.Stale {
+		t.Fatalf("replayed write = %+v, want an ack", resp)
+	}
+	entry, _ := kvs.Get("a")
+	if entry.Value != "1" || entry.Timestamp != first.Timestamp {
+		t.Fatalf("entry after replay = %+v, want %+v", entry, first)
+	}
+	if n := kvs.Metrics().ReplayedWrites; n != 1 {
+		t.Fatalf("ReplayedWrites = %d, want 1", n)
+	}
+}
+
+func TestReplayedBatchIgnored(t *testing.T) {
+	chdirTemp(t)
+
+	kvs := newTestKVStore(t, "node:1", nil)
+	defer kvs.Close()
+
+	put := func(pairs map[string]string) {
+		resp := &PutResponse{}
+		kvs.requestHandlers.PutBatch(&PutBatchRequest{Pairs: pairs, Nonce: "n1"}, resp)
+		if !resp.Ok {
+			t.Fatalf("batch failed: %s", resp.Message)
+		}
+	}
+
+	// Every key of the batch is written, though they share its nonce.
+	put(map[string]string{"a": "1", "b": "1"})
+	put(map[string]string{"a": "2", "b": "2"})
+	for _, key := range []string{"a", "b"} {
+		if entry, err := kvs.Get(key); err != nil || entry.Value != "1" {
+			t.Fatalf("Get(%s) = %+v, %v, want 1", key, entry, err)
+		}
+	}
+}
+
+func TestWriteNoncesForgetOldest(t *testing.T) {
+	nonces := newWriteNonces(2)
+	nonces.record("a")
+	nonces.record("b")
+	nonces.record("a")
+	nonces.record("c")
+
+	if nonces.seen("a") || !nonces.seen("b") || !nonces.seen("c") {
+		t.Fatal("nonces kept are not the last two recorded")
+	}
+	if nonces.seen("") {
+		t.Fatal("empty nonce seen")
+	}
+}
@@ -0,0 +1,108 @@
+package storage
+
+import (
+	"sort"
+	"swimring/util"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// requestStats counts the internal requests handled by local KVS, with
+// their latency by operation and across operations, and the hits and misses
+// of Get.
+type requestStats struct {
+	hits, misses int64 // first for 64-bit alignment of atomic access
+
+	sync.Mutex
+	latencies map[string]*util.LatencyHistogram
+	all       *util.LatencyHistogram
+}
+
+func newRequestStats() *requestStats {
+	return &requestStats{
+		latencies: make(map[string]*util.LatencyHistogram),
+		all:       util.NewLatencyHistogram(),
+	}
+}
+
+func (s *requestStats) observe(op string, latency time.Duration) {
+	s.Lock()
+	h, ok := s.latencies[op]
+	if !ok {
+		h = util.NewLatencyHistogram()
+		s.latencies[op] = h
+	}
+	s.Unlock()
+
+	h.Observe(latency)
+	s.all.Observe(latency)
+}
+
+// WritePrometheus writes the metrics of local KVS in the Prometheus text
+// format.
+func (k *KVStore) WritePrometheus(p *util.PrometheusWriter) {
+	m := k.Metrics()
+	stats := k.requestHandlers.stats
+
+	p.Family("swimring_kvs_request_duration_seconds", "histogram", "Latency of the internal KVS requests by operation.")
+	stats.Lock()
+	ops := make([]string, 0, len(stats.latencies))
+	for op := range stats.latencies {
+		ops = append(ops, op)
+	}
+	sort.Strings(ops)
+	for _, op := range ops {
+		p.Histogram("swimring_kvs_request_duration_seconds", stats.latencies[op], "op", op)
+	}
+	stats.Unlock()
+
+	p.Family("swimring_kvs_gets_total", "counter", "Internal Get requests by result.")
+	p.Sample("swimring_kvs_gets_total", float64(atomic.LoadInt64(&stats.hits)), "result", "hit")
+	p.Sample("swimring_kvs_gets_total", float64(atomic.LoadInt64(&stats.misses)), "result", "miss")
+
+	gauges := []struct {
+		name, help string
+		value      float64
+	}{
+		{"swimring_kvs_keys", "Number of entries in local KVS, tombstones included.", float64(m.KeyCount)},
+		{"swimring_kvs_wal_bytes", "Size of the commit log.", float64(m.WALSize)},
+		{"swimring_kvs_wal_segments", "Number of commit log segments.", float64(m.WALSegments)},
+		{"swimring_kvs_pending_reconcile_keys", "Keys awaiting anti-entropy reconciliation.", float64(k.PendingReconcile())},
+		{"swimring_kvs_migration_keys_per_second", "Keys migrated per second.", float64(m.Migration.KeysPerSec)},
+		{"swimring_kvs_migration_bytes_per_second", "Bytes migrated per second.", float64(m.Migration.BytesPerSec)},
+		{"swimring_kvs_migration_transfers", "Key transfers in flight.", float64(m.Migration.InFlight)},
+		{"swimring_kvs_expiring_keys", "Keys with a pending TTL.", float64(m.ExpiringKeys)},
+		{"swimring_kvs_requests_per_second", "Foreground requests per second.", float64(m.Load.RequestsPerSec)},
+		{"swimring_kvs_requests_in_flight", "Foreground requests in progress.", float64(m.Load.InFlight)},
+		{"swimring_kvs_background_paused", "Whether background reconciliation is paused by the load.", boolToFloat(m.Load.Paused)},
+		{"swimring_kvs_background_waiting", "Background tasks held back by the load.", float64(m.Load.Waiting)},
+		{"swimring_kvs_queue_depth", "Requests waiting for local KVS.", float64(m.QueueDepth)},
+	}
+	for _, g := range gauges {
+		p.Family(g.name, "gauge", g.help)
+		p.Sample(g.name, g.value)
+	}
+
+	counters := []struct {
+		name, help string
+		value      float64
+	}{
+		{"swimring_kvs_expired_keys_total", "Keys removed by the expiry sweeper.", float64(m.ExpiredKeys)},
+		{"swimring_kvs_compacted_versions_total", "Superseded versions dropped by compaction.", float64(m.CompactedVersions)},
+		{"swimring_kvs_evicted_keys_total", "Keys evicted under the memory limit.", float64(m.EvictedKeys)},
+		{"swimring_kvs_replayed_writes_total", "Forwarded writes ignored as already applied.", float64(m.ReplayedWrites)},
+		{"swimring_kvs_filtered_reads_total", "Reads of absent keys answered by the key filter.", float64(m.FilteredReads)},
+	}
+	for _, c := range counters {
+		p.Family(c.name, "counter", c.help)
+		p.Sample(c.name, c.value)
+	}
+}
+
+func boolToFloat(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,30 @@
+package storage
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// queueMutex is a mutex counting the goroutines waiting for it, which are
+// the requests queued behind the one holding local KVS.
+type queueMutex struct {
+	waiting int64 // first for 64-bit alignment of atomic access
+
+	sync.Mutex
+}
+
+// Lock locks m, counting the caller as waiting while m is held by another.
+func (m *queueMutex) Lock() {
+	if m.Mutex.TryLock() {
+		return
+	}
+
+	atomic.AddInt64(&m.waiting, 1)
+	m.Mutex.Lock()
+	atomic.AddInt64(&m.waiting, -1)
+}
+
+// depth returns the number of goroutines waiting for m.
+func (m *queueMutex) depth() int64 {
+	return atomic.LoadInt64(&m.waiting)
+}
@@ -0,0 +1,134 @@
+package storage
+
+import (
+	"time"
+)
+
+// RebalanceStatus is the progress of the rebalance in progress, made of the
+// key transfers planned since the node last finished migrating keys.
+type RebalanceStatus struct {
+	Active        bool
+	Started       time.Time
+	KeysMoved     int64
+	KeysRemaining int64
+	KeysPerSec    int64
+	BytesPerSec   int64
+	// ETA is the estimated time left at the current throughput, or zero if
+	// it cannot be estimated yet.
+	ETA time.Duration
+}
+
+// Plan adds the given number of keys to the transfers of the rebalance in
+// progress, starting a new one if none is. It is called whenever a join, a
+// leave or a token change moves keys away from this node.
+func (t *MigrationThrottle) Plan(keys int) {
+	if keys <= 0 {
+		return
+	}
+
+	t.mu.Lock()
+	if t.planned == 0 {
+		t.started = time.Now()
+		t.moved = 0
+	}
+	t.planned += int64(keys)
+	t.mu.Unlock()
+}
+
+// Skip removes the given number of planned keys that will not be moved,
+// such as keys deleted meanwhile or transfers given up.
+func (t *MigrationThrottle) Skip(keys int) {
+	t.mu.Lock()
+	t.planned -= int64(keys)
+	if t.planned < t.moved {
+		t.planned = t.moved
+	}
+	t.finishIfDoneNoLock()
+	t.mu.Unlock()
+}
+
+// RebalanceStatus returns the progress of the rebalance in progress.
+func (t *MigrationThrottle) RebalanceStatus() RebalanceStatus {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := time.Now()
+	t.rollNoLock(now)
+
+	status := RebalanceStatus{
+		KeysPerSec:  t.lastKeys,
+		BytesPerSec: t.lastBytes,
+	}
+	if t.planned == 0 {
+		return status
+	}
+
+	status.Active = true
+	status.Started = t.started
+	status.KeysMoved = t.moved
+	status.KeysRemaining = t.planned - t.moved
+
+	// Until a full window has elapsed, fall back to the average rate.
+	rate := float64(t.lastKeys)
+	if rate == 0 && t.moved > 0 {
+		rate = float64(t.moved) / now.Sub(t.started).Seconds()
+	}
+	if rate > 0 {
+		status.ETA = time.Duration(float64(status.KeysRemaining) / rate * float64(time.Second))
+	}
+
+	return status
+}
+
+// moveNoLock accounts for a key moved by the rebalance in progress, if any.
+func (t *MigrationThrottle) moveNoLock() {
+	if t.planned == 0 {
+		return
+	}
+
+	t.moved++
+	t.finishIfDoneNoLock()
+}
+
+func (t *MigrationThrottle) finishIfDoneNoLock() {
+	if t.planned > 0 && t.moved >= t.planned {
+		logger.Noticef("Rebalance done: %d keys moved in %s", t.moved, time.Since(t.started).Round(time.Second))
+		t.planned, t.moved = 0, 0
+	}
+}
+
+// Receive applies an entry handed off by another node during a rebalance,
+// keeping its timestamp and clock, unless the local version of the key is
+// newer, by vector clock when both versions carry one.
+func (k *KVStore) Receive(key string, entry KVEntry) error {
+	record := &exportRecord{
+		Key:       key,
+		Value:     []byte(entry.Value),
+		Timestamp: entry.Timestamp,
+		Deleted:   entry.Exist == 0,
+		Metadata:  entry.Metadata,
+		Sequence:  entry.Sequence,
+		Clock:     entry.Clock,
+	}
+
+	var stats ImportStats
+	return k.importRecord(record, &ImportOptions{}, &stats)
+}
+
+// Release drops the given key from local KVS without writing a tombstone,
+// once it was handed off to the replicas now owning it. The key is kept if
+// it was written since the handed off version, which has the given
+// timestamp. Returns whether the key was dropped.
+func (k *KVStore) Release(key string, timestamp int64) bool {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	entry, ok := k.memtable.Get(key)
+	if !ok || entry.Exist == 0 || entry.Timestamp != timestamp {
+		return false
+	}
+
+	k.eviction.remove(key)
+	k.evictNoLock(key)
+	return true
+}
@@ -1,45 +1,261 @@
 package storage
 
+import (
+	"swimring/util"
+	"sync/atomic"
+	"time"
+)
+
 // RequestHandlers defines a set of RPC handlers for internal KVS request.
 type RequestHandlers struct {
-	kvs *KVStore
+	kvs   *KVStore
+	stats *requestStats
 }
 
-// GetRequest is the payload of Get.
+// GetRequest is the payload of Get. RequestID identifies the external
+// request which caused it in the log messages.
 type GetRequest struct {
-	Key string
+	Key       string
+	RequestID string
 }
 
 // GetResponse is the payload of the response of Get.
 type GetResponse struct {
 	Ok      bool
 	Message string
+	// NotFound tells a missing key apart from other failures. Value then
+	// holds the tombstone of the key, if it was deleted, so that the
+	// coordinator can tell the delete is newer than the values of the other
+	// replicas.
+	NotFound bool
 
 	Node  string
 	Key   string
 	Value KVEntry
 }
 
-// PutRequest is the payload of Put.
+// GetMultiRequest is the payload of GetMulti.
+type GetMultiRequest struct {
+	Keys []string
+}
+
+// GetMultiResponse is the payload of the response of GetMulti. Keys not found
+// are missing from Values.
+type GetMultiResponse struct {
+	Ok      bool
+	Message string
+
+	Node   string
+	Values map[string]KVEntry
+}
+
+// ScanPageRequest is the payload of ScanPage. With Tombstones set, the
+// deleted keys are returned as well.
+type ScanPageRequest struct {
+	Prefix     string
+	After      string
+	Limit      int
+	Tombstones bool
+}
+
+// ScanPageResponse is the payload of the response of ScanPage. Values[i] is
+// the entry of Keys[i].
+type ScanPageResponse struct {
+	Ok      bool
+	Message string
+
+	Node   string
+	Keys   []string
+	Values []KVEntry
+	More   bool
+}
+
+// PutBatchRequest is the payload of PutBatch. Nonce, RequestID, Timestamp
+// and Clock are as in PutRequest, for every key of the batch.
+type PutBatchRequest struct {
+	Pairs map[string]string
+
+	Nonce     string
+	RequestID string
+	Timestamp int64
+	Clock     *util.VectorClock
+}
+
+// PutRequest is the payload of Put. A positive Sequence fences the write:
+// it is rejected unless Sequence is greater than the stored one. Metadata is
+// attached to the value. Nonce identifies the write across its deliveries,
+// such as by hinted handoff and by normal replication, so that a replica
+// applies it once and acknowledges the others without changing the value.
+// RequestID identifies the external request which caused it in the log
+// messages. Timestamp and Clock are stamped by the coordinator, so that every
+// replica stores the same version; a zero Timestamp dates the write from its
+// arrival. A non-empty IndexField indexes the key on that field of the value,
+// as PutIndexed does.
 type PutRequest struct {
 	Key, Value string
+	IndexField string
+	Sequence   int64
+	Metadata   map[string]string
+	Nonce      string
+	RequestID  string
+	Timestamp  int64
+	Clock      *util.VectorClock
 }
 
-// PutResponse is the payload of the response of Put.
+// PutResponse is the payload of the response of Put. Stale tells a write
+// rejected for its sequence apart from other failures, and Sequence is then
+// the sequence stored for the key. Clock is the one stored, which descends
+// from the clock of the write and of the version it replaced.
 type PutResponse struct {
 	Ok      bool
 	Message string
+
+	Stale    bool
+	Sequence int64
+	Clock    *util.VectorClock
+}
+
+// QueryIndexRequest is the payload of QueryIndex.
+type QueryIndexRequest struct {
+	Field, Value string
+}
+
+// QueryIndexResponse is the payload of the response of QueryIndex.
+type QueryIndexResponse struct {
+	Ok      bool
+	Message string
+
+	Node string
+	Keys []string
+}
+
+// DigestsRequest is the payload of Digests.
+type DigestsRequest struct {
+	Buckets int
+}
+
+// DigestsResponse is the payload of the response of Digests.
+type DigestsResponse struct {
+	Ok      bool
+	Node    string
+	Digests []uint64
+}
+
+// KeyFilterRequest is the payload of KeyFilter.
+type KeyFilterRequest struct{}
+
+// KeyFilterResponse is the payload of the response of KeyFilter. Filter is
+// a zero snapshot, which may contain any key, if the node has no key filter.
+type KeyFilterResponse struct {
+	Ok     bool
+	Node   string
+	Filter KeyFilterSnapshot
+}
+
+// BucketEntriesRequest is the payload of BucketEntries.
+type BucketEntriesRequest struct {
+	Bucket, Buckets int
+}
+
+// BucketEntriesResponse is the payload of the response of BucketEntries.
+type BucketEntriesResponse struct {
+	Ok      bool
+	Node    string
+	Entries map[string]KVEntry
 }
 
-// DeleteRequest is the payload of Delete.
+// DeleteRequest is the payload of Delete. RequestID identifies the external
+// request which caused it in the log messages. Timestamp and Clock are as
+// for Put.
 type DeleteRequest struct {
-	Key string
+	Key       string
+	RequestID string
+	Timestamp int64
+	Clock     *util.VectorClock
 }
 
-// DeleteResponse is the payload of the response of Delete.
+// DeleteResponse is the payload of the response of Delete. Clock is the one
+// of the tombstone stored.
 type DeleteResponse struct {
 	Ok      bool
 	Message string
+	Clock   *util.VectorClock
+}
+
+// HandoffRequest is the payload of Handoff, a key moved by a rebalance to a
+// node now holding one of its replicas.
+type HandoffRequest struct {
+	Key   string
+	Value KVEntry
+}
+
+// HandoffResponse is the payload of the response of Handoff.
+type HandoffResponse struct {
+	Ok      bool
+	Message string
+}
+
+// CompareAndSwapRequest is the payload of CompareAndSwap. RequestID,
+// Timestamp and Clock are as in PutRequest.
+type CompareAndSwapRequest struct {
+	Key string
+	Op  CASOp
+
+	RequestID string
+	Timestamp int64
+	Clock     *util.VectorClock
+}
+
+// CompareAndSwapResponse is the payload of the response of CompareAndSwap.
+type CompareAndSwapResponse struct {
+	Ok      bool
+	Message string
+	// Mismatch tells a key not holding the expected value apart from other
+	// failures.
+	Mismatch bool
+}
+
+// ExpireRequest is the payload of Expire.
+type ExpireRequest struct {
+	Key string
+	TTL time.Duration
+}
+
+// ExpireResponse is the payload of the response of Expire.
+type ExpireResponse struct {
+	Ok       bool
+	Message  string
+	NotFound bool
+}
+
+// TTLRequest is the payload of TTL.
+type TTLRequest struct {
+	Key string
+}
+
+// TTLResponse is the payload of the response of TTL. TTL is NoExpiry if the
+// key does not expire.
+type TTLResponse struct {
+	Ok       bool
+	Message  string
+	NotFound bool
+
+	TTL time.Duration
+}
+
+// GetHistoryRequest is the payload of GetHistory.
+type GetHistoryRequest struct {
+	Key string
+}
+
+// GetHistoryResponse is the payload of the response of GetHistory.
+type GetHistoryResponse struct {
+	Ok      bool
+	Message string
+
+	Node     string
+	Key      string
+	Versions []KVEntry
 }
 
 // StatRequest is the payload of Stat.
@@ -47,30 +263,77 @@ type StatRequest struct{}
 
 // StatResponse is the payload of the response of Stat.
 type StatResponse struct {
-	Ok    bool
-	Count int
+	Ok          bool
+	Count       int
+	MemoryBytes int64
+	ReadOnly    bool
+
+	PendingReconcile int
+}
+
+// MetricsRequest is the payload of Metrics.
+type MetricsRequest struct{}
+
+// MetricsResponse is the payload of the response of Metrics.
+type MetricsResponse struct {
+	Ok      bool
+	Metrics MetricsSnapshot
 }
 
 // NewRequestHandler returns a new RequestHandlers.
 func NewRequestHandler(kvs *KVStore) *RequestHandlers {
 	rh := &RequestHandlers{
-		kvs: kvs,
+		kvs:   kvs,
+		stats: newRequestStats(),
 	}
 
 	return rh
 }
 
+// logRequest records the latency of an internal request and logs it with its
+// fields. A request sent without the ID of the external request causing it,
+// such as by an older node, is given one.
+func (rh *RequestHandlers) logRequest(op, key, requestID string, start time.Time) {
+	latency := time.Since(start)
+	rh.stats.observe(op, latency)
+
+	if requestID == "" {
+		requestID = util.NewRequestID()
+	}
+
+	fields := util.LogFields{
+		"op":         op,
+		"latency":    latency,
+		"request_id": requestID,
+	}
+	if key != "" {
+		fields["key_hash"] = util.KeyHash(key)
+	}
+
+	logger.Info("Internal request handled", fields)
+}
+
 // Get handles the incoming Get request.
 func (rh *RequestHandlers) Get(req *GetRequest, resp *GetResponse) error {
-	logger.Infof("Handling intrnal request Get(%s)", req.Key)
+	start := time.Now()
+	defer rh.logRequest("Get", req.Key, req.RequestID, start)
+	defer rh.kvs.load.track()()
 
 	value, err := rh.kvs.Get(req.Key)
 	resp.Node = rh.kvs.address
 	if err != nil {
+		if err == ErrKeyNotFound {
+			atomic.AddInt64(&rh.stats.misses, 1)
+		}
 		resp.Ok = false
 		resp.Message = err.Error()
+		resp.NotFound = err == ErrKeyNotFound
+		if tombstone, ok := rh.kvs.tombstone(req.Key); ok && resp.NotFound {
+			resp.Value = tombstone
+		}
 		return nil
 	}
+	atomic.AddInt64(&rh.stats.hits, 1)
 
 	resp.Ok = true
 	resp.Key = req.Key
@@ -78,11 +341,91 @@ func (rh *RequestHandlers) Get(req *GetRequest, resp *GetResponse) error {
 	return nil
 }
 
+// GetMulti handles the incoming GetMulti request, reading several keys held
+// by this node in a single call.
+func (rh *RequestHandlers) GetMulti(req *GetMultiRequest, resp *GetMultiResponse) error {
+	start := time.Now()
+	defer rh.logRequest("GetMulti", "", "", start)
+	defer rh.kvs.load.track()()
+
+	resp.Node = rh.kvs.address
+	resp.Values = rh.kvs.GetMulti(req.Keys)
+
+	resp.Ok = true
+	return nil
+}
+
+// ScanPage handles the incoming ScanPage request.
+func (rh *RequestHandlers) ScanPage(req *ScanPageRequest, resp *ScanPageResponse) error {
+	start := time.Now()
+	defer rh.logRequest("ScanPage", "", "", start)
+	defer rh.kvs.load.track()()
+
+	resp.Node = rh.kvs.address
+	if req.Tombstones {
+		resp.Keys, resp.Values, resp.More = rh.kvs.ScanPageWithTombstones(req.Prefix, req.After, req.Limit)
+	} else {
+		resp.Keys, resp.Values, resp.More = rh.kvs.ScanPage(req.Prefix, req.After, req.Limit)
+	}
+	resp.Ok = true
+	return nil
+}
+
 // Put handles the incoming Put request.
 func (rh *RequestHandlers) Put(req *PutRequest, resp *PutResponse) error {
-	logger.Infof("Handling intrnal request Put(%s, %s)", req.Key, req.Value)
+	start := time.Now()
+	defer rh.logRequest("Put", req.Key, req.RequestID, start)
+	defer rh.kvs.load.track()()
 
-	err := rh.kvs.Put(req.Key, req.Value)
+	opts := putOptions{
+		metadata:  req.Metadata,
+		nonce:     req.Nonce,
+		timestamp: req.Timestamp,
+		clock:     req.Clock,
+	}
+
+	if req.IndexField != "" {
+		indexed, err := indexValue(req.Value, req.IndexField)
+		if err != nil {
+			resp.Ok = false
+			resp.Message = err.Error()
+			return nil
+		}
+		opts.indexField, opts.indexValue = req.IndexField, indexed
+	}
+
+	var err error
+	if req.Sequence > 0 {
+		err = rh.kvs.putSequenced(req.Key, req.Value, req.Sequence, opts)
+	} else {
+		err = rh.kvs.put(req.Key, req.Value, opts)
+	}
+	if err != nil {
+		resp.Ok = false
+		resp.Message = err.Error()
+		if err == ErrStaleSequence {
+			resp.Stale = true
+			resp.Sequence = rh.kvs.Sequence(req.Key)
+		}
+		return nil
+	}
+
+	resp.Ok = true
+	resp.Clock = rh.kvs.Clock(req.Key)
+	return nil
+}
+
+// PutBatch handles the incoming PutBatch request.
+func (rh *RequestHandlers) PutBatch(req *PutBatchRequest, resp *PutResponse) error {
+	start := time.Now()
+	defer rh.logRequest("PutBatch", "", req.RequestID, start)
+	defer rh.kvs.load.track()()
+
+	err := rh.kvs.putBatch(req.Pairs, putOptions{
+		nonce:     req.Nonce,
+		timestamp: req.Timestamp,
+		clock:     req.Clock,
+	})
 	if err != nil {
 		resp.Ok = false
 		resp.Message = err.Error()
@@ -93,11 +436,58 @@ func (rh *RequestHandlers) Put(req *PutRequest, resp *PutResponse) error {
 	return nil
 }
 
+// QueryIndex handles the incoming QueryIndex request.
+func (rh *RequestHandlers) QueryIndex(req *QueryIndexRequest, resp *QueryIndexResponse) error {
+	start := time.Now()
+	defer rh.logRequest("QueryIndex", "", "", start)
+	defer rh.kvs.load.track()()
+
+	resp.Node = rh.kvs.address
+	resp.Keys = rh.kvs.QueryIndex(req.Field, req.Value)
+	resp.Ok = true
+	return nil
+}
+
+// Digests handles the incoming Digests request.
+func (rh *RequestHandlers) Digests(req *DigestsRequest, resp *DigestsResponse) error {
+	start := time.Now()
+	defer rh.logRequest("Digests", "", "", start)
+
+	resp.Node = rh.kvs.address
+	resp.Digests = rh.kvs.Digests(req.Buckets)
+	resp.Ok = true
+	return nil
+}
+
+// KeyFilter handles the incoming KeyFilter request.
+func (rh *RequestHandlers) KeyFilter(req *KeyFilterRequest, resp *KeyFilterResponse) error {
+	logger.Info("Handling intrnal request KeyFilter()")
+
+	resp.Ok = true
+	resp.Node = rh.kvs.address
+	resp.Filter = rh.kvs.KeyFilter()
+
+	return nil
+}
+
+// BucketEntries handles the incoming BucketEntries request.
+func (rh *RequestHandlers) BucketEntries(req *BucketEntriesRequest, resp *BucketEntriesResponse) error {
+	start := time.Now()
+	defer rh.logRequest("BucketEntries", "", "", start)
+
+	resp.Node = rh.kvs.address
+	resp.Entries = rh.kvs.BucketEntries(req.Bucket, req.Buckets)
+	resp.Ok = true
+	return nil
+}
+
 // Delete handles the incoming Delete request.
 func (rh *RequestHandlers) Delete(req *DeleteRequest, resp *DeleteResponse) error {
-	logger.Infof("Handling intrnal request Delete(%s)", req.Key)
+	start := time.Now()
+	defer rh.logRequest("Delete", req.Key, req.RequestID, start)
+	defer rh.kvs.load.track()()
 
-	err := rh.kvs.Delete(req.Key)
+	err := rh.kvs.delete(req.Key, putOptions{timestamp: req.Timestamp, clock: req.Clock})
 	if err != nil {
 		resp.Ok = false
 		resp.Message = err.Error()
@@ -105,6 +495,99 @@ func (rh *RequestHandlers) Delete(req *DeleteRequest, resp *DeleteResponse) erro
 	}
 
 	resp.Ok = true
+	resp.Clock = rh.kvs.Clock(req.Key)
+	return nil
+}
+
+// Handoff handles the incoming Handoff request.
+func (rh *RequestHandlers) Handoff(req *HandoffRequest, resp *HandoffResponse) error {
+	start := time.Now()
+	defer rh.logRequest("Handoff", req.Key, "", start)
+
+	if err := rh.kvs.Receive(req.Key, req.Value); err != nil {
+		resp.Ok = false
+		resp.Message = err.Error()
+		return nil
+	}
+
+	resp.Ok = true
+	return nil
+}
+
+// CompareAndSwap handles the incoming CompareAndSwap request.
+func (rh *RequestHandlers) CompareAndSwap(req *CompareAndSwapRequest, resp *CompareAndSwapResponse) error {
+	start := time.Now()
+	defer rh.logRequest("CompareAndSwap", req.Key, req.RequestID, start)
+	defer rh.kvs.load.track()()
+
+	err := rh.kvs.compareAndSwap(req.Key, req.Op, putOptions{
+		timestamp: req.Timestamp,
+		clock:     req.Clock,
+	})
+	if err != nil {
+		resp.Ok = false
+		resp.Message = err.Error()
+		resp.Mismatch = err == ErrCASMismatch
+		return nil
+	}
+
+	resp.Ok = true
+	return nil
+}
+
+// Expire handles the incoming Expire request.
+func (rh *RequestHandlers) Expire(req *ExpireRequest, resp *ExpireResponse) error {
+	start := time.Now()
+	defer rh.logRequest("Expire", req.Key, "", start)
+	defer rh.kvs.load.track()()
+
+	err := rh.kvs.Expire(req.Key, req.TTL)
+	if err != nil {
+		resp.Ok = false
+		resp.Message = err.Error()
+		resp.NotFound = err == ErrKeyNotFound
+		return nil
+	}
+
+	resp.Ok = true
+	return nil
+}
+
+// TTL handles the incoming TTL request.
+func (rh *RequestHandlers) TTL(req *TTLRequest, resp *TTLResponse) error {
+	start := time.Now()
+	defer rh.logRequest("TTL", req.Key, "", start)
+	defer rh.kvs.load.track()()
+
+	ttl, err := rh.kvs.TTL(req.Key)
+	if err != nil {
+		resp.Ok = false
+		resp.Message = err.Error()
+		resp.NotFound = err == ErrKeyNotFound
+		return nil
+	}
+
+	resp.Ok = true
+	resp.TTL = ttl
+	return nil
+}
+
+// GetHistory handles the incoming GetHistory request.
+func (rh *RequestHandlers) GetHistory(req *GetHistoryRequest, resp *GetHistoryResponse) error {
+	start := time.Now()
+	defer rh.logRequest("GetHistory", req.Key, "", start)
+
+	versions, err := rh.kvs.GetHistory(req.Key)
+	resp.Node = rh.kvs.address
+	if err != nil {
+		resp.Ok = false
+		resp.Message = err.Error()
+		return nil
+	}
+
+	resp.Ok = true
+	resp.Key = req.Key
+	resp.Versions = versions
 	return nil
 }
 
@@ -114,6 +597,19 @@ func (rh *RequestHandlers) Stat(req *StatRequest, resp *StatResponse) error {
 
 	resp.Ok = true
 	resp.Count = rh.kvs.Count()
+	resp.MemoryBytes = rh.kvs.MemoryUsage()
+	resp.ReadOnly = rh.kvs.ReadOnly()
+	resp.PendingReconcile = rh.kvs.PendingReconcile()
+
+	return nil
+}
+
+// Metrics handles the incoming Metrics request.
+func (rh *RequestHandlers) Metrics(req *MetricsRequest, resp *MetricsResponse) error {
+	logger.Info("Handling intrnal request Metrics()")
+
+	resp.Ok = true
+	resp.Metrics = rh.kvs.Metrics()
 
 	return nil
 }
@@ -0,0 +1,33 @@
+package storage
+
+import (
+	"testing"
+)
+
+func TestGetReturnsTombstone(t *testing.T) {
+	chdirTemp(t)
+
+	kvs := newTestKVStore(t, "node:1", nil)
+	defer kvs.Close()
+	rh := NewRequestHandler(kvs)
+
+	kvs.Put("a", "1")
+	if err := kvs.Delete("a"); err != nil {
+		t.Fatal(err)
+	}
+
+	resp := &GetResponse{}
+	rh.Get(&GetRequest{Key: "a"}, resp)
+	if resp.Ok || !resp.NotFound {
+		t.Fatalf("Get of a deleted key: Ok=%t NotFound=%t", resp.Ok, resp.NotFound)
+	}
+	if resp.Value.Exist != 0 || resp.Value.Timestamp == 0 {
+		t.Fatalf("Get of a deleted key returned %+v, want its tombstone", resp.Value)
+	}
+
+	resp = &GetResponse{}
+	rh.Get(&GetRequest{Key: "missing"}, resp)
+	if !resp.NotFound || resp.Value.Timestamp != 0 {
+		t.Fatalf("Get of a missing key returned %+v, want no tombstone", resp.Value)
+	}
+}
@@ -0,0 +1,134 @@
+package storage
+
+import (
+	"container/heap"
+	"encoding/base64"
+	"encoding/json"
+	"sort"
+)
+
+// ScanCursor is the position reached by a paginated scan: the last key
+// returned. The pages are merged in key order from every node, so the key
+// alone resumes the scan on whichever nodes hold the keys after it. It is
+// passed to clients as an opaque string.
+type ScanCursor struct {
+	Key string
+}
+
+// String encodes the cursor as an opaque string.
+func (c ScanCursor) String() string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// ParseScanCursor decodes a cursor encoded by ScanCursor.String. The empty
+// string is the cursor of a scan starting from the beginning.
+func ParseScanCursor(s string) (ScanCursor, error) {
+	var c ScanCursor
+	if s == "" {
+		return c, nil
+	}
+
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return c, err
+	}
+	err = json.Unmarshal(data, &c)
+	return c, err
+}
+
+// ScanPage returns, in key order, at most limit existing entries whose key
+// has the given prefix and sorts after the given key. more reports whether
+// entries remain after the last one returned. Only limit+1 keys are held in
+// memory while scanning.
+func (k *KVStore) ScanPage(prefix, after string, limit int) (keys []string, entries []KVEntry, more bool) {
+	return k.scanPage(prefix, after, limit, false)
+}
+
+// ScanPageWithTombstones is ScanPage returning the tombstones as well, so
+// that a coordinator merging the pages of several replicas tells a deleted
+// key from one a replica missed.
+func (k *KVStore) ScanPageWithTombstones(prefix, after string, limit int) (keys []string, entries []KVEntry, more bool) {
+	return k.scanPage(prefix, after, limit, true)
+}
+
+func (k *KVStore) scanPage(prefix, after string, limit int, tombstones bool) (keys []string, entries []KVEntry, more bool) {
+	matched, more := k.scanKeys(prefix, after, limit, nil, tombstones)
+
+	k.batch.RLock()
+	for _, key := range matched {
+		entry, ok := k.memtable.Get(key)
+		if !ok || (entry.Exist == 0 && !tombstones) {
+			continue
+		}
+		keys = append(keys, key)
+		entries = append(entries, *entry)
+	}
+	k.batch.RUnlock()
+
+	return keys, entries, more
+}
+
+// OwnedKeys returns, in key order, at most limit existing keys sorting after
+// the given key for which owns reports true, typically the keys this node is
+// the primary owner of. more reports whether keys remain after the last one
+// returned.
+func (k *KVStore) OwnedKeys(owns func(key string) bool, after string, limit int) (keys []string, more bool) {
+	matched, more := k.scanKeys("", after, limit, owns, false)
+
+	for _, key := range matched {
+		entry, ok := k.memtable.Get(key)
+		if !ok || entry.Exist == 0 {
+			continue
+		}
+		keys = append(keys, key)
+	}
+
+	return keys, more
+}
+
+// scanKeys returns the at most limit smallest keys with the given prefix that
+// sort after the given key and, if match is not nil, for which match reports
+// true. The deleted keys are only matched with tombstones set. more reports
+// whether more keys matched.
+func (k *KVStore) scanKeys(prefix, after string, limit int, match func(key string) bool, tombstones bool) (keys []string, more bool) {
+	if limit <= 0 {
+		return nil, false
+	}
+
+	smallest := &maxKeyHeap{}
+	k.memtable.Scan(prefix, func(key string, entry *KVEntry) bool {
+		if (entry.Exist == 0 && !tombstones) || key <= after || (match != nil && !match(key)) {
+			return true
+		}
+
+		heap.Push(smallest, key)
+		if smallest.Len() > limit+1 {
+			heap.Pop(smallest)
+		}
+		return true
+	})
+
+	keys = []string(*smallest)
+	sort.Strings(keys)
+	if len(keys) > limit {
+		keys, more = keys[:limit], true
+	}
+
+	return keys, more
+}
+
+// maxKeyHeap is a heap of keys whose root is the largest one.
+type maxKeyHeap []string
+
+func (h maxKeyHeap) Len() int            { return len(h) }
+func (h maxKeyHeap) Less(i, j int) bool  { return h[i] > h[j] }
+func (h maxKeyHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *maxKeyHeap) Push(x interface{}) { *h = append(*h, x.(string)) }
+
+func (h *maxKeyHeap) Pop() interface{} {
+	old := *h
+	key := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return key
+}
@@ -0,0 +1,45 @@
+package storage
+
+import (
+	"errors"
+)
+
+// ErrStaleSequence is returned by PutSequenced when the write does not carry
+// a sequence greater than the one stored for the key.
+var ErrStaleSequence = errors.New("stale write sequence")
+
+// PutSequenced updates the value for the given key if seq is greater than
+// the sequence of the last sequenced write of the key, and returns
+// ErrStaleSequence otherwise. Writes without a sequence do not change it.
+// The sequence is stored in the entry of the key, so it is persisted with
+// it, and dropped once its tombstone is compacted.
+func (k *KVStore) PutSequenced(key, value string, seq int64) error {
+	return k.putSequenced(key, value, seq, putOptions{})
+}
+
+func (k *KVStore) putSequenced(key, value string, seq int64, opts putOptions) error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	if k.readOnly {
+		return ErrReadOnly
+	}
+	if k.replayed(key, opts.nonce) {
+		return nil
+	}
+	if cur, ok := k.memtable.Get(key); ok && seq <= cur.Sequence {
+		return ErrStaleSequence
+	}
+
+	opts.sequence = seq
+	return k.writeValue(key, value, opts)
+}
+
+// Sequence returns the sequence of the last sequenced write of the given key,
+// or zero if it has none.
+func (k *KVStore) Sequence(key string) int64 {
+	if entry, ok := k.memtable.Get(key); ok {
+		return entry.Sequence
+	}
+	return 0
+}
@@ -0,0 +1,41 @@
+package storage
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSequenceSurvivesRestart(t *testing.T) {
+	chdirTemp(t)
+
+	kvs := newTestKVStore(t, "node:1", nil)
+	if err := kvs.PutSequenced("a", "1", 5); err != nil {
+		t.Fatal(err)
+	}
+	kvs.Put("a", "2")
+	if err := kvs.Delete("a"); err != nil {
+		t.Fatal(err)
+	}
+	kvs.Close()
+
+	kvs = newTestKVStore(t, "node:1", nil)
+	defer kvs.Close()
+
+	if seq := kvs.Sequence("a"); seq != 5 {
+		t.Fatalf("Sequence after restart = %d, want 5", seq)
+	}
+	if err := kvs.PutSequenced("a", "late", 3); err != ErrStaleSequence {
+		t.Fatalf("late write after restart = %v, want ErrStaleSequence", err)
+	}
+
+	// Purging the tombstone drops the sequence along with the key.
+	if n := kvs.purgeTombstones(time.Now().UnixNano()); n != 1 {
+		t.Fatalf("%d tombstones purged, want 1", n)
+	}
+	if seq := kvs.Sequence("a"); seq != 0 {
+		t.Fatalf("Sequence after purge = %d, want 0", seq)
+	}
+	if err := kvs.PutSequenced("a", "new", 3); err != nil {
+		t.Fatalf("write after purge = %v", err)
+	}
+}
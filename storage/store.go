@@ -0,0 +1,100 @@
+package storage
+
+import (
+	"strings"
+	"sync"
+)
+
+const (
+	// MemoryBackend keeps entries in an in-memory map, recovered from the
+	// commit log and dump file on restart.
+	MemoryBackend = "memory"
+	// BoltBackend keeps entries in a BoltDB file on local disk.
+	BoltBackend = "bolt"
+)
+
+// Store is a local storage backend holding the KVEntry of each key.
+type Store interface {
+	// Get returns the entry of the given key, including tombstones.
+	Get(key string) (*KVEntry, bool)
+	// Put stores the entry for the given key.
+	Put(key string, entry *KVEntry) error
+	// Delete removes the entry of the given key from the backend.
+	Delete(key string) error
+	// Scan calls fn for each entry whose key has the given prefix, and stops
+	// when fn returns false.
+	Scan(prefix string, fn func(key string, entry *KVEntry) bool) error
+	// Count returns the number of entries in the backend.
+	Count() int
+	// Close releases the resources held by the backend.
+	Close() error
+}
+
+type memoryStore struct {
+	sync.RWMutex
+	entries map[string]*KVEntry
+}
+
+func newMemoryStore() *memoryStore {
+	return &memoryStore{
+		entries: make(map[string]*KVEntry),
+	}
+}
+
+// Get returns the entry of the given key.
+func (m *memoryStore) Get(key string) (*KVEntry, bool) {
+	m.RLock()
+	entry, ok := m.entries[key]
+	m.RUnlock()
+
+	return entry, ok
+}
+
+// Put stores the entry for the given key.
+func (m *memoryStore) Put(key string, entry *KVEntry) error {
+	m.Lock()
+	m.entries[key] = entry
+	m.Unlock()
+
+	return nil
+}
+
+// Delete removes the entry of the given key.
+func (m *memoryStore) Delete(key string) error {
+	m.Lock()
+	delete(m.entries, key)
+	m.Unlock()
+
+	return nil
+}
+
+// Scan calls fn for each entry whose key has the given prefix.
+func (m *memoryStore) Scan(prefix string, fn func(key string, entry *KVEntry) bool) error {
+	m.RLock()
+	defer m.RUnlock()
+
+	for key, entry := range m.entries {
+		if !strings.HasPrefix(key, prefix) {
+			continue
+		}
+		if !fn(key, entry) {
+			break
+		}
+	}
+
+	return nil
+}
+
+// Count returns the number of entries.
+func (m *memoryStore) Count() int {
+	m.RLock()
+	n := len(m.entries)
+	m.RUnlock()
+
+	return n
+}
+
+// Close does nothing for the in-memory backend.
+func (m *memoryStore) Close() error {
+	return nil
+}
@@ -0,0 +1,144 @@
+package storage
+
+import (
+	"sync"
+	"time"
+)
+
+// MigrationThrottle limits the bandwidth and concurrency of the key
+// transfers made while rebalancing, so that a node joining the ring does not
+// saturate the network at the expense of live traffic.
+type MigrationThrottle struct {
+	keys, bytes *rateLimiter
+	slots       chan struct{}
+
+	mu                  sync.Mutex
+	window              time.Time
+	curKeys, curBytes   int64
+	lastKeys, lastBytes int64
+	inFlight            int
+
+	// planned and moved count the keys of the rebalance in progress, which
+	// started at started.
+	planned, moved int64
+	started        time.Time
+}
+
+// MigrationStats is the current throughput of key migration.
+type MigrationStats struct {
+	KeysPerSec  int64
+	BytesPerSec int64
+	InFlight    int
+}
+
+// NewMigrationThrottle returns a MigrationThrottle allowing keysPerSec keys
+// and bytesPerSec bytes per second over at most maxInFlight concurrent
+// transfers. A zero rate is unlimited.
+func NewMigrationThrottle(keysPerSec, bytesPerSec int64, maxInFlight int) *MigrationThrottle {
+	if maxInFlight < 1 {
+		maxInFlight = 1
+	}
+
+	return &MigrationThrottle{
+		keys:   newRateLimiter(keysPerSec),
+		bytes:  newRateLimiter(bytesPerSec),
+		slots:  make(chan struct{}, maxInFlight),
+		window: time.Now(),
+	}
+}
+
+// Begin waits for a free transfer slot and returns the function releasing it.
+func (t *MigrationThrottle) Begin() func() {
+	t.slots <- struct{}{}
+
+	t.mu.Lock()
+	t.inFlight++
+	t.mu.Unlock()
+
+	return func() {
+		t.mu.Lock()
+		t.inFlight--
+		t.mu.Unlock()
+
+		<-t.slots
+	}
+}
+
+// Wait blocks until a key of the given size may be sent, and accounts for it
+// in the migration throughput.
+func (t *MigrationThrottle) Wait(size int) {
+	t.keys.wait(1)
+	t.bytes.wait(int64(size))
+
+	t.mu.Lock()
+	t.rollNoLock(time.Now())
+	t.curKeys++
+	t.curBytes += int64(size)
+	t.moveNoLock()
+	t.mu.Unlock()
+}
+
+// Stats returns the throughput measured over the last window of at least a
+// second.
+func (t *MigrationThrottle) Stats() MigrationStats {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.rollNoLock(time.Now())
+	return MigrationStats{
+		KeysPerSec:  t.lastKeys,
+		BytesPerSec: t.lastBytes,
+		InFlight:    t.inFlight,
+	}
+}
+
+func (t *MigrationThrottle) rollNoLock(now time.Time) {
+	elapsed := now.Sub(t.window).Seconds()
+	if elapsed < 1 {
+		return
+	}
+
+	t.lastKeys = int64(float64(t.curKeys) / elapsed)
+	t.lastBytes = int64(float64(t.curBytes) / elapsed)
+	t.curKeys, t.curBytes = 0, 0
+	t.window = now
+}
+
+// rateLimiter is a token bucket refilled at rate tokens per second, holding
+// at most one second worth of tokens.
+type rateLimiter struct {
+	mu     sync.Mutex
+	rate   int64
+	tokens float64
+	last   time.Time
+}
+
+func newRateLimiter(rate int64) *rateLimiter {
+	return &rateLimiter{
+		rate:   rate,
+		tokens: float64(rate),
+		last:   time.Now(),
+	}
+}
+
+// wait takes n tokens, sleeping if the bucket goes into debt.
+func (l *rateLimiter) wait(n int64) {
+	if l.rate <= 0 {
+		return
+	}
+
+	l.mu.Lock()
+	now := time.Now()
+	l.tokens += now.Sub(l.last).Seconds() * float64(l.rate)
+	if l.tokens > float64(l.rate) {
+		l.tokens = float64(l.rate)
+	}
+	l.last = now
+	l.tokens -= float64(n)
+	debt := l.tokens
+	l.mu.Unlock()
+
+	if debt < 0 {
+		time.Sleep(time.Duration(-debt / float64(l.rate) * float64(time.Second)))
+	}
+}
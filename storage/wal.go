@@ -0,0 +1,203 @@
+package storage
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// writeAheadLog is an append-only log split into numbered segment files.
+// Every write is appended to the current segment before it is applied to
+// the memtable, and a checkpoint removes all segments once the memtable
+// has been dumped to disk.
+type writeAheadLog struct {
+	sync.Mutex
+
+	prefix      string
+	segmentSize int64
+	format      int
+
+	file    *os.File
+	index   int
+	size    int64
+	oldSize int64
+}
+
+func openWriteAheadLog(prefix string, segmentSize int64, format int) (*writeAheadLog, error) {
+	w := &writeAheadLog{
+		prefix:      prefix,
+		segmentSize: segmentSize,
+		format:      format,
+	}
+
+	segments := w.Segments()
+	if len(segments) > 0 {
+		last := segments[len(segments)-1]
+		w.index = w.segmentIndex(last)
+		for _, segment := range segments[:len(segments)-1] {
+			if info, err := os.Stat(segment); err == nil {
+				w.oldSize += info.Size()
+			}
+		}
+	}
+
+	if err := w.openSegment(); err != nil {
+		return nil, err
+	}
+
+	return w, nil
+}
+
+// Append writes the record of the given key to the current segment, rotating
+// to a new segment if it grows beyond the segment size.
+func (w *writeAheadLog) Append(key string, entry *KVEntry) error {
+	w.Lock()
+	defer w.Unlock()
+
+	n, err := writeKeyValueToFile(w.file, key, entry, w.format)
+	w.size += int64(n)
+	if err != nil {
+		return err
+	}
+
+	if err := w.file.Sync(); err != nil {
+		return err
+	}
+
+	if w.size >= w.segmentSize {
+		return w.rotate()
+	}
+
+	return nil
+}
+
+// Checkpoint removes every segment and starts a new one. It must only be
+// called after all the logged records have been persisted elsewhere.
+func (w *writeAheadLog) Checkpoint() error {
+	w.Lock()
+	defer w.Unlock()
+
+	w.file.Close()
+	for _, segment := range w.Segments() {
+		if err := os.Remove(segment); err != nil {
+			logger.Error(err.Error())
+		}
+	}
+
+	w.index++
+	w.oldSize = 0
+	return w.openSegment()
+}
+
+// IsSegment returns whether the given file name is a segment of the log.
+func (w *writeAheadLog) IsSegment(name string) bool {
+	if !strings.HasPrefix(name, w.prefix+"_commit.") || !strings.HasSuffix(name, ".log") {
+		return false
+	}
+
+	_, err := strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(name, w.prefix+"_commit."), ".log"))
+	return err == nil
+}
+
+// Truncate cuts the given segment at size, dropping the record torn by a
+// crash after it, so that the records appended next follow the last
+// complete one.
+func (w *writeAheadLog) Truncate(name string, size int64) error {
+	w.Lock()
+	defer w.Unlock()
+
+	info, err := os.Stat(name)
+	if err != nil {
+		return err
+	}
+	if err := os.Truncate(name, size); err != nil {
+		return err
+	}
+
+	if name == w.segmentName(w.index) {
+		w.size = size
+	} else {
+		w.oldSize -= info.Size() - size
+	}
+
+	return nil
+}
+
+// Segments returns the file names of all segments, oldest first.
+func (w *writeAheadLog) Segments() []string {
+	matches, _ := filepath.Glob(w.prefix + "_commit.*.log")
+
+	sort.Slice(matches, func(i, j int) bool {
+		return w.segmentIndex(matches[i]) < w.segmentIndex(matches[j])
+	})
+
+	return matches
+}
+
+// Size returns the total size of all segments in bytes.
+func (w *writeAheadLog) Size() int64 {
+	w.Lock()
+	size := w.oldSize + w.size
+	w.Unlock()
+
+	return size
+}
+
+// NumSegments returns the number of segment files on disk.
+func (w *writeAheadLog) NumSegments() int {
+	w.Lock()
+	n := len(w.Segments())
+	w.Unlock()
+
+	return n
+}
+
+// Close closes the current segment.
+func (w *writeAheadLog) Close() error {
+	w.Lock()
+	err := w.file.Close()
+	w.Unlock()
+
+	return err
+}
+
+func (w *writeAheadLog) rotate() error {
+	w.file.Close()
+	w.oldSize += w.size
+	w.index++
+
+	logger.Infof("Commit log rotated to segment %d", w.index)
+
+	return w.openSegment()
+}
+
+func (w *writeAheadLog) openSegment() error {
+	f, err := os.OpenFile(w.segmentName(w.index), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+
+	w.file = f
+	w.size = info.Size()
+	return nil
+}
+
+func (w *writeAheadLog) segmentName(index int) string {
+	return fmt.Sprintf("%s_commit.%d.log", w.prefix, index)
+}
+
+func (w *writeAheadLog) segmentIndex(name string) int {
+	index := strings.TrimSuffix(strings.TrimPrefix(name, w.prefix+"_commit."), ".log")
+	i, _ := strconv.Atoi(index)
+	return i
+}
@@ -0,0 +1,96 @@
+package storage
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestReadRecordTruncated(t *testing.T) {
+	var buf bytes.Buffer
+	entry := &KVEntry{Value: "v\xff\x00", Timestamp: 42, Exist: 1, Metadata: map[string]string{"type": "raw"}}
+	if _, err := writeKeyValueToFile(&buf, "key", entry, CurrentEntryFormat); err != nil {
+		t.Fatal(err)
+	}
+	record := buf.Bytes()
+
+	key, got, n, err := readRecord(bufio.NewReader(bytes.NewReader(record)))
+	if err != nil {
+		t.Fatalf("complete record: %v", err)
+	}
+	if key != "key" || got.Value != entry.Value || got.Timestamp != 42 || got.Exist != 1 || got.Metadata["type"] != "raw" {
+		t.Fatalf("complete record: got %q %+v", key, got)
+	}
+	if n != int64(len(record)) {
+		t.Fatalf("complete record: size %d, want %d", n, len(record))
+	}
+
+	for i := 1; i < len(record); i++ {
+		_, _, _, err := readRecord(bufio.NewReader(bytes.NewReader(record[:i])))
+		if err != errTruncatedRecord {
+			t.Errorf("record cut at %d of %d: got %v, want errTruncatedRecord", i, len(record), err)
+		}
+	}
+
+	if _, _, _, err := readRecord(bufio.NewReader(bytes.NewReader(nil))); err != io.EOF {
+		t.Errorf("empty file: got %v, want io.EOF", err)
+	}
+}
+
+// chdirTemp runs the rest of the test in a temporary directory, where the
+// KVS files are written.
+func chdirTemp(t *testing.T) {
+	wd, _ := os.Getwd()
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+}
+
+func newTestKVStore(t *testing.T, address string, opts *Options) *KVStore {
+	kvs, err := NewKVStore(address, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return kvs
+}
+
+func TestRepairDBStopsAtTruncatedRecord(t *testing.T) {
+	chdirTemp(t)
+
+	kvs := newTestKVStore(t, "node:1", nil)
+	kvs.Put("a", "1")
+	kvs.Put("b", "2")
+	kvs.Close()
+
+	segments, _ := filepath.Glob("node_1_commit.*.log")
+	if len(segments) != 1 {
+		t.Fatalf("got segments %v", segments)
+	}
+	info, _ := os.Stat(segments[0])
+	// Cut the newline ending the last record, as a crash while appending it
+	// would.
+	if err := os.Truncate(segments[0], info.Size()-1); err != nil {
+		t.Fatal(err)
+	}
+
+	kvs = newTestKVStore(t, "node:1", nil)
+	if entry, err := kvs.Get("a"); err != nil || entry.Value != "1" {
+		t.Fatalf("Get(a) = %v, %v", entry, err)
+	}
+	if _, err := kvs.Get("b"); err != ErrKeyNotFound {
+		t.Fatalf("Get(b) = %v, want ErrKeyNotFound", err)
+	}
+
+	kvs.Put("c", "3")
+	kvs.Close()
+
+	kvs = newTestKVStore(t, "node:1", nil)
+	defer kvs.Close()
+	if entry, err := kvs.Get("c"); err != nil || entry.Value != "3" {
+		t.Fatalf("Get(c) after restart = %v, %v", entry, err)
+	}
+}
@@ -0,0 +1,160 @@
+package swimring
+
+import (
+	"errors"
+	"sort"
+	"strings"
+	"swimring/storage"
+	"swimring/util"
+	"time"
+)
+
+// errBatchLevel is returned for a PutBatch at a level which does not wait
+// for the replicas to apply it.
+var errBatchLevel = errors.New("PutBatch needs the ONE, QUORUM or ALL level")
+
+// PutBatchRequest is the payload of PutBatch.
+type PutBatchRequest struct {
+	Level string
+	Pairs map[string]string
+
+	IdempotencyKey string
+}
+
+// PutBatch handles the incoming PutBatch request. The keys are grouped by
+// write replicas, and each group is written in a single request to each of
+// its replicas, which apply it atomically. Atomicity is per replica set:
+// groups are written independently, and the batch fails with the reason
+// and replica outcomes of the first group which did not reach its level,
+// though the other groups may have been written.
+func (rc *RequestCoordinator) PutBatch(req *PutBatchRequest, resp *PutResponse) (err error) {
+	start := time.Now()
+	defer func() {
+		failure := err
+		if failure == nil && resp.Reason != "" {
+			failure = errConsistencyLevel
+		}
+		rc.stats.observe("PutBatch", time.Since(start), failure)
+	}()
+
+	if req.Level == ANY || req.Level == LOCAL {
+		return errBatchLevel
+	}
+	if err := rc.refuseWrites(); err != nil {
+		return err
+	}
+
+	if result, ok := rc.writes.Lookup(req.IdempotencyKey); ok {
+		logger.Debugf("PutBatch(%d keys) already applied, returning its result", len(req.Pairs))
+		*resp = result.(PutResponse)
+		return nil
+	}
+
+	requestID := util.NewRequestID()
+	logger.Info("Coordinating external request", util.LogFields{
+		"op":         "PutBatch",
+		"level":      req.Level,
+		"keys":       len(req.Pairs),
+		"request_id": requestID,
+	})
+
+	timestamp, clock, err := rc.stamp(nil)
+	if err != nil {
+		return err
+	}
+
+	type group struct {
+		replicas []string
+		pairs    map[string]string
+	}
+	groups := make(map[string]*group)
+	for key, value := range req.Pairs {
+		rc.reads.Invalidate(key)
+
+		replicas := rc.writeReplicas(key)
+		set := append([]string(nil), replicas...)
+		sort.Strings(set)
+		id := strings.Join(set, ",")
+
+		if groups[id] == nil {
+			groups[id] = &group{replicas: replicas, pairs: make(map[string]string)}
+		}
+		groups[id].pairs[key] = value
+	}
+
+	ids := make([]string, 0, len(groups))
+	for id := range groups {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	for _, id := range ids {
+		g := groups[id]
+		internalReq := &storage.PutBatchRequest{
+			Pairs:     g.pairs,
+			RequestID: requestID,
+			Timestamp: timestamp,
+			Clock:     clock,
+		}
+		// Groups sent to the same replica must not share a nonce, or the
+		// replica would take the second one for a retry of the first.
+		if req.IdempotencyKey != "" {
+			internalReq.Nonce = req.IdempotencyKey + "/" + id
+		}
+
+		err := rc.writeBatchGroup(g.replicas, req.Level, internalReq, resp)
+		rc.filters.invalidate(g.replicas)
+		if err != nil || resp.Reason != "" {
+			return err
+		}
+	}
+
+	resp.Clock = clock
+	rc.writes.Store(req.IdempotencyKey, *resp)
+	return nil
+}
+
+// writeBatchGroup sends a group of keys sharing the given replicas to them,
+// and sets the reason and the replica outcomes in resp if too few of them
+// acknowledged it for the consistency level.
+func (rc *RequestCoordinator) writeBatchGroup(replicas []string, level string, req *storage.PutBatchRequest, resp *PutResponse) error {
+	resCh := rc.sendReplicaRequests(replicas, PutBatchOp, req)
+
+	ackNeed := rc.numOfRequiredACK(level)
+	ackOk := 0
+	timedOut := false
+	var statuses []ReplicaStatus
+
+	for result := range resCh {
+		status := ReplicaStatus{Address: result.server, Status: ReplicaFailed}
+
+		switch res := result.result.(type) {
+		case *storage.PutResponse:
+			if res.Ok {
+				ackOk++
+				status.Status = ReplicaAcked
+			} else {
+				status.Message = res.Message
+			}
+		case error:
+			status.Message = res.Error()
+			if res == errRequestTimeout {
+				status.Status = ReplicaTimedOut
+				timedOut = true
+			}
+		}
+
+		if ackOk >= ackNeed {
+			return nil
+		}
+		statuses = append(statuses, status)
+	}
+
+	resp.Replicas = statuses
+	resp.Reason = ReasonUnavailable
+	if timedOut {
+		resp.Reason = ReasonTimeout
+	}
+	logger.Errorf("Cannot reach consistency requirements for PutBatch(%d keys, %s): %s", len(req.Pairs), level, resp.Reason)
+	return nil
+}
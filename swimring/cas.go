@@ -0,0 +1,111 @@
+package swimring
+
+import (
+	"errors"
+	"swimring/storage"
+	"swimring/util"
+	"time"
+)
+
+// errCASLevel is returned for a CompareAndSwap at a level which does not
+// wait for the replicas to compare the value.
+var errCASLevel = errors.New("CompareAndSwap needs the ONE, QUORUM or ALL level")
+
+// CompareAndSwapRequest is the payload of CompareAndSwap. The value of the
+// key is replaced, or deleted if Delete is set, only if the key holds
+// Expected or, if Absent is set, does not exist.
+type CompareAndSwapRequest struct {
+	Level string
+	Key   string
+
+	Expected string
+	Absent   bool
+
+	Value  string
+	Delete bool
+	TTL    time.Duration
+}
+
+// CompareAndSwapResponse is the payload of the response of CompareAndSwap.
+// Mismatch is set when too many replicas do not hold the expected value for
+// the write to reach its level.
+type CompareAndSwapResponse struct {
+	Mismatch bool
+}
+
+// CompareAndSwap handles the incoming CompareAndSwap request. Each write
+// replica compares and swaps the value atomically, and the write succeeds
+// once as many of them as the consistency level requires swapped it. The
+// replicas which swapped it keep the new value even if the others did not,
+// so that a write failing midway is left on some replicas, until its TTL
+// expires if it has one.
+func (rc *RequestCoordinator) CompareAndSwap(req *CompareAndSwapRequest, resp *CompareAndSwapResponse) (err error) {
+	start := time.Now()
+	defer func() { rc.stats.observe("CompareAndSwap", time.Since(start), err) }()
+
+	if req.Level == ANY || req.Level == LOCAL {
+		return errCASLevel
+	}
+	if err := rc.refuseWrites(); err != nil {
+		return err
+	}
+	defer rc.reads.Invalidate(req.Key)
+
+	requestID := util.NewRequestID()
+	logger.Info("Coordinating external request", util.LogFields{
+		"op":         "CompareAndSwap",
+		"level":      req.Level,
+		"key_hash":   util.KeyHash(req.Key),
+		"request_id": requestID,
+	})
+
+	timestamp, clock, err := rc.stamp(nil)
+	if err != nil {
+		return err
+	}
+
+	replicas := rc.writeReplicas(req.Key)
+	defer rc.filters.invalidate(replicas)
+
+	resCh := rc.sendRPCRequests(replicas, CompareAndSwapOp, &storage.CompareAndSwapRequest{
+		Key: req.Key,
+		Op: storage.CASOp{
+			Expected: req.Expected,
+			Absent:   req.Absent,
+			Value:    req.Value,
+			Delete:   req.Delete,
+			TTL:      req.TTL,
+		},
+		RequestID: requestID,
+		Timestamp: timestamp,
+		Clock:     clock,
+	})
+
+	ackNeed := rc.numOfRequiredACK(req.Level)
+	ackOk := 0
+	mismatches := 0
+
+	for result := range resCh {
+		res, ok := result.(*storage.CompareAndSwapResponse)
+		if !ok {
+			continue
+		}
+
+		if res.Ok {
+			ackOk++
+		} else if res.Mismatch {
+			mismatches++
+		}
+
+		if ackOk >= ackNeed {
+			return nil
+		}
+		if mismatches > len(replicas)-ackNeed {
+			resp.Mismatch = true
+			return nil
+		}
+	}
+
+	logger.Errorf("Cannot reach consistency requirements for CompareAndSwap(%s)", req.Level)
+	return errConsistencyLevel
+}
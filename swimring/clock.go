@@ -0,0 +1,81 @@
+package swimring
+
+import (
+	"strings"
+	"swimring/util"
+	"sync/atomic"
+	"time"
+)
+
+// stamp returns the timestamp and the vector clock of a write coordinated by
+// this node, so that every replica stores the same version. The clock
+// descends from the given context, if any, and its entry for this node is
+// bumped past every counter this node issued before. The counters start from
+// the time the coordinator was created, so that they keep growing across
+// restarts, and two writes coordinated by this node never share a clock.
+// Beyond MaxClockEntries, the least recently updated entries are pruned.
+func (rc *RequestCoordinator) stamp(context *util.VectorClock) (int64, *util.VectorClock, error) {
+	self := rc.sr.node.Address()
+	issued := atomic.AddInt64(&rc.clockCounter, 1)
+
+	clock := util.NewVectorClock()
+	if context != nil {
+		clock.Merge(context)
+	}
+	clock.Merge(&util.VectorClock{Entries: map[string]*util.ClockEntry{
+		self: {NodeID: self, Counter: int(issued - 1)},
+	}})
+
+	_, counter, err := clock.Increment(self)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	if pruned := clock.Prune(rc.sr.config.MaxClockEntries); len(pruned) > 0 {
+		logger.Warningf("Pruned the clock entries of %s beyond MaxClockEntries", strings.Join(pruned, ", "))
+	}
+
+	// A context may carry a greater counter of this node, issued before a
+	// restart with a clock running late.
+	for {
+		current := atomic.LoadInt64(&rc.clockCounter)
+		if int64(counter) <= current || atomic.CompareAndSwapInt64(&rc.clockCounter, current, int64(counter)) {
+			break
+		}
+	}
+
+	return time.Now().UnixNano(), clock, nil
+}
+
+// mergeClocks returns a clock descending from both given clocks, either of
+// which may be nil.
+func mergeClocks(a, b *util.VectorClock) *util.VectorClock {
+	if a == nil {
+		return b
+	}
+	if b == nil {
+		return a
+	}
+
+	merged := util.NewVectorClock()
+	merged.Merge(a)
+	merged.Merge(b)
+	return merged
+}
+
+// descends returns whether a version with the given clock includes the
+// writes of min, which any version does if min is nil.
+func descends(clock, min *util.VectorClock) bool {
+	if min == nil {
+		return true
+	}
+	if clock == nil {
+		return false
+	}
+
+	switch clock.Compare(min) {
+	case "NEWER", "EQUAL":
+		return true
+	}
+	return false
+}
@@ -0,0 +1,52 @@
+package swimring
+
+// LocalDigestsRequest is the payload of LocalDigests.
+type LocalDigestsRequest struct {
+	Buckets int
+}
+
+// LocalDigestsResponse is the payload of the response of LocalDigests. It
+// holds a digest of each bucket of the keys stored on this node.
+type LocalDigestsResponse struct {
+	Digests []uint64
+}
+
+// LocalBucketRequest is the payload of LocalBucket.
+type LocalBucketRequest struct {
+	Bucket  int
+	Buckets int
+}
+
+// LocalBucketResponse is the payload of the response of LocalBucket.
+type LocalBucketResponse struct {
+	Entries map[string]LocalEntry
+}
+
+// LocalEntry is the version of a key stored on this node, without its value.
+type LocalEntry struct {
+	Timestamp int64
+	Deleted   bool
+}
+
+// LocalDigests returns the digests of the keys stored on this node, split
+// into the given number of buckets, with the anti-entropy digests. It lets
+// a client compare two nodes without modifying either.
+func (rc *RequestCoordinator) LocalDigests(req *LocalDigestsRequest, resp *LocalDigestsResponse) error {
+	resp.Digests = rc.sr.kvs.Digests(req.Buckets)
+	return nil
+}
+
+// LocalBucket returns the versions of the keys stored on this node in the
+// given bucket, tombstones included.
+func (rc *RequestCoordinator) LocalBucket(req *LocalBucketRequest, resp *LocalBucketResponse) error {
+	entries := rc.sr.kvs.BucketEntries(req.Bucket, req.Buckets)
+
+	resp.Entries = make(map[string]LocalEntry, len(entries))
+	for key, entry := range entries {
+		resp.Entries[key] = LocalEntry{
+			Timestamp: entry.Timestamp,
+			Deleted:   entry.Exist == 0,
+		}
+	}
+	return nil
+}
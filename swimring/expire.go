@@ -0,0 +1,126 @@
+package swimring
+
+import (
+	"errors"
+	"swimring/storage"
+	"time"
+)
+
+// ExpireRequest is the payload of Expire.
+type ExpireRequest struct {
+	Level string
+	Key   string
+	TTL   time.Duration
+}
+
+// ExpireResponse is the payload of the response of Expire. NotFound is set
+// when none of the replicas which answered holds the key.
+type ExpireResponse struct {
+	NotFound bool
+}
+
+// TTLRequest is the payload of TTL.
+type TTLRequest struct {
+	Level string
+	Key   string
+}
+
+// TTLResponse is the payload of the response of TTL. TTL is
+// storage.NoExpiry if the key does not expire.
+type TTLResponse struct {
+	NotFound bool
+	TTL      time.Duration
+}
+
+// Expire handles the incoming Expire request. The TTL of the key is set on
+// its write replicas without rewriting its value, and a non-positive TTL
+// removes its expiry. Like the deadlines of the writes with a TTL, it is
+// kept in memory by the replicas.
+func (rc *RequestCoordinator) Expire(req *ExpireRequest, resp *ExpireResponse) (err error) {
+	start := time.Now()
+	defer func() { rc.stats.observe("Expire", time.Since(start), err) }()
+
+	if err := rc.refuseWrites(); err != nil {
+		return err
+	}
+	defer rc.reads.Invalidate(req.Key)
+
+	logger.Debugf("Coordinating external request Expire(%s, %v)", req.Level, req.TTL)
+
+	internalReq := &storage.ExpireRequest{
+		Key: req.Key,
+		TTL: req.TTL,
+	}
+	resCh := rc.sendRPCRequests(rc.writeReplicas(req.Key), ExpireOp, internalReq)
+
+	ackNeed := rc.numOfRequiredACK(req.Level)
+	ackReceived := 0
+	ackOk := 0
+	notFound := 0
+
+	for result := range resCh {
+		res, ok := result.(*storage.ExpireResponse)
+		if !ok {
+			continue
+		}
+
+		ackReceived++
+		if res.Ok {
+			ackOk++
+		} else if res.NotFound {
+			notFound++
+		}
+
+		if ackReceived >= ackNeed {
+			if ackOk > 0 {
+				return nil
+			}
+			if notFound == ackReceived {
+				resp.NotFound = true
+				return nil
+			}
+			logger.Debugf("No ACK with Ok received for Expire(%s): %s", req.Level, res.Message)
+			return errors.New(res.Message)
+		}
+	}
+
+	logger.Errorf("Cannot reach consistency requirements for Expire(%s)", req.Level)
+	return errConsistencyLevel
+}
+
+// TTL handles the incoming TTL request. The remaining time to live is the
+// one of the first replica holding the key among those which answered for
+// the consistency level, as each replica counts down its own deadline.
+func (rc *RequestCoordinator) TTL(req *TTLRequest, resp *TTLResponse) (err error) {
+	start := time.Now()
+	defer func() { rc.stats.observe("TTL", time.Since(start), err) }()
+
+	logger.Debugf("Coordinating external request TTL(%s)", req.Level)
+
+	resCh := rc.sendRPCRequests(rc.replicas(req.Key), TTLOp, &storage.TTLRequest{Key: req.Key})
+
+	ackNeed := rc.numOfRequiredACK(req.Level)
+	ackReceived := 0
+	found := false
+
+	for result := range resCh {
+		res, ok := result.(*storage.TTLResponse)
+		if !ok || (!res.Ok && !res.NotFound) {
+			continue
+		}
+
+		ackReceived++
+		if res.Ok && !found {
+			found = true
+			resp.TTL = res.TTL
+		}
+
+		if ackReceived >= ackNeed {
+			resp.NotFound = !found
+			return nil
+		}
+	}
+
+	logger.Errorf("Cannot reach consistency requirements for TTL(%s)", req.Level)
+	return errConsistencyLevel
+}
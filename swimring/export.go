@@ -0,0 +1,70 @@
+package swimring
+
+import (
+	"errors"
+	"path/filepath"
+	"swimring/storage"
+)
+
+// errExportName is returned for an export file name which is not a plain
+// file name, as the file is kept in the working directory of the node.
+var errExportName = errors.New("export file name must not hold a path")
+
+// ExportRequest is the payload of Export.
+type ExportRequest struct {
+	File string
+}
+
+// ExportResponse is the payload of the response of Export.
+type ExportResponse struct{}
+
+// ImportRequest is the payload of Import.
+type ImportRequest struct {
+	File             string
+	ConflictStrategy storage.ConflictStrategy
+}
+
+// ImportResponse is the payload of the response of Import, with the counts
+// of imported, skipped and conflicted entries.
+type ImportResponse struct {
+	Stats storage.ImportStats
+}
+
+// Export writes the local data of this node, tombstones and vector clocks
+// included, to the named file in its working directory, compressed with gzip
+// if the name ends with .gz.
+func (rc *RequestCoordinator) Export(req *ExportRequest, resp *ExportResponse) error {
+	if err := checkExportName(req.File); err != nil {
+		return err
+	}
+
+	logger.Noticef("Exporting local data to %s", req.File)
+	return rc.sr.kvs.ExportFile(req.File)
+}
+
+// Import restores the named export file of the working directory of this
+// node into its local data, resolving the keys it already holds with the
+// conflict strategy of the request. The entries are not forwarded to the
+// other replicas of their keys, which get them through read repair, so it is
+// meant for restoring the backup of the same node. A read-only node refuses
+// it with ErrReadOnly.
+func (rc *RequestCoordinator) Import(req *ImportRequest, resp *ImportResponse) (err error) {
+	if err := checkExportName(req.File); err != nil {
+		return err
+	}
+
+	logger.Noticef("Importing local data from %s", req.File)
+	resp.Stats, err = rc.sr.kvs.ImportFile(req.File, &storage.ImportOptions{
+		ConflictStrategy: req.ConflictStrategy,
+	})
+	rc.filters.invalidate([]string{rc.sr.node.Address()})
+	return err
+}
+
+// checkExportName returns errExportName unless name is a plain file name.
+func checkExportName(name string) error {
+	if name == "" || name != filepath.Base(name) || name == "." || name == ".." {
+		return errExportName
+	}
+	return nil
+}
@@ -0,0 +1,18 @@
+package swimring
+
+import "swimring/membership"
+
+// GossipDebugRequest is the payload of GossipDebug.
+type GossipDebugRequest struct{}
+
+// GossipDebugResponse is the payload of the response of GossipDebug, the raw
+// membership view of this node.
+type GossipDebugResponse membership.GossipDebug
+
+// GossipDebug returns the raw membership view of this node, incarnation
+// numbers, last-heard times and suspect timers included, for debugging the
+// membership protocol.
+func (rc *RequestCoordinator) GossipDebug(req *GossipDebugRequest, resp *GossipDebugResponse) error {
+	*resp = GossipDebugResponse(rc.sr.node.GossipDebug())
+	return nil
+}
@@ -0,0 +1,217 @@
+package swimring
+
+import (
+	"swimring/hashring"
+	"swimring/storage"
+	"sync"
+)
+
+// handoff moves the local keys whose replicas changed with a ring change to
+// the servers which became one of their replicas. old is the ring before the
+// change, and removed lists the servers which left the ring with it.
+//
+// Each key is sent by a single node: an old replica which is no longer one,
+// which then drops the key once every new replica has it, or else the first
+// old replica still on the ring. The transfers go through the migration
+// throttle of local KVS, which reports their progress as the rebalance
+// status, and wait while the node is under load. The key filter is rebuilt
+// once the handed off keys are dropped.
+func (sr *SwimRing) handoff(old *hashring.HashRing, removed []string) {
+	sr.handoffMutex.Lock()
+	defer sr.handoffMutex.Unlock()
+
+	self := sr.node.Address()
+	n := sr.config.KVSReplicaPoints
+
+	gone := make(map[string]bool)
+	for _, server := range removed {
+		gone[server] = true
+	}
+
+	transfers := make(map[string][]string)
+	released := make(map[string]bool)
+	planned := 0
+
+	sr.kvs.Scan("", func(key string, entry *storage.KVEntry) bool {
+		before := old.LookupN(key, n)
+		after := sr.ring.LookupN(key, n)
+
+		var targets []string
+		for _, server := range after {
+			if server != self && !contains(before, server) {
+				targets = append(targets, server)
+			}
+		}
+		if len(targets) == 0 {
+			return true
+		}
+
+		var leaving, staying []string
+		for _, server := range before {
+			switch {
+			case gone[server]:
+			case contains(after, server):
+				staying = append(staying, server)
+			default:
+				leaving = append(leaving, server)
+			}
+		}
+
+		switch {
+		case contains(leaving, self):
+			released[key] = true
+		case len(leaving) == 0 && len(staying) > 0 && staying[0] == self:
+		default:
+			return true
+		}
+
+		for _, target := range targets {
+			transfers[target] = append(transfers[target], key)
+		}
+		planned += len(targets)
+		return true
+	})
+
+	if planned == 0 {
+		return
+	}
+	logger.Noticef("Handing off %d keys to %d nodes", planned, len(transfers))
+
+	throttle := sr.kvs.MigrationThrottle()
+	throttle.Plan(planned)
+	load := sr.kvs.LoadThrottle()
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	failed := make(map[string]bool)
+	sent := make(map[string]int64)
+
+	for target, keys := range transfers {
+		wg.Add(1)
+
+		go func(target string, keys []string) {
+			defer wg.Done()
+
+			done := throttle.Begin()
+			defer done()
+
+			for i, key := range keys {
+				entry, err := sr.kvs.Get(key)
+				if err != nil {
+					throttle.Skip(1)
+					continue
+				}
+
+				load.Wait()
+				throttle.Wait(len(key) + len(entry.Value))
+				err = sr.rc.handoff(target, key, *entry)
+
+				mu.Lock()
+				if ts, ok := sent[key]; err != nil || (ok && ts != entry.Timestamp) {
+					failed[key] = true
+				}
+				sent[key] = entry.Timestamp
+				mu.Unlock()
+
+				if err != nil {
+					logger.Warningf("Cannot hand off keys to %s: %s", target, err.Error())
+
+					mu.Lock()
+					for _, key := range keys[i+1:] {
+						failed[key] = true
+					}
+					mu.Unlock()
+
+					throttle.Skip(len(keys) - i - 1)
+					return
+				}
+			}
+		}(target, keys)
+	}
+
+	wg.Wait()
+
+	dropped := 0
+	for key := range released {
+		if ts, ok := sent[key]; ok && !failed[key] && sr.kvs.Release(key, ts) {
+			dropped++
+		}
+	}
+
+	logger.Noticef("Handoff done: %d keys failed, %d keys dropped", len(failed), dropped)
+	if dropped > 0 {
+		sr.kvs.RebuildKeyFilter()
+	}
+}
+
+func contains(list []string, str string) bool {
+	for _, s := range list {
+		if s == str {
+			return true
+		}
+	}
+	return false
+}
+
+// handBack hands the keys this node held in place of the given owner while
+// it was suspect or read-only back to it, now that it is alive and writable
+// again, and drops those this node does not own, unless another of their
+// owners is still suspect or read-only.
+func (sr *SwimRing) handBack(owner string) {
+	sr.handoffMutex.Lock()
+	defer sr.handoffMutex.Unlock()
+
+	self := sr.node.Address()
+	n := sr.config.KVSReplicaPoints
+
+	var keys []string
+	sr.kvs.Scan("", func(key string, entry *storage.KVEntry) bool {
+		owners := sr.ring.LookupN(key, n)
+		if contains(owners, owner) && !contains(owners, self) {
+			keys = append(keys, key)
+		}
+		return true
+	})
+
+	if len(keys) == 0 {
+		return
+	}
+	logger.Noticef("Handing back %d keys to %s", len(keys), owner)
+
+	throttle := sr.kvs.MigrationThrottle()
+	throttle.Plan(len(keys))
+	load := sr.kvs.LoadThrottle()
+
+	done := throttle.Begin()
+	defer done()
+
+	dropped := 0
+	for i, key := range keys {
+		entry, err := sr.kvs.Get(key)
+		if err != nil {
+			throttle.Skip(1)
+			continue
+		}
+
+		load.Wait()
+		throttle.Wait(len(key) + len(entry.Value))
+		if err := sr.rc.handoff(owner, key, *entry); err != nil {
+			logger.Warningf("Cannot hand back keys to %s: %s", owner, err.Error())
+			throttle.Skip(len(keys) - i - 1)
+			break
+		}
+
+		skipped := false
+		for _, server := range sr.ring.LookupN(key, n) {
+			skipped = skipped || sr.node.MemberSuspect(server) || sr.memberReadOnly(server)
+		}
+		if !skipped && sr.kvs.Release(key, entry.Timestamp) {
+			dropped++
+		}
+	}
+
+	logger.Noticef("Hand back to %s done: %d keys dropped", owner, dropped)
+	if dropped > 0 {
+		sr.kvs.RebuildKeyFilter()
+	}
+}
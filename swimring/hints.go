@@ -0,0 +1,132 @@
+package swimring
+
+import (
+	"errors"
+	"sort"
+	"swimring/storage"
+	"sync"
+	"time"
+)
+
+// hintRetryInterval is how often the coordinator tries again to deliver the
+// hints of the replicas which are reachable.
+const hintRetryInterval = 10 * time.Second
+
+// hint is a write a replica did not get, kept by the coordinator to hand it
+// off to the replica once it is back. req is the internal request of op,
+// which carries the timestamp, clock and nonce of the write, so that a hint
+// delivered late or twice does not override a newer write.
+type hint struct {
+	op  string
+	req interface{}
+}
+
+// hints holds the hints of the replicas, kept in memory only: the hints of
+// a coordinator which crashes are lost.
+type hints struct {
+	sync.Mutex
+	byServer map[string][]hint
+}
+
+func newHints() *hints {
+	return &hints{
+		byServer: make(map[string][]hint),
+	}
+}
+
+func (h *hints) add(server, op string, req interface{}) {
+	h.Lock()
+	h.byServer[server] = append(h.byServer[server], hint{op: op, req: req})
+	h.Unlock()
+}
+
+// take removes and returns the hints of the given server.
+func (h *hints) take(server string) []hint {
+	h.Lock()
+	pending := h.byServer[server]
+	delete(h.byServer, server)
+	h.Unlock()
+
+	return pending
+}
+
+// servers returns the servers which have hints, sorted.
+func (h *hints) servers() []string {
+	h.Lock()
+	servers := make([]string, 0, len(h.byServer))
+	for server := range h.byServer {
+		servers = append(servers, server)
+	}
+	h.Unlock()
+
+	sort.Strings(servers)
+	return servers
+}
+
+func (h *hints) pending(server string) bool {
+	h.Lock()
+	n := len(h.byServer[server])
+	h.Unlock()
+
+	return n > 0
+}
+
+// deliverHints sends the hints of the given replica to it, and keeps those
+// it could not deliver for a later attempt.
+func (rc *RequestCoordinator) deliverHints(server string) {
+	pending := rc.hints.take(server)
+	if len(pending) == 0 {
+		return
+	}
+
+	for i, h := range pending {
+		if err := rc.deliverHint(server, h); err != nil {
+			logger.Debugf("Cannot deliver %d hints to %s: %s", len(pending)-i, server, err.Error())
+			for _, left := range pending[i:] {
+				rc.hints.add(server, left.op, left.req)
+			}
+			return
+		}
+	}
+
+	logger.Infof("Delivered %d hints to %s", len(pending), server)
+}
+
+func (rc *RequestCoordinator) deliverHint(server string, h hint) error {
+	res, err := rc.sendRPCRequest(server, h.op, h.req)
+	if err != nil {
+		return err
+	}
+
+	switch res := res.(type) {
+	case *storage.PutResponse:
+		if !res.Ok {
+			return errors.New(res.Message)
+		}
+	case *storage.DeleteResponse:
+		if !res.Ok {
+			return errors.New(res.Message)
+		}
+	}
+	return nil
+}
+
+// deliverAllHints delivers the hints of every replica, such as before the
+// node leaves the ring.
+func (rc *RequestCoordinator) deliverAllHints() {
+	for _, server := range rc.hints.servers() {
+		rc.deliverHints(server)
+	}
+}
+
+// retryHints periodically delivers the hints of the reachable replicas, for
+// the writes they missed without being seen down, such as on a timeout.
+func (rc *RequestCoordinator) retryHints() {
+	for range time.Tick(hintRetryInterval) {
+		for _, server := range rc.hints.servers() {
+			if rc.sr.node.MemberReachable(server) {
+				rc.deliverHints(server)
+			}
+		}
+	}
+}
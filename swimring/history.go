@@ -0,0 +1,106 @@
+package swimring
+
+import (
+	"sort"
+	"swimring/storage"
+	"swimring/util"
+	"time"
+)
+
+// GetHistoryRequest is the payload of GetHistory.
+type GetHistoryRequest struct {
+	Level string
+	Key   string
+}
+
+// GetHistoryResponse is the payload of the response of GetHistory.
+type GetHistoryResponse struct {
+	Key      string
+	Versions []VersionedValue
+}
+
+// VersionedValue is a past or current version of a key. Deleted marks a
+// tombstone, whose Value is empty.
+type VersionedValue struct {
+	Value     []byte
+	Clock     *util.VectorClock
+	Timestamp time.Time
+	Deleted   bool
+}
+
+// GetHistory handles the incoming GetHistory request. The versions kept by
+// the replicas which answered for the consistency level are merged, newest
+// first, tombstones included, and bounded by the longest history a replica
+// returned.
+func (rc *RequestCoordinator) GetHistory(req *GetHistoryRequest, resp *GetHistoryResponse) (err error) {
+	start := time.Now()
+	defer func() { rc.stats.observe("GetHistory", time.Since(start), err) }()
+
+	logger.Debugf("Coordinating external request GetHistory(%s)", req.Level)
+
+	ackNeed := rc.numOfRequiredACK(req.Level)
+	versions, replies, found := rc.readHistory(req.Key, rc.replicas(req.Key), ackNeed)
+	if replies < ackNeed {
+		logger.Errorf("Cannot reach consistency requirements for GetHistory(%s)", req.Level)
+		return errConsistencyLevel
+	}
+	if !found {
+		return storage.ErrKeyNotFound
+	}
+
+	resp.Key = req.Key
+	resp.Versions = make([]VersionedValue, len(versions))
+	for i, version := range versions {
+		resp.Versions[i] = VersionedValue{
+			Value:     []byte(version.Value),
+			Clock:     version.Clock,
+			Timestamp: time.Unix(0, version.Timestamp),
+			Deleted:   version.Exist == 0,
+		}
+	}
+	return nil
+}
+
+// readHistory reads the versions of the given key kept by the given
+// replicas, until need of them answered, or all of them did or timed out.
+// It returns the versions merged newest first, each once, the number of
+// replicas which answered, and whether any of them held the key.
+func (rc *RequestCoordinator) readHistory(key string, replicas []string, need int) (versions []storage.KVEntry, replies int, found bool) {
+	resCh := rc.sendRPCRequests(replicas, GetHistoryOp, &storage.GetHistoryRequest{Key: key})
+
+	seen := make(map[int64]bool)
+	limit := 0
+	for result := range resCh {
+		res, ok := result.(*storage.GetHistoryResponse)
+		if !ok {
+			continue
+		}
+
+		replies++
+		if res.Ok {
+			found = true
+			if len(res.Versions) > limit {
+				limit = len(res.Versions)
+			}
+			for _, version := range res.Versions {
+				if !seen[version.Timestamp] {
+					seen[version.Timestamp] = true
+					versions = append(versions, version)
+				}
+			}
+		}
+
+		if replies >= need {
+			break
+		}
+	}
+
+	sort.Slice(versions, func(i, j int) bool {
+		return versions[i].Timestamp > versions[j].Timestamp
+	})
+	if len(versions) > limit {
+		versions = versions[:limit]
+	}
+
+	return versions, replies, found
+}
@@ -0,0 +1,97 @@
+package swimring
+
+import (
+	"sort"
+	"swimring/storage"
+	"time"
+)
+
+// PutIndexedRequest is the payload of PutIndexed.
+type PutIndexedRequest struct {
+	Level      string
+	Key        string
+	Value      string
+	IndexField string
+
+	IdempotencyKey string
+}
+
+// QueryIndexRequest is the payload of QueryIndex.
+type QueryIndexRequest struct {
+	Level string
+	Field string
+	Value string
+}
+
+// QueryIndexResponse is the payload of the response of QueryIndex.
+type QueryIndexResponse struct {
+	Keys []string
+}
+
+// PutIndexed handles the incoming PutIndexed request, which writes the key as
+// Put does and has every replica index it on a field of the value, which
+// must be a JSON object holding it.
+func (rc *RequestCoordinator) PutIndexed(req *PutIndexedRequest, resp *PutResponse) error {
+	if err := storage.CheckIndexable(req.Value, req.IndexField); err != nil {
+		return err
+	}
+
+	return rc.Put(&PutRequest{
+		Level:      req.Level,
+		Key:        req.Key,
+		Value:      req.Value,
+		IndexField: req.IndexField,
+
+		IdempotencyKey: req.IdempotencyKey,
+	}, resp)
+}
+
+// QueryIndex handles the incoming QueryIndex request. Every server looks the
+// field value up in its own index, which holds the keys of its replicas,
+// and the keys any of them returned are merged in ascending order. A replica
+// which missed the last write of a key may still return it for its former
+// value. The query fails unless enough servers answered for every key to be
+// looked up on as many replicas as the consistency level requires.
+func (rc *RequestCoordinator) QueryIndex(req *QueryIndexRequest, resp *QueryIndexResponse) (err error) {
+	start := time.Now()
+	defer func() { rc.stats.observe("QueryIndex", time.Since(start), err) }()
+
+	logger.Debugf("Coordinating external request QueryIndex(%s)", req.Level)
+
+	n := rc.sr.config.KVSReplicaPoints
+	servers := rc.sr.ring.PrefixServers("", n)
+	resCh := rc.sendRPCRequests(servers, QueryIndexOp, &storage.QueryIndexRequest{
+		Field: req.Field,
+		Value: req.Value,
+	})
+
+	failed := 0
+	found := make(map[string]struct{})
+
+	for result := range resCh {
+		res, ok := result.(*storage.QueryIndexResponse)
+		if !ok || !res.Ok {
+			failed++
+			continue
+		}
+
+		for _, key := range res.Keys {
+			found[key] = struct{}{}
+		}
+	}
+
+	if n > len(servers) {
+		n = len(servers)
+	}
+	if failed > n-rc.numOfRequiredACK(req.Level) {
+		logger.Errorf("Cannot reach consistency requirements for QueryIndex(%s)", req.Level)
+		return errConsistencyLevel
+	}
+
+	resp.Keys = make([]string, 0, len(found))
+	for key := range found {
+		resp.Keys = append(resp.Keys, key)
+	}
+	sort.Strings(resp.Keys)
+	return nil
+}
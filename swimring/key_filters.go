@@ -0,0 +1,151 @@
+package swimring
+
+import (
+	"errors"
+	"swimring/storage"
+	"sync"
+	"time"
+)
+
+// keyFilters holds the snapshots of the key filters of the replicas, so that
+// the coordinator answers a read of a key none of its replicas may hold
+// without sending it to them. A snapshot is used until it is older than the
+// refresh interval, and then fetched again in the background, meanwhile the
+// replica may hold any key. The writes coordinated locally drop the
+// snapshots of their replicas, which misses only the keys written through
+// other coordinators, for at most the refresh interval.
+type keyFilters struct {
+	interval time.Duration
+	fetch    func(server string) (storage.KeyFilterSnapshot, error)
+
+	mu       sync.Mutex
+	byServer map[string]*cachedKeyFilter
+}
+
+type cachedKeyFilter struct {
+	filter  storage.KeyFilterSnapshot
+	fetched time.Time
+	// generation is bumped whenever the snapshot is dropped, so that a fetch
+	// started before is not kept.
+	generation int64
+	fetching   bool
+}
+
+// newKeyFilters returns the key filters of the replicas, fetched with the
+// given function and refreshed every interval. A zero interval disables
+// them.
+func newKeyFilters(interval time.Duration, fetch func(server string) (storage.KeyFilterSnapshot, error)) *keyFilters {
+	return &keyFilters{
+		interval: interval,
+		fetch:    fetch,
+		byServer: make(map[string]*cachedKeyFilter),
+	}
+}
+
+// absent returns whether none of the given servers may hold the given key,
+// as told by their snapshots. A server whose snapshot is missing or too old
+// may hold any key, and its snapshot is fetched in the background.
+func (f *keyFilters) absent(servers []string, key string) bool {
+	if f.interval <= 0 || len(servers) == 0 {
+		return false
+	}
+
+	now := time.Now()
+	absent := true
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for _, server := range servers {
+		cached, ok := f.byServer[server]
+		if !ok {
+			cached = &cachedKeyFilter{}
+			f.byServer[server] = cached
+		}
+
+		if now.Sub(cached.fetched) >= f.interval {
+			f.refreshNoLock(server, cached)
+			absent = false
+			continue
+		}
+		if cached.filter.MayContain(key) {
+			absent = false
+		}
+	}
+
+	return absent
+}
+
+// invalidate drops the snapshots of the given servers, such as the replicas
+// of a key being written.
+func (f *keyFilters) invalidate(servers []string) {
+	if f.interval <= 0 {
+		return
+	}
+
+	f.mu.Lock()
+	for _, server := range servers {
+		if cached, ok := f.byServer[server]; ok {
+			cached.fetched = time.Time{}
+			cached.generation++
+		}
+	}
+	f.mu.Unlock()
+}
+
+// invalidateAll drops every snapshot, such as when the ring changed and keys
+// move to other replicas.
+func (f *keyFilters) invalidateAll() {
+	if f.interval <= 0 {
+		return
+	}
+
+	f.mu.Lock()
+	for _, cached := range f.byServer {
+		cached.fetched = time.Time{}
+		cached.generation++
+	}
+	f.mu.Unlock()
+}
+
+// refreshNoLock fetches the snapshot of the given server in the background,
+// unless a fetch is already in progress. The snapshot is dated from the
+// start of the fetch, which it may be as old as. The caller must hold the
+// lock.
+func (f *keyFilters) refreshNoLock(server string, cached *cachedKeyFilter) {
+	if cached.fetching {
+		return
+	}
+	cached.fetching = true
+	generation := cached.generation
+	started := time.Now()
+
+	go func() {
+		filter, err := f.fetch(server)
+		if err != nil {
+			logger.Debugf("Cannot fetch the key filter of %s: %s", server, err.Error())
+		}
+
+		f.mu.Lock()
+		cached.fetching = false
+		if err == nil && cached.generation == generation {
+			cached.filter = filter
+			cached.fetched = started
+		}
+		f.mu.Unlock()
+	}()
+}
+
+// fetchKeyFilter returns a snapshot of the key filter of the given server.
+func (rc *RequestCoordinator) fetchKeyFilter(server string) (storage.KeyFilterSnapshot, error) {
+	res, err := rc.sendRPCRequest(server, KeyFilterOp, &storage.KeyFilterRequest{})
+	if err != nil {
+		return storage.KeyFilterSnapshot{}, err
+	}
+
+	resp := res.(*storage.KeyFilterResponse)
+	if !resp.Ok {
+		return storage.KeyFilterSnapshot{}, errors.New("key filter unavailable")
+	}
+	return resp.Filter, nil
+}
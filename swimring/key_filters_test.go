@@ -0,0 +1,136 @@
+package swimring
+
+import (
+	"errors"
+	"os"
+	"swimring/storage"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeKeyFilters serves snapshots holding the given keys, per server.
+type fakeKeyFilters struct {
+	mu      sync.Mutex
+	keys    map[string][]string
+	fetches int
+}
+
+func (f *fakeKeyFilters) fetch(server string) (storage.KeyFilterSnapshot, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.fetches++
+	keys, ok := f.keys[server]
+	if !ok {
+		return storage.KeyFilterSnapshot{}, errors.New("not reachable")
+	}
+
+	kvs, err := storage.NewKVStore(server, &storage.Options{KeyFilterFalsePositiveRate: 0.01})
+	if err != nil {
+		return storage.KeyFilterSnapshot{}, err
+	}
+	defer kvs.Close()
+
+	for _, key := range keys {
+		kvs.Put(key, "value")
+	}
+	return kvs.KeyFilter(), nil
+}
+
+func chdirTemp(t *testing.T) {
+	wd, _ := os.Getwd()
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+}
+
+// waitFetched waits until no fetch of the given filters is in progress.
+func waitFetched(t *testing.T, filters *keyFilters) {
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		filters.mu.Lock()
+		fetching := false
+		for _, cached := range filters.byServer {
+			fetching = fetching || cached.fetching
+		}
+		filters.mu.Unlock()
+
+		if !fetching {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatal("key filters never fetched")
+}
+
+func TestKeyFiltersAbsent(t *testing.T) {
+	chdirTemp(t)
+
+	fake := &fakeKeyFilters{keys: map[string][]string{
+		"a": {"k1"},
+		"b": {"k2"},
+	}}
+	filters := newKeyFilters(time.Minute, fake.fetch)
+	replicas := []string{"a", "b"}
+	// The fetches write the commit logs of their stores to the temporary
+	// directory, so they must be done before the test leaves it.
+	t.Cleanup(func() { waitFetched(t, filters) })
+
+	// Without snapshots, the replicas may hold any key.
+	if filters.absent(replicas, "missing") {
+		t.Error("key absent before the snapshots were fetched")
+	}
+	waitFetched(t, filters)
+
+	if !filters.absent(replicas, "missing") {
+		t.Error("missing key not absent")
+	}
+	if filters.absent(replicas, "k1") || filters.absent(replicas, "k2") {
+		t.Error("key held by a replica absent")
+	}
+	if fake.fetches != 2 {
+		t.Errorf("%d fetches, want 2", fake.fetches)
+	}
+
+	// A write drops the snapshots of its replicas until they are fetched
+	// again.
+	fake.keys["a"] = append(fake.keys["a"], "k3")
+	filters.invalidate([]string{"a"})
+	if filters.absent(replicas, "k3") {
+		t.Error("written key absent")
+	}
+	waitFetched(t, filters)
+	if filters.absent(replicas, "k3") || !filters.absent(replicas, "missing") {
+		t.Error("snapshot not refreshed after the write")
+	}
+
+	// An unreachable replica may hold any key.
+	if filters.absent([]string{"a", "c"}, "missing") {
+		t.Error("key absent from an unreachable replica")
+	}
+	waitFetched(t, filters)
+	if filters.absent([]string{"a", "c"}, "missing") {
+		t.Error("key absent from an unreachable replica")
+	}
+
+	filters.invalidateAll()
+	if filters.absent(replicas, "missing") {
+		t.Error("key absent after the ring changed")
+	}
+}
+
+func TestKeyFiltersDisabled(t *testing.T) {
+	fake := &fakeKeyFilters{keys: map[string][]string{"a": nil}}
+	filters := newKeyFilters(0, fake.fetch)
+
+	for i := 0; i < 2; i++ {
+		if filters.absent([]string{"a"}, "missing") {
+			t.Error("key absent with disabled key filters")
+		}
+	}
+	if fake.fetches != 0 {
+		t.Errorf("%d fetches, want none", fake.fetches)
+	}
+}
@@ -0,0 +1,64 @@
+package swimring
+
+import (
+	"errors"
+	"swimring/storage"
+	"swimring/util"
+)
+
+// errLocalAckDisabled is returned for the writes at level LOCAL unless the
+// cluster enables AllowLocalAck.
+var errLocalAckDisabled = errors.New("LOCAL writes are not allowed, AllowLocalAck is disabled")
+
+// writeLocal applies a write at level LOCAL: it is written to this node when
+// it is one of the given replicas, and handed to the other ones in the
+// background through hints, which are kept for those which cannot be
+// reached. It returns the clock stored locally, or the one of the write if
+// this node is not a replica, and the write is then only held by the hints
+// when it is acknowledged. An acknowledged write is lost if this node fails
+// before the hints are delivered.
+func (rc *RequestCoordinator) writeLocal(replicas []string, op string, req interface{}) (*util.VectorClock, error) {
+	if !rc.sr.config.AllowLocalAck {
+		return nil, errLocalAckDisabled
+	}
+	if len(replicas) == 0 {
+		return nil, errConsistencyLevel
+	}
+
+	self := rc.sr.node.Address()
+	var clock *util.VectorClock
+
+	switch req := req.(type) {
+	case *storage.PutRequest:
+		clock = req.Clock
+	case *storage.DeleteRequest:
+		clock = req.Clock
+	}
+
+	for _, server := range replicas {
+		if server != self {
+			rc.hints.add(server, op, req)
+			go rc.deliverHints(server)
+			continue
+		}
+
+		res, err := rc.sendRPCRequest(self, op, req)
+		if err != nil {
+			return nil, err
+		}
+		switch res := res.(type) {
+		case *storage.PutResponse:
+			if !res.Ok {
+				return nil, errors.New(res.Message)
+			}
+			clock = res.Clock
+		case *storage.DeleteResponse:
+			if !res.Ok {
+				return nil, errors.New(res.Message)
+			}
+			clock = res.Clock
+		}
+	}
+
+	return clock, nil
+}
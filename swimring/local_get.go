@@ -0,0 +1,37 @@
+package swimring
+
+import (
+	"swimring/storage"
+	"swimring/util"
+)
+
+// LocalGetRequest is the payload of LocalGet.
+type LocalGetRequest struct {
+	Key string
+}
+
+// LocalGetResponse is the payload of the response of LocalGet. Found is
+// false when this node holds no live version of the key.
+type LocalGetResponse struct {
+	Found bool
+	Value []byte
+	Clock *util.VectorClock
+}
+
+// LocalGet returns the version of the key stored on this node, without
+// coordinating the read: no other replica is contacted and no read repair
+// is triggered, which reveals exactly what this replica holds.
+func (rc *RequestCoordinator) LocalGet(req *LocalGetRequest, resp *LocalGetResponse) error {
+	entry, err := rc.sr.kvs.Get(req.Key)
+	if err == storage.ErrKeyNotFound {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	resp.Found = true
+	resp.Value = []byte(entry.Value)
+	resp.Clock = entry.Clock
+	return nil
+}
@@ -0,0 +1,21 @@
+package swimring
+
+import "swimring/storage"
+
+// MetricsRequest is the payload of Metrics.
+type MetricsRequest struct{}
+
+// MetricsResponse is the payload of the response of Metrics, the local KVS
+// metrics of this node.
+type MetricsResponse struct {
+	Address string
+	Metrics storage.MetricsSnapshot
+}
+
+// Metrics returns the local KVS metrics of this node, request queue depth
+// and processing latencies included.
+func (rc *RequestCoordinator) Metrics(req *MetricsRequest, resp *MetricsResponse) error {
+	resp.Address = rc.sr.node.Address()
+	resp.Metrics = rc.sr.kvs.Metrics()
+	return nil
+}
@@ -0,0 +1,46 @@
+package swimring
+
+import (
+	"errors"
+	"swimring/storage"
+)
+
+// OwnedKeysRequest is the payload of OwnedKeys.
+type OwnedKeysRequest struct {
+	Cursor string
+	Limit  int
+}
+
+// OwnedKeysResponse is the payload of the response of OwnedKeys. Next is
+// empty when the listing is complete.
+type OwnedKeysResponse struct {
+	Keys []string
+	Next string
+}
+
+// OwnedKeys returns a page of the local keys this node is the primary owner
+// of on the ring, that is the keys it coordinates, in key order after the
+// cursor. The cursor is the one of ScanPage.
+func (rc *RequestCoordinator) OwnedKeys(req *OwnedKeysRequest, resp *OwnedKeysResponse) error {
+	if req.Limit <= 0 {
+		return errors.New("invalid limit")
+	}
+	cursor, err := storage.ParseScanCursor(req.Cursor)
+	if err != nil {
+		return errors.New("invalid cursor")
+	}
+
+	self := rc.sr.node.Address()
+	owns := func(key string) bool {
+		owner, ok := rc.sr.ring.Lookup(key)
+		return ok && owner == self
+	}
+
+	keys, more := rc.sr.kvs.OwnedKeys(owns, cursor.Key, req.Limit)
+
+	resp.Keys = keys
+	if more && len(keys) > 0 {
+		resp.Next = storage.ScanCursor{Key: keys[len(keys)-1]}.String()
+	}
+	return nil
+}
@@ -0,0 +1,30 @@
+package swimring
+
+// SplitBrainCheckRequest is the payload of SplitBrainCheck.
+type SplitBrainCheckRequest struct{}
+
+// SplitBrainCheckResponse is the payload of the response of SplitBrainCheck,
+// the view of this node on whether it is in a minority partition. Alive
+// counts the alive members, this node included, and Known the members of
+// the cluster, those which left on purpose excluded.
+type SplitBrainCheckResponse struct {
+	Address     string
+	Alive       int
+	Known       int
+	Minority    bool
+	Unreachable []string
+}
+
+// SplitBrainCheck returns whether this node suspects it is in a minority
+// partition, in which case the writes it accepts may not reach the majority
+// side.
+func (rc *RequestCoordinator) SplitBrainCheck(req *SplitBrainCheckRequest, resp *SplitBrainCheckResponse) error {
+	status := rc.sr.node.PartitionStatus()
+
+	resp.Address = rc.sr.node.Address()
+	resp.Alive = status.Alive
+	resp.Known = status.Known
+	resp.Minority = status.Minority
+	resp.Unreachable = status.Unreachable
+	return nil
+}
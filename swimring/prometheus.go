@@ -0,0 +1,87 @@
+package swimring
+
+import (
+	"fmt"
+	"sort"
+	"swimring/util"
+	"sync"
+	"time"
+)
+
+// coordinatorStats counts the external requests coordinated by the node,
+// with their latency and how many could not reach their consistency level,
+// by operation.
+type coordinatorStats struct {
+	sync.Mutex
+	latencies      map[string]*util.LatencyHistogram
+	quorumFailures map[string]int64
+}
+
+func newCoordinatorStats() *coordinatorStats {
+	return &coordinatorStats{
+		latencies:      make(map[string]*util.LatencyHistogram),
+		quorumFailures: make(map[string]int64),
+	}
+}
+
+func (s *coordinatorStats) observe(op string, latency time.Duration, err error) {
+	s.Lock()
+	h, ok := s.latencies[op]
+	if !ok {
+		h = util.NewLatencyHistogram()
+		s.latencies[op] = h
+	}
+	if err == errConsistencyLevel {
+		s.quorumFailures[op]++
+	}
+	s.Unlock()
+
+	h.Observe(latency)
+}
+
+// WritePrometheus writes the metrics of the coordinator in the Prometheus
+// text format.
+func (rc *RequestCoordinator) WritePrometheus(p *util.PrometheusWriter) {
+	s := rc.stats
+	s.Lock()
+	defer s.Unlock()
+
+	ops := make([]string, 0, len(s.latencies))
+	for op := range s.latencies {
+		ops = append(ops, op)
+	}
+	sort.Strings(ops)
+
+	p.Family("swimring_coordinator_request_duration_seconds", "histogram", "Latency of the external requests by operation.")
+	for _, op := range ops {
+		p.Histogram("swimring_coordinator_request_duration_seconds", s.latencies[op], "op", op)
+	}
+
+	p.Family("swimring_coordinator_quorum_failures_total", "counter", "External requests which could not reach their consistency level, by operation.")
+	for _, op := range ops {
+		p.Sample("swimring_coordinator_quorum_failures_total", float64(s.quorumFailures[op]), "op", op)
+	}
+
+	cache := rc.reads.Stats()
+	p.Family("swimring_coordinator_read_cache_entries", "gauge", "Read responses held by the read cache.")
+	p.Sample("swimring_coordinator_read_cache_entries", float64(cache.Entries))
+	p.Family("swimring_coordinator_read_cache_lookups_total", "counter", "Read cache lookups by result.")
+	p.Sample("swimring_coordinator_read_cache_lookups_total", float64(cache.Hits), "result", "hit")
+	p.Sample("swimring_coordinator_read_cache_lookups_total", float64(cache.Misses), "result", "miss")
+}
+
+// serveMetrics serves the metrics of the coordinator, local KVS, the SWIM
+// node and remote replication at /metrics on MetricsPort of the bind
+// address, in the Prometheus text format.
+func (sr *SwimRing) serveMetrics() {
+	address := fmt.Sprintf("%s:%d", sr.config.BindAddress, sr.config.MetricsPort)
+	logger.Noticef("Metrics server listening at port %d...", sr.config.MetricsPort)
+
+	err := util.ServeMetrics(address, func(p *util.PrometheusWriter) {
+		sr.rc.WritePrometheus(p)
+		sr.kvs.WritePrometheus(p)
+		sr.node.WritePrometheus(p)
+		sr.replicator.WritePrometheus(p)
+	})
+	logger.Errorf("Cannot serve metrics: %s", err.Error())
+}
@@ -0,0 +1,95 @@
+package swimring
+
+import (
+	"swimring/hashring"
+	"swimring/membership"
+	"swimring/storage"
+)
+
+// ReadOnlyTag is the member tag a node in read-only mode sets, so that the
+// coordinators skip it as a write replica.
+const ReadOnlyTag = "readonly"
+
+// SetReadOnlyRequest is the payload of SetReadOnly.
+type SetReadOnlyRequest struct {
+	ReadOnly bool
+}
+
+// SetReadOnlyResponse is the payload of the response of SetReadOnly.
+type SetReadOnlyResponse struct {
+	ReadOnly bool
+}
+
+// SetReadOnly switches the read-only mode of this node. A read-only node
+// keeps serving reads, refuses to coordinate writes, and is skipped as a
+// write replica by every coordinator once its tag is gossiped, the next live
+// node on the ring holding its writes meanwhile.
+func (rc *RequestCoordinator) SetReadOnly(req *SetReadOnlyRequest, resp *SetReadOnlyResponse) error {
+	rc.sr.kvs.SetReadOnly(req.ReadOnly)
+
+	value := ""
+	if req.ReadOnly {
+		value = "true"
+	}
+	rc.sr.node.SetTag(ReadOnlyTag, value)
+
+	resp.ReadOnly = req.ReadOnly
+	return nil
+}
+
+// memberReadOnly returns whether the member at the given address announces
+// the read-only mode.
+func (sr *SwimRing) memberReadOnly(server string) bool {
+	tags, _ := sr.node.MemberTags(server)
+	return tags[ReadOnlyTag] != ""
+}
+
+// skipWrites returns whether the writes skip the given replica, as it is
+// read-only, or suspect when suspect replicas are skipped.
+func (sr *SwimRing) skipWrites(server string) bool {
+	if sr.memberReadOnly(server) {
+		return true
+	}
+	return sr.config.SkipSuspectReplicas && sr.node.MemberSuspect(server)
+}
+
+// writeReplicas returns the replicas the writes of the given key go to,
+// skipping the read-only ones for the next nodes on the ring.
+func (rc *RequestCoordinator) writeReplicas(key string) []string {
+	n := rc.sr.config.KVSReplicaPoints
+
+	replicas, skipped := hashring.LookupNHealthy(rc.sr.ring, key, n, rc.sr.skipWrites)
+	if len(skipped) > 0 {
+		logger.Debugf("Skipping replicas of %s for writes: %v", key, skipped)
+	}
+	return replicas
+}
+
+// refuseWrites returns ErrReadOnly while this node is read-only.
+func (rc *RequestCoordinator) refuseWrites() error {
+	if rc.sr.kvs.ReadOnly() {
+		return storage.ErrReadOnly
+	}
+	return nil
+}
+
+// handleReadOnly follows the read-only mode the members announce, and hands
+// the keys written while a member was read-only back to it once it announces
+// being writable again.
+func (sr *SwimRing) handleReadOnly(change membership.Change) {
+	if change.Tags == nil || change.Address == sr.node.Address() {
+		return
+	}
+
+	readOnly := change.Tags[ReadOnlyTag] != ""
+	if sr.readOnly[change.Address] == readOnly {
+		return
+	}
+
+	if readOnly {
+		sr.readOnly[change.Address] = true
+		return
+	}
+	delete(sr.readOnly, change.Address)
+	go sr.handBack(change.Address)
+}
@@ -0,0 +1,1178 @@
+package swimring
+
+import (
+	"errors"
+	"math"
+	"net/rpc"
+	"swimring/hashring"
+	"swimring/membership"
+	"swimring/replication"
+	"swimring/storage"
+	"swimring/util"
+	"sync"
+	"time"
+)
+
+const (
+	// ONE is the weakest consistency level.
+	// For read request, returns value when the first response arrived.
+	// For write request, returns when the first ACK received.
+	ONE = "ONE"
+	// QUORUM is the moderate consistency level.
+	// For read request, returns value when the quorum set of replicas all responded.
+	// For write request, returns when the quorum set of replicas all responded ACKs.
+	QUORUM = "QUORUM"
+	// ALL is the strongest consistency level.
+	// For read request, returns value when all replicas responded.
+	// For write request, returns when all replicas all responded ACKs.
+	ALL = "ALL"
+	// ANY is a write-only level weaker than ONE.
+	// Returns when the first ACK received or, if no replica answered, once
+	// a hint is stored for each of them.
+	ANY = "ANY"
+	// LOCAL is a write-only level which is not durable, allowed only with
+	// AllowLocalAck. Returns once the coordinator wrote locally, before the
+	// write is replicated in the background.
+	LOCAL = "LOCAL"
+	// GetOp is the name of the service method for Get.
+	GetOp = "KVS.Get"
+	// PutOp is the name of the service method for Put.
+	PutOp = "KVS.Put"
+	// DeleteOp is the name of the service method for Delete.
+	DeleteOp = "KVS.Delete"
+	// StatOp is the name of the service method for Stat.
+	StatOp = "KVS.Stat"
+	// HandoffOp is the name of the service method for Handoff.
+	HandoffOp = "KVS.Handoff"
+	// GetMultiOp is the name of the service method for GetMulti.
+	GetMultiOp = "KVS.GetMulti"
+	// KeyFilterOp is the name of the service method for KeyFilter.
+	KeyFilterOp = "KVS.KeyFilter"
+	// ScanPageOp is the name of the service method for ScanPage.
+	ScanPageOp = "KVS.ScanPage"
+	// GetHistoryOp is the name of the service method for GetHistory.
+	GetHistoryOp = "KVS.GetHistory"
+	// ExpireOp is the name of the service method for Expire.
+	ExpireOp = "KVS.Expire"
+	// TTLOp is the name of the service method for TTL.
+	TTLOp = "KVS.TTL"
+	// QueryIndexOp is the name of the service method for QueryIndex.
+	QueryIndexOp = "KVS.QueryIndex"
+	// PutBatchOp is the name of the service method for PutBatch.
+	PutBatchOp = "KVS.PutBatch"
+	// CompareAndSwapOp is the name of the service method for
+	// CompareAndSwap.
+	CompareAndSwapOp = "KVS.CompareAndSwap"
+	// PartitionStatusOp is the name of the service method for the partition
+	// status of a member.
+	PartitionStatusOp = "Protocol.PartitionStatus"
+)
+
+const (
+	// rpcTimeout is how long the coordinator waits for a replica to answer.
+	rpcTimeout = 1500 * time.Millisecond
+	// readRepairKeys is the number of keys whose last read repair is
+	// remembered to throttle the next one.
+	readRepairKeys = 10000
+	// idempotencyWindow is how long the result of a write is returned to
+	// its retries, and idempotencyKeys the number of writes remembered.
+	idempotencyWindow = 5 * time.Minute
+	idempotencyKeys   = 100000
+)
+
+// errConsistencyLevel is returned when too few replicas acknowledged a
+// request for its consistency level.
+var errConsistencyLevel = errors.New("cannot reach consistency level")
+
+// errNotReachable and errRequestTimeout are returned for a replica which is
+// not reachable, or did not answer in time.
+var (
+	errNotReachable   = errors.New("not reachable")
+	errRequestTimeout = errors.New("request timeout")
+)
+
+// unboundedFanOut sends the requests which are not writes to every replica
+// at once.
+var unboundedFanOut = util.NewFanOut(0)
+
+// RequestCoordinator is the coordinator for all the incoming external request.
+type RequestCoordinator struct {
+	sr      *SwimRing
+	repairs *util.RepairThrottle
+	writes  *util.IdempotencyCache
+	reads   *util.ReadCache
+	stats   *coordinatorStats
+
+	// replicaWrites bounds the replica writes in flight at once, across all
+	// the writes this node coordinates.
+	replicaWrites *util.FanOut
+	// filters are the key filters of the replicas, which answer the reads
+	// of keys none of them holds.
+	filters *keyFilters
+	// clockCounter is the last counter of this node stamped on a clock.
+	clockCounter int64
+	// hints are the writes to hand off to the replicas which missed them.
+	hints *hints
+}
+
+// GetRequest is the payload of Get. Clients may send more fields, for
+// features this node does not support, which gob ignores.
+type GetRequest struct {
+	Level string
+	Key   string
+
+	// MinClock asks for a version descending from it, such as the clock of
+	// the last write of the client, for it to read its own writes.
+	MinClock *util.VectorClock
+	// MaxStaleness asks for a version last updated at most that long ago.
+	// Zero accepts any version.
+	MaxStaleness time.Duration
+	// AllowStale asks, when too few replicas answer to reach the level, for
+	// the latest version among those which did instead of failing.
+	AllowStale bool
+}
+
+// accepts returns whether a version with the given clock is one the read
+// asks for.
+func (req *GetRequest) accepts(clock *util.VectorClock) bool {
+	if req.MaxStaleness > 0 && (clock == nil || time.Since(clock.LastUpdated()) > req.MaxStaleness) {
+		return false
+	}
+	return descends(clock, req.MinClock)
+}
+
+// GetResponse is the payload of the response of Get. Value holds the bytes
+// of the value as is, binary included, as gob does not alter strings.
+// Clock is the vector clock of the version, nil if it was written without
+// one. Metadata is the one written with the value, if any. Stale is set when
+// the level was not reached, as allowed by GetRequest.AllowStale.
+type GetResponse struct {
+	Key, Value string
+	Clock      *util.VectorClock
+	Stale      bool
+	Metadata   map[string]string
+}
+
+// GetMultiRequest is the payload of GetMulti.
+type GetMultiRequest struct {
+	Level string
+	Keys  []string
+}
+
+// GetMultiResponse is the payload of the response of GetMulti. Keys not
+// found are missing from Values.
+type GetMultiResponse struct {
+	Values map[string]string
+}
+
+// PutRequest is the payload of Put. Value holds the bytes of the value as
+// is, binary included. A positive Sequence fences the write: replicas
+// holding a greater or equal sequence for the key reject it. Metadata is
+// attached to the value and replicated with it. IdempotencyKey is the same
+// across the retries of a write, which get the result of the first one
+// instead of applying it again. Context is the clock the value descends
+// from, if any, so that the write supersedes the siblings it was merged from.
+// A non-empty IndexField indexes the key on that field of the value, as
+// PutIndexed does.
+type PutRequest struct {
+	Level      string
+	Key, Value string
+	Context    *util.VectorClock
+	Sequence   int64
+	Metadata   map[string]string
+	IndexField string
+
+	IdempotencyKey string
+}
+
+// PutResponse is the payload of the response of Put. Reason is set when the
+// write cannot reach its consistency level, with the outcome of each
+// replica. Clock is the vector clock stored by the replicas which
+// acknowledged the write. Stale is set when a sequenced write was rejected,
+// and Sequence is then the greatest sequence held by the replicas.
+type PutResponse struct {
+	Reason   string
+	Replicas []ReplicaStatus
+	Clock    *util.VectorClock
+
+	Stale    bool
+	Sequence int64
+}
+
+const (
+	// ReasonTimeout means too few replicas answered before the deadline.
+	ReasonTimeout = "TIMEOUT"
+	// ReasonUnavailable means too few replicas were reachable to reach the
+	// level.
+	ReasonUnavailable = "UNAVAILABLE"
+
+	// ReplicaAcked means the replica applied the write.
+	ReplicaAcked = "acked"
+	// ReplicaFailed means the replica answered with an error or was
+	// unreachable.
+	ReplicaFailed = "failed"
+	// ReplicaTimedOut means the replica did not answer in time.
+	ReplicaTimedOut = "timeout"
+)
+
+// ReplicaStatus is the outcome of a write on a single replica.
+type ReplicaStatus struct {
+	Address string
+	Status  string
+	Message string
+}
+
+// DeleteRequest is the payload of Delete. IdempotencyKey is as for Put.
+type DeleteRequest struct {
+	Level string
+	Key   string
+
+	IdempotencyKey string
+}
+
+// DeleteResponse is the payload of the response of Delete. Clock is the
+// vector clock of the tombstone, as for Put.
+type DeleteResponse struct {
+	Clock *util.VectorClock
+}
+
+// StateRequest is the payload of Stat.
+type StateRequest struct{}
+
+// StateResponse is the payload of the response of Stat.
+type StateResponse struct {
+	Nodes []NodeStat
+
+	// Unreachable lists the nodes which did not answer the Stat request.
+	Unreachable []string
+	// ReplicaPoints is the replication factor of the cluster.
+	ReplicaPoints int
+}
+
+// NodeStat stores the information of a Node. Address is the address of the
+// node on the ring, and ExternalAddress the one clients dial.
+type NodeStat struct {
+	Address         string
+	ExternalAddress string
+	Status          string
+	KeyCount        int
+	MemoryBytes     int64
+	Tags            map[string]string
+	ReadOnly        bool
+
+	// PendingReconcile is the number of keys for which the node is known to
+	// diverge from its peers, waiting for anti-entropy reconciliation.
+	PendingReconcile int
+	// Minority is set when the node sees at most half of the cluster alive,
+	// and suspects it is on the minority side of a partition.
+	Minority bool
+	// DuplicateAddress is set when another node claimed the address of the
+	// node, whose join or gossip was rejected.
+	DuplicateAddress bool
+}
+
+// HandshakeRequest is the payload of Handshake.
+type HandshakeRequest struct {
+	ProtocolVersion int
+	Features        []string
+}
+
+// HandshakeResponse is the payload of the response of Handshake. Features
+// are the optional payload fields this node supports, named as by clients.
+type HandshakeResponse struct {
+	ProtocolVersion int
+	Features        []string
+}
+
+// features are the optional features of the client protocol supported by
+// the coordinator: binary values, PutRequest.Sequence, metadata,
+// RebalanceStatus, GetMulti, GetHistory, Watch, Expire/TTL, GossipDebug,
+// OwnedKeys, Metrics, SplitBrainCheck, the ANY and LOCAL write levels and
+// the clocks of reads and writes, with GetRequest.MinClock, and
+// GetRequest.MaxStaleness, GetVersioned, GetSiblings with
+// PutRequest.Context, SnapshotGet, GetRequest.AllowStale and
+// PutIndexed/QueryIndex, CompareAndSwap and PutBatch.
+var features = []string{"bytes", "sequence", "metadata", "rebalance", "getmulti", "history", "watch", "expire", "gossipdebug", "ownedkeys", "metrics", "splitbrain", "hints", "localack", "clocks", "staleness", "readmeta", "siblings", "snapshot", "stalereads", "index", "cas", "batch"}
+
+// RebalanceStatusRequest is the payload of RebalanceStatus.
+type RebalanceStatusRequest struct{}
+
+// RebalanceStatusResponse is the payload of the response of RebalanceStatus,
+// the progress of the keys this node hands off after a ring change. ETA is
+// zero if it cannot be estimated yet.
+type RebalanceStatusResponse struct {
+	Address       string
+	Active        bool
+	Started       time.Time
+	KeysMoved     int64
+	KeysRemaining int64
+	KeysPerSec    int64
+	BytesPerSec   int64
+	ETA           time.Duration
+}
+
+// NewRequestCoordinator returns a new RequestCoordinator.
+func NewRequestCoordinator(sr *SwimRing) *RequestCoordinator {
+	rc := &RequestCoordinator{
+		sr: sr,
+		repairs: util.NewRepairThrottle(time.Duration(sr.config.ReadRepairInterval)*time.Millisecond,
+			readRepairKeys),
+		writes: util.NewIdempotencyCache(idempotencyWindow, idempotencyKeys),
+		reads: util.NewReadCache(time.Duration(sr.config.ReadCacheTTL)*time.Millisecond,
+			sr.config.ReadCacheSize),
+		stats:         newCoordinatorStats(),
+		replicaWrites: util.NewFanOut(sr.config.ReplicaWriteConcurrency),
+		clockCounter:  time.Now().UnixNano(),
+		hints:         newHints(),
+	}
+	rc.filters = newKeyFilters(time.Duration(sr.config.KeyFilterRefreshInterval)*time.Millisecond,
+		rc.fetchKeyFilter)
+
+	return rc
+}
+
+// Get handles the incoming Get request. It first looks up for the owner replicas
+// of the given key, forwards request to all replicas and deals with them according to
+// consistency level. Read repair is initiated if necessary. With the read cache,
+// a read of the same key at the same level within its TTL is answered from it.
+// With the key filters of the replicas, a read at ONE of a key none of them
+// may hold is answered not found without them. A read asking for a version descending
+// from MinClock, or updated within MaxStaleness, waits for more replicas than
+// its level needs until one holds such a version, and otherwise returns the
+// latest version of all of them. A read allowing stale values returns the
+// latest version of fewer replicas than its level needs, if any holds one,
+// and the response is marked Stale.
+func (rc *RequestCoordinator) Get(req *GetRequest, resp *GetResponse) (err error) {
+	start := time.Now()
+	defer func() { rc.stats.observe("Get", time.Since(start), err) }()
+
+	if cached, ok := rc.reads.Lookup(req.Key, req.Level); ok && req.accepts(cached.(GetResponse).Clock) {
+		logger.Debugf("Get(%s, %s) answered from the read cache", req.Key, req.Level)
+		*resp = cached.(GetResponse)
+		return nil
+	}
+	generation := rc.reads.Generation()
+
+	requestID := util.NewRequestID()
+	logger.Info("Coordinating external request", util.LogFields{
+		"op":         "Get",
+		"level":      req.Level,
+		"key_hash":   util.KeyHash(req.Key),
+		"request_id": requestID,
+	})
+
+	result, err := rc.read(req, requestID)
+	if err != nil {
+		return err
+	}
+
+	resp.Key = req.Key
+	resp.Value = result.latest.Value
+	resp.Clock = result.latest.Clock
+	resp.Metadata = result.latest.Metadata
+	resp.Stale = result.stale
+	if !result.stale {
+		rc.reads.Store(req.Key, req.Level, *resp, generation)
+	}
+	return nil
+}
+
+// readResult is the outcome of a read coordinated across the replicas of a
+// key. replies is the number of replicas which answered, agreed the number
+// of those holding the latest version, and diverged reports whether any of
+// them does not, for which read repair starts. stale reports whether fewer
+// replicas than the level needs answered, as GetRequest.AllowStale allows.
+type readResult struct {
+	latest          storage.KVEntry
+	replies, agreed int
+	diverged, stale bool
+}
+
+// read reads the given key from its replicas as the request asks, and starts
+// the read repair of the replicas which do not hold its latest version once
+// they all answered.
+func (rc *RequestCoordinator) read(req *GetRequest, requestID string) (readResult, error) {
+	var result readResult
+
+	internalReq := &storage.GetRequest{
+		Key:       req.Key,
+		RequestID: requestID,
+	}
+
+	// A snapshot misses the keys written through other coordinators since
+	// it was taken, so it only answers the reads which accept any replica
+	// missing the latest write.
+	replicas := rc.replicas(req.Key)
+	if req.Level == ONE && req.MinClock == nil && rc.filters.absent(replicas, req.Key) {
+		logger.Debugf("Get(%s) answered from the key filters of its replicas", req.Key)
+		return result, storage.ErrKeyNotFound
+	}
+	resCh := rc.sendRPCRequests(replicas, GetOp, internalReq)
+
+	ackNeed := rc.numOfRequiredACK(req.Level)
+	ackOk := 0
+	var message string
+
+	var resList []*storage.GetResponse
+
+	for reply := range resCh {
+		res, ok := reply.(*storage.GetResponse)
+		if !ok {
+			continue
+		}
+		resList = append(resList, res)
+
+		if res.Ok {
+			ackOk++
+		} else {
+			message = res.Message
+		}
+
+		if (res.Ok || res.NotFound) && res.Value.Timestamp > result.latest.Timestamp {
+			result.latest = res.Value
+		}
+
+		if len(resList) >= ackNeed && (ackOk == 0 || req.accepts(result.latest.Clock)) {
+			break
+		}
+	}
+
+	if len(resList) < ackNeed {
+		if !req.AllowStale || ackOk == 0 {
+			logger.Errorf("Cannot reach consistency requirements for Get(%s, %s)", req.Key, req.Level)
+			return result, errConsistencyLevel
+		}
+
+		logger.Warningf("Returning a stale value for Get(%s, %s) from %d replicas", req.Key, req.Level, len(resList))
+		result.stale = true
+	}
+
+	go rc.readRepair(resList, internalReq, result.latest, ackOk, resCh)
+
+	if ackOk == 0 {
+		logger.Debugf("No ACK with Ok received for Get(%s): %s", req.Key, message)
+		return result, errors.New(message)
+	}
+	if result.latest.Exist == 0 {
+		logger.Debugf("Get(%s) found the key deleted after the values of some replicas", req.Key)
+		return result, storage.ErrKeyNotFound
+	}
+
+	result.replies = len(resList)
+	for _, res := range resList {
+		if res.Ok && res.Value.Timestamp == result.latest.Timestamp {
+			result.agreed++
+		} else {
+			result.diverged = true
+		}
+	}
+	return result, nil
+}
+
+// GetMulti handles the incoming GetMulti request. The keys are grouped by
+// replica, so that each replica receives a single request for all the keys
+// it holds, and each key is answered with its latest value once enough of
+// its replicas responded for the consistency level. Multi-key reads are not
+// read repaired.
+func (rc *RequestCoordinator) GetMulti(req *GetMultiRequest, resp *GetMultiResponse) (err error) {
+	start := time.Now()
+	defer func() { rc.stats.observe("GetMulti", time.Since(start), err) }()
+
+	logger.Debugf("Coordinating external request GetMulti(%d keys, %s)", len(req.Keys), req.Level)
+
+	type result struct {
+		keys []string
+		res  interface{}
+		err  error
+	}
+
+	groups := hashring.GroupByServer(req.Keys, rc.replicas)
+	resCh := make(chan result, len(groups))
+	for server, keys := range groups {
+		go func(server string, keys []string) {
+			res, err := rc.sendRPCRequest(server, GetMultiOp, &storage.GetMultiRequest{Keys: keys})
+			resCh <- result{keys: keys, res: res, err: err}
+		}(server, keys)
+	}
+
+	ackNeed := rc.numOfRequiredACK(req.Level)
+	acks := make(map[string]int)
+	for _, keys := range groups {
+		for _, key := range keys {
+			acks[key] = 0
+		}
+	}
+	remaining := len(acks)
+	latest := make(map[string]storage.KVEntry)
+
+	for i := 0; i < len(groups) && remaining > 0; i++ {
+		r := <-resCh
+		if r.err != nil || !r.res.(*storage.GetMultiResponse).Ok {
+			continue
+		}
+
+		values := r.res.(*storage.GetMultiResponse).Values
+		for _, key := range r.keys {
+			if value, ok := values[key]; ok && value.Timestamp > latest[key].Timestamp {
+				latest[key] = value
+			}
+
+			acks[key]++
+			if acks[key] == ackNeed {
+				remaining--
+			}
+		}
+	}
+
+	if remaining > 0 {
+		logger.Errorf("Cannot reach consistency requirements for GetMulti(%d keys, %s)", len(req.Keys), req.Level)
+		return errConsistencyLevel
+	}
+
+	resp.Values = make(map[string]string, len(latest))
+	for key, entry := range latest {
+		resp.Values[key] = entry.Value
+	}
+	return nil
+}
+
+// Put handles the incoming Put request. It first looks up for the owner replicas
+// of the given key, forwards request to all replicas and deals with them according to
+// consistency level. A retry of a write already applied gets its result back, and
+// replicas apply a write forwarded twice once, as it carries its idempotency key.
+// The key is invalidated in the read cache once the write is done. A read-only
+// node refuses it with ErrReadOnly. A write which cannot reach its consistency
+// level is answered with the reason and the outcome of each replica.
+func (rc *RequestCoordinator) Put(req *PutRequest, resp *PutResponse) (err error) {
+	start := time.Now()
+	defer func() {
+		failure := err
+		if failure == nil && resp.Reason != "" {
+			failure = errConsistencyLevel
+		}
+		rc.stats.observe("Put", time.Since(start), failure)
+	}()
+
+	if err := rc.refuseWrites(); err != nil {
+		return err
+	}
+
+	if result, ok := rc.writes.Lookup(req.IdempotencyKey); ok {
+		logger.Debugf("Put(%s) already applied, returning its result", req.Key)
+		*resp = result.(PutResponse)
+		return nil
+	}
+	defer rc.reads.Invalidate(req.Key)
+
+	requestID := util.NewRequestID()
+	logger.Info("Coordinating external request", util.LogFields{
+		"op":         "Put",
+		"level":      req.Level,
+		"key_hash":   util.KeyHash(req.Key),
+		"request_id": requestID,
+	})
+
+	timestamp, clock, err := rc.stamp(req.Context)
+	if err != nil {
+		return err
+	}
+
+	internalReq := &storage.PutRequest{
+		Key:        req.Key,
+		Value:      req.Value,
+		IndexField: req.IndexField,
+		Sequence:   req.Sequence,
+		Metadata:   req.Metadata,
+		Nonce:      req.IdempotencyKey,
+		RequestID:  requestID,
+		Timestamp:  timestamp,
+		Clock:      clock,
+	}
+
+	replicas := rc.writeReplicas(req.Key)
+	defer rc.filters.invalidate(replicas)
+
+	// accept records the result of the write once it reached its level.
+	accept := func() error {
+		rc.writes.Store(req.IdempotencyKey, *resp)
+		rc.sr.replicator.Replicate(replication.RemoteWrite{
+			Key:      req.Key,
+			Value:    []byte(req.Value),
+			Metadata: req.Metadata,
+			Clock:    mergeClocks(clock, resp.Clock),
+		})
+		return nil
+	}
+
+	if req.Level == LOCAL {
+		resp.Clock, err = rc.writeLocal(replicas, PutOp, internalReq)
+		if err != nil {
+			return err
+		}
+		return accept()
+	}
+
+	resCh := rc.sendReplicaRequests(replicas, PutOp, internalReq)
+
+	ackNeed := rc.numOfRequiredACK(req.Level)
+	ackReceived := 0
+	ackOk := 0
+	staleSequence := int64(0)
+	timedOut := false
+
+	for result := range resCh {
+		status := ReplicaStatus{Address: result.server, Status: ReplicaFailed}
+
+		switch res := result.result.(type) {
+		case *storage.PutResponse:
+			ackReceived++
+			if res.Ok {
+				ackOk++
+				resp.Clock = mergeClocks(resp.Clock, res.Clock)
+				status.Status = ReplicaAcked
+			} else {
+				status.Message = res.Message
+			}
+			if res.Stale && res.Sequence > staleSequence {
+				staleSequence = res.Sequence
+			}
+
+			if ackReceived >= ackNeed {
+				if ackOk == 0 {
+					if staleSequence > 0 {
+						resp.Stale = true
+						resp.Sequence = staleSequence
+						rc.writes.Store(req.IdempotencyKey, *resp)
+						return nil
+					}
+					logger.Debugf("No ACK with Ok received for Put(%s): %s", req.Key, res.Message)
+					return errors.New(res.Message)
+				}
+				resp.Replicas = nil
+				return accept()
+			}
+		case error:
+			status.Message = res.Error()
+			if res == errRequestTimeout {
+				status.Status = ReplicaTimedOut
+				timedOut = true
+			}
+		}
+
+		resp.Replicas = append(resp.Replicas, status)
+	}
+
+	if req.Level == ANY && ackReceived == 0 && len(replicas) > 0 {
+		for _, status := range resp.Replicas {
+			rc.hints.add(status.Address, PutOp, internalReq)
+		}
+		logger.Noticef("No replica answered a Put at level %s, hinted to %d replicas", req.Level, len(replicas))
+		resp.Replicas = nil
+		return accept()
+	}
+
+	// The failure is returned in the response, so that the client gets the
+	// outcome of each replica along with it.
+	resp.Reason = ReasonUnavailable
+	if timedOut {
+		resp.Reason = ReasonTimeout
+	}
+	logger.Errorf("Cannot reach consistency requirements for Put(%s, %s): %s", req.Key, req.Level, resp.Reason)
+	return nil
+}
+
+// Delete handles the incoming Delete request. It first looks up for the owner replicas
+// of the given key, forwards request to all replicas and deals with them according to
+// consistency level. A retry of a delete already applied succeeds without
+// applying it again. The key is invalidated in the read cache once the delete
+// is done. A read-only node refuses it with ErrReadOnly.
+func (rc *RequestCoordinator) Delete(req *DeleteRequest, resp *DeleteResponse) (err error) {
+	start := time.Now()
+	defer func() { rc.stats.observe("Delete", time.Since(start), err) }()
+
+	if err := rc.refuseWrites(); err != nil {
+		return err
+	}
+
+	if _, ok := rc.writes.Lookup(req.IdempotencyKey); ok {
+		logger.Debugf("Delete(%s) already applied, returning its result", req.Key)
+		return nil
+	}
+	defer rc.reads.Invalidate(req.Key)
+
+	requestID := util.NewRequestID()
+	logger.Info("Coordinating external request", util.LogFields{
+		"op":         "Delete",
+		"level":      req.Level,
+		"key_hash":   util.KeyHash(req.Key),
+		"request_id": requestID,
+	})
+
+	timestamp, clock, err := rc.stamp(nil)
+	if err != nil {
+		return err
+	}
+
+	internalReq := &storage.DeleteRequest{
+		Key:       req.Key,
+		RequestID: requestID,
+		Timestamp: timestamp,
+		Clock:     clock,
+	}
+
+	replicas := rc.writeReplicas(req.Key)
+
+	// accept records the result of the delete once it reached its level.
+	accept := func() error {
+		rc.writes.Store(req.IdempotencyKey, *resp)
+		rc.sr.replicator.Replicate(replication.RemoteWrite{
+			Key:     req.Key,
+			Deleted: true,
+			Clock:   mergeClocks(clock, resp.Clock),
+		})
+		return nil
+	}
+
+	if req.Level == LOCAL {
+		resp.Clock, err = rc.writeLocal(replicas, DeleteOp, internalReq)
+		if err != nil {
+			return err
+		}
+		return accept()
+	}
+
+	resCh := rc.sendReplicaRequests(replicas, DeleteOp, internalReq)
+
+	ackNeed := rc.numOfRequiredACK(req.Level)
+	ackReceived := 0
+	ackOk := 0
+	var failed []string
+
+	for result := range resCh {
+		switch res := result.result.(type) {
+		case *storage.DeleteResponse:
+			ackReceived++
+			if res.Ok {
+				ackOk++
+				resp.Clock = mergeClocks(resp.Clock, res.Clock)
+			}
+
+			if ackReceived >= ackNeed {
+				if ackOk == 0 {
+					logger.Debugf("No ACK with Ok received for Delete(%s): %s", req.Key, res.Message)
+					return errors.New(res.Message)
+				}
+				return accept()
+			}
+		case error:
+			failed = append(failed, result.server)
+		}
+	}
+
+	if req.Level == ANY && ackReceived == 0 && len(replicas) > 0 {
+		for _, server := range failed {
+			rc.hints.add(server, DeleteOp, internalReq)
+		}
+		logger.Noticef("No replica answered a Delete at level %s, hinted to %d replicas", req.Level, len(failed))
+		return accept()
+	}
+
+	logger.Errorf("Cannot reach consistency requirements for Delete(%s, %s)", req.Key, req.Level)
+	return errConsistencyLevel
+}
+
+// ReplicateRemote handles the writes streamed by another cluster. Each write
+// is handed to the replicas of its key with its vector clock, and the time it
+// was accepted as its timestamp, so that a replica keeps it only if it
+// descends from the local version, the latest write winning between
+// concurrent ones, and it is not streamed again. The batch fails if a write
+// reached none of its replicas, and the other cluster then sends it again.
+func (rc *RequestCoordinator) ReplicateRemote(req *replication.ReplicateRemoteRequest, resp *replication.ReplicateRemoteResponse) error {
+	logger.Debugf("Applying %d writes replicated from cluster %s", len(req.Writes), req.Source)
+
+	for _, write := range req.Writes {
+		entry := storage.KVEntry{
+			Value:     string(write.Value),
+			Timestamp: write.Accepted,
+			Exist:     1,
+			Metadata:  write.Metadata,
+			Clock:     write.Clock,
+		}
+		if write.Deleted {
+			entry = storage.KVEntry{Timestamp: write.Accepted, Clock: write.Clock}
+		}
+
+		replicas := rc.replicas(write.Key)
+		resCh := rc.sendRPCRequests(replicas, HandoffOp, &storage.HandoffRequest{
+			Key:   write.Key,
+			Value: entry,
+		})
+
+		ackOk := 0
+		for result := range resCh {
+			if res, ok := result.(*storage.HandoffResponse); ok && res.Ok {
+				ackOk++
+			}
+		}
+		rc.reads.Invalidate(write.Key)
+		rc.filters.invalidate(replicas)
+		if ackOk == 0 {
+			logger.Errorf("Cannot apply write of %s replicated from cluster %s", write.Key, req.Source)
+			return errors.New("cannot reach any replica")
+		}
+
+		resp.Applied++
+	}
+
+	return nil
+}
+
+// Handshake handles the incoming Handshake request. It returns the protocol
+// version and features of this node, and the client keeps those it shares.
+func (rc *RequestCoordinator) Handshake(req *HandshakeRequest, resp *HandshakeResponse) error {
+	resp.ProtocolVersion = util.ProtocolVersion
+	resp.Features = features
+	return nil
+}
+
+// PingRequest is the payload of Ping.
+type PingRequest struct{}
+
+// PingResponse is the payload of the response of Ping.
+type PingResponse struct{}
+
+// Ping handles the incoming Ping request, which clients send to check that
+// their connection is alive.
+func (rc *RequestCoordinator) Ping(req *PingRequest, resp *PingResponse) error {
+	return nil
+}
+
+// VersionRequest is the payload of Version.
+type VersionRequest struct{}
+
+// VersionResponse is the payload of the response of Version.
+type VersionResponse struct {
+	Info util.VersionInfo
+}
+
+// Version handles the incoming Version request. It returns the version of
+// the code this node runs.
+func (rc *RequestCoordinator) Version(req *VersionRequest, resp *VersionResponse) error {
+	resp.Info = util.LocalVersion()
+	return nil
+}
+
+// RebalanceStatus handles the incoming RebalanceStatus request.
+func (rc *RequestCoordinator) RebalanceStatus(req *RebalanceStatusRequest, resp *RebalanceStatusResponse) error {
+	status := rc.sr.kvs.MigrationThrottle().RebalanceStatus()
+
+	resp.Address = rc.sr.node.Address()
+	resp.Active = status.Active
+	resp.Started = status.Started
+	resp.KeysMoved = status.KeysMoved
+	resp.KeysRemaining = status.KeysRemaining
+	resp.KeysPerSec = status.KeysPerSec
+	resp.BytesPerSec = status.BytesPerSec
+	resp.ETA = status.ETA
+	return nil
+}
+
+// Stat handles the incoming Stat request. Each node reports whether it is
+// in a minority partition as it sees it, while the duplicate addresses are
+// the conflicting claims this node rejected.
+func (rc *RequestCoordinator) Stat(req *StateRequest, resp *StateResponse) error {
+	logger.Debug("Coordinating external request Stat()")
+
+	internalReq := &storage.StatRequest{}
+
+	members := rc.sr.node.Members()
+	conflicts := make(map[string]bool)
+	for _, conflict := range rc.sr.node.AddressConflicts() {
+		conflicts[conflict.Address] = true
+	}
+
+	resCh := make(chan NodeStat, len(members))
+	unreachableCh := make(chan string, len(members))
+	var wg sync.WaitGroup
+
+	for _, member := range members {
+		wg.Add(1)
+
+		go func(member membership.MemberState) {
+			defer wg.Done()
+
+			stat := NodeStat{
+				Address:          member.Address,
+				ExternalAddress:  rc.sr.externalAddress(member.Address),
+				Status:           member.Status,
+				Tags:             member.Tags,
+				DuplicateAddress: conflicts[member.Address],
+			}
+
+			res, err := rc.sendRPCRequest(member.Address, StatOp, internalReq)
+			if err == nil {
+				s := res.(*storage.StatResponse)
+				stat.KeyCount = s.Count
+				stat.MemoryBytes = s.MemoryBytes
+				stat.ReadOnly = s.ReadOnly
+				stat.PendingReconcile = s.PendingReconcile
+			} else if member.Status != membership.Faulty {
+				unreachableCh <- member.Address
+			}
+
+			if res, err := rc.sendRPCRequest(member.Address, PartitionStatusOp, &membership.PartitionStatusRequest{}); err == nil {
+				stat.Minority = res.(*membership.PartitionStatus).Minority
+			}
+
+			resCh <- stat
+		}(member)
+	}
+
+	wg.Wait()
+	close(resCh)
+	close(unreachableCh)
+
+	for stat := range resCh {
+		resp.Nodes = append(resp.Nodes, stat)
+	}
+	for address := range unreachableCh {
+		resp.Unreachable = append(resp.Unreachable, address)
+	}
+	resp.ReplicaPoints = rc.sr.config.KVSReplicaPoints
+
+	return nil
+}
+
+// sendRPCRequests sends the request to the given replicas and returns the
+// channel of their responses or errors, closed once they all answered. The
+// writes are sent to at most ReplicaWriteConcurrency replicas at once.
+func (rc *RequestCoordinator) sendRPCRequests(replicas []string, op string, req interface{}) <-chan interface{} {
+	resCh := make(chan interface{}, len(replicas))
+
+	go func() {
+		for res := range rc.sendReplicaRequests(replicas, op, req) {
+			resCh <- res.result
+		}
+		close(resCh)
+	}()
+
+	return resCh
+}
+
+// replicaResult is the response or error of a replica.
+type replicaResult struct {
+	server string
+	result interface{}
+}
+
+// sendReplicaRequests is as sendRPCRequests, along with the replica each
+// response or error comes from.
+func (rc *RequestCoordinator) sendReplicaRequests(replicas []string, op string, req interface{}) <-chan replicaResult {
+	resCh := make(chan replicaResult, len(replicas))
+
+	fanOut := unboundedFanOut
+	switch op {
+	case PutOp, DeleteOp, HandoffOp, ExpireOp, CompareAndSwapOp, PutBatchOp:
+		fanOut = rc.replicaWrites
+	}
+
+	go func() {
+		fanOut.Run(len(replicas), func(i int) {
+			res, err := rc.sendRPCRequest(replicas[i], op, req)
+			if err != nil {
+				resCh <- replicaResult{server: replicas[i], result: err}
+				return
+			}
+
+			resCh <- replicaResult{server: replicas[i], result: res}
+		})
+		close(resCh)
+	}()
+
+	return resCh
+}
+
+func (rc *RequestCoordinator) sendRPCRequest(server string, op string, req interface{}) (interface{}, error) {
+	if !rc.sr.node.MemberReachable(server) {
+		return nil, errNotReachable
+	}
+
+	var resp interface{}
+	switch op {
+	case GetOp:
+		resp = &storage.GetResponse{}
+	case PutOp:
+		resp = &storage.PutResponse{}
+	case DeleteOp:
+		resp = &storage.DeleteResponse{}
+	case StatOp:
+		resp = &storage.StatResponse{}
+	case HandoffOp:
+		resp = &storage.HandoffResponse{}
+	case GetMultiOp:
+		resp = &storage.GetMultiResponse{}
+	case KeyFilterOp:
+		resp = &storage.KeyFilterResponse{}
+	case ScanPageOp:
+		resp = &storage.ScanPageResponse{}
+	case GetHistoryOp:
+		resp = &storage.GetHistoryResponse{}
+	case ExpireOp:
+		resp = &storage.ExpireResponse{}
+	case CompareAndSwapOp:
+		resp = &storage.CompareAndSwapResponse{}
+	case PutBatchOp:
+		resp = &storage.PutResponse{}
+	case QueryIndexOp:
+		resp = &storage.QueryIndexResponse{}
+	case TTLOp:
+		resp = &storage.TTLResponse{}
+	case PartitionStatusOp:
+		resp = &membership.PartitionStatus{}
+	}
+
+	client, err := rc.sr.node.MemberClient(server)
+	if err != nil {
+		logger.Errorf("%s request to %s: %s", op, server, err.Error())
+		return nil, err
+	}
+
+	// The reply is only returned if the call completed, so that a call
+	// abandoned on timeout never races with the caller reading it.
+	call := client.Go(op, req, resp, make(chan *rpc.Call, 1))
+
+	select {
+	case <-call.Done:
+		err = call.Error
+	case <-time.After(rpcTimeout):
+		logger.Warningf("%s request to %s: timeout", op, server)
+		return nil, errRequestTimeout
+	}
+
+	if err != nil {
+		logger.Errorf("%s response from %s: %s", op, server, err.Error())
+		return nil, err
+	}
+
+	logger.Debugf("%s response from %s: ok", op, server)
+	return resp, nil
+}
+
+// handoff sends the given entry of a key to the server now holding one of
+// its replicas.
+func (rc *RequestCoordinator) handoff(server, key string, entry storage.KVEntry) error {
+	res, err := rc.sendRPCRequest(server, HandoffOp, &storage.HandoffRequest{
+		Key:   key,
+		Value: entry,
+	})
+	if err != nil {
+		return err
+	}
+
+	if resp := res.(*storage.HandoffResponse); !resp.Ok {
+		return errors.New(resp.Message)
+	}
+	return nil
+}
+
+// replicas returns the servers to send the requests about the given key to,
+// its N owners on the ring. With SkipSuspectReplicas, the suspect owners are
+// replaced by the next healthy servers on the ring, which hand the key back
+// to them once they are alive again.
+func (rc *RequestCoordinator) replicas(key string) []string {
+	n := rc.sr.config.KVSReplicaPoints
+	if !rc.sr.config.SkipSuspectReplicas {
+		return rc.sr.ring.LookupN(key, n)
+	}
+
+	replicas, skipped := hashring.LookupNHealthy(rc.sr.ring, key, n, rc.sr.node.MemberSuspect)
+	if len(skipped) > 0 {
+		logger.Debugf("Skipping suspect replicas of %s: %v", key, skipped)
+	}
+	return replicas
+}
+
+func (rc *RequestCoordinator) numOfRequiredACK(level string) int {
+	switch level {
+	case ONE, ANY:
+		return 1
+	case QUORUM:
+		return int(math.Floor(float64(rc.sr.config.KVSReplicaPoints)/2)) + 1
+	case ALL:
+		return rc.sr.config.KVSReplicaPoints
+	}
+
+	return rc.sr.config.KVSReplicaPoints
+}
+
+// readRepair waits for the remaining replicas to answer a read, and hands
+// the latest entry, a tombstone included, off to the replicas which do not
+// hold it. A replica keeps its own version if its clock is newer, so that a
+// repair racing with a later write or delete does not undo it. A key is repaired at most once per read repair interval, so that
+// the reads of a hot key do not all send the same repairs, and the repairs
+// wait while the node is under load, so that they do not slow down requests.
+// The repair waits for the replicas to acknowledge it, and fails unless, with
+// those already holding the entry, as many replicas as RepairWriteLevel
+// requires hold it.
+func (rc *RequestCoordinator) readRepair(resList []*storage.GetResponse, req *storage.GetRequest, latest storage.KVEntry, okCount int, resCh <-chan interface{}) {
+	ackOk := okCount
+
+	for result := range resCh {
+		switch res := result.(type) {
+		case *storage.GetResponse:
+			resList = append(resList, res)
+
+			if res.Ok {
+				ackOk++
+			}
+
+			if (res.Ok || res.NotFound) && res.Value.Timestamp > latest.Timestamp {
+				latest = res.Value
+			}
+		case error:
+			continue
+		}
+	}
+
+	if ackOk == 0 {
+		return
+	}
+
+	var stale []string
+	for _, res := range resList {
+		holds := res.Ok && res.Value.Value == latest.Value
+		if latest.Exist == 0 {
+			holds = !res.Ok
+		}
+		if !holds {
+			stale = append(stale, res.Node)
+		}
+	}
+	if len(stale) == 0 || !rc.repairs.Allow(req.Key) {
+		return
+	}
+
+	rc.sr.kvs.LoadThrottle().Wait()
+
+	start := time.Now()
+	logger.Debugf("Initiating read repair for %v: %s", stale, req.Key)
+	resCh = rc.sendRPCRequests(stale, HandoffOp, &storage.HandoffRequest{
+		Key:   req.Key,
+		Value: latest,
+	})
+
+	held := len(resList) - len(stale)
+	for result := range resCh {
+		if res, ok := result.(*storage.HandoffResponse); ok && res.Ok {
+			held++
+		}
+	}
+
+	var err error
+	level := rc.sr.config.RepairWriteLevel
+	if need := rc.numOfRequiredACK(level); held < need {
+		logger.Errorf("Read repair of %s reached %d of the %d replicas %s requires", req.Key, held, need, level)
+		err = errConsistencyLevel
+	}
+	rc.stats.observe("ReadRepair", time.Since(start), err)
+}
@@ -0,0 +1,80 @@
+package swimring
+
+import "swimring/hashring"
+
+// RingStateRequest is the payload of RingState.
+type RingStateRequest struct{}
+
+// RingStateResponse is the payload of the response of RingState.
+type RingStateResponse struct {
+	Tokens []RingToken
+	// ReplicaPoints is the replication factor of the cluster.
+	ReplicaPoints int
+	// Partitioning is the partitioning strategy of the cluster, hash or
+	// range.
+	Partitioning string
+	// Zones are the zones of the owners announcing one, by external
+	// address, across which the replicas of a key are spread.
+	Zones map[string]string
+}
+
+// RingToken is a position on the hash ring and the node owning it, by its
+// external address.
+type RingToken struct {
+	Token uint32
+	Owner string
+}
+
+// RingState handles the incoming RingState request. It returns every token
+// on the ring, including virtual nodes, in ascending order, and the zones of
+// their owners, so that clients can place keys without a round trip.
+func (rc *RequestCoordinator) RingState(req *RingStateRequest, resp *RingStateResponse) error {
+	logger.Debug("Coordinating external request RingState()")
+
+	tokens := rc.sr.ring.Tokens()
+	owners := make(map[string]string)
+
+	resp.Tokens = make([]RingToken, 0, len(tokens))
+	resp.Zones = make(map[string]string)
+	for _, token := range tokens {
+		owner, ok := owners[token.Server]
+		if !ok {
+			owner = rc.sr.externalAddress(token.Server)
+			owners[token.Server] = owner
+
+			tags, _ := rc.sr.node.MemberTags(token.Server)
+			if zone := tags[hashring.ZoneTag]; zone != "" {
+				resp.Zones[owner] = zone
+			}
+		}
+		resp.Tokens = append(resp.Tokens, RingToken{Token: uint32(token.Value), Owner: owner})
+	}
+	resp.ReplicaPoints = rc.sr.config.KVSReplicaPoints
+	resp.Partitioning = rc.sr.config.PartitionStrategy
+	if resp.Partitioning == "" {
+		resp.Partitioning = hashring.HashPartitioning
+	}
+
+	return nil
+}
+
+// ReplicasRequest is the payload of Replicas.
+type ReplicasRequest struct {
+	Key string
+}
+
+// ReplicasResponse is the payload of the response of Replicas. Replicas are
+// external addresses ordered clockwise, the owner first.
+type ReplicasResponse struct {
+	Replicas []string
+}
+
+// Replicas handles the incoming Replicas request. It returns the replicas
+// the coordinator sends the requests about the key to, so that clients can
+// send them to its owner directly.
+func (rc *RequestCoordinator) Replicas(req *ReplicasRequest, resp *ReplicasResponse) error {
+	for _, replica := range rc.replicas(req.Key) {
+		resp.Replicas = append(resp.Replicas, rc.sr.externalAddress(replica))
+	}
+	return nil
+}
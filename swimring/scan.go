@@ -0,0 +1,103 @@
+package swimring
+
+import (
+	"errors"
+	"sort"
+	"swimring/storage"
+	"time"
+)
+
+// ScanPageRequest is the payload of ScanPage. Cursor is empty for the first
+// page, and else the Next cursor of the previous one.
+type ScanPageRequest struct {
+	Level  string
+	Prefix string
+	Cursor string
+	Limit  int
+}
+
+// ScanPageResponse is the payload of the response of ScanPage. Next is empty
+// when the scan is complete.
+type ScanPageResponse struct {
+	Items map[string]string
+	Next  string
+}
+
+// ScanPage handles the incoming ScanPage request. Every server which may
+// hold a key with the prefix returns its first keys after the cursor, the
+// tombstones included, and the pages are merged in key order, the latest
+// entry of a key winning, so that a key deleted or missed by a replica is
+// told apart. The merged page holds the smallest keys, which every server
+// returned if it held them, and the cursor of the next page is the last of
+// them. The scan fails unless enough servers answered for every key to be
+// read from as many replicas as the consistency level requires.
+func (rc *RequestCoordinator) ScanPage(req *ScanPageRequest, resp *ScanPageResponse) (err error) {
+	start := time.Now()
+	defer func() { rc.stats.observe("ScanPage", time.Since(start), err) }()
+
+	if req.Limit <= 0 {
+		return errors.New("invalid limit")
+	}
+	cursor, err := storage.ParseScanCursor(req.Cursor)
+	if err != nil {
+		return errors.New("invalid cursor")
+	}
+
+	logger.Debugf("Coordinating external request ScanPage(%d keys, %s)", req.Limit, req.Level)
+
+	n := rc.sr.config.KVSReplicaPoints
+	servers := rc.sr.ring.PrefixServers(req.Prefix, n)
+	resCh := rc.sendRPCRequests(servers, ScanPageOp, &storage.ScanPageRequest{
+		Prefix:     req.Prefix,
+		After:      cursor.Key,
+		Limit:      req.Limit,
+		Tombstones: true,
+	})
+
+	failed := 0
+	more := false
+	latest := make(map[string]storage.KVEntry)
+
+	for result := range resCh {
+		res, ok := result.(*storage.ScanPageResponse)
+		if !ok || !res.Ok {
+			failed++
+			continue
+		}
+
+		more = more || res.More
+		for i, key := range res.Keys {
+			if entry, ok := latest[key]; !ok || res.Values[i].Timestamp > entry.Timestamp {
+				latest[key] = res.Values[i]
+			}
+		}
+	}
+
+	if n > len(servers) {
+		n = len(servers)
+	}
+	if failed > n-rc.numOfRequiredACK(req.Level) {
+		logger.Errorf("Cannot reach consistency requirements for ScanPage(%s)", req.Level)
+		return errConsistencyLevel
+	}
+
+	keys := make([]string, 0, len(latest))
+	for key := range latest {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	if len(keys) > req.Limit {
+		keys, more = keys[:req.Limit], true
+	}
+
+	resp.Items = make(map[string]string, len(keys))
+	for _, key := range keys {
+		if entry := latest[key]; entry.Exist != 0 {
+			resp.Items[key] = entry.Value
+		}
+	}
+	if more && len(keys) > 0 {
+		resp.Next = storage.ScanCursor{Key: keys[len(keys)-1]}.String()
+	}
+	return nil
+}
@@ -0,0 +1,108 @@
+package swimring
+
+import (
+	"swimring/storage"
+	"swimring/util"
+	"time"
+)
+
+// Sibling is one of the concurrent versions of a key, none of which
+// descends from the others.
+type Sibling struct {
+	Value string
+	Clock *util.VectorClock
+}
+
+// GetSiblingsRequest is the payload of GetSiblings.
+type GetSiblingsRequest struct {
+	Level string
+	Key   string
+}
+
+// GetSiblingsResponse is the payload of the response of GetSiblings. It has
+// no sibling when the key does not exist.
+type GetSiblingsResponse struct {
+	Key      string
+	Siblings []Sibling
+}
+
+// GetSiblings handles the incoming GetSiblings request. The versions held by
+// every replica which answered in time, at least as many as the consistency
+// level requires, are returned unless another of them supersedes them, so
+// that the concurrent versions of the key written on diverging replicas are
+// all returned. A write whose PutRequest.Context merges their clocks then
+// supersedes them. The read does not trigger read repair, which would keep
+// the latest of them only.
+func (rc *RequestCoordinator) GetSiblings(req *GetSiblingsRequest, resp *GetSiblingsResponse) (err error) {
+	start := time.Now()
+	defer func() { rc.stats.observe("GetSiblings", time.Since(start), err) }()
+
+	logger.Debugf("Coordinating external request GetSiblings(%s)", req.Level)
+
+	resCh := rc.sendRPCRequests(rc.replicas(req.Key), GetOp, &storage.GetRequest{Key: req.Key})
+
+	replies := 0
+	var versions []storage.KVEntry
+	for result := range resCh {
+		res, ok := result.(*storage.GetResponse)
+		if !ok {
+			continue
+		}
+
+		replies++
+		if res.Ok {
+			versions = append(versions, res.Value)
+		}
+	}
+
+	if replies < rc.numOfRequiredACK(req.Level) {
+		logger.Errorf("Cannot reach consistency requirements for GetSiblings(%s)", req.Level)
+		return errConsistencyLevel
+	}
+
+	resp.Key = req.Key
+	for _, version := range frontier(versions) {
+		resp.Siblings = append(resp.Siblings, Sibling{Value: version.Value, Clock: version.Clock})
+	}
+	return nil
+}
+
+// frontier returns the given versions which no other one supersedes, each
+// once. A version supersedes another if its clock descends from it, or, if
+// either has no clock, if it is more recent.
+func frontier(versions []storage.KVEntry) []storage.KVEntry {
+	var kept []storage.KVEntry
+
+	for i, version := range versions {
+		superseded := false
+		for j, other := range versions {
+			if i == j {
+				continue
+			}
+			if supersedes(other, version) || (j < i && sameVersion(other, version)) {
+				superseded = true
+				break
+			}
+		}
+
+		if !superseded {
+			kept = append(kept, version)
+		}
+	}
+
+	return kept
+}
+
+func supersedes(a, b storage.KVEntry) bool {
+	if a.Clock == nil || b.Clock == nil {
+		return a.Timestamp > b.Timestamp
+	}
+	return a.Clock.Compare(b.Clock) == "NEWER"
+}
+
+func sameVersion(a, b storage.KVEntry) bool {
+	if a.Clock == nil || b.Clock == nil {
+		return a.Timestamp == b.Timestamp
+	}
+	return a.Clock.Compare(b.Clock) == "EQUAL"
+}
@@ -0,0 +1,52 @@
+package swimring
+
+import (
+	"swimring/storage"
+	"swimring/util"
+	"testing"
+)
+
+func clockOf(counters map[string]int) *util.VectorClock {
+	clock := util.NewVectorClock()
+	for node, counter := range counters {
+		clock.Entries[node] = &util.ClockEntry{NodeID: node, Counter: counter}
+	}
+	return clock
+}
+
+func TestFrontier(t *testing.T) {
+	a := storage.KVEntry{Value: "a", Timestamp: 1, Clock: clockOf(map[string]int{"n1": 1})}
+	b := storage.KVEntry{Value: "b", Timestamp: 2, Clock: clockOf(map[string]int{"n2": 1})}
+	merged := storage.KVEntry{Value: "ab", Timestamp: 3, Clock: clockOf(map[string]int{"n1": 1, "n2": 2})}
+	legacy := storage.KVEntry{Value: "legacy", Timestamp: 0}
+
+	tests := []struct {
+		name     string
+		versions []storage.KVEntry
+		want     []string
+	}{
+		{"concurrent", []storage.KVEntry{a, b}, []string{"a", "b"}},
+		{"duplicates", []storage.KVEntry{a, a, b, a}, []string{"a", "b"}},
+		{"superseded", []storage.KVEntry{a, merged, b}, []string{"ab"}},
+		{"without clock", []storage.KVEntry{legacy, a}, []string{"a"}},
+		{"none", nil, nil},
+	}
+
+	for _, test := range tests {
+		var got []string
+		for _, version := range frontier(test.versions) {
+			got = append(got, version.Value)
+		}
+
+		if len(got) != len(test.want) {
+			t.Errorf("%s: frontier %v, want %v", test.name, got, test.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != test.want[i] {
+				t.Errorf("%s: frontier %v, want %v", test.name, got, test.want)
+				break
+			}
+		}
+	}
+}
@@ -0,0 +1,112 @@
+package swimring
+
+import (
+	"errors"
+	"swimring/storage"
+	"swimring/util"
+	"time"
+)
+
+// snapshotRounds is how many times SnapshotGet reads the keys again to
+// reach the versions covered by its frontier.
+const snapshotRounds = 3
+
+// errSnapshotUnstable is returned when the replicas kept returning newer
+// versions covered by the frontier of a snapshot.
+var errSnapshotUnstable = errors.New("snapshot did not converge")
+
+// SnapshotGetRequest is the payload of SnapshotGet.
+type SnapshotGetRequest struct {
+	Level string
+	Keys  []string
+}
+
+// SnapshotGetResponse is the payload of the response of SnapshotGet. Keys
+// not found are missing from Values. Clock is the merge of the clocks of
+// the returned versions.
+type SnapshotGetResponse struct {
+	Values map[string][]byte
+	Clock  *util.VectorClock
+}
+
+// SnapshotGet handles the incoming SnapshotGet request. Each key is read as
+// Get does at the read level, then read again until no replica read returns
+// a newer version of a key whose clock the merged clock of the returned
+// versions already covers. A write made after the versions read bumps the
+// counter of its coordinator past the frontier, so it is never taken in;
+// the versions covered by the frontier are those the returned values
+// causally depend on. This is not a transaction: concurrent writes are
+// taken in for the keys read after them only.
+func (rc *RequestCoordinator) SnapshotGet(req *SnapshotGetRequest, resp *SnapshotGetResponse) (err error) {
+	start := time.Now()
+	defer func() { rc.stats.observe("SnapshotGet", time.Since(start), err) }()
+
+	requestID := util.NewRequestID()
+	logger.Info("Coordinating external request", util.LogFields{
+		"op":         "SnapshotGet",
+		"level":      req.Level,
+		"keys":       len(req.Keys),
+		"request_id": requestID,
+	})
+
+	versions := make(map[string]storage.KVEntry)
+	for _, key := range req.Keys {
+		version, found, err := rc.readVersion(req.Level, key, requestID)
+		if err != nil {
+			return err
+		}
+		if found {
+			versions[key] = version
+		}
+	}
+
+	var clock *util.VectorClock
+	for _, version := range versions {
+		clock = mergeClocks(clock, version.Clock)
+	}
+
+	converged := false
+	for round := 0; round < snapshotRounds && !converged; round++ {
+		converged = true
+		for _, key := range req.Keys {
+			version, found, err := rc.readVersion(req.Level, key, requestID)
+			if err != nil {
+				return err
+			}
+			if !found || version.Clock == nil || version.Timestamp <= versions[key].Timestamp {
+				continue
+			}
+
+			// The frontier already includes the writes the version depends on,
+			// so taking it in keeps the frontier as is.
+			if descends(clock, version.Clock) {
+				versions[key] = version
+				converged = false
+			}
+		}
+	}
+	if !converged {
+		logger.Errorf("SnapshotGet(%d keys) did not converge after %d rounds", len(req.Keys), snapshotRounds)
+		return errSnapshotUnstable
+	}
+
+	resp.Values = make(map[string][]byte, len(versions))
+	for key, version := range versions {
+		resp.Values[key] = []byte(version.Value)
+	}
+	resp.Clock = clock
+	return nil
+}
+
+// readVersion reads the latest version of the key as Get does, and whether
+// it was found.
+func (rc *RequestCoordinator) readVersion(level, key, requestID string) (storage.KVEntry, bool, error) {
+	result, err := rc.read(&GetRequest{Level: level, Key: key}, requestID)
+	if err != nil {
+		if err.Error() == storage.ErrKeyNotFound.Error() {
+			return storage.KVEntry{}, false, nil
+		}
+		return storage.KVEntry{}, false, err
+	}
+	return result.latest, true, nil
+}
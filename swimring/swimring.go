@@ -0,0 +1,387 @@
+package swimring
+
+import (
+	"fmt"
+	"net"
+	"net/rpc"
+	"strconv"
+	"swimring/hashring"
+	"swimring/membership"
+	"swimring/replication"
+	"swimring/storage"
+	"sync"
+	"time"
+
+	"github.com/dgryski/go-farm"
+	"github.com/op/go-logging"
+)
+
+var logger = logging.MustGetLogger("swimring")
+
+// ExternalPortTag is the member tag through which a node announces the port
+// of its external RPC server, which clients dial.
+const ExternalPortTag = "external_port"
+
+// Configuration is the configuration of a SwimRing node, loaded from
+// config.yml. Durations are in milliseconds.
+type Configuration struct {
+	Host             string
+	BindAddress      string `yaml:"BindAddress"`
+	AdvertiseAddress string `yaml:"AdvertiseAddress"`
+	ExternalPort     int    `yaml:"ExternalPort"`
+	InternalPort     int    `yaml:"InternalPort"`
+
+	JoinTimeout        int `yaml:"JoinTimeout"`
+	SuspectTimeout     int `yaml:"SuspectTimeout"`
+	PingTimeout        int `yaml:"PingTimeout"`
+	PingRequestTimeout int `yaml:"PingRequestTimeout"`
+
+	MinProtocolPeriod int  `yaml:"MinProtocolPeriod"`
+	PingRequestSize   int  `yaml:"PingRequestSize"`
+	GossipFanout      int  `yaml:"GossipFanout"`
+	GossipBatchSize   int  `yaml:"GossipBatchSize"`
+	GossipCompression bool `yaml:"GossipCompression"`
+
+	VirtualNodeSize     int    `yaml:"VirtualNodeSize"`
+	KVSReplicaPoints    int    `yaml:"KVSReplicaPoints"`
+	SkipSuspectReplicas bool   `yaml:"SkipSuspectReplicas"`
+	PartitionStrategy   string `yaml:"PartitionStrategy"`
+	MaxVersionsPerKey   int    `yaml:"MaxVersionsPerKey"`
+	MaxClockEntries     int    `yaml:"MaxClockEntries"`
+
+	ReadCacheTTL  int `yaml:"ReadCacheTTL"`
+	ReadCacheSize int `yaml:"ReadCacheSize"`
+
+	MigrationKeysPerSec   int64 `yaml:"MigrationKeysPerSec"`
+	MigrationBytesPerSec  int64 `yaml:"MigrationBytesPerSec"`
+	MaxMigrationTransfers int   `yaml:"MaxMigrationTransfers"`
+
+	AllowLocalAck       bool `yaml:"AllowLocalAck"`
+	ExpirySweepInterval int  `yaml:"ExpirySweepInterval"`
+	CompactionInterval  int  `yaml:"CompactionInterval"`
+	VersionGracePeriod  int  `yaml:"VersionGracePeriod"`
+
+	RepairMaxRequestsPerSec int64  `yaml:"RepairMaxRequestsPerSec"`
+	RepairMaxInFlight       int    `yaml:"RepairMaxInFlight"`
+	RepairWriteLevel        string `yaml:"RepairWriteLevel"`
+	ReadRepairInterval      int    `yaml:"ReadRepairInterval"`
+
+	ReplicaWriteConcurrency    int     `yaml:"ReplicaWriteConcurrency"`
+	KeyFilterFalsePositiveRate float64 `yaml:"KeyFilterFalsePositiveRate"`
+	KeyFilterRefreshInterval   int     `yaml:"KeyFilterRefreshInterval"`
+
+	StorageBackend string `yaml:"StorageBackend"`
+	MaxMemoryBytes int64  `yaml:"MaxMemoryBytes"`
+
+	LogFormat       string `yaml:"LogFormat"`
+	LogLevel        string `yaml:"LogLevel"`
+	MetricsPort     int    `yaml:"MetricsPort"`
+	ShutdownTimeout int    `yaml:"ShutdownTimeout"`
+
+	BootstrapNodes []string          `yaml:"BootstrapNodes"`
+	Tags           map[string]string `yaml:"Tags"`
+	BucketSalts    map[string]string `yaml:"BucketSalts"`
+
+	ClusterName    string              `yaml:"ClusterName"`
+	RemoteClusters map[string][]string `yaml:"RemoteClusters"`
+}
+
+// SwimRing is a local key-value store replica consisting of a SWIM node,
+// a consistent hash ring and a storage engine.
+type SwimRing struct {
+	config *Configuration
+
+	status      status
+	statusMutex sync.RWMutex
+
+	node *membership.Node
+	ring *hashring.HashRing
+	kvs  *storage.KVStore
+	rc   *RequestCoordinator
+
+	// replicator streams the writes this node coordinates to the remote
+	// clusters.
+	replicator *replication.Replicator
+
+	// handoffMutex makes the handoffs of successive ring changes run in
+	// order.
+	handoffMutex sync.Mutex
+	// readOnly holds the members announcing the read-only mode, which get
+	// the keys written meanwhile handed back once writable again. It is
+	// only used by HandleChanges, which the membership calls in order.
+	readOnly map[string]bool
+}
+
+type status uint
+
+const (
+	created status = iota
+	initialized
+	ready
+	destroyed
+)
+
+// NewSwimRing returns a new SwimRing instance.
+func NewSwimRing(config *Configuration) *SwimRing {
+	sr := &SwimRing{
+		config:   config,
+		readOnly: make(map[string]bool),
+	}
+	sr.setStatus(created)
+
+	return sr
+}
+
+func (sr *SwimRing) init() error {
+	address := fmt.Sprintf("%s:%d", sr.config.Host, sr.config.InternalPort)
+
+	ring, err := hashring.NewRing(sr.config.PartitionStrategy, farm.Fingerprint32, sr.config.VirtualNodeSize)
+	if err != nil {
+		return err
+	}
+	ring.SetBucketSalts(sr.config.BucketSalts)
+	sr.ring = ring
+
+	tags := make(map[string]string, len(sr.config.Tags)+1)
+	for key, value := range sr.config.Tags {
+		tags[key] = value
+	}
+	tags[ExternalPortTag] = strconv.Itoa(sr.config.ExternalPort)
+
+	sr.node = membership.NewNode(sr, address, &membership.Options{
+		JoinTimeout:        time.Duration(sr.config.JoinTimeout) * time.Millisecond,
+		SuspectTimeout:     time.Duration(sr.config.SuspectTimeout) * time.Millisecond,
+		PingTimeout:        time.Duration(sr.config.PingTimeout) * time.Millisecond,
+		PingRequestTimeout: time.Duration(sr.config.PingRequestTimeout) * time.Millisecond,
+		MinProtocolPeriod:  time.Duration(sr.config.MinProtocolPeriod) * time.Millisecond,
+		PingRequestSize:    sr.config.PingRequestSize,
+		BootstrapNodes:     sr.config.BootstrapNodes,
+		GossipFanout:       sr.config.GossipFanout,
+		GossipBatchSize:    sr.config.GossipBatchSize,
+		GossipCompression:  sr.config.GossipCompression,
+		Tags:               tags,
+	})
+	ring.SetZoneFunc(hashring.ZoneFromTags(sr.node.MemberTags))
+	if sr.config.SkipSuspectReplicas {
+		sr.node.OnNodeStateChange(func(address, oldStatus, newStatus string) {
+			if oldStatus == membership.Suspect && newStatus == membership.Alive {
+				go sr.handBack(address)
+			}
+		})
+	}
+
+	sr.kvs, err = storage.NewKVStore(address, &storage.Options{
+		Backend:                    sr.config.StorageBackend,
+		MaxVersionsPerKey:          sr.config.MaxVersionsPerKey,
+		MigrationKeysPerSec:        sr.config.MigrationKeysPerSec,
+		MigrationBytesPerSec:       sr.config.MigrationBytesPerSec,
+		MaxMigrationTransfers:      sr.config.MaxMigrationTransfers,
+		ExpirySweepInterval:        time.Duration(sr.config.ExpirySweepInterval) * time.Millisecond,
+		CompactionInterval:         time.Duration(sr.config.CompactionInterval) * time.Millisecond,
+		VersionGracePeriod:         time.Duration(sr.config.VersionGracePeriod) * time.Millisecond,
+		RepairMaxRequestsPerSec:    sr.config.RepairMaxRequestsPerSec,
+		RepairMaxInFlight:          sr.config.RepairMaxInFlight,
+		MaxMemoryBytes:             sr.config.MaxMemoryBytes,
+		KeyFilterFalsePositiveRate: sr.config.KeyFilterFalsePositiveRate,
+		MaxClockEntries:            sr.config.MaxClockEntries,
+	})
+	if err != nil {
+		return err
+	}
+	sr.rc = NewRequestCoordinator(sr)
+	sr.replicator = replication.NewReplicator(sr.config.ClusterName, sr.config.RemoteClusters, nil)
+
+	sr.setStatus(initialized)
+
+	return nil
+}
+
+// Status returns the status of the current SwimRing instance.
+func (sr *SwimRing) Status() status {
+	sr.statusMutex.RLock()
+	r := sr.status
+	sr.statusMutex.RUnlock()
+	return r
+}
+
+func (sr *SwimRing) setStatus(s status) {
+	sr.statusMutex.Lock()
+	sr.status = s
+	sr.statusMutex.Unlock()
+}
+
+// Bootstrap starts communication for this SwimRing instance.
+//
+// It first checks if the instance is initialized, then registers RPC handlers,
+// and calls Bootstap method of Node instance.
+//
+// After all the operations, the SwimRing instance enters ready state.
+func (sr *SwimRing) Bootstrap() ([]string, error) {
+	if sr.Status() < initialized {
+		err := sr.init()
+		if err != nil {
+			logger.Errorf("Cannot initialize SwimRing: %s", err.Error())
+			return nil, err
+		}
+	}
+
+	if err := sr.registerInternalRPCHandlers(); err != nil {
+		logger.Errorf("Cannot start internal RPC server: %s", err.Error())
+		return nil, err
+	}
+	if err := sr.registerExternalRPCHandlers(); err != nil {
+		logger.Errorf("Cannot start external RPC server: %s", err.Error())
+		return nil, err
+	}
+	if sr.config.MetricsPort != 0 {
+		go sr.serveMetrics()
+	}
+
+	joined, err := sr.node.Bootstrap()
+	if err != nil {
+		logger.Errorf("Cannot bootstrap local node: %s", err.Error())
+		return joined, err
+	}
+
+	sr.setStatus(ready)
+	go sr.rc.retryHints()
+
+	return joined, nil
+}
+
+// Leave flushes local KVS to disk, delivers the pending hints and leaves the
+// cluster gracefully, so that the other members stop counting this node and
+// a restart replays no commit log.
+func (sr *SwimRing) Leave() error {
+	if sr.Status() < initialized {
+		return nil
+	}
+
+	flushErr := sr.kvs.Flush()
+	if flushErr != nil {
+		logger.Warningf("Cannot flush local KVS: %s", flushErr.Error())
+	}
+	sr.rc.deliverAllHints()
+
+	err := sr.node.Leave()
+	sr.setStatus(destroyed)
+	sr.replicator.Stop()
+	sr.kvs.Close()
+
+	if err != nil {
+		return err
+	}
+	return flushErr
+}
+
+// HandleChanges reveives the change events emitted from memberlist,
+// then add/remove servers to/from hashring correspondingly, and applies the
+// token counts they announce. The keys whose replicas changed are then
+// handed off in the background, as are the hints of the members back alive.
+func (sr *SwimRing) HandleChanges(changes []membership.Change) {
+	var serversToAdd, serversToRemove []string
+	var old *hashring.HashRing
+	tokensChanged := false
+
+	for _, change := range changes {
+		onRing := sr.ring.HasServer(change.Address)
+		sr.handleReadOnly(change)
+
+		if change.Tags != nil {
+			n := hashring.TokenCountFromTags(change.Tags, sr.config.VirtualNodeSize)
+			if sr.ring.TokenCount(change.Address) != n {
+				if old == nil {
+					old = sr.ring.Clone()
+				}
+				changed, _ := sr.ring.SetTokenCount(change.Address, n)
+				tokensChanged = tokensChanged || changed
+			}
+		}
+
+		if change.Status == membership.Alive && sr.rc.hints.pending(change.Address) {
+			go sr.rc.deliverHints(change.Address)
+		}
+
+		switch change.Status {
+		case membership.Alive, membership.Suspect:
+			if !onRing {
+				serversToAdd = append(serversToAdd, change.Address)
+			}
+		case membership.Faulty:
+			if onRing {
+				serversToRemove = append(serversToRemove, change.Address)
+			}
+		}
+	}
+
+	if len(serversToAdd) == 0 && len(serversToRemove) == 0 && !tokensChanged {
+		return
+	}
+
+	if old == nil {
+		old = sr.ring.Clone()
+	}
+	if sr.ring.AddRemoveServers(serversToAdd, serversToRemove) || tokensChanged {
+		sr.rc.filters.invalidateAll()
+		go sr.handoff(old, serversToRemove)
+	}
+}
+
+func (sr *SwimRing) registerInternalRPCHandlers() error {
+	conn, err := sr.listen(sr.config.InternalPort)
+	if err != nil {
+		return err
+	}
+
+	server := rpc.NewServer()
+	sr.node.RegisterRPCHandlers(server)
+	sr.kvs.RegisterRPCHandlers(server)
+	go server.Accept(conn)
+
+	logger.Noticef("Internal RPC server listening at port %d...", sr.config.InternalPort)
+
+	return nil
+}
+
+func (sr *SwimRing) registerExternalRPCHandlers() error {
+	conn, err := sr.listen(sr.config.ExternalPort)
+	if err != nil {
+		return err
+	}
+
+	server := rpc.NewServer()
+	server.RegisterName("SwimRing", sr.rc)
+	logger.Info("External KVS request RPC handlers registered")
+	go server.Accept(conn)
+
+	logger.Noticef("External RPC server listening at port %d...", sr.config.ExternalPort)
+
+	return nil
+}
+
+// externalAddress returns the address clients dial to reach the given
+// member, whose internal address is the one on the ring: its host with the
+// external port it announces, or else the one of this node.
+func (sr *SwimRing) externalAddress(server string) string {
+	host, _, err := net.SplitHostPort(server)
+	if err != nil {
+		return server
+	}
+
+	port := strconv.Itoa(sr.config.ExternalPort)
+	if tags, ok := sr.node.MemberTags(server); ok && tags[ExternalPortTag] != "" {
+		port = tags[ExternalPortTag]
+	}
+
+	return net.JoinHostPort(host, port)
+}
+
+// listen listens on the given port of the bind address.
+func (sr *SwimRing) listen(port int) (*net.TCPListener, error) {
+	addr, err := net.ResolveTCPAddr("tcp", fmt.Sprintf("%s:%d", sr.config.BindAddress, port))
+	if err != nil {
+		return nil, err
+	}
+
+	return net.ListenTCP("tcp", addr)
+}
@@ -0,0 +1,40 @@
+package swimring
+
+import (
+	"fmt"
+	"strconv"
+	"swimring/hashring"
+)
+
+// SetTokensRequest is the payload of SetTokens.
+type SetTokensRequest struct {
+	Tokens int
+}
+
+// SetTokensResponse is the payload of the response of SetTokens, with the
+// token count of this node before the change.
+type SetTokensResponse struct {
+	Previous int
+}
+
+// SetTokens changes the number of tokens of this node, virtual nodes
+// included, which grows or shrinks its share of the ring. The count is
+// announced through the tokens tag, and every node applies it as the tag is
+// gossiped, handing off the keys whose replicas changed at the throttled
+// migration rate.
+func (rc *RequestCoordinator) SetTokens(req *SetTokensRequest, resp *SetTokensResponse) error {
+	if req.Tokens < 1 {
+		return fmt.Errorf("invalid token count %d", req.Tokens)
+	}
+
+	self := rc.sr.node.Address()
+	resp.Previous = rc.sr.ring.TokenCount(self)
+
+	value := strconv.Itoa(req.Tokens)
+	if req.Tokens == rc.sr.config.VirtualNodeSize {
+		value = ""
+	}
+	rc.sr.node.SetTag(hashring.TokensTag, value)
+
+	return nil
+}
@@ -0,0 +1,54 @@
+package swimring
+
+import (
+	"swimring/util"
+	"time"
+)
+
+// GetVersionedResponse is the payload of the response of GetVersioned. Along
+// with the value and its clock, it tells how consistent the read was:
+// RepliesReceived is the number of replicas which answered in time,
+// RepliesAgreed the number of those holding the returned version, and
+// RepairTriggered whether any of them did not, for which read repair
+// started. Stale is set when the level was not reached, as allowed by
+// GetRequest.AllowStale.
+type GetVersionedResponse struct {
+	Key   string
+	Value []byte
+	Clock *util.VectorClock
+
+	RepliesReceived int
+	RepliesAgreed   int
+	RepairTriggered bool
+	Stale           bool
+}
+
+// GetVersioned handles the incoming GetVersioned request, which reads the
+// key as Get does, without the read cache, and returns the consistency
+// metadata of the read along with the value.
+func (rc *RequestCoordinator) GetVersioned(req *GetRequest, resp *GetVersionedResponse) (err error) {
+	start := time.Now()
+	defer func() { rc.stats.observe("GetVersioned", time.Since(start), err) }()
+
+	requestID := util.NewRequestID()
+	logger.Info("Coordinating external request", util.LogFields{
+		"op":         "GetVersioned",
+		"level":      req.Level,
+		"key_hash":   util.KeyHash(req.Key),
+		"request_id": requestID,
+	})
+
+	result, err := rc.read(req, requestID)
+	if err != nil {
+		return err
+	}
+
+	resp.Key = req.Key
+	resp.Value = []byte(result.latest.Value)
+	resp.Clock = result.latest.Clock
+	resp.RepliesReceived = result.replies
+	resp.RepliesAgreed = result.agreed
+	resp.RepairTriggered = result.diverged
+	resp.Stale = result.stale
+	return nil
+}
@@ -0,0 +1,77 @@
+package swimring
+
+import (
+	"swimring/util"
+	"time"
+)
+
+const (
+	// watchPollInterval is how often a watch reads the versions of its key
+	// from the replicas.
+	watchPollInterval = 100 * time.Millisecond
+	// maxWatchWait bounds how long a watch waits for a change.
+	maxWatchWait = time.Minute
+)
+
+// WatchRequest is the payload of Watch. The coordinator answers once the key
+// has changed after Since, or with no event when Wait elapses.
+type WatchRequest struct {
+	Key   string
+	Since int64
+	Wait  time.Duration
+}
+
+// WatchResponse is the payload of the response of Watch.
+type WatchResponse struct {
+	Events []WatchEvent
+}
+
+// WatchEvent is a change of a watched key. Timestamp is the time of the
+// change in Unix nanoseconds.
+type WatchEvent struct {
+	Key       string
+	Value     []byte
+	Clock     *util.VectorClock
+	Deleted   bool
+	Timestamp int64
+}
+
+// Watch handles the incoming Watch request. It long-polls the versions of
+// the key kept by every replica, and returns those written after Since,
+// oldest first, as soon as there are any. The changes are read from the
+// version history of the replicas, so without history, only the latest
+// change since the previous poll is seen.
+func (rc *RequestCoordinator) Watch(req *WatchRequest, resp *WatchResponse) error {
+	wait := req.Wait
+	if wait > maxWatchWait {
+		wait = maxWatchWait
+	}
+	deadline := time.Now().Add(wait)
+
+	for {
+		replicas := rc.replicas(req.Key)
+		versions, replies, _ := rc.readHistory(req.Key, replicas, len(replicas))
+		if replies == 0 {
+			return errConsistencyLevel
+		}
+
+		for i := len(versions) - 1; i >= 0; i-- {
+			version := versions[i]
+			if version.Timestamp <= req.Since {
+				continue
+			}
+			resp.Events = append(resp.Events, WatchEvent{
+				Key:       req.Key,
+				Value:     []byte(version.Value),
+				Clock:     version.Clock,
+				Deleted:   version.Exist == 0,
+				Timestamp: version.Timestamp,
+			})
+		}
+
+		if len(resp.Events) > 0 || !time.Now().Add(watchPollInterval).Before(deadline) {
+			return nil
+		}
+		time.Sleep(watchPollInterval)
+	}
+}
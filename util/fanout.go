@@ -0,0 +1,63 @@
+package util
+
+import (
+	"sync"
+)
+
+// FanOut bounds the concurrency of the calls sent to replicas, such as the
+// writes of keys to their replicas, so that a large replication factor
+// under a high request volume does not spawn a goroutine per replica and
+// request. The limit is shared by every Run of a FanOut, so that it bounds
+// the calls in flight across all the requests using it, not per request. A
+// limit of zero or less sends to every replica at once.
+type FanOut struct {
+	limit int
+	slots chan struct{}
+}
+
+// NewFanOut returns a FanOut running at most limit calls at once, across all
+// its Runs, or all of them if limit is zero or less.
+func NewFanOut(limit int) *FanOut {
+	f := &FanOut{
+		limit: limit,
+	}
+	if limit > 0 {
+		f.slots = make(chan struct{}, limit)
+	}
+
+	return f
+}
+
+// Limit returns the maximum number of calls run at once, zero meaning
+// unbounded.
+func (f *FanOut) Limit() int {
+	if f.limit < 0 {
+		return 0
+	}
+	return f.limit
+}
+
+// Run calls fn with every index from 0 to n-1, each in its own goroutine,
+// and returns once all the calls have returned. A call only starts once
+// fewer than the limit of calls of every Run are in flight, the calls of
+// concurrent Runs taking the free slots as they are released. To return
+// once a consistency level is reached, before every replica answered, call
+// Run in a goroutine and collect the results of fn. fn must not call Run on
+// the same FanOut, which may wait for a slot it holds.
+func (f *FanOut) Run(n int, fn func(i int)) {
+	var wg sync.WaitGroup
+	wg.Add(n)
+	for i := 0; i < n; i++ {
+		if f.slots != nil {
+			f.slots <- struct{}{}
+		}
+		go func(i int) {
+			defer wg.Done()
+			if f.slots != nil {
+				defer func() { <-f.slots }()
+			}
+			fn(i)
+		}(i)
+	}
+	wg.Wait()
+}
@@ -0,0 +1,77 @@
+package util
+
+import (
+	"fmt"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestFanOutSharesLimitAcrossRuns(t *testing.T) {
+	f := NewFanOut(4)
+
+	var inFlight, peak int32
+	call := func(int) {
+		n := atomic.AddInt32(&inFlight, 1)
+		for {
+			p := atomic.LoadInt32(&peak)
+			if n <= p || atomic.CompareAndSwapInt32(&peak, p, n) {
+				break
+			}
+		}
+		time.Sleep(time.Millisecond)
+		atomic.AddInt32(&inFlight, -1)
+	}
+
+	var wg sync.WaitGroup
+	for r := 0; r < 8; r++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			f.Run(3, call)
+		}()
+	}
+	wg.Wait()
+
+	if peak > 4 {
+		t.Fatalf("%d calls in flight across runs, want at most 4", peak)
+	}
+}
+
+// BenchmarkFanOut writes to 9 replicas taking 1ms each from 8 requests per
+// CPU at once, and reports the time per write, the writes of the requests
+// overlapping, along with the peak of goroutines in use, for several limits.
+func BenchmarkFanOut(b *testing.B) {
+	for _, limit := range []int{0, 64, 16, 4} {
+		b.Run(fmt.Sprintf("limit=%d", limit), func(b *testing.B) {
+			f := NewFanOut(limit)
+
+			var peak int64
+			done := make(chan struct{})
+			go func() {
+				for {
+					select {
+					case <-done:
+						return
+					case <-time.After(100 * time.Microsecond):
+					}
+					if n := int64(runtime.NumGoroutine()); n > atomic.LoadInt64(&peak) {
+						atomic.StoreInt64(&peak, n)
+					}
+				}
+			}()
+
+			b.SetParallelism(8)
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					f.Run(9, func(int) { time.Sleep(time.Millisecond) })
+				}
+			})
+			close(done)
+
+			b.ReportMetric(float64(atomic.LoadInt64(&peak)), "goroutines")
+		})
+	}
+}
@@ -0,0 +1,91 @@
+package util
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// IdempotencyCache remembers the result of recent writes by idempotency key,
+// so that a retried write within the window returns the original result
+// instead of being applied again. At most capacity keys are kept, the least
+// recently seen ones being evicted first.
+type IdempotencyCache struct {
+	sync.Mutex
+	window   time.Duration
+	capacity int
+
+	lru  *list.List
+	keys map[string]*list.Element
+}
+
+type idempotencyEntry struct {
+	key    string
+	result interface{}
+	seen   time.Time
+}
+
+// NewIdempotencyCache returns an IdempotencyCache keeping results for window,
+// for at most capacity keys.
+func NewIdempotencyCache(window time.Duration, capacity int) *IdempotencyCache {
+	if capacity < 1 {
+		capacity = 1
+	}
+
+	return &IdempotencyCache{
+		window:   window,
+		capacity: capacity,
+		lru:      list.New(),
+		keys:     make(map[string]*list.Element),
+	}
+}
+
+// Lookup returns the result stored for the given idempotency key, if it was
+// seen within the window. The empty key is never found.
+func (c *IdempotencyCache) Lookup(key string) (interface{}, bool) {
+	if key == "" {
+		return nil, false
+	}
+
+	c.Lock()
+	defer c.Unlock()
+
+	elem, ok := c.keys[key]
+	if !ok {
+		return nil, false
+	}
+
+	entry := elem.Value.(*idempotencyEntry)
+	if time.Since(entry.seen) > c.window {
+		c.lru.Remove(elem)
+		delete(c.keys, key)
+		return nil, false
+	}
+
+	return entry.result, true
+}
+
+// Store records the result of the write with the given idempotency key. The
+// empty key is ignored.
+func (c *IdempotencyCache) Store(key string, result interface{}) {
+	if key == "" {
+		return
+	}
+
+	c.Lock()
+	defer c.Unlock()
+
+	if elem, ok := c.keys[key]; ok {
+		entry := elem.Value.(*idempotencyEntry)
+		entry.result, entry.seen = result, time.Now()
+		c.lru.MoveToFront(elem)
+		return
+	}
+
+	if c.lru.Len() >= c.capacity {
+		oldest := c.lru.Back()
+		c.lru.Remove(oldest)
+		delete(c.keys, oldest.Value.(*idempotencyEntry).key)
+	}
+	c.keys[key] = c.lru.PushFront(&idempotencyEntry{key: key, result: result, seen: time.Now()})
+}
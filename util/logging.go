@@ -0,0 +1,100 @@
+package util
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/dgryski/go-farm"
+	"github.com/op/go-logging"
+)
+
+// LogFields holds structured fields attached to a log message. It is printed
+// as key=value pairs by text formatters and as JSON attributes by JSONFormatter.
+// A message carrying fields is logged with the functions without format, such
+// as Info, so that JSONFormatter leaves the fields out of the message.
+type LogFields map[string]interface{}
+
+// NewRequestID returns a random identifier for a request, carried by the
+// requests it causes so that their log messages can be correlated.
+func NewRequestID() string {
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return ""
+	}
+	return hex.EncodeToString(id)
+}
+
+// KeyHash returns the hash of the given key to log in place of the key.
+func KeyHash(key string) string {
+	return fmt.Sprintf("%08x", farm.Fingerprint32([]byte(key)))
+}
+
+// String returns the fields as key=value pairs sorted by key.
+func (f LogFields) String() string {
+	keys := make([]string, 0, len(f))
+	for key := range f {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	pairs := make([]string, 0, len(keys))
+	for _, key := range keys {
+		pairs = append(pairs, fmt.Sprintf("%s=%v", key, f[key]))
+	}
+	return strings.Join(pairs, " ")
+}
+
+// JSONFormatter formats each log record as a single line of JSON, including
+// the node address and every LogFields passed as an argument. Durations are
+// written in milliseconds under the field name suffixed with _ms. The message
+// of a record carrying fields is made of its other arguments.
+type JSONFormatter struct {
+	Node string
+}
+
+// Format writes the JSON form of the record to w.
+func (f *JSONFormatter) Format(calldepth int, r *logging.Record, w io.Writer) error {
+	entry := map[string]interface{}{
+		"time":   r.Time.Format(time.RFC3339Nano),
+		"level":  r.Level.String(),
+		"module": r.Module,
+	}
+	if f.Node != "" {
+		entry["node"] = f.Node
+	}
+
+	var args []interface{}
+	for _, arg := range r.Args {
+		fields, ok := arg.(LogFields)
+		if !ok {
+			args = append(args, arg)
+			continue
+		}
+		for key, value := range fields {
+			if d, ok := value.(time.Duration); ok {
+				key, value = key+"_ms", d.Seconds()*1000
+			}
+			entry[key] = value
+		}
+	}
+
+	if len(args) < len(r.Args) {
+		entry["msg"] = strings.TrimSuffix(fmt.Sprintln(args...), "\n")
+	} else {
+		entry["msg"] = r.Message()
+	}
+
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	_, err = w.Write(data)
+	return err
+}
@@ -0,0 +1,34 @@
+package util
+
+import (
+	"errors"
+)
+
+// MaxMetadataBytes caps the total size of the metadata of a value, its keys
+// and values included, so that metadata stays small next to the value.
+const MaxMetadataBytes = 1024
+
+var (
+	// ErrMetadataTooLarge is returned by writes whose metadata exceeds
+	// MaxMetadataBytes.
+	ErrMetadataTooLarge = errors.New("metadata too large")
+)
+
+// MetadataSize returns the total size of the keys and values of the given
+// metadata.
+func MetadataSize(metadata map[string]string) int {
+	n := 0
+	for key, value := range metadata {
+		n += len(key) + len(value)
+	}
+	return n
+}
+
+// CheckMetadata returns ErrMetadataTooLarge if the given metadata exceeds
+// MaxMetadataBytes.
+func CheckMetadata(metadata map[string]string) error {
+	if MetadataSize(metadata) > MaxMetadataBytes {
+		return ErrMetadataTooLarge
+	}
+	return nil
+}
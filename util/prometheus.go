@@ -0,0 +1,189 @@
+package util
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// PrometheusWriter writes metrics in the Prometheus text exposition format.
+// The first write error is kept and the later writes are skipped.
+type PrometheusWriter struct {
+	w   io.Writer
+	err error
+}
+
+// NewPrometheusWriter returns a PrometheusWriter writing to w.
+func NewPrometheusWriter(w io.Writer) *PrometheusWriter {
+	return &PrometheusWriter{w: w}
+}
+
+// Family writes the HELP and TYPE lines of a metric, whose kind is counter,
+// gauge or histogram. It must precede the samples of the metric.
+func (p *PrometheusWriter) Family(name, kind, help string) {
+	p.printf("# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+}
+
+// Sample writes a sample of a metric with the given labels, given as
+// name/value pairs.
+func (p *PrometheusWriter) Sample(name string, value float64, labels ...string) {
+	p.printf("%s%s %s\n", name, formatLabels(labels), formatFloat(value))
+}
+
+// Histogram writes the cumulative buckets, sum and count of the given
+// histogram, in seconds, with the given labels.
+func (p *PrometheusWriter) Histogram(name string, h *LatencyHistogram, labels ...string) {
+	bounds, counts, count, sum := h.snapshot()
+
+	var cumulative uint64
+	for i, bound := range bounds {
+		cumulative += counts[i]
+		le := append(labels[:len(labels):len(labels)], "le", formatFloat(bound.Seconds()))
+		p.Sample(name+"_bucket", float64(cumulative), le...)
+	}
+	le := append(labels[:len(labels):len(labels)], "le", "+Inf")
+	p.Sample(name+"_bucket", float64(count), le...)
+	p.Sample(name+"_sum", sum.Seconds(), labels...)
+	p.Sample(name+"_count", float64(count), labels...)
+}
+
+// Err returns the first error met while writing.
+func (p *PrometheusWriter) Err() error {
+	return p.err
+}
+
+func (p *PrometheusWriter) printf(format string, args ...interface{}) {
+	if p.err != nil {
+		return
+	}
+	_, p.err = fmt.Fprintf(p.w, format, args...)
+}
+
+func formatLabels(labels []string) string {
+	if len(labels) == 0 {
+		return ""
+	}
+
+	pairs := make([]string, 0, len(labels)/2)
+	for i := 0; i+1 < len(labels); i += 2 {
+		pairs = append(pairs, labels[i]+"=\""+escapeLabel(labels[i+1])+"\"")
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeLabel(value string) string {
+	return labelEscaper.Replace(value)
+}
+
+func formatFloat(value float64) string {
+	switch {
+	case math.IsInf(value, 1):
+		return "+Inf"
+	case math.IsInf(value, -1):
+		return "-Inf"
+	case math.IsNaN(value):
+		return "NaN"
+	}
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
+
+// defaultLatencyBuckets are the upper bounds of the buckets of a
+// LatencyHistogram, from 100µs to 10s.
+var defaultLatencyBuckets = []time.Duration{
+	100 * time.Microsecond, 250 * time.Microsecond, 500 * time.Microsecond,
+	time.Millisecond, 2500 * time.Microsecond, 5 * time.Millisecond,
+	10 * time.Millisecond, 25 * time.Millisecond, 50 * time.Millisecond,
+	100 * time.Millisecond, 250 * time.Millisecond, 500 * time.Millisecond,
+	time.Second, 2500 * time.Millisecond, 5 * time.Second, 10 * time.Second,
+}
+
+// LatencyHistogram counts latencies into fixed buckets.
+type LatencyHistogram struct {
+	sync.Mutex
+	counts []uint64
+	count  uint64
+	sum    time.Duration
+}
+
+// NewLatencyHistogram returns an empty LatencyHistogram.
+func NewLatencyHistogram() *LatencyHistogram {
+	return &LatencyHistogram{
+		counts: make([]uint64, len(defaultLatencyBuckets)),
+	}
+}
+
+// Observe records a latency.
+func (h *LatencyHistogram) Observe(d time.Duration) {
+	h.Lock()
+	for i, bound := range defaultLatencyBuckets {
+		if d <= bound {
+			h.counts[i]++
+			break
+		}
+	}
+	h.count++
+	h.sum += d
+	h.Unlock()
+}
+
+// Mean returns the average of the recorded latencies, zero if none.
+func (h *LatencyHistogram) Mean() time.Duration {
+	_, _, count, sum := h.snapshot()
+	if count == 0 {
+		return 0
+	}
+	return sum / time.Duration(count)
+}
+
+// Quantile estimates the q-quantile of the recorded latencies, interpolating
+// linearly within the bucket it falls in. Latencies beyond the last bucket
+// are reported as its upper bound. It returns zero if nothing was recorded.
+func (h *LatencyHistogram) Quantile(q float64) time.Duration {
+	bounds, counts, count, _ := h.snapshot()
+	if count == 0 {
+		return 0
+	}
+
+	rank := q * float64(count)
+	var cumulative float64
+	var lower time.Duration
+	for i, bound := range bounds {
+		n := float64(counts[i])
+		if n > 0 && cumulative+n >= rank {
+			return lower + time.Duration(float64(bound-lower)*(rank-cumulative)/n)
+		}
+		cumulative += n
+		lower = bound
+	}
+
+	return bounds[len(bounds)-1]
+}
+
+func (h *LatencyHistogram) snapshot() ([]time.Duration, []uint64, uint64, time.Duration) {
+	h.Lock()
+	counts := make([]uint64, len(h.counts))
+	copy(counts, h.counts)
+	count, sum := h.count, h.sum
+	h.Unlock()
+
+	return defaultLatencyBuckets, counts, count, sum
+}
+
+// ServeMetrics serves at /metrics on the given address the metrics written
+// by collect. Like http.ListenAndServe, it only returns on error.
+func ServeMetrics(address string, collect func(p *PrometheusWriter)) error {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		collect(NewPrometheusWriter(w))
+	})
+
+	return http.ListenAndServe(address, mux)
+}
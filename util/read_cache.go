@@ -0,0 +1,184 @@
+package util
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// ReadCache keeps the responses of recent reads by key and consistency
+// level for a short TTL, so that repeated reads of a hot key skip the fan-out
+// to its replicas. At most capacity responses are kept, the least recently
+// used ones being evicted first. A zero TTL or capacity disables the cache.
+//
+// A write invalidates the cached responses of its key. To keep a read that
+// raced with a write from caching the value it replaced, a response is only
+// stored if its key was not invalidated since the Generation taken before
+// the read.
+type ReadCache struct {
+	sync.Mutex
+	ttl      time.Duration
+	capacity int
+
+	lru  *list.List
+	keys map[string]map[string]*list.Element
+
+	// generation counts invalidations, and invalidated records the
+	// generation of the last invalidation of each key. It is reset when it
+	// grows beyond capacity, and floor then rejects the stores of reads
+	// started before.
+	generation  uint64
+	floor       uint64
+	invalidated map[string]uint64
+
+	hits, misses int64
+}
+
+type readCacheEntry struct {
+	key, level string
+	value      interface{}
+	stored     time.Time
+}
+
+// ReadCacheStats are the counters of a ReadCache.
+type ReadCacheStats struct {
+	Entries      int
+	Hits, Misses int64
+}
+
+// NewReadCache returns a ReadCache keeping responses for ttl, for at most
+// capacity reads.
+func NewReadCache(ttl time.Duration, capacity int) *ReadCache {
+	return &ReadCache{
+		ttl:         ttl,
+		capacity:    capacity,
+		lru:         list.New(),
+		keys:        make(map[string]map[string]*list.Element),
+		invalidated: make(map[string]uint64),
+	}
+}
+
+// Enabled returns whether the cache stores anything.
+func (c *ReadCache) Enabled() bool {
+	return c.ttl > 0 && c.capacity > 0
+}
+
+// Lookup returns the response cached for a read of the given key at the given
+// level, if it was stored within the TTL.
+func (c *ReadCache) Lookup(key, level string) (interface{}, bool) {
+	if !c.Enabled() {
+		return nil, false
+	}
+
+	c.Lock()
+	defer c.Unlock()
+
+	elem, ok := c.keys[key][level]
+	if !ok {
+		c.misses++
+		return nil, false
+	}
+
+	entry := elem.Value.(*readCacheEntry)
+	if time.Since(entry.stored) > c.ttl {
+		c.removeNoLock(elem)
+		c.misses++
+		return nil, false
+	}
+
+	c.lru.MoveToFront(elem)
+	c.hits++
+	return entry.value, true
+}
+
+// Generation returns the current invalidation generation, to be taken before
+// a read and passed to Store along with its response.
+func (c *ReadCache) Generation() uint64 {
+	c.Lock()
+	generation := c.generation
+	c.Unlock()
+
+	return generation
+}
+
+// Store caches the response of a read of the given key at the given level,
+// unless the key was invalidated since the given generation.
+func (c *ReadCache) Store(key, level string, value interface{}, generation uint64) {
+	if !c.Enabled() {
+		return
+	}
+
+	c.Lock()
+	defer c.Unlock()
+
+	if generation < c.floor || c.invalidated[key] > generation {
+		return
+	}
+
+	if elem, ok := c.keys[key][level]; ok {
+		entry := elem.Value.(*readCacheEntry)
+		entry.value = value
+		entry.stored = time.Now()
+		c.lru.MoveToFront(elem)
+		return
+	}
+
+	if c.lru.Len() >= c.capacity {
+		c.removeNoLock(c.lru.Back())
+	}
+
+	levels, ok := c.keys[key]
+	if !ok {
+		levels = make(map[string]*list.Element)
+		c.keys[key] = levels
+	}
+	levels[level] = c.lru.PushFront(&readCacheEntry{
+		key:    key,
+		level:  level,
+		value:  value,
+		stored: time.Now(),
+	})
+}
+
+// Invalidate drops the cached responses of the given key, at every level.
+func (c *ReadCache) Invalidate(key string) {
+	if !c.Enabled() {
+		return
+	}
+
+	c.Lock()
+	defer c.Unlock()
+
+	for _, elem := range c.keys[key] {
+		c.removeNoLock(elem)
+	}
+
+	c.generation++
+	if len(c.invalidated) >= c.capacity {
+		c.invalidated = make(map[string]uint64)
+		c.floor = c.generation
+	}
+	c.invalidated[key] = c.generation
+}
+
+// Stats returns the number of cached responses, hits and misses.
+func (c *ReadCache) Stats() ReadCacheStats {
+	c.Lock()
+	defer c.Unlock()
+
+	return ReadCacheStats{
+		Entries: c.lru.Len(),
+		Hits:    c.hits,
+		Misses:  c.misses,
+	}
+}
+
+func (c *ReadCache) removeNoLock(elem *list.Element) {
+	entry := c.lru.Remove(elem).(*readCacheEntry)
+
+	levels := c.keys[entry.key]
+	delete(levels, entry.level)
+	if len(levels) == 0 {
+		delete(c.keys, entry.key)
+	}
+}
@@ -0,0 +1,39 @@
+package util
+
+import (
+	"testing"
+	"time"
+)
+
+func TestReadCacheInvalidation(t *testing.T) {
+	cache := NewReadCache(time.Hour, 10)
+
+	cache.Store("a", "ONE", "1", cache.Generation())
+	if value, ok := cache.Lookup("a", "ONE"); !ok || value != "1" {
+		t.Fatalf("Lookup = %v, %t, want 1", value, ok)
+	}
+	if _, ok := cache.Lookup("a", "QUORUM"); ok {
+		t.Fatal("response cached at another level")
+	}
+
+	// A read started before a write must not cache the value it replaced.
+	generation := cache.Generation()
+	cache.Invalidate("a")
+	cache.Store("a", "ONE", "stale", generation)
+	if _, ok := cache.Lookup("a", "ONE"); ok {
+		t.Fatal("response of a read older than the write cached")
+	}
+
+	cache.Store("a", "ONE", "2", cache.Generation())
+	if value, ok := cache.Lookup("a", "ONE"); !ok || value != "2" {
+		t.Fatalf("Lookup = %v, %t, want 2", value, ok)
+	}
+}
+
+func TestReadCacheDisabled(t *testing.T) {
+	cache := NewReadCache(0, 10)
+	cache.Store("a", "ONE", "1", cache.Generation())
+	if _, ok := cache.Lookup("a", "ONE"); ok {
+		t.Fatal("response cached with a zero TTL")
+	}
+}
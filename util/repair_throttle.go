@@ -0,0 +1,79 @@
+package util
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// RepairThrottle coalesces the read repairs of a key, allowing at most one
+// per interval. The last repair time is kept for a bounded number of keys in
+// an LRU, so hot keys stay throttled while cold ones are evicted.
+type RepairThrottle struct {
+	sync.Mutex
+	interval time.Duration
+	capacity int
+
+	lru  *list.List
+	keys map[string]*list.Element
+}
+
+type repairEntry struct {
+	key  string
+	last time.Time
+}
+
+// NewRepairThrottle returns a RepairThrottle allowing one repair per key per
+// interval, remembering at most capacity keys.
+func NewRepairThrottle(interval time.Duration, capacity int) *RepairThrottle {
+	if capacity < 1 {
+		capacity = 1
+	}
+
+	return &RepairThrottle{
+		interval: interval,
+		capacity: capacity,
+		lru:      list.New(),
+		keys:     make(map[string]*list.Element),
+	}
+}
+
+// SetReadRepairInterval sets the minimum interval between two repairs of the
+// same key. Zero disables the throttle.
+func (t *RepairThrottle) SetReadRepairInterval(d time.Duration) {
+	t.Lock()
+	t.interval = d
+	t.Unlock()
+}
+
+// Allow returns whether a repair of the given key may be issued now, and if
+// so records it.
+func (t *RepairThrottle) Allow(key string) bool {
+	t.Lock()
+	defer t.Unlock()
+
+	if t.interval <= 0 {
+		return true
+	}
+
+	now := time.Now()
+	if elem, ok := t.keys[key]; ok {
+		entry := elem.Value.(*repairEntry)
+		if now.Sub(entry.last) < t.interval {
+			return false
+		}
+
+		entry.last = now
+		t.lru.MoveToFront(elem)
+		return true
+	}
+
+	if t.lru.Len() >= t.capacity {
+		oldest := t.lru.Back()
+		t.lru.Remove(oldest)
+		delete(t.keys, oldest.Value.(*repairEntry).key)
+	}
+	t.keys[key] = t.lru.PushFront(&repairEntry{key: key, last: now})
+
+	return true
+}
@@ -0,0 +1,36 @@
+package util
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRepairThrottleCoalescesRepairs(t *testing.T) {
+	throttle := NewRepairThrottle(time.Hour, 2)
+
+	allowed := 0
+	for i := 0; i < 1000; i++ {
+		if throttle.Allow("hot") {
+			allowed++
+		}
+	}
+	if allowed != 1 {
+		t.Fatalf("%d repairs of a hot key allowed within the interval, want 1", allowed)
+	}
+
+	if !throttle.Allow("a") || !throttle.Allow("b") {
+		t.Fatal("repair of a new key not allowed")
+	}
+	// Remembering a and b evicted hot, the least recently repaired key.
+	if !throttle.Allow("hot") {
+		t.Fatal("repair of an evicted key not allowed")
+	}
+	if throttle.Allow("b") {
+		t.Fatal("repair of a remembered key allowed within the interval")
+	}
+
+	throttle.SetReadRepairInterval(0)
+	if !throttle.Allow("b") {
+		t.Fatal("repair not allowed with the throttle disabled")
+	}
+}
@@ -1,14 +1,19 @@
 package util
 
 import (
+	"errors"
 	"fmt"
 	"net"
-	"strings"
+	"sort"
 	"time"
 )
 
 const loopbackIP = "127.0.0.1"
 
+// ErrEmptyNodeID is returned when a vector clock entry is bumped for an
+// empty node ID.
+var ErrEmptyNodeID = errors.New("empty node ID")
+
 // SelectIntOpt takes an option and a default value and returns the default value if
 // the option is equal to zero, and the option otherwise.
 func SelectIntOpt(opt, def int) int {
@@ -45,31 +50,59 @@ func GetLocalIP() string {
 	return loopbackIP
 }
 
-// SafeSplit splits the give string by space and handles quotation marks
-func SafeSplit(s string) []string {
-	split := strings.Split(s, " ")
+// IsLoopback returns whether the given host, an IP address or localhost,
+// designates the local machine only.
+func IsLoopback(host string) bool {
+	if host == "localhost" {
+		return true
+	}
+
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
 
+// SafeSplit splits the given string into shell-like tokens. Tokens are
+// separated by runs of spaces or tabs. Single or double quotes group text,
+// spaces included, into a token and may appear in the middle of one; a quote
+// left open runs to the end of the string. A backslash escapes the next
+// character, except inside single quotes and, inside double quotes, before
+// anything but a double quote or a backslash. A trailing backslash is kept.
+func SafeSplit(s string) []string {
 	var result []string
-	var inquote string
-	var block string
-	for _, i := range split {
-		if inquote == "" {
-			if strings.HasPrefix(i, "'") || strings.HasPrefix(i, "\"") {
-				inquote = string(i[0])
-				block = strings.TrimPrefix(i, inquote) + " "
-			} else {
-				result = append(result, i)
+	var token []byte
+	var inquote byte
+	intoken := false
+
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+
+		switch {
+		case inquote == 0 && (c == ' ' || c == '\t'):
+			if intoken {
+				result = append(result, string(token))
+				token = token[:0]
+				intoken = false
 			}
-		} else {
-			if !strings.HasSuffix(i, inquote) {
-				block += i + " "
-			} else {
-				block += strings.TrimSuffix(i, inquote)
-				inquote = ""
-				result = append(result, block)
-				block = ""
+			continue
+		case c == '\\' && inquote != '\'' && i+1 < len(s):
+			next := s[i+1]
+			if inquote == 0 || next == '"' || next == '\\' {
+				c = next
+				i++
 			}
+			token = append(token, c)
+		case inquote == 0 && (c == '\'' || c == '"'):
+			inquote = c
+		case c == inquote:
+			inquote = 0
+		default:
+			token = append(token, c)
 		}
+		intoken = true
+	}
+
+	if intoken {
+		result = append(result, string(token))
 	}
 
 	return result
@@ -95,17 +128,49 @@ func NewVectorClock() *VectorClock {
 }
 
 // Update increments the counter for the given node or creates a new entry.
+// An empty nodeID leaves the clock unchanged.
 func (vc *VectorClock) Update(nodeID string) {
+	vc.Increment(nodeID)
+}
+
+// Increment bumps the counter for the given node, creating the entry if needed,
+// and returns the counter before and after the increment. An empty nodeID is
+// rejected with ErrEmptyNodeID without touching the clock.
+func (vc *VectorClock) Increment(nodeID string) (oldCounter, newCounter int, err error) {
+	if nodeID == "" {
+		return 0, 0, ErrEmptyNodeID
+	}
+
+	entry, exists := vc.Entries[nodeID]
+	if !exists {
+		entry = &ClockEntry{NodeID: nodeID}
+		vc.Entries[nodeID] = entry
+	}
+
+	oldCounter = entry.Counter
+	entry.Counter++
+	entry.Updated = time.Now()
+
+	return oldCounter, entry.Counter, nil
+}
+
+// CounterFor returns the counter of the given node, or 0 if it has no entry.
+func (vc *VectorClock) CounterFor(nodeID string) int {
 	if entry, exists := vc.Entries[nodeID]; exists {
-		entry.Counter++
-		entry.Updated = time.Now()
-	} else {
-		vc.Entries[nodeID] = &ClockEntry{
-			NodeID:  nodeID,
-			Counter: 1,
-			Updated: time.Now(),
+		return entry.Counter
+	}
+	return 0
+}
+
+// LastUpdated returns the most recent update time among all entries.
+func (vc *VectorClock) LastUpdated() time.Time {
+	var latest time.Time
+	for _, entry := range vc.Entries {
+		if entry.Updated.After(latest) {
+			latest = entry.Updated
 		}
 	}
+	return latest
 }
 
 // Compare checks the relationship between two vector clocks.
@@ -140,6 +205,54 @@ func (vc *VectorClock) Compare(other *VectorClock) string {
 	return "EQUAL"
 }
 
+// Merge sets each counter to the maximum of its value in both clocks, so that
+// the clock descends from both.
+func (vc *VectorClock) Merge(other *VectorClock) {
+	for nodeID, otherEntry := range other.Entries {
+		entry, exists := vc.Entries[nodeID]
+		if !exists {
+			entry = &ClockEntry{NodeID: nodeID}
+			vc.Entries[nodeID] = entry
+		}
+
+		if otherEntry.Counter > entry.Counter {
+			entry.Counter = otherEntry.Counter
+		}
+		if otherEntry.Updated.After(entry.Updated) {
+			entry.Updated = otherEntry.Updated
+		}
+	}
+}
+
+// Prune drops the least recently updated entries until at most max remain,
+// and returns the IDs of the dropped nodes, oldest first. A max of 0 or less
+// disables pruning. Pruning loses causality information: a pruned clock may
+// later compare as CONCURRENT with one it actually descends from.
+func (vc *VectorClock) Prune(max int) []string {
+	if max <= 0 || len(vc.Entries) <= max {
+		return nil
+	}
+
+	entries := make([]*ClockEntry, 0, len(vc.Entries))
+	for _, entry := range vc.Entries {
+		entries = append(entries, entry)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if !entries[i].Updated.Equal(entries[j].Updated) {
+			return entries[i].Updated.Before(entries[j].Updated)
+		}
+		return entries[i].NodeID < entries[j].NodeID
+	})
+
+	pruned := make([]string, 0, len(entries)-max)
+	for _, entry := range entries[:len(entries)-max] {
+		delete(vc.Entries, entry.NodeID)
+		pruned = append(pruned, entry.NodeID)
+	}
+
+	return pruned
+}
+
 // String converts the vector clock to a human-readable string.
 func (vc *VectorClock) String() string {
 	result := ""
@@ -0,0 +1,136 @@
+package util
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// quoteTokens joins the given tokens into a command line which SafeSplit
+// splits back into them, double quoting each token.
+func quoteTokens(tokens []string) string {
+	quoted := make([]string, len(tokens))
+	for i, token := range tokens {
+		token = strings.ReplaceAll(token, `\`, `\\`)
+		token = strings.ReplaceAll(token, `"`, `\"`)
+		quoted[i] = `"` + token + `"`
+	}
+	return strings.Join(quoted, " ")
+}
+
+func TestSafeSplit(t *testing.T) {
+	tests := []struct {
+		in   string
+		want []string
+	}{
+		{``, nil},
+		{` 	 `, nil},
+		{`get a`, []string{"get", "a"}},
+		{`  get	 a  `, []string{"get", "a"}},
+		{`put k "hello world"`, []string{"put", "k", "hello world"}},
+		{`put k 'hello world'`, []string{"put", "k", "hello world"}},
+		{`a'b c'd`, []string{"ab cd"}},
+		{`""`, []string{""}},
+		{`get "" a`, []string{"get", "", "a"}},
+
+		// Lone quotes run to the end of the string.
+		{`"`, []string{""}},
+		{`'`, []string{""}},
+		{`put k "abc def`, []string{"put", "k", "abc def"}},
+		{`put k 'abc def`, []string{"put", "k", "abc def"}},
+
+		// Mixed quotes.
+		{`"it's"`, []string{"it's"}},
+		{`'say "hi"'`, []string{`say "hi"`}},
+		{`"a'b" 'c"d'`, []string{`a'b`, `c"d`}},
+		{`"a"'b'c`, []string{"abc"}},
+
+		// Backslashes.
+		{`a\ b`, []string{"a b"}},
+		{`\"a`, []string{`"a`}},
+		{`"a\"b"`, []string{`a"b`}},
+		{`"a\\b"`, []string{`a\b`}},
+		{`"a\nb"`, []string{`a\nb`}},
+		{`'a\b'`, []string{`a\b`}},
+		{`'a\'`, []string{`a\`}},
+
+		// A trailing backslash is kept.
+		{`\`, []string{`\`}},
+		{`abc\`, []string{`abc\`}},
+		{`get abc\`, []string{"get", `abc\`}},
+		{`"abc\`, []string{`abc\`}},
+		{`'abc\`, []string{`abc\`}},
+	}
+
+	for _, test := range tests {
+		if got := SafeSplit(test.in); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("SafeSplit(%q) = %q, want %q", test.in, got, test.want)
+		}
+	}
+}
+
+func TestSafeSplitRoundTrip(t *testing.T) {
+	tests := [][]string{
+		{"get", "a"},
+		{"put", "k", "hello world"},
+		{"put", "k", `say "hi"`, "it's"},
+		{"put", "k", `C:\path\`, `\"`},
+		{"get", "", "\t"},
+	}
+
+	for _, tokens := range tests {
+		line := quoteTokens(tokens)
+		if got := SafeSplit(line); !reflect.DeepEqual(got, tokens) {
+			t.Errorf("SafeSplit(%q) = %q, want %q", line, got, tokens)
+		}
+	}
+}
+
+func FuzzSafeSplit(f *testing.F) {
+	for _, seed := range []string{
+		`get a`,
+		`put k "hello world"`,
+		`"it's" 'say "hi"'`,
+		`"abc`,
+		`'`,
+		`abc\`,
+		`"a\"b\\c\n"`,
+	} {
+		f.Add(seed)
+	}
+
+	f.Fuzz(func(t *testing.T, line string) {
+		tokens := SafeSplit(line)
+
+		// Whatever the input, the tokens it split into must survive
+		// quoting and splitting again.
+		if len(tokens) == 0 {
+			return
+		}
+		quoted := quoteTokens(tokens)
+		if got := SafeSplit(quoted); !reflect.DeepEqual(got, tokens) {
+			t.Fatalf("SafeSplit(%q) = %q, want %q", quoted, got, tokens)
+		}
+	})
+}
+
+func TestVectorClockIncrement(t *testing.T) {
+	vc := NewVectorClock()
+
+	if _, _, err := vc.Increment(""); err != ErrEmptyNodeID {
+		t.Errorf("Increment of an empty node ID returned %v, want %v", err, ErrEmptyNodeID)
+	}
+	if len(vc.Entries) != 0 {
+		t.Errorf("Increment of an empty node ID changed the clock: %v", vc)
+	}
+
+	for want := 1; want <= 2; want++ {
+		old, counter, err := vc.Increment("a")
+		if err != nil || old != want-1 || counter != want {
+			t.Errorf("Increment returned (%d, %d, %v), want (%d, %d, nil)", old, counter, err, want-1, want)
+		}
+	}
+	if vc.CounterFor("a") != 2 || vc.CounterFor("b") != 0 {
+		t.Errorf("counters %v, want a:2", vc)
+	}
+}
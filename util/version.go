@@ -0,0 +1,36 @@
+package util
+
+import (
+	"fmt"
+)
+
+// ProtocolVersion is the version of the RPC payloads exchanged between
+// clients and nodes. It is raised whenever a payload changes incompatibly.
+const ProtocolVersion = 1
+
+// Version and GitCommit describe the build, and are meant to be set at link
+// time, e.g. -ldflags "-X swimring/util.Version=1.2.0 -X swimring/util.GitCommit=abc123".
+var (
+	Version   = "dev"
+	GitCommit = "unknown"
+)
+
+// VersionInfo describes the code a node or client runs.
+type VersionInfo struct {
+	Version         string
+	GitCommit       string
+	ProtocolVersion int
+}
+
+// LocalVersion returns the VersionInfo of the running binary.
+func LocalVersion() VersionInfo {
+	return VersionInfo{
+		Version:         Version,
+		GitCommit:       GitCommit,
+		ProtocolVersion: ProtocolVersion,
+	}
+}
+
+func (v VersionInfo) String() string {
+	return fmt.Sprintf("%s (commit %s, protocol %d)", v.Version, v.GitCommit, v.ProtocolVersion)
+}